@@ -2,11 +2,20 @@ package config
 
 import (
 	"bufio"
+	"crypto"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Lifetimes of the tokens issued at login when none are configured
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
 )
 
 type Config struct {
@@ -20,6 +29,46 @@ type Config struct {
 	EnableHTTPS bool
 	CertFile    string
 	KeyFile     string
+
+	// JWTAlgorithm is HS256, signing tokens with JWTSecret, or RS256 or
+	// EdDSA, signing them with JWTSigningKey read from JWT_PRIVATE_KEY_FILE.
+	// Tokens signed with JWTVerificationKeys, read from
+	// JWT_VERIFICATION_KEY_FILES, are accepted too, so that retired keys
+	// keep working until their tokens expire.
+	JWTAlgorithm        string
+	JWTSigningKey       crypto.Signer
+	JWTVerificationKeys []crypto.PublicKey
+	// JWTAcceptHS256 keeps accepting HS256 tokens signed with JWTSecret
+	// under RS256 or EdDSA, for the migration from HS256 only
+	// (JWT_ACCEPT_HS256)
+	JWTAcceptHS256 bool
+
+	// AccessTokenTTL is how long the access tokens sent with every request
+	// are valid; RefreshTokenTTL how long a session may go without being
+	// refreshed
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// StorageBackend selects the document store implementation (memory, file, sqlite)
+	StorageBackend string
+	// DataDir holds the files of durable storage backends
+	DataDir string
+	// SQLitePath is the database file of the sqlite backend (defaults to DataDir/docstore.db)
+	SQLitePath string
+	// WALSyncPolicy controls when the write-ahead log is fsynced (always, interval, never)
+	WALSyncPolicy   string
+	WALSyncInterval time.Duration
+	// WALCompactThreshold is the number of log records that triggers a snapshot
+	WALCompactThreshold int
+
+	// UploadDir holds resumable upload sessions (defaults to DataDir/uploads)
+	UploadDir string
+	// UploadSessionTTL is how long an upload session survives without activity
+	UploadSessionTTL time.Duration
+	// UploadGCInterval is how often expired upload sessions are removed
+	UploadGCInterval time.Duration
+	// ContentGCInterval is how often content no document references is removed
+	ContentGCInterval time.Duration
 }
 
 // LoadConfig loads configuration from environment variables and .env files
@@ -53,8 +102,15 @@ func LoadConfig() *Config {
 		}
 	}
 
+	// Only HS256 needs a secret; the asymmetric algorithms need a key
+	algorithm := getEnv("JWT_ALGORITHM", JWTAlgorithmHS256)
+	jwtSecret := getEnv("JWT_SECRET", "")
+	if algorithm == JWTAlgorithmHS256 {
+		jwtSecret = getRequiredEnv("JWT_SECRET")
+	}
+
 	config := &Config{
-		JWTSecret:   getRequiredEnv("JWT_SECRET"),
+		JWTSecret:   jwtSecret,
 		AdminUser:   getEnv("ADMIN_USERNAME", "admin"),
 		AdminPass:   getRequiredEnv("ADMIN_PASSWORD"),
 		ServerPort:  getEnv("SERVER_PORT", "8080"),
@@ -64,11 +120,34 @@ func LoadConfig() *Config {
 		EnableHTTPS: getEnv("ENABLE_HTTPS", "false") == "true",
 		CertFile:    getEnv("CERT_FILE", "ssl/cert.pem"),
 		KeyFile:     getEnv("KEY_FILE", "ssl/key.pem"),
+
+		JWTAlgorithm:    algorithm,
+		JWTAcceptHS256:  getEnv("JWT_ACCEPT_HS256", "false") == "true",
+		AccessTokenTTL:  getEnvDuration("JWT_ACCESS_TTL", DefaultAccessTokenTTL),
+		RefreshTokenTTL: getEnvDuration("JWT_REFRESH_TTL", DefaultRefreshTokenTTL),
+
+		StorageBackend:      getEnv("STORAGE_BACKEND", "memory"),
+		DataDir:             getEnv("DATA_DIR", "data"),
+		WALSyncPolicy:       getEnv("WAL_SYNC", "always"),
+		WALSyncInterval:     getEnvDuration("WAL_SYNC_INTERVAL", time.Second),
+		WALCompactThreshold: getEnvInt("WAL_COMPACT_THRESHOLD", 1000),
+		UploadSessionTTL:    getEnvDuration("UPLOAD_SESSION_TTL", 24*time.Hour),
+		UploadGCInterval:    getEnvDuration("UPLOAD_GC_INTERVAL", 10*time.Minute),
+		ContentGCInterval:   getEnvDuration("CONTENT_GC_INTERVAL", time.Hour),
+	}
+	config.SQLitePath = getEnv("SQLITE_PATH", filepath.Join(config.DataDir, "docstore.db"))
+	config.UploadDir = getEnv("UPLOAD_DIR", filepath.Join(config.DataDir, "uploads"))
+	if err := loadJWTKeys(config); err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
 	}
 
 	// Log configuration source (without sensitive data)
-	log.Printf("Configuration loaded - Environment: %s, Port: %s, Admin User: %s",
-		config.Environment, config.ServerPort, config.AdminUser)
+	log.Printf("Configuration loaded - Environment: %s, Port: %s, Admin User: %s, Storage: %s, JWT: %s",
+		config.Environment, config.ServerPort, config.AdminUser, config.StorageBackend, config.JWTAlgorithm)
+	if config.JWTAcceptHS256 && config.JWTAlgorithm != JWTAlgorithmHS256 {
+		log.Printf("WARNING: JWT_ACCEPT_HS256 is on: HS256 tokens signed with JWT_SECRET are still accepted; "+
+			"turn it off once JWT_REFRESH_TTL has passed since switching to %s", config.JWTAlgorithm)
+	}
 
 	return config
 }
@@ -156,3 +235,31 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "500ms", "2s"), falling back to the default when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetEnv(t *testing.T) {
@@ -145,7 +146,10 @@ func TestLoadConfig(t *testing.T) {
 	envVars := []string{
 		"JWT_SECRET", "ADMIN_USERNAME", "ADMIN_PASSWORD", "SERVER_PORT",
 		"APP_ENV", "ENABLE_CORS", "CORS_ORIGINS", "ENABLE_HTTPS",
-		"CERT_FILE", "KEY_FILE",
+		"CERT_FILE", "KEY_FILE", "STORAGE_BACKEND", "DATA_DIR",
+		"WAL_SYNC", "WAL_SYNC_INTERVAL", "WAL_COMPACT_THRESHOLD", "SQLITE_PATH",
+		"UPLOAD_DIR", "UPLOAD_SESSION_TTL", "UPLOAD_GC_INTERVAL", "CONTENT_GC_INTERVAL",
+		"JWT_ACCESS_TTL", "JWT_REFRESH_TTL", "JWT_ALGORITHM",
 	}
 
 	for _, key := range envVars {
@@ -191,6 +195,37 @@ func TestLoadConfig(t *testing.T) {
 		if config.Environment != "development" {
 			t.Errorf("Environment = %v, want %v", config.Environment, "development")
 		}
+
+		if config.StorageBackend != "memory" {
+			t.Errorf("StorageBackend = %v, want %v", config.StorageBackend, "memory")
+		}
+
+		if config.WALSyncPolicy != "always" || config.WALSyncInterval != time.Second || config.WALCompactThreshold != 1000 {
+			t.Errorf("WAL defaults = %v/%v/%v, want always/1s/1000",
+				config.WALSyncPolicy, config.WALSyncInterval, config.WALCompactThreshold)
+		}
+
+		if config.SQLitePath != filepath.Join("data", "docstore.db") {
+			t.Errorf("SQLitePath = %v, want %v", config.SQLitePath, filepath.Join("data", "docstore.db"))
+		}
+
+		if config.UploadDir != filepath.Join("data", "uploads") || config.UploadSessionTTL != 24*time.Hour ||
+			config.UploadGCInterval != 10*time.Minute {
+			t.Errorf("upload defaults = %v/%v/%v, want data/uploads/24h/10m",
+				config.UploadDir, config.UploadSessionTTL, config.UploadGCInterval)
+		}
+
+		if config.ContentGCInterval != time.Hour {
+			t.Errorf("ContentGCInterval = %v, want 1h", config.ContentGCInterval)
+		}
+
+		if config.JWTAlgorithm != JWTAlgorithmHS256 || config.JWTSigningKey != nil {
+			t.Errorf("JWTAlgorithm = %v, want HS256 without a signing key", config.JWTAlgorithm)
+		}
+
+		if config.AccessTokenTTL != 15*time.Minute || config.RefreshTokenTTL != 7*24*time.Hour {
+			t.Errorf("token lifetimes = %v/%v, want 15m/168h", config.AccessTokenTTL, config.RefreshTokenTTL)
+		}
 	})
 
 	t.Run("parses CORS origins correctly", func(t *testing.T) {
@@ -266,3 +301,31 @@ func TestLoadEnvFileFromPaths(t *testing.T) {
 		t.Errorf("Expected TEST_PATH_VAR to be 'found', got '%s'", os.Getenv("TEST_PATH_VAR"))
 	}
 }
+
+func TestGetEnvIntAndDuration(t *testing.T) {
+	os.Setenv("TEST_INT_VAR", "42")
+	os.Setenv("TEST_BAD_INT_VAR", "many")
+	os.Setenv("TEST_DURATION_VAR", "250ms")
+	os.Setenv("TEST_BAD_DURATION_VAR", "soon")
+	defer func() {
+		for _, key := range []string{"TEST_INT_VAR", "TEST_BAD_INT_VAR", "TEST_DURATION_VAR", "TEST_BAD_DURATION_VAR"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	if got := getEnvInt("TEST_INT_VAR", 1); got != 42 {
+		t.Errorf("getEnvInt() = %v, want %v", got, 42)
+	}
+	if got := getEnvInt("TEST_BAD_INT_VAR", 1); got != 1 {
+		t.Errorf("getEnvInt() with invalid value = %v, want default %v", got, 1)
+	}
+	if got := getEnvInt("TEST_UNSET_INT_VAR", 7); got != 7 {
+		t.Errorf("getEnvInt() with unset value = %v, want default %v", got, 7)
+	}
+	if got := getEnvDuration("TEST_DURATION_VAR", time.Second); got != 250*time.Millisecond {
+		t.Errorf("getEnvDuration() = %v, want %v", got, 250*time.Millisecond)
+	}
+	if got := getEnvDuration("TEST_BAD_DURATION_VAR", time.Second); got != time.Second {
+		t.Errorf("getEnvDuration() with invalid value = %v, want default %v", got, time.Second)
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Algorithms tokens can be signed with, selected through JWT_ALGORITHM
+const (
+	// JWTAlgorithmHS256 signs with the shared JWT_SECRET
+	JWTAlgorithmHS256 = "HS256"
+	// JWTAlgorithmRS256 signs with an RSA private key of at least
+	// MinRSAKeyBits
+	JWTAlgorithmRS256 = "RS256"
+	// JWTAlgorithmEdDSA signs with an Ed25519 private key
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// MinRSAKeyBits is the smallest RSA key accepted for signing or verifying
+const MinRSAKeyBits = 2048
+
+// loadJWTKeys checks config.JWTAlgorithm and, for the asymmetric ones,
+// reads the signing key from JWT_PRIVATE_KEY_FILE and the verification keys
+// from the comma-separated JWT_VERIFICATION_KEY_FILES
+func loadJWTKeys(config *Config) error {
+	switch config.JWTAlgorithm {
+	case JWTAlgorithmHS256:
+		return nil
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+	default:
+		return fmt.Errorf("unknown JWT algorithm %q: must be %s, %s or %s",
+			config.JWTAlgorithm, JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmEdDSA)
+	}
+	if config.JWTAcceptHS256 && config.JWTSecret == "" {
+		return fmt.Errorf("JWT_ACCEPT_HS256 needs the JWT_SECRET HS256 tokens were signed with")
+	}
+
+	key, err := readSigningKey(getRequiredEnv("JWT_PRIVATE_KEY_FILE"), config.JWTAlgorithm)
+	if err != nil {
+		return err
+	}
+	config.JWTSigningKey = key
+	for _, path := range splitList(getEnv("JWT_VERIFICATION_KEY_FILES", "")) {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return err
+		}
+		config.JWTVerificationKeys = append(config.JWTVerificationKeys, key)
+	}
+	return nil
+}
+
+// readSigningKey reads the PEM private key at path, which must suit
+// algorithm
+func readSigningKey(path, algorithm string) (crypto.Signer, error) {
+	key, err := readPEMKey(path)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if algorithm == JWTAlgorithmRS256 {
+			return key, checkRSAKey(path, &key.PublicKey)
+		}
+	case ed25519.PrivateKey:
+		if algorithm == JWTAlgorithmEdDSA {
+			return key, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s: not a private key", path)
+	}
+	return nil, fmt.Errorf("%s: %T cannot sign %s tokens", path, key, algorithm)
+}
+
+// readPublicKey reads the PEM RSA or Ed25519 public key at path, or the
+// public part of a private key
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	key, err := readPEMKey(path)
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return key, checkRSAKey(path, key)
+	case ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+}
+
+func checkRSAKey(path string, key *rsa.PublicKey) error {
+	if key.N.BitLen() < MinRSAKeyBits {
+		return fmt.Errorf("%s: RSA key of %d bits is shorter than %d", path, key.N.BitLen(), MinRSAKeyBits)
+	}
+	return nil
+}
+
+// readPEMKey parses the first PEM block of the file at path as a PKCS #8
+// or PKCS #1 private key or a PKIX or PKCS #1 public key
+func readPEMKey(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
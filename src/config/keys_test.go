@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePEM writes der as a PEM block of blockType into dir and returns its
+// path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	rsaPKCS1 := writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPKCS8 := writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)
+	edPublicDER, _ := x509.MarshalPKIXPublicKey(edPublic)
+	edPKIX := writePEM(t, dir, "ed.pub", "PUBLIC KEY", edPublicDER)
+
+	for _, key := range []string{"JWT_PRIVATE_KEY_FILE", "JWT_VERIFICATION_KEY_FILES"} {
+		original := os.Getenv(key)
+		defer os.Setenv(key, original)
+	}
+
+	t.Run("HS256 needs no keys", func(t *testing.T) {
+		config := &Config{JWTAlgorithm: JWTAlgorithmHS256}
+		if err := loadJWTKeys(config); err != nil || config.JWTSigningKey != nil {
+			t.Errorf("loadJWTKeys() = %v, signing key %v", err, config.JWTSigningKey)
+		}
+	})
+
+	t.Run("RS256 with a retired Ed25519 key", func(t *testing.T) {
+		os.Setenv("JWT_PRIVATE_KEY_FILE", rsaPKCS1)
+		os.Setenv("JWT_VERIFICATION_KEY_FILES", edPKIX+", "+edPKCS8)
+		config := &Config{JWTAlgorithm: JWTAlgorithmRS256}
+		if err := loadJWTKeys(config); err != nil {
+			t.Fatalf("loadJWTKeys() failed: %v", err)
+		}
+		if _, ok := config.JWTSigningKey.(*rsa.PrivateKey); !ok {
+			t.Errorf("signing key is %T, want *rsa.PrivateKey", config.JWTSigningKey)
+		}
+		if len(config.JWTVerificationKeys) != 2 {
+			t.Fatalf("got %d verification keys, want 2", len(config.JWTVerificationKeys))
+		}
+		for _, key := range config.JWTVerificationKeys {
+			if !edPublic.Equal(key) {
+				t.Errorf("verification key %v, want the Ed25519 public key", key)
+			}
+		}
+	})
+
+	t.Run("EdDSA", func(t *testing.T) {
+		os.Setenv("JWT_PRIVATE_KEY_FILE", edPKCS8)
+		os.Setenv("JWT_VERIFICATION_KEY_FILES", "")
+		config := &Config{JWTAlgorithm: JWTAlgorithmEdDSA}
+		if err := loadJWTKeys(config); err != nil || !edPublic.Equal(config.JWTSigningKey.Public()) {
+			t.Errorf("loadJWTKeys() = %v, signing key %v", err, config.JWTSigningKey)
+		}
+	})
+
+	t.Run("accepting HS256 needs the secret", func(t *testing.T) {
+		os.Setenv("JWT_PRIVATE_KEY_FILE", edPKCS8)
+		if err := loadJWTKeys(&Config{JWTAlgorithm: JWTAlgorithmEdDSA, JWTAcceptHS256: true}); err == nil {
+			t.Error("expected JWT_ACCEPT_HS256 without JWT_SECRET to fail")
+		}
+		config := &Config{JWTAlgorithm: JWTAlgorithmEdDSA, JWTAcceptHS256: true, JWTSecret: "secret"}
+		if err := loadJWTKeys(config); err != nil {
+			t.Errorf("loadJWTKeys() failed: %v", err)
+		}
+	})
+
+	t.Run("rejects unusable keys", func(t *testing.T) {
+		smallKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+		small := writePEM(t, dir, "small.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallKey))
+		garbage := filepath.Join(dir, "garbage.pem")
+		os.WriteFile(garbage, []byte("not a key"), 0o600)
+
+		tests := []struct {
+			algorithm, privateKey string
+		}{
+			{JWTAlgorithmRS256, edPKCS8},
+			{JWTAlgorithmEdDSA, rsaPKCS1},
+			{JWTAlgorithmRS256, small},
+			{JWTAlgorithmRS256, edPKIX},
+			{JWTAlgorithmRS256, garbage},
+			{JWTAlgorithmRS256, filepath.Join(dir, "missing.pem")},
+			{"HS512", rsaPKCS1},
+		}
+		for _, tt := range tests {
+			os.Setenv("JWT_PRIVATE_KEY_FILE", tt.privateKey)
+			if err := loadJWTKeys(&Config{JWTAlgorithm: tt.algorithm}); err == nil {
+				t.Errorf("expected %s with %s to fail", tt.algorithm, filepath.Base(tt.privateKey))
+			}
+		}
+	})
+}
@@ -3,13 +3,18 @@ package controllers
 import (
 	"docstore-api/src/config"
 	"docstore-api/src/middleware"
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthController struct {
-	config *config.Config
+	config   *config.Config
+	users    services.UserService
+	sessions services.SessionService
 }
 
 type LoginRequest struct {
@@ -18,19 +23,32 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
+	// Token is the access token, sent as a bearer token with every request
 	Token string `json:"token"`
-	User  string `json:"user"`
+	// RefreshToken can be exchanged once at /auth/refresh for new tokens
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is how many seconds Token is valid for
+	ExpiresIn int64  `json:"expires_in"`
+	User      string `json:"user"`
+	Role      string `json:"role"`
 }
 
-func NewAuthController(cfg *config.Config) *AuthController {
+// RefreshRequest is the body of Refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func NewAuthController(cfg *config.Config, users services.UserService, sessions services.SessionService) *AuthController {
 	return &AuthController{
-		config: cfg,
+		config:   cfg,
+		users:    users,
+		sessions: sessions,
 	}
 }
 
 // Login godoc
 // @Summary User login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate a stored user, or the bootstrap admin configured through the environment, and start a session: return a short-lived access token carrying their role and groups, and a refresh token to get new ones with
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -46,20 +64,142 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	// Simple authentication - verify against configured credentials
-	if req.Username == ctrl.config.AdminUser && req.Password == ctrl.config.AdminPass {
-		token, err := middleware.GenerateToken(req.Username, ctrl.config)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-			return
-		}
+	ctx := requestContext(c)
+	user, err := ctrl.users.Authenticate(ctx, req.Username, req.Password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credentials"})
+		return
+	}
+
+	sessionID, tokenID := middleware.NewTokenID(), middleware.NewTokenID()
+	refreshToken, expiresAt, err := middleware.GenerateRefreshToken(user.Username, sessionID, tokenID, ctrl.config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if _, err := ctrl.sessions.StartSession(ctx, sessionID, user.Username, tokenID, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	ctrl.respondWithTokens(c, user, sessionID, refreshToken)
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be exchanged once: presenting one again revokes the session it belongs to, with every token issued for it. The new access token carries the user's current role and groups; disabled or deleted users are logged out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token body RefreshRequest true "Refresh token"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/auth/refresh [post]
+func (ctrl *AuthController) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusOK, LoginResponse{
-			Token: token,
-			User:  req.Username,
-		})
+	claims, err := middleware.ValidateRefreshToken(req.RefreshToken, ctrl.config)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	ctx := requestContext(c)
+	user, err := ctrl.users.ActiveUser(ctx, claims.Username)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		ctrl.sessions.EndSession(ctx, claims.SessionID, claims.ID, claims.ExpiresAt.Time)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify credentials"})
+		return
+	}
+
+	nextID := middleware.NewTokenID()
+	refreshToken, expiresAt, err := middleware.GenerateRefreshToken(user.Username, claims.SessionID, nextID, ctrl.config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	_, err = ctrl.sessions.RotateSession(ctx, claims.SessionID, claims.ID, nextID, expiresAt)
+	switch {
+	case errors.Is(err, models.ErrRefreshTokenReused), errors.Is(err, models.ErrSessionRevoked),
+		errors.Is(err, models.ErrSessionNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has been revoked"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	ctrl.respondWithTokens(c, user, claims.SessionID, refreshToken)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the session the access token was issued for: the token itself, the other access tokens of the session and its refresh token stop working at once
+// @Tags auth
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/auth/logout [post]
+func (ctrl *AuthController) Logout(c *gin.Context) {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*middleware.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		return
+	}
+
+	err := ctrl.sessions.EndSession(requestContext(c), claims.SessionID, claims.ID, claims.ExpiresAt.Time)
+	if err != nil && !errors.Is(err, models.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithTokens issues an access token for user in session sessionID
+// and sends it along with refreshToken
+func (ctrl *AuthController) respondWithTokens(c *gin.Context, user models.User, sessionID, refreshToken string) {
+	token, err := middleware.GenerateToken(user.Username, user.Role, user.Groups, sessionID, ctrl.config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(middleware.AccessTokenTTL(ctrl.config).Seconds()),
+		User:         user.Username,
+		Role:         user.Role,
+	})
+}
+
+// JWKS godoc
+// @Summary Public signing keys
+// @Description Get the public keys tokens are signed with, as a JSON Web Key Set, so that other services can verify them. Tokens name their key in the kid header. The set holds the current signing key first, then retired keys whose tokens are still accepted; it is empty when tokens are signed with the shared HS256 secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} middleware.JWKS
+// @Router /.well-known/jwks.json [get]
+func (ctrl *AuthController) JWKS(c *gin.Context) {
+	jwks, err := middleware.PublicKeys(ctrl.config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
 }
@@ -2,13 +2,21 @@ package controllers
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"docstore-api/src/config"
+	"docstore-api/src/middleware"
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,12 +27,24 @@ func TestNewAuthController(t *testing.T) {
 		AdminPass: "password",
 	}
 
-	controller := NewAuthController(cfg)
+	controller := newTestAuthController(t, cfg)
 
 	assert.NotNil(t, controller)
 	assert.Equal(t, cfg, controller.config)
 }
 
+// newTestAuthController creates an AuthController whose bootstrap admin is
+// the one configured in cfg
+func newTestAuthController(t *testing.T, cfg *config.Config) *AuthController {
+	t.Helper()
+	store := models.NewDocumentStore()
+	users, err := services.NewUserService(store, cfg.AdminUser, cfg.AdminPass)
+	if err != nil {
+		t.Fatalf("NewUserService() failed: %v", err)
+	}
+	return NewAuthController(cfg, users, services.NewSessionService(store))
+}
+
 func TestAuthController_Login(t *testing.T) {
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -35,7 +55,7 @@ func TestAuthController_Login(t *testing.T) {
 		AdminPass: "password123",
 	}
 
-	controller := NewAuthController(cfg)
+	controller := newTestAuthController(t, cfg)
 
 	tests := []struct {
 		name           string
@@ -173,7 +193,7 @@ func TestAuthController_Login_Integration(t *testing.T) {
 		AdminPass: "testpass123",
 	}
 
-	controller := NewAuthController(cfg)
+	controller := newTestAuthController(t, cfg)
 	router := gin.New()
 	router.POST("/api/v1/auth/login", controller.Login)
 
@@ -217,7 +237,7 @@ func TestLoginRequest_Validation(t *testing.T) {
 		AdminPass: "password",
 	}
 
-	controller := NewAuthController(cfg)
+	controller := newTestAuthController(t, cfg)
 	router := gin.New()
 	router.POST("/login", controller.Login)
 
@@ -287,3 +307,209 @@ func TestLoginRequest_Validation(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthController_Login_StoredUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		JWTSecret: "test-secret-key",
+		AdminUser: "admin",
+		AdminPass: "password123",
+	}
+	store := models.NewDocumentStore()
+	users, err := services.NewUserService(store, cfg.AdminUser, cfg.AdminPass)
+	assert.NoError(t, err)
+	controller := NewAuthController(cfg, users, services.NewSessionService(store))
+	router := gin.New()
+	router.POST("/login", controller.Login)
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: password})
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	ctx := context.Background()
+	_, err = users.CreateUser(ctx, "bob", "correct horse", models.RoleEditor)
+	assert.NoError(t, err)
+
+	w := login("bob", "correct horse")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response LoginResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "bob", response.User)
+	assert.Equal(t, models.RoleEditor, response.Role)
+	claims, err := middleware.ValidateToken(response.Token, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleEditor, claims.Role)
+
+	assert.Equal(t, http.StatusUnauthorized, login("bob", "wrong horse").Code)
+
+	disabled := true
+	users.UpdateUser(ctx, "bob", services.UserChanges{Disabled: &disabled})
+	assert.Equal(t, http.StatusUnauthorized, login("bob", "correct horse").Code)
+
+	// The bootstrap admin keeps working alongside stored users
+	w = login("admin", "password123")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.RoleAdmin, response.Role)
+}
+
+func TestAuthController_RefreshAndLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		JWTSecret: "test-secret-key",
+		AdminUser: "admin",
+		AdminPass: "password123",
+	}
+	store := models.NewDocumentStore()
+	users, err := services.NewUserService(store, cfg.AdminUser, cfg.AdminPass)
+	assert.NoError(t, err)
+	sessions := services.NewSessionService(store)
+	controller := NewAuthController(cfg, users, sessions)
+
+	router := gin.New()
+	router.POST("/login", controller.Login)
+	router.POST("/refresh", controller.Refresh)
+	protected := router.Group("/", middleware.JWTAuthMiddleware(cfg, sessions))
+	protected.POST("/logout", controller.Logout)
+	protected.GET("/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"role": c.GetString("role")})
+	})
+
+	send := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	tokens := func(w *httptest.ResponseRecorder) LoginResponse {
+		t.Helper()
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response LoginResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	ctx := context.Background()
+	users.CreateUser(ctx, "bob", "correct horse", models.RoleReader)
+
+	login := tokens(send("POST", "/login", "", LoginRequest{Username: "bob", Password: "correct horse"}))
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, int64(900), login.ExpiresIn)
+	assert.Equal(t, http.StatusOK, send("GET", "/me", login.Token, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/me", login.RefreshToken, nil).Code,
+		"refresh tokens must not be accepted as access tokens")
+	assert.Equal(t, http.StatusUnauthorized, send("POST", "/refresh", "", RefreshRequest{RefreshToken: login.Token}).Code,
+		"access tokens must not be accepted as refresh tokens")
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/refresh", "", gin.H{}).Code)
+
+	t.Run("refresh picks up role changes", func(t *testing.T) {
+		editor := models.RoleEditor
+		users.UpdateUser(ctx, "bob", services.UserChanges{Role: &editor})
+		refreshed := tokens(send("POST", "/refresh", "", RefreshRequest{RefreshToken: login.RefreshToken}))
+		assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+		assert.Equal(t, models.RoleEditor, refreshed.Role)
+		assert.JSONEq(t, `{"role": "editor"}`, send("GET", "/me", refreshed.Token, nil).Body.String())
+		login = refreshed
+	})
+
+	t.Run("reusing a refresh token revokes the family", func(t *testing.T) {
+		stolen := login.RefreshToken
+		next := tokens(send("POST", "/refresh", "", RefreshRequest{RefreshToken: stolen}))
+
+		w := send("POST", "/refresh", "", RefreshRequest{RefreshToken: stolen})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "revoked")
+		assert.Equal(t, http.StatusUnauthorized, send("POST", "/refresh", "", RefreshRequest{RefreshToken: next.RefreshToken}).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/me", next.Token, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/me", login.Token, nil).Code)
+	})
+
+	t.Run("logout revokes the session", func(t *testing.T) {
+		session := tokens(send("POST", "/login", "", LoginRequest{Username: "bob", Password: "correct horse"}))
+		other := tokens(send("POST", "/login", "", LoginRequest{Username: "bob", Password: "correct horse"}))
+
+		assert.Equal(t, http.StatusNoContent, send("POST", "/logout", session.Token, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/me", session.Token, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("POST", "/logout", session.Token, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("POST", "/refresh", "", RefreshRequest{RefreshToken: session.RefreshToken}).Code)
+
+		// Other sessions of the same user are left alone
+		assert.Equal(t, http.StatusOK, send("GET", "/me", other.Token, nil).Code)
+	})
+
+	t.Run("disabled users cannot refresh", func(t *testing.T) {
+		session := tokens(send("POST", "/login", "", LoginRequest{Username: "bob", Password: "correct horse"}))
+		disabled := true
+		users.UpdateUser(ctx, "bob", services.UserChanges{Disabled: &disabled})
+		assert.Equal(t, http.StatusUnauthorized, send("POST", "/refresh", "", RefreshRequest{RefreshToken: session.RefreshToken}).Code)
+		assert.Equal(t, http.StatusUnauthorized, send("GET", "/me", session.Token, nil).Code)
+	})
+}
+
+func TestAuthController_JWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fetch := func(cfg *config.Config) middleware.JWKS {
+		t.Helper()
+		router := gin.New()
+		router.GET("/.well-known/jwks.json", newTestAuthController(t, cfg).JWKS)
+		req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var jwks middleware.JWKS
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+		return jwks
+	}
+
+	t.Run("HS256 publishes nothing", func(t *testing.T) {
+		jwks := fetch(&config.Config{JWTSecret: "test-secret-key", AdminUser: "admin", AdminPass: "password123"})
+		assert.Empty(t, jwks.Keys)
+	})
+
+	t.Run("tokens verify against the published key", func(t *testing.T) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		cfg := &config.Config{
+			JWTAlgorithm:  config.JWTAlgorithmEdDSA,
+			JWTSigningKey: key,
+			AdminUser:     "admin",
+			AdminPass:     "password123",
+		}
+		jwks := fetch(cfg)
+		if !assert.Len(t, jwks.Keys, 1) {
+			return
+		}
+		assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+
+		router := gin.New()
+		router.POST("/login", newTestAuthController(t, cfg).Login)
+		body, _ := json.Marshal(LoginRequest{Username: "admin", Password: "password123"})
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response LoginResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		// Verify the way another service would, knowing only the key set
+		publicKey, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+		assert.NoError(t, err)
+		token, err := jwt.Parse(response.Token, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+			return ed25519.PublicKey(publicKey), nil
+		}, jwt.WithValidMethods([]string{"EdDSA"}))
+		assert.NoError(t, err)
+		assert.True(t, token.Valid)
+	})
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// documentsSegment ends the path of a collection's document listing. It is
+// reserved, so no collection can be named like it.
+const documentsSegment = "/documents"
+
+type CollectionController struct {
+	collections services.CollectionService
+	documents   services.DocumentService
+}
+
+func NewCollectionController(collections services.CollectionService, documents services.DocumentService) *CollectionController {
+	return &CollectionController{
+		collections: collections,
+		documents:   documents,
+	}
+}
+
+// collectionResponse is a collection together with the collections below it
+type collectionResponse struct {
+	models.Collection
+	Collections []models.Collection `json:"collections"`
+}
+
+// moveCollectionRequest is the body of PATCH /collections/*path
+type moveCollectionRequest struct {
+	Path string `json:"path" binding:"required" example:"/archive/2026"`
+}
+
+// collectionPath returns the collection path a request addresses and
+// whether it addresses the collection's documents rather than the
+// collection itself
+func collectionPath(c *gin.Context) (string, bool) {
+	path, documents := c.Param("path"), false
+	if strings.HasSuffix(path, documentsSegment) {
+		path, documents = strings.TrimSuffix(path, documentsSegment), true
+	}
+	if path == "" {
+		path = "/"
+	}
+	return path, documents
+}
+
+// parseRecursive reads the recursive query parameter, answering 400 if it
+// is not a boolean
+func parseRecursive(c *gin.Context) (bool, bool) {
+	value := c.Query("recursive")
+	if value == "" {
+		return false, true
+	}
+	recursive, err := strconv.ParseBool(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "recursive must be true or false"})
+		return false, false
+	}
+	return recursive, true
+}
+
+// GetCollection godoc
+// @Summary Get a collection or list its documents
+// @Description Get the collection at a path with the collections directly below it, or all of them below it with recursive=true. "/" is the root. A path ending in /documents lists the collection's documents instead, with the paging, sorting and filtering parameters of GET /api/v1/documents; recursive=true includes the documents of every collection below it.
+// @Tags collections
+// @Produce json
+// @Param path path string true "Collection path, e.g. contracts/2026/q3 or contracts/2026/q3/documents"
+// @Param recursive query bool false "Include everything below the collection, not only its direct children"
+// @Param limit query int false "Page size of a document listing (default 50, capped at 200)"
+// @Param cursor query string false "Opaque cursor from a previous page's next_cursor"
+// @Param sort query string false "Sort field: id, name, created_at or updated_at; prefix with - for descending"
+// @Param filter query string false "Filter expression, e.g. name:prefix:Getting AND created_at>2026-01-01"
+// @Success 200 {object} collectionResponse
+// @Success 200 {object} models.DocumentPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/collections/{path} [get]
+func (ctrl *CollectionController) GetCollection(c *gin.Context) {
+	path, documents := collectionPath(c)
+	recursive, ok := parseRecursive(c)
+	if !ok {
+		return
+	}
+
+	if documents {
+		opts, ok := parseListOptions(c)
+		if !ok {
+			return
+		}
+		opts.Collection, opts.Recursive = path, recursive
+		listDocuments(c, ctrl.documents, opts)
+		return
+	}
+
+	collection, err := ctrl.collections.GetCollection(requestContext(c), path)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	below, err := ctrl.collections.ListCollections(requestContext(c), path, recursive)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, collectionResponse{Collection: collection, Collections: below})
+}
+
+// CreateCollection godoc
+// @Summary Create a collection or a document in it
+// @Description Create the collection at a path, along with any missing collections above it. A path ending in /documents creates the document in the body inside the collection instead, like POST /api/v1/documents.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param path path string true "Collection path, e.g. contracts/2026/q3 or contracts/2026/q3/documents"
+// @Param document body models.Document false "Document to create, for a path ending in /documents"
+// @Success 201 {object} models.Collection
+// @Success 201 {object} models.Document
+// @Header 201 {string} Location "URL of the created collection or document"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/collections/{path} [post]
+func (ctrl *CollectionController) CreateCollection(c *gin.Context) {
+	path, documents := collectionPath(c)
+
+	if documents {
+		doc, ok := bindCreateDocument(c)
+		if !ok {
+			return
+		}
+		collection, err := ctrl.collections.GetCollection(requestContext(c), path)
+		if err != nil {
+			respondWithStoreError(c, err)
+			return
+		}
+		doc.CollectionID = collection.ID
+		createDocument(c, ctrl.documents, doc)
+		return
+	}
+
+	collection, err := ctrl.collections.CreateCollection(requestContext(c), path)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", "/api/v1/collections"+collection.Path)
+	c.JSON(http.StatusCreated, collection)
+}
+
+// MoveCollection godoc
+// @Summary Move or rename a collection
+// @Description Move a collection to a new path, taking every collection and document below it along. The new parent must exist and nothing may exist at the new path yet.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param path path string true "Collection path, e.g. contracts/2026"
+// @Param move body moveCollectionRequest true "New path of the collection"
+// @Success 200 {object} models.Collection
+// @Header 200 {string} Location "URL of the moved collection"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/collections/{path} [patch]
+func (ctrl *CollectionController) MoveCollection(c *gin.Context) {
+	path, documents := collectionPath(c)
+	if documents {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "documents of a collection are moved one by one"})
+		return
+	}
+	var req moveCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection, err := ctrl.collections.MoveCollection(requestContext(c), path, req.Path)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", "/api/v1/collections"+collection.Path)
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection godoc
+// @Summary Delete a collection
+// @Description Delete a collection that holds no documents or collections
+// @Tags collections
+// @Param path path string true "Collection path, e.g. contracts/2026"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/collections/{path} [delete]
+func (ctrl *CollectionController) DeleteCollection(c *gin.Context) {
+	path, documents := collectionPath(c)
+	if documents {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "documents of a collection are deleted one by one"})
+		return
+	}
+	if err := ctrl.collections.DeleteCollection(requestContext(c), path); err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCollectionTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	store := models.NewDocumentStore()
+	documentService := services.NewDocumentService(store)
+	documents := NewDocumentController(documentService)
+	collections := NewCollectionController(services.NewCollectionService(store), documentService)
+
+	router := gin.New()
+	router.POST("/documents", documents.CreateDocument)
+	router.POST("/documents/:id/move", documents.MoveDocument)
+	router.GET("/collections", collections.GetCollection)
+	router.GET("/collections/*path", collections.GetCollection)
+	router.POST("/collections/*path", collections.CreateCollection)
+	router.PATCH("/collections/*path", collections.MoveCollection)
+	router.DELETE("/collections/*path", collections.DeleteCollection)
+	return router
+}
+
+func TestCollectionController_Collections(t *testing.T) {
+	router := setupCollectionTestRouter()
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	children := func(path string) []string {
+		w := send("GET", path, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response collectionResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		paths := []string{}
+		for _, c := range response.Collections {
+			paths = append(paths, c.Path)
+		}
+		return paths
+	}
+	listIDs := func(path string) []string {
+		w := send("GET", path, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page models.DocumentPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		ids := []string{}
+		for _, doc := range page.Documents {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		w := send("POST", "/collections/contracts/2026/q3", "")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v1/collections/contracts/2026/q3", w.Header().Get("Location"))
+		var created models.Collection
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "q3", created.Name)
+		assert.Equal(t, "/contracts/2026/q3", created.Path)
+
+		assert.Equal(t, http.StatusConflict, send("POST", "/collections/contracts/2026/q3", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/collections/a%20b", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/collections/documents/x", "").Code)
+		send("POST", "/collections/reports", "")
+	})
+
+	t.Run("Children and descendants", func(t *testing.T) {
+		assert.Equal(t, []string{"/contracts", "/reports"}, children("/collections"))
+		assert.Equal(t, []string{"/contracts", "/reports"}, children("/collections/"))
+		assert.Equal(t, []string{"/contracts/2026"}, children("/collections/contracts"))
+		assert.Equal(t, []string{"/contracts/2026", "/contracts/2026/q3"}, children("/collections/contracts?recursive=true"))
+		assert.Equal(t, http.StatusNotFound, send("GET", "/collections/missing", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/collections/contracts?recursive=maybe", "").Code)
+	})
+
+	t.Run("Documents", func(t *testing.T) {
+		w := send("POST", "/collections/contracts/2026/q3/documents", `{"id": "c-1", "name": "Lease"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v1/documents/c-1", w.Header().Get("Location"))
+		send("POST", "/documents", `{"id": "c-2", "name": "Loose"}`)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/collections/missing/documents", `{"id": "c-3"}`).Code)
+
+		assert.Equal(t, []string{"c-2"}, listIDs("/collections/documents"))
+		assert.Equal(t, []string{"c-1"}, listIDs("/collections/contracts/2026/q3/documents"))
+		assert.Equal(t, []string{}, listIDs("/collections/contracts/documents"))
+		assert.Equal(t, []string{"c-1"}, listIDs("/collections/contracts/documents?recursive=true&sort=name"))
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/collections/contracts/documents?limit=0", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/collections/missing/documents", "").Code)
+	})
+
+	t.Run("Move document", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/documents/c-2/move", strings.NewReader(`{"collection": "/reports"}`))
+		req.Header.Set("If-Match", `"1"`)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+		assert.Equal(t, []string{"c-2"}, listIDs("/collections/reports/documents"))
+
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/documents/c-2/move", `{}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/documents/c-2/move", `{"collection": "/missing"}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/documents/missing/move", `{"collection": "/"}`).Code)
+	})
+
+	t.Run("Move collection", func(t *testing.T) {
+		w := send("PATCH", "/collections/contracts/2026", `{"path": "/archive"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/api/v1/collections/archive", w.Header().Get("Location"))
+		assert.Equal(t, []string{"c-1"}, listIDs("/collections/archive/q3/documents"))
+
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/collections/archive", `{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/collections/archive", `{"path": "/archive/q3/x"}`).Code)
+		assert.Equal(t, http.StatusConflict, send("PATCH", "/collections/archive", `{"path": "/reports"}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("PATCH", "/collections/missing", `{"path": "/x"}`).Code)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, send("DELETE", "/collections/archive", "").Code)
+		assert.Equal(t, http.StatusNoContent, send("DELETE", "/collections/contracts", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("DELETE", "/collections/contracts", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send("DELETE", "/collections/", "").Code)
+	})
+}
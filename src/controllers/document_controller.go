@@ -1,9 +1,19 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"docstore-api/src/models"
 	"docstore-api/src/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,32 +28,136 @@ func NewDocumentController(service services.DocumentService) *DocumentController
 	}
 }
 
+// requestContext carries the authenticated username into the service layer,
+// where stores record it as the author of revisions. Users other than admins
+// are limited to the documents they own or that are shared with them.
+func requestContext(c *gin.Context) context.Context {
+	username := c.GetString("username")
+	ctx := models.WithActor(c.Request.Context(), username)
+	if username != "" && c.GetString("role") != models.RoleAdmin {
+		ctx = models.WithViewer(ctx, models.Viewer{Username: username, Groups: c.GetStringSlice("groups")})
+	}
+	return ctx
+}
+
+// respondWithStoreError maps storage errors to HTTP status codes
+func respondWithStoreError(c *gin.Context, err error) {
+	c.JSON(storeErrorStatus(err), storeErrorBody(err))
+}
+
+// storeErrorStatus returns the HTTP status code a storage error is answered with
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrInvalidDocumentID), errors.Is(err, models.ErrInvalidCursor),
+		errors.Is(err, models.ErrInvalidSort), errors.Is(err, models.ErrInvalidSearchQuery),
+		errors.Is(err, models.ErrInvalidUpload), errors.Is(err, models.ErrUploadInterrupted),
+		errors.Is(err, models.ErrInvalidPatch), errors.Is(err, models.ErrInvalidCollectionPath),
+		errors.Is(err, models.ErrInvalidSchema), errors.Is(err, models.ErrInvalidType),
+		errors.Is(err, models.ErrInvalidBatch), errors.Is(err, models.ErrInvalidUsername),
+		errors.Is(err, models.ErrInvalidRole), errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, models.ErrInvalidGroup), errors.Is(err, models.ErrInvalidGrant):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrDocumentNotFound), errors.Is(err, models.ErrRevisionNotFound),
+		errors.Is(err, models.ErrContentNotFound), errors.Is(err, models.ErrUploadNotFound),
+		errors.Is(err, models.ErrCollectionNotFound), errors.Is(err, models.ErrSchemaNotFound),
+		errors.Is(err, models.ErrUserNotFound), errors.Is(err, models.ErrGrantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrDocumentExists), errors.Is(err, models.ErrUploadOffset),
+		errors.Is(err, models.ErrUploadBusy), errors.Is(err, models.ErrUploadIncomplete),
+		errors.Is(err, models.ErrPatchConflict), errors.Is(err, models.ErrPatchTestFailed),
+		errors.Is(err, models.ErrCollectionExists), errors.Is(err, models.ErrCollectionNotEmpty),
+		errors.Is(err, models.ErrUserExists), errors.Is(err, services.ErrBootstrapAccount):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, models.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, models.ErrChecksumMismatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrBatchAborted):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// storeErrorBody returns the response body reporting a storage error, which
+// lists the rejected fields of a validation error
+func storeErrorBody(err error) gin.H {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return gin.H{"error": validationErr.Error(), "errors": validationErr.Errors}
+	}
+	return gin.H{"error": err.Error()}
+}
+
+// createDocumentRequest tells an omitted id, which the server generates,
+// apart from an explicitly empty one, which is rejected
+type createDocumentRequest struct {
+	models.Document
+	ID *string `json:"id"`
+}
+
 // CreateDocument godoc
 // @Summary Create a new document
-// @Description Create a new document with the provided information
+// @Description Create a new document with the provided information. When id is omitted the server generates a time-sortable UUIDv7. If a schema is registered for the document's type, metadata that does not conform is rejected with 422 and the violations located by JSON pointer.
 // @Tags documents
 // @Accept json
 // @Produce json
 // @Param document body models.Document true "Document to create"
 // @Success 201 {object} models.Document
+// @Header 201 {string} ETag "Version of the created document"
+// @Header 201 {string} Location "URL of the created document"
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /api/v1/documents [post]
 func (ctrl *DocumentController) CreateDocument(c *gin.Context) {
-	var doc models.Document
-	if err := c.ShouldBindJSON(&doc); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	doc, ok := bindCreateDocument(c)
+	if !ok {
 		return
 	}
+	createDocument(c, ctrl.service, doc)
+}
+
+// bindCreateDocument reads the document to create from the request body,
+// answering 400 if it cannot
+func bindCreateDocument(c *gin.Context) (models.Document, bool) {
+	var req createDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Document{}, false
+	}
 
-	if err := ctrl.service.CreateDocument(doc); err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	doc := req.Document
+	if req.ID != nil {
+		if err := models.ValidateDocumentID(*req.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return models.Document{}, false
+		}
+		doc.ID = *req.ID
+	}
+	return doc, true
+}
+
+// createDocument stores doc and answers 201 with its location and version
+func createDocument(c *gin.Context, service services.DocumentService, doc models.Document) {
+	created, err := service.CreateDocument(requestContext(c), doc)
+	if err != nil {
+		respondWithStoreError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, doc)
+	c.Header("Location", "/api/v1/documents/"+url.PathEscape(created.ID))
+	setETag(c, created)
+	c.JSON(http.StatusCreated, created)
 }
 
 // GetDocument godoc
@@ -53,50 +167,157 @@ func (ctrl *DocumentController) CreateDocument(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Document ID"
+// @Param If-None-Match header string false "Answer 304 if the document still has one of these ETags"
 // @Success 200 {object} models.Document
+// @Header 200 {string} ETag "Current document version"
+// @Success 304
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/v1/documents/{id} [get]
 func (ctrl *DocumentController) GetDocument(c *gin.Context) {
 	id := c.Param("id")
 
-	doc, err := ctrl.service.GetDocument(id)
+	doc, err := ctrl.service.GetDocument(requestContext(c), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondWithStoreError(c, err)
 		return
 	}
 
+	setETag(c, doc)
+	if notModified(c, doc) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, doc)
 }
 
 // ListDocuments godoc
-// @Summary List all documents
-// @Description Get a list of all documents
+// @Summary List documents
+// @Description Get one page of documents. Follow next_cursor to fetch the following page; it is omitted on the last one. Users other than admins only see the documents they own or that are shared with them or one of their groups.
 // @Tags documents
 // @Accept json
 // @Produce json
-// @Success 200 {array} models.Document
+// @Param limit query int false "Page size (default 50, capped at 200)"
+// @Param cursor query string false "Opaque cursor from a previous page's next_cursor"
+// @Param sort query string false "Sort field: id, name, created_at or updated_at; prefix with - for descending"
+// @Param filter query string false "Filter expression, e.g. name:prefix:Getting AND created_at>2026-01-01"
+// @Param tag query []string false "Only documents with this tag; repeat to require several" collectionFormat(multi)
+// @Param metadata[key] query string false "Only documents whose metadata has key set to this value; repeat with other keys to require several"
+// @Success 200 {object} models.DocumentPage
+// @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/v1/documents [get]
 func (ctrl *DocumentController) ListDocuments(c *gin.Context) {
-	docs := ctrl.service.ListDocuments()
-	c.JSON(http.StatusOK, docs)
+	opts, ok := parseListOptions(c)
+	if !ok {
+		return
+	}
+	listDocuments(c, ctrl.service, opts)
+}
+
+// listDocuments answers with the page of documents opts selects
+func listDocuments(c *gin.Context, service services.DocumentService, opts models.ListOptions) {
+	page, err := service.ListDocuments(requestContext(c), opts)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// parseListOptions reads the paging, sorting and filtering parameters of a
+// document listing, answering 400 if they are malformed
+func parseListOptions(c *gin.Context) (models.ListOptions, bool) {
+	var opts models.ListOptions
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return opts, false
+		}
+		opts.Limit = limit
+	}
+	sortBy, descending, err := models.ParseSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return opts, false
+	}
+	opts.SortBy, opts.Descending = sortBy, descending
+	opts.Cursor = c.Query("cursor")
+	if expr := c.Query("filter"); expr != "" {
+		filter, err := models.ParseFilter(expr)
+		var filterErr *models.FilterError
+		if errors.As(err, &filterErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    filterErr.Error(),
+				"position": filterErr.Position,
+				"token":    filterErr.Token,
+			})
+			return opts, false
+		}
+		opts.Filter = filter
+	}
+	opts.Tags = c.QueryArray("tag")
+	opts.Metadata = c.QueryMap("metadata")
+	return opts, true
+}
+
+// SearchDocuments godoc
+// @Summary Search documents
+// @Description Full-text search over document names and descriptions, ranked by BM25. Every word must match; words are stemmed, so "searching" also finds "search". Quote words to match them as a phrase. Highlights hold HTML snippets with matches wrapped in <mark>. Users other than admins only find the documents they can see.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param q query string true "Search query, e.g. getting \"api reference\""
+// @Param limit query int false "Maximum number of results (default 50, capped at 200)"
+// @Success 200 {object} models.SearchResults
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/search [get]
+func (ctrl *DocumentController) SearchDocuments(c *gin.Context) {
+	var limit int
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+	}
+
+	results, err := ctrl.service.SearchDocuments(requestContext(c), c.Query("q"), limit)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
 }
 
 // UpdateDocument godoc
 // @Summary Update a document (PUT)
-// @Description Replace an entire document with new data
+// @Description Replace an entire document with new data. If a schema is registered for the document's type, metadata that does not conform is rejected with 422.
 // @Tags documents
 // @Accept json
 // @Produce json
 // @Param id path string true "Document ID"
 // @Param document body models.Document true "Document data to update"
+// @Param If-Match header string false "Only update if the document still has one of these ETags"
 // @Success 200 {object} models.Document
+// @Header 200 {string} ETag "New document version"
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /api/v1/documents/{id} [put]
 func (ctrl *DocumentController) UpdateDocument(c *gin.Context) {
@@ -108,32 +329,65 @@ func (ctrl *DocumentController) UpdateDocument(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.service.UpdateDocument(id, doc); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	updatedDoc, err := ctrl.service.UpdateDocument(requestContext(c), id, doc, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
 		return
 	}
 
-	// Return the updated document
-	updatedDoc, _ := ctrl.service.GetDocument(id)
+	setETag(c, updatedDoc)
 	c.JSON(http.StatusOK, updatedDoc)
 }
 
+// acceptPatch lists the media types PATCH /documents/:id accepts
+const acceptPatch = "application/json, " + models.MergePatchMediaType + ", " + models.JSONPatchMediaType
+
 // PartialUpdateDocument godoc
 // @Summary Partially update a document (PATCH)
-// @Description Update specific fields of a document
+// @Description Update specific fields of a document. The format follows Content-Type: application/json sets the fields given, application/merge-patch+json applies a JSON Merge Patch (RFC 7396) and application/json-patch+json applies a JSON Patch (RFC 6902), whose test operations make the update conditional. The result is validated as a whole: unknown fields, read-only fields such as id and values of the wrong type are reported together with 422, and nothing is changed unless every field is valid. Metadata must also conform to the schema registered for the document's type, if any.
 // @Tags documents
 // @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
 // @Produce json
 // @Param id path string true "Document ID"
 // @Param updates body map[string]interface{} true "Fields to update"
+// @Param If-Match header string false "Only update if the document still has one of these ETags"
 // @Success 200 {object} models.Document
+// @Header 200 {string} ETag "New document version"
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
 // @Security BearerAuth
 // @Router /api/v1/documents/{id} [patch]
 func (ctrl *DocumentController) PartialUpdateDocument(c *gin.Context) {
 	id := c.Param("id")
+	mediaType := ""
+	if contentType := c.GetHeader("Content-Type"); contentType != "" {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			c.Header("Accept-Patch", acceptPatch)
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "invalid Content-Type"})
+			return
+		}
+		mediaType = parsed
+	}
+	switch mediaType {
+	case "", "application/json":
+	case models.MergePatchMediaType, models.JSONPatchMediaType:
+		ctrl.patchDocument(c, id, mediaType)
+		return
+	default:
+		c.Header("Accept-Patch", acceptPatch)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported patch format " + mediaType})
+		return
+	}
+
 	var updates map[string]interface{}
 
 	if err := c.ShouldBindJSON(&updates); err != nil {
@@ -141,16 +395,148 @@ func (ctrl *DocumentController) PartialUpdateDocument(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.service.PartialUpdateDocument(id, updates); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	updatedDoc, err := ctrl.service.PartialUpdateDocument(requestContext(c), id, updates, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
 		return
 	}
 
-	// Return the updated document
-	updatedDoc, _ := ctrl.service.GetDocument(id)
+	setETag(c, updatedDoc)
 	c.JSON(http.StatusOK, updatedDoc)
 }
 
+// patchDocument applies a body in one of the patch formats
+func (ctrl *DocumentController) patchDocument(c *gin.Context, id, mediaType string) {
+	data, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var patch models.DocumentPatch
+	if mediaType == models.MergePatchMediaType {
+		patch, err = models.ParseMergePatch(data)
+	} else {
+		patch, err = models.ParseJSONPatch(data)
+	}
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	doc, err := ctrl.service.PatchDocument(requestContext(c), id, patch, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// tagsRequest is the body of POST /documents/:id/tags
+type tagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// AddDocumentTags godoc
+// @Summary Add tags to a document
+// @Description Add tags to a document's set of tags. Tags it already has are ignored; if nothing changes, no new version is written.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param tags body tagsRequest true "Tags to add"
+// @Param If-Match header string false "Only update if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "Document version"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/tags [post]
+func (ctrl *DocumentController) AddDocumentTags(c *gin.Context) {
+	var req tagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc, err := ctrl.service.AddDocumentTags(requestContext(c), c.Param("id"), req.Tags, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// RemoveDocumentTag godoc
+// @Summary Remove a tag from a document
+// @Description Remove one tag from a document. Removing a tag the document does not have changes nothing.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param tag path string true "Tag to remove"
+// @Param If-Match header string false "Only update if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "Document version"
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/tags/{tag} [delete]
+func (ctrl *DocumentController) RemoveDocumentTag(c *gin.Context) {
+	doc, err := ctrl.service.RemoveDocumentTags(requestContext(c), c.Param("id"), []string{c.Param("tag")}, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// moveDocumentRequest is the body of POST /documents/:id/move
+type moveDocumentRequest struct {
+	Collection string `json:"collection" binding:"required" example:"/contracts/2026"`
+}
+
+// MoveDocument godoc
+// @Summary Move a document to another collection
+// @Description Put a document into the collection at the given path; "/" is the root. Moving a document where it already is writes no new version.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param move body moveDocumentRequest true "Path of the target collection"
+// @Param If-Match header string false "Only move if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "Document version"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/move [post]
+func (ctrl *DocumentController) MoveDocument(c *gin.Context) {
+	var req moveDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc, err := ctrl.service.MoveDocument(requestContext(c), c.Param("id"), req.Collection, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
 // DeleteDocument godoc
 // @Summary Delete a document
 // @Description Delete a document by its ID
@@ -158,18 +544,477 @@ func (ctrl *DocumentController) PartialUpdateDocument(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path string true "Document ID"
+// @Param If-Match header string false "Only delete if the document still has one of these ETags"
 // @Success 204
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
 // @Security BearerAuth
 // @Router /api/v1/documents/{id} [delete]
 func (ctrl *DocumentController) DeleteDocument(c *gin.Context) {
 	id := c.Param("id")
 
-	if err := ctrl.service.DeleteDocument(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := ctrl.service.DeleteDocument(requestContext(c), id, ifMatchOptions(c)...); err != nil {
+		respondWithStoreError(c, err)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+// Modes of POST /documents:batch
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "best_effort"
+)
+
+// batchRequest is the body of POST /documents:batch
+type batchRequest struct {
+	// Mode is atomic (the default), applying every operation or none, or
+	// best_effort, applying each operation that succeeds
+	Mode       string                  `json:"mode" enums:"atomic,best_effort" example:"atomic"`
+	Operations []batchOperationRequest `json:"operations" binding:"required"`
+}
+
+// batchOperationRequest is one operation of a batch. Create takes the
+// document (with an optional id), update the replacing document and patch a
+// JSON Merge Patch object or a JSON Patch array.
+type batchOperationRequest struct {
+	Op       string           `json:"op" enums:"create,update,patch,delete" example:"create"`
+	ID       string           `json:"id,omitempty" example:"doc-1"`
+	Document *models.Document `json:"document,omitempty"`
+	Patch    json.RawMessage  `json:"patch,omitempty" swaggertype:"object"`
+	IfMatch  string           `json:"if_match,omitempty" example:"\"3\""`
+}
+
+// batchItemResult reports the outcome of one operation with the status code
+// it would have been answered with on its own
+type batchItemResult struct {
+	Status   int                 `json:"status" example:"201"`
+	ID       string              `json:"id,omitempty" example:"doc-1"`
+	Document *models.Document    `json:"document,omitempty"`
+	Error    string              `json:"error,omitempty"`
+	Errors   []models.FieldError `json:"errors,omitempty"`
+}
+
+// batchResponse lists the results in the order of the operations
+type batchResponse struct {
+	Results []batchItemResult `json:"results"`
+}
+
+// batchOperation turns one operation of the request into a store operation
+func batchOperation(req batchOperationRequest) (models.BatchOperation, error) {
+	op := models.BatchOperation{Op: req.Op, ID: req.ID, Options: parseIfMatch(req.IfMatch)}
+	if req.Op != models.BatchCreate && req.ID == "" {
+		return op, errors.New("id is required")
+	}
+	switch req.Op {
+	case models.BatchCreate, models.BatchUpdate:
+		if req.Document == nil {
+			return op, errors.New("document is required")
+		}
+		op.Document = *req.Document
+		if op.ID == "" {
+			op.ID = req.Document.ID
+		}
+	case models.BatchPatch:
+		data := bytes.TrimSpace(req.Patch)
+		var err error
+		switch {
+		case len(data) > 0 && data[0] == '{':
+			op.Patch, err = models.ParseMergePatch(data)
+		case len(data) > 0 && data[0] == '[':
+			op.Patch, err = models.ParseJSONPatch(data)
+		default:
+			err = errors.New("patch must be a JSON Merge Patch object or a JSON Patch array")
+		}
+		if err != nil {
+			return op, err
+		}
+	case models.BatchDelete:
+	default:
+		return op, fmt.Errorf("unknown op %q (must be create, update, patch or delete)", req.Op)
+	}
+	return op, nil
+}
+
+// BatchDocuments godoc
+// @Summary Create, update, patch and delete documents in bulk
+// @Description Perform up to 1000 operations in order, each seeing the outcome of those before it. In atomic mode (the default) they are applied all together under the store lock or, if any fails, not at all; the operations that would have succeeded then report 424. In best_effort mode every operation that succeeds is applied. Each result carries the status code the operation would have been answered with on its own. The answer is 200 if every operation succeeded and 207 otherwise.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param batch body batchRequest true "Operations to perform"
+// @Success 200 {object} batchResponse
+// @Success 207 {object} batchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents:batch [post]
+func (ctrl *DocumentController) BatchDocuments(c *gin.Context) {
+	// Gin reads the colon of /documents:batch as the start of a route
+	// parameter, so any other /documents:method lands here too
+	if c.Param("method") != ":batch" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown method " + c.Param("method")})
+		return
+	}
+	var req batchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	atomic := true
+	switch req.Mode {
+	case "", batchAtomic:
+	case batchBestEffort:
+		atomic = false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or best_effort"})
+		return
+	}
+	ops := make([]models.BatchOperation, len(req.Operations))
+	for i, item := range req.Operations {
+		op, err := batchOperation(item)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("operations[%d]: %v", i, err)})
+			return
+		}
+		ops[i] = op
+	}
+
+	results, err := ctrl.service.BatchDocuments(requestContext(c), ops, atomic)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	status, response := http.StatusOK, batchResponse{Results: make([]batchItemResult, len(results))}
+	for i, result := range results {
+		item := batchItemResult{ID: ops[i].ID}
+		switch {
+		case result.Err != nil:
+			status = http.StatusMultiStatus
+			item.Status = storeErrorStatus(result.Err)
+			var validationErr *models.ValidationError
+			if errors.As(result.Err, &validationErr) {
+				item.Errors = validationErr.Errors
+			}
+			item.Error = result.Err.Error()
+		case ops[i].Op == models.BatchCreate:
+			item.Status, item.Document = http.StatusCreated, &results[i].Document
+		case ops[i].Op == models.BatchDelete:
+			item.Status = http.StatusNoContent
+		default:
+			item.Status, item.Document = http.StatusOK, &results[i].Document
+		}
+		response.Results[i] = item
+	}
+	c.JSON(status, response)
+}
+
+// parseRevision reads the :rev path parameter, answering 400 when it is not a positive integer
+func parseRevision(c *gin.Context) (int64, bool) {
+	rev, err := strconv.ParseInt(c.Param("rev"), 10, 64)
+	if err != nil || rev < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "revision must be a positive integer"})
+		return 0, false
+	}
+	return rev, true
+}
+
+// ListDocumentVersions godoc
+// @Summary List document versions
+// @Description Get the revision history of a document, oldest first
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {array} models.Revision
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/versions [get]
+func (ctrl *DocumentController) ListDocumentVersions(c *gin.Context) {
+	history, err := ctrl.service.ListDocumentVersions(requestContext(c), c.Param("id"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetDocumentVersion godoc
+// @Summary Get a document version
+// @Description Get a single past revision of a document
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param rev path int true "Revision number"
+// @Success 200 {object} models.Revision
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/versions/{rev} [get]
+func (ctrl *DocumentController) GetDocumentVersion(c *gin.Context) {
+	rev, ok := parseRevision(c)
+	if !ok {
+		return
+	}
+
+	revision, err := ctrl.service.GetDocumentVersion(requestContext(c), c.Param("id"), rev)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// RestoreDocumentVersion godoc
+// @Summary Restore a document version
+// @Description Make a past revision current again; the restore is itself recorded as a new revision
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param rev path int true "Revision number"
+// @Param If-Match header string false "Only restore if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "New document version"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/versions/{rev}/restore [post]
+func (ctrl *DocumentController) RestoreDocumentVersion(c *gin.Context) {
+	rev, ok := parseRevision(c)
+	if !ok {
+		return
+	}
+
+	doc, err := ctrl.service.RestoreDocumentVersion(requestContext(c), c.Param("id"), rev, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// contentUpload returns the body of a content upload and its media type. A
+// multipart/form-data request contributes its "file" part; any other body is
+// taken as the content itself.
+func contentUpload(c *gin.Context) (io.Reader, string, error) {
+	contentType := c.GetHeader("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, contentType, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", errors.New(`multipart upload has no "file" part`)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() == "file" {
+			return part, part.Header.Get("Content-Type"), nil
+		}
+	}
+}
+
+// UploadDocumentContent godoc
+// @Summary Upload document content
+// @Description Replace the binary content of a document with the request body, or with the "file" part of a multipart/form-data request. The content type, size and SHA-256 are recorded on the document as a new revision.
+// @Tags documents
+// @Accept application/octet-stream,multipart/form-data
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param If-Match header string false "Only upload if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "New document version"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/content [put]
+func (ctrl *DocumentController) UploadDocumentContent(c *gin.Context) {
+	body, contentType, err := contentUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc, err := ctrl.service.UploadDocumentContent(requestContext(c), c.Param("id"), contentType, body, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// DownloadDocumentContent godoc
+// @Summary Download document content
+// @Description Stream the binary content of a document. Single and multiple byte ranges are supported through the Range header; the ETag is the content's SHA-256.
+// @Tags documents
+// @Produce application/octet-stream
+// @Param id path string true "Document ID"
+// @Param Range header string false "Byte ranges to return, e.g. bytes=0-1023"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 416 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/content [get]
+func (ctrl *DocumentController) DownloadDocumentContent(c *gin.Context) {
+	content, err := ctrl.service.OpenDocumentContent(requestContext(c), c.Param("id"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	defer content.Close()
+
+	// ServeContent answers Range, If-Range and If-None-Match requests and
+	// sets Content-Length; with Content-Type set it does not sniff the body
+	c.Header("Content-Type", content.Document.ContentType)
+	c.Header("ETag", `"`+content.Document.ContentSHA256+`"`)
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, content)
+}
+
+// grantAccessRequest is the body of GrantDocumentAccess
+type grantAccessRequest struct {
+	// Principal is "user:<username>" or "group:<group>"
+	Principal string `json:"principal" binding:"required" example:"group:finance"`
+	// Level is read or write
+	Level string `json:"level" binding:"required" example:"read"`
+}
+
+// setOwnerRequest is the body of SetDocumentOwner
+type setOwnerRequest struct {
+	// Owner is the username of the new owner
+	Owner string `json:"owner" binding:"required" example:"alice"`
+}
+
+// GetDocumentACL godoc
+// @Summary Get who a document is shared with
+// @Description Get the owner of a document, the user who created it unless it was given to someone else since, and the users and groups it is shared with besides them. Documents written before authors were recorded, and those of deleted users, have no owner.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Success 200 {object} models.ACL
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/acl [get]
+func (ctrl *DocumentController) GetDocumentACL(c *gin.Context) {
+	acl, err := ctrl.service.GetDocumentACL(requestContext(c), c.Param("id"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, acl)
+}
+
+// GrantDocumentAccess godoc
+// @Summary Share a document
+// @Description Share a document with a user or group at read or write level, replacing what they were granted before. Write access lets them change and delete the document but not share it. Only the owner and admins may share a document.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param grant body grantAccessRequest true "Principal and level to grant"
+// @Success 200 {object} models.ACL
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/acl [post]
+func (ctrl *DocumentController) GrantDocumentAccess(c *gin.Context) {
+	var req grantAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	acl, err := ctrl.service.GrantDocumentAccess(requestContext(c), c.Param("id"), req.Principal, req.Level)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, acl)
+}
+
+// RevokeDocumentAccess godoc
+// @Summary Stop sharing a document
+// @Description Remove the access granted to a user or group. Only the owner and admins may change who a document is shared with.
+// @Tags documents
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param principal path string true "Principal to revoke, e.g. user:bob or group:finance"
+// @Success 200 {object} models.ACL
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/acl/{principal} [delete]
+func (ctrl *DocumentController) RevokeDocumentAccess(c *gin.Context) {
+	acl, err := ctrl.service.RevokeDocumentAccess(requestContext(c), c.Param("id"), c.Param("principal"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, acl)
+}
+
+// SetDocumentOwner godoc
+// @Summary Give a document to another user
+// @Description Make an existing user the owner of a document. The owner may hand a document over; admins may also give an owner to documents that have none, such as those written before authors were recorded or owned by a deleted user.
+// @Tags documents
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param owner body setOwnerRequest true "New owner"
+// @Success 200 {object} models.ACL
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/owner [put]
+func (ctrl *DocumentController) SetDocumentOwner(c *gin.Context) {
+	var req setOwnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	acl, err := ctrl.service.SetDocumentOwner(requestContext(c), c.Param("id"), req.Owner)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, acl)
+}
@@ -2,11 +2,18 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"docstore-api/src/models"
 	"docstore-api/src/services"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -77,6 +84,40 @@ func TestDocumentController_CreateDocument(t *testing.T) {
 		router.ServeHTTP(w2, req2)
 		assert.Equal(t, http.StatusConflict, w2.Code)
 	})
+
+	t.Run("Generated ID", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/documents", bytes.NewBufferString(`{"name": "No ID"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var response models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.NotEmpty(t, response.ID)
+		assert.Equal(t, "No ID", response.Name)
+		assert.Equal(t, "/api/v1/documents/"+response.ID, w.Header().Get("Location"))
+	})
+
+	t.Run("Client ID sets Location", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/documents", bytes.NewBufferString(`{"id": "located", "name": "Mine"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v1/documents/located", w.Header().Get("Location"))
+	})
+
+	t.Run("Empty or invalid ID", func(t *testing.T) {
+		for _, body := range []string{`{"id": "", "name": "Empty"}`, `{"id": "a/b"}`, `{"id": ".."}`} {
+			req, _ := http.NewRequest("POST", "/documents", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Contains(t, w.Body.String(), "invalid document id")
+		}
+	})
 }
 func TestDocumentController_GetDocument(t *testing.T) {
 	router, controller := setupTestRouter()
@@ -129,10 +170,12 @@ func TestDocumentController_ListDocuments(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response []models.Document
+		var response models.DocumentPage
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, 0, len(response))
+		assert.Equal(t, 0, len(response.Documents))
+		assert.Equal(t, 0, response.Total)
+		assert.Empty(t, response.NextCursor)
 	})
 
 	t.Run("List with documents", func(t *testing.T) {
@@ -156,10 +199,77 @@ func TestDocumentController_ListDocuments(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 
-		var response []models.Document
+		var response models.DocumentPage
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		assert.NoError(t, err)
-		assert.Equal(t, 2, len(response))
+		assert.Equal(t, 2, len(response.Documents))
+		assert.Equal(t, 2, response.Total)
+	})
+
+	t.Run("Paginated and sorted", func(t *testing.T) {
+		for _, doc := range []models.Document{{ID: "list-3", Name: "A"}, {ID: "list-4", Name: "B"}} {
+			jsonData, _ := json.Marshal(doc)
+			createReq, _ := http.NewRequest("POST", "/documents", bytes.NewBuffer(jsonData))
+			createReq.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(httptest.NewRecorder(), createReq)
+		}
+
+		var ids []string
+		path := "/documents?limit=3&sort=-name"
+		for pages := 0; path != ""; pages++ {
+			req, _ := http.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response models.DocumentPage
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, 4, response.Total)
+			for _, doc := range response.Documents {
+				ids = append(ids, doc.ID)
+			}
+
+			path = ""
+			if response.NextCursor != "" {
+				assert.Equal(t, 0, pages, "expected exactly two pages")
+				path = "/documents?limit=3&sort=-name&cursor=" + response.NextCursor
+			}
+		}
+		assert.Equal(t, []string{"list-2", "list-1", "list-4", "list-3"}, ids)
+	})
+
+	t.Run("Filtered", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/documents?filter="+url.QueryEscape(`name:prefix:doc AND NOT id=list-1`), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.DocumentPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Total)
+		assert.Equal(t, "list-2", response.Documents[0].ID)
+	})
+
+	t.Run("Invalid filter", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/documents?filter="+url.QueryEscape(`name=a AND size>3`), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, float64(12), response["position"])
+		assert.Equal(t, "size>3", response["token"])
+		assert.Contains(t, response["error"], "unknown field")
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=abc", "sort=size", "cursor=not-a-cursor"} {
+			req, _ := http.NewRequest("GET", "/documents?"+query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
 	})
 }
 func TestDocumentController_UpdateDocument(t *testing.T) {
@@ -233,6 +343,7 @@ func TestDocumentController_PartialUpdateDocument(t *testing.T) {
 	router, controller := setupTestRouter()
 	router.PATCH("/documents/:id", controller.PartialUpdateDocument)
 	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents/:id", controller.GetDocument)
 
 	// Create a test document first
 	originalDoc := models.Document{
@@ -334,6 +445,34 @@ func TestDocumentController_PartialUpdateDocument(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	t.Run("Invalid fields", func(t *testing.T) {
+		body := `{"name": 42, "description": "Valid but not applied", "version": 9, "colour": "red"}`
+		req, _ := http.NewRequest("PATCH", "/documents/patch-test-1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var response struct {
+			Errors []models.FieldError `json:"errors"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		fields := make([]string, len(response.Errors))
+		for i, fe := range response.Errors {
+			fields[i] = fe.Field
+		}
+		assert.Equal(t, []string{"colour", "name", "version"}, fields)
+
+		// Nothing was applied
+		req, _ = http.NewRequest("GET", "/documents/patch-test-1", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "Both Updated Description", doc.Description)
+	})
 }
 func TestDocumentController_DeleteDocument(t *testing.T) {
 	router, controller := setupTestRouter()
@@ -375,3 +514,765 @@ func TestDocumentController_DeleteDocument(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
+
+// failingStore is a models.Store whose operations fail with a backend error.
+// Methods not overridden here panic through the nil embedded interface.
+type failingStore struct {
+	models.Store
+}
+
+var errBackendDown = errors.New("backend unavailable")
+
+func (failingStore) Get(ctx context.Context, id string) (models.Document, error) {
+	return models.Document{}, errBackendDown
+}
+func (failingStore) List(ctx context.Context, opts models.ListOptions) (models.DocumentPage, error) {
+	return models.DocumentPage{}, errBackendDown
+}
+func (failingStore) Delete(ctx context.Context, id string, opts ...models.WriteOption) error {
+	return errBackendDown
+}
+func (failingStore) ListRevisions(ctx context.Context, id string) ([]models.Revision, error) {
+	return nil, errBackendDown
+}
+
+func TestDocumentController_StoreFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controller := NewDocumentController(services.NewDocumentService(failingStore{}))
+	router := gin.New()
+	router.GET("/documents", controller.ListDocuments)
+	router.GET("/documents/:id", controller.GetDocument)
+	router.DELETE("/documents/:id", controller.DeleteDocument)
+	router.GET("/documents/:id/versions", controller.ListDocumentVersions)
+
+	for _, tc := range []struct{ method, path string }{
+		{"GET", "/documents"},
+		{"GET", "/documents/1"},
+		{"DELETE", "/documents/1"},
+		{"GET", "/documents/1/versions"},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestDocumentController_DocumentVersions(t *testing.T) {
+	router, controller := setupTestRouter()
+	// Stand-in for JWTAuthMiddleware
+	router.Use(func(c *gin.Context) {
+		c.Set("username", "alice")
+		c.Next()
+	})
+	router.POST("/documents", controller.CreateDocument)
+	router.PUT("/documents/:id", controller.UpdateDocument)
+	router.GET("/documents/:id/versions", controller.ListDocumentVersions)
+	router.GET("/documents/:id/versions/:rev", controller.GetDocumentVersion)
+	router.POST("/documents/:id/versions/:rev/restore", controller.RestoreDocumentVersion)
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	send("POST", "/documents", models.Document{ID: "v-1", Name: "Original"})
+	send("PUT", "/documents/v-1", models.Document{ID: "v-1", Name: "Edited"})
+
+	t.Run("List versions", func(t *testing.T) {
+		w := send("GET", "/documents/v-1/versions", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var history []models.Revision
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		assert.Equal(t, 2, len(history))
+		assert.Equal(t, "alice", history[0].Author)
+		assert.Equal(t, "Edited", history[1].Document.Name)
+	})
+
+	t.Run("Get version", func(t *testing.T) {
+		w := send("GET", "/documents/v-1/versions/1", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var rev models.Revision
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rev))
+		assert.Equal(t, int64(1), rev.Revision)
+		assert.Equal(t, "Original", rev.Document.Name)
+	})
+
+	t.Run("Invalid and unknown versions", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/documents/v-1/versions/abc", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, send("GET", "/documents/v-1/versions/0", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/documents/v-1/versions/99", nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/documents/nope/versions", nil).Code)
+	})
+
+	t.Run("Restore version", func(t *testing.T) {
+		w := send("POST", "/documents/v-1/versions/1/restore", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "Original", doc.Name)
+
+		w = send("GET", "/documents/v-1/versions", nil)
+		var history []models.Revision
+		json.Unmarshal(w.Body.Bytes(), &history)
+		assert.Equal(t, 3, len(history))
+	})
+}
+
+func TestDocumentController_ConditionalRequests(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents/:id", controller.GetDocument)
+	router.PUT("/documents/:id", controller.UpdateDocument)
+	router.PATCH("/documents/:id", controller.PartialUpdateDocument)
+	router.DELETE("/documents/:id", controller.DeleteDocument)
+
+	send := func(method, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/documents", models.Document{ID: "c-1", Name: "Original", Version: 41}, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	t.Run("GET returns ETag", func(t *testing.T) {
+		w := send("GET", "/documents/c-1", nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, int64(1), doc.Version)
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		w := send("GET", "/documents/c-1", nil, map[string]string{"If-None-Match": `"7", W/"1"`})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+
+		assert.Equal(t, http.StatusNotModified, send("GET", "/documents/c-1", nil, map[string]string{"If-None-Match": "*"}).Code)
+		assert.Equal(t, http.StatusOK, send("GET", "/documents/c-1", nil, map[string]string{"If-None-Match": `"2"`}).Code)
+	})
+
+	t.Run("PUT with stale If-Match", func(t *testing.T) {
+		w := send("PUT", "/documents/c-1", models.Document{Name: "Clobbered"}, map[string]string{"If-Match": `"2"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		// Weak tags never satisfy If-Match
+		w = send("PUT", "/documents/c-1", models.Document{Name: "Clobbered"}, map[string]string{"If-Match": `W/"1"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("PUT with current If-Match", func(t *testing.T) {
+		w := send("PUT", "/documents/c-1", models.Document{Name: "Edited"}, map[string]string{"If-Match": `"1"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("PATCH honours If-Match", func(t *testing.T) {
+		updates := map[string]interface{}{"description": "Patched"}
+		assert.Equal(t, http.StatusPreconditionFailed,
+			send("PATCH", "/documents/c-1", updates, map[string]string{"If-Match": `"1"`}).Code)
+
+		w := send("PATCH", "/documents/c-1", updates, map[string]string{"If-Match": `"1", "2"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+		w = send("PATCH", "/documents/c-1", updates, map[string]string{"If-Match": "*"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("DELETE honours If-Match", func(t *testing.T) {
+		assert.Equal(t, http.StatusPreconditionFailed,
+			send("DELETE", "/documents/c-1", nil, map[string]string{"If-Match": `"3"`}).Code)
+		assert.Equal(t, http.StatusNoContent,
+			send("DELETE", "/documents/c-1", nil, map[string]string{"If-Match": `"4"`}).Code)
+	})
+	t.Run("Recreated document gets new ETags", func(t *testing.T) {
+		w := send("POST", "/documents", models.Document{ID: "c-1", Name: "Reborn"}, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+
+		assert.Equal(t, http.StatusOK, send("GET", "/documents/c-1", nil, map[string]string{"If-None-Match": `"1"`}).Code)
+		assert.Equal(t, http.StatusPreconditionFailed,
+			send("PUT", "/documents/c-1", models.Document{Name: "Clobbered"}, map[string]string{"If-Match": `"1"`}).Code)
+	})
+}
+
+func TestDocumentController_Metadata(t *testing.T) {
+	router, controller := setupTestRouter()
+	// Stand-in for JWTAuthMiddleware, taking the user from a test header.
+	// They are admins, so that every user can edit every document.
+	router.Use(func(c *gin.Context) {
+		c.Set("username", c.GetHeader("X-Test-User"))
+		c.Set("role", models.RoleAdmin)
+		c.Next()
+	})
+	router.POST("/documents", controller.CreateDocument)
+	router.PUT("/documents/:id", controller.UpdateDocument)
+	router.PATCH("/documents/:id", controller.PartialUpdateDocument)
+
+	send := func(method, path, user string, body interface{}) models.Document {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Less(t, w.Code, 300, "%s %s: %s", method, path, w.Body.String())
+
+		var doc models.Document
+		json.Unmarshal(w.Body.Bytes(), &doc)
+		return doc
+	}
+
+	created := send("POST", "/documents", "alice", map[string]interface{}{
+		"id": "m-1", "name": "Original", "created_by": "mallory", "created_at": "2000-01-01T00:00:00Z",
+	})
+	assert.Equal(t, "alice", created.CreatedBy)
+	assert.Equal(t, "alice", created.UpdatedBy)
+	assert.False(t, created.CreatedAt.IsZero())
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	t.Run("PUT cannot overwrite metadata", func(t *testing.T) {
+		doc := send("PUT", "/documents/m-1", "bob", map[string]interface{}{
+			"name": "Edited", "created_by": "mallory", "updated_by": "mallory", "created_at": "2000-01-01T00:00:00Z",
+		})
+		assert.Equal(t, "alice", doc.CreatedBy)
+		assert.Equal(t, "bob", doc.UpdatedBy)
+		assert.True(t, doc.CreatedAt.Equal(created.CreatedAt))
+		assert.False(t, doc.UpdatedAt.Before(created.UpdatedAt))
+	})
+
+	t.Run("PATCH cannot overwrite metadata", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"description": "Forged", "created_by": "mallory", "updated_at": "2000-01-01T00:00:00Z",
+		})
+		req, _ := http.NewRequest("PATCH", "/documents/m-1", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		doc := send("PATCH", "/documents/m-1", "carol", map[string]interface{}{"description": "Patched"})
+		assert.Equal(t, "Patched", doc.Description)
+		assert.Equal(t, "alice", doc.CreatedBy)
+		assert.Equal(t, "carol", doc.UpdatedBy)
+		assert.True(t, doc.CreatedAt.Equal(created.CreatedAt))
+	})
+}
+
+func TestDocumentController_SearchDocuments(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents/search", controller.SearchDocuments)
+
+	for _, doc := range []models.Document{
+		{ID: "s-1", Name: "Getting Started", Description: "A guide to getting started"},
+		{ID: "s-2", Name: "API Reference", Description: "Everything about getting documents"},
+	} {
+		jsonData, _ := json.Marshal(doc)
+		req, _ := http.NewRequest("POST", "/documents", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Ranked results", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/documents/search?q=getting", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResults
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 2, response.Total)
+		assert.Equal(t, "s-1", response.Results[0].Document.ID)
+		assert.Equal(t, "<mark>Getting</mark> Started", response.Results[0].Highlights["name"])
+	})
+
+	t.Run("Phrase and limit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/documents/search?limit=1&q="+url.QueryEscape(`"getting documents"`), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.SearchResults
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 1, response.Total)
+		assert.Equal(t, "s-2", response.Results[0].Document.ID)
+	})
+
+	t.Run("Invalid queries", func(t *testing.T) {
+		for _, query := range []string{"", "q=", "q=%22open", "q=x&limit=0"} {
+			req, _ := http.NewRequest("GET", "/documents/search?"+query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+}
+
+func TestDocumentController_Content(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.POST("/documents", controller.CreateDocument)
+	router.PUT("/documents/:id/content", controller.UploadDocumentContent)
+	router.GET("/documents/:id/content", controller.DownloadDocumentContent)
+	router.HEAD("/documents/:id/content", controller.DownloadDocumentContent)
+
+	send := func(method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, body)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	created, _ := json.Marshal(models.Document{ID: "f-1", Name: "Attachment"})
+	send("POST", "/documents", bytes.NewReader(created), map[string]string{"Content-Type": "application/json"})
+
+	t.Run("Download before upload", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send("GET", "/documents/f-1/content", nil, nil).Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/documents/nope/content", nil, nil).Code)
+	})
+
+	t.Run("Raw upload", func(t *testing.T) {
+		w := send("PUT", "/documents/f-1/content", strings.NewReader("0123456789"), map[string]string{"Content-Type": "text/plain"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "text/plain", doc.ContentType)
+		assert.Equal(t, int64(10), doc.ContentSize)
+		assert.Equal(t, "84d89877f0d4041efb6bf91a16f0248f2fd573e6af05c19f96bedb9f882f7882", doc.ContentSHA256)
+	})
+
+	t.Run("Full download", func(t *testing.T) {
+		w := send("GET", "/documents/f-1/content", nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+		assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		assert.Equal(t, "10", w.Header().Get("Content-Length"))
+		assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+
+		w = send("HEAD", "/documents/f-1/content", nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	})
+
+	t.Run("Range download", func(t *testing.T) {
+		w := send("GET", "/documents/f-1/content", nil, map[string]string{"Range": "bytes=2-5"})
+		assert.Equal(t, http.StatusPartialContent, w.Code)
+		assert.Equal(t, "2345", w.Body.String())
+		assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+		assert.Equal(t, "4", w.Header().Get("Content-Length"))
+
+		w = send("GET", "/documents/f-1/content", nil, map[string]string{"Range": "bytes=-3"})
+		assert.Equal(t, "789", w.Body.String())
+
+		w = send("GET", "/documents/f-1/content", nil, map[string]string{"Range": "bytes=50-"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+
+		// A range for content that has since changed returns the whole body
+		w = send("GET", "/documents/f-1/content", nil, map[string]string{"Range": "bytes=2-5", "If-Range": `"stale"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "0123456789", w.Body.String())
+	})
+
+	t.Run("Multipart upload", func(t *testing.T) {
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		form.WriteField("comment", "ignored")
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="logo.png"`)
+		header.Set("Content-Type", "image/png")
+		part, _ := form.CreatePart(header)
+		part.Write([]byte("\x89PNG"))
+		form.Close()
+
+		w := send("PUT", "/documents/f-1/content", &buf, map[string]string{"Content-Type": form.FormDataContentType()})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = send("GET", "/documents/f-1/content", nil, nil)
+		assert.Equal(t, "\x89PNG", w.Body.String())
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	})
+
+	t.Run("Multipart upload without file", func(t *testing.T) {
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		form.WriteField("comment", "no file")
+		form.Close()
+
+		w := send("PUT", "/documents/f-1/content", &buf, map[string]string{"Content-Type": form.FormDataContentType()})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Upload honours If-Match", func(t *testing.T) {
+		w := send("PUT", "/documents/f-1/content", strings.NewReader("late"), map[string]string{"If-Match": `"1"`})
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, http.StatusNotFound, send("PUT", "/documents/nope/content", strings.NewReader("x"), nil).Code)
+	})
+}
+
+func TestDocumentController_PatchFormats(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.PATCH("/documents/:id", controller.PartialUpdateDocument)
+	router.POST("/documents", controller.CreateDocument)
+
+	createReq, _ := http.NewRequest("POST", "/documents", strings.NewReader(`{"id": "p-1", "name": "Name", "description": "Description"}`))
+	createReq.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), createReq)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/documents/p-1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Merge patch", func(t *testing.T) {
+		w := patch("application/merge-patch+json", `{"name": "Merged", "description": null}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "Merged", doc.Name)
+		assert.Equal(t, "", doc.Description)
+	})
+
+	t.Run("JSON patch", func(t *testing.T) {
+		w := patch("application/json-patch+json; charset=utf-8", `[
+			{"op": "test", "path": "/name", "value": "Merged"},
+			{"op": "add", "path": "/description", "value": "Patched"}
+		]`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "Patched", doc.Description)
+		assert.Equal(t, int64(3), doc.Version)
+	})
+
+	t.Run("Failed test operation", func(t *testing.T) {
+		w := patch("application/json-patch+json", `[{"op": "test", "path": "/name", "value": "Name"}]`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Invalid patch", func(t *testing.T) {
+		w := patch("application/json-patch+json", `{"op": "add"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = patch("application/merge-patch+json", `[]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid fields", func(t *testing.T) {
+		w := patch("application/json-patch+json", `[{"op": "add", "path": "/version", "value": 9}]`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"version"`)
+	})
+
+	t.Run("Unsupported media type", func(t *testing.T) {
+		w := patch("text/plain", `name=x`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Contains(t, w.Header().Get("Accept-Patch"), "application/json-patch+json")
+	})
+}
+
+func TestDocumentController_TagsAndMetadata(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents", controller.ListDocuments)
+	router.POST("/documents/:id/tags", controller.AddDocumentTags)
+	router.DELETE("/documents/:id/tags/:tag", controller.RemoveDocumentTag)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	listIDs := func(query string) []string {
+		w := send("GET", "/documents?"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page models.DocumentPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		ids := []string{}
+		for _, doc := range page.Documents {
+			ids = append(ids, doc.ID)
+		}
+		return ids
+	}
+
+	w := send("POST", "/documents", `{"id": "m-1", "name": "Contract", "metadata": {"customer": "acme"}, "tags": ["legal"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	send("POST", "/documents", `{"id": "m-2", "name": "Invoice", "metadata": {"customer": "globex"}}`)
+
+	t.Run("Invalid labels", func(t *testing.T) {
+		w := send("POST", "/documents", `{"id": "m-3", "tags": ["has space"]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("Add tags", func(t *testing.T) {
+		w := send("POST", "/documents/m-2/tags", `{"tags": ["finance", "legal"]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, []string{"finance", "legal"}, doc.Tags)
+
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/documents/m-2/tags", `{}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("POST", "/documents/none/tags", `{"tags": ["x"]}`).Code)
+	})
+
+	t.Run("Filter by tag and metadata", func(t *testing.T) {
+		assert.Equal(t, []string{"m-1", "m-2"}, listIDs("tag=legal"))
+		assert.Equal(t, []string{"m-2"}, listIDs("tag=legal&tag=finance"))
+		assert.Equal(t, []string{"m-1"}, listIDs("tag=legal&metadata[customer]=acme"))
+		assert.Equal(t, []string{}, listIDs("metadata[customer]=initech"))
+	})
+
+	t.Run("Remove tag", func(t *testing.T) {
+		w := send("DELETE", "/documents/m-2/tags/legal", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+		// Removing it again changes nothing
+		w = send("DELETE", "/documents/m-2/tags/legal", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+		assert.Equal(t, []string{"m-1"}, listIDs("tag=legal"))
+	})
+}
+
+func TestDocumentController_BatchDocuments(t *testing.T) {
+	router, controller := setupTestRouter()
+	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents/:id", controller.GetDocument)
+	router.POST("/documents:method", controller.BatchDocuments)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	batch := func(body string) (int, []batchItemResult) {
+		w := send("POST", "/documents:batch", body)
+		var response batchResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Results
+	}
+	statuses := func(results []batchItemResult) []int {
+		codes := make([]int, len(results))
+		for i, result := range results {
+			codes[i] = result.Status
+		}
+		return codes
+	}
+	send("POST", "/documents", `{"id": "b-1", "name": "First"}`)
+
+	t.Run("Atomic", func(t *testing.T) {
+		code, results := batch(`{"operations": [
+			{"op": "create", "document": {"id": "b-2", "name": "Second"}},
+			{"op": "create", "document": {"name": "Generated"}},
+			{"op": "patch", "id": "b-2", "patch": {"description": "merged"}},
+			{"op": "update", "id": "b-1", "if_match": "\"1\"", "document": {"name": "First v2"}}
+		]}`)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []int{201, 201, 200, 200}, statuses(results))
+		assert.NotEmpty(t, results[1].ID)
+		assert.Equal(t, int64(2), results[2].Document.Version)
+		assert.Equal(t, "merged", results[2].Document.Description)
+		assert.Equal(t, http.StatusOK, send("GET", "/documents/"+results[1].ID, "").Code)
+	})
+
+	t.Run("Atomic failure applies nothing", func(t *testing.T) {
+		code, results := batch(`{"mode": "atomic", "operations": [
+			{"op": "delete", "id": "b-1"},
+			{"op": "patch", "id": "b-2", "patch": [{"op": "test", "path": "/name", "value": "Other"}]},
+			{"op": "create", "document": {"id": "b-1", "tags": ["has space"]}}
+		]}`)
+		assert.Equal(t, http.StatusMultiStatus, code)
+		assert.Equal(t, []int{424, 409, 422}, statuses(results))
+		assert.NotEmpty(t, results[2].Errors)
+		assert.Equal(t, http.StatusOK, send("GET", "/documents/b-1", "").Code)
+	})
+
+	t.Run("Best effort", func(t *testing.T) {
+		code, results := batch(`{"mode": "best_effort", "operations": [
+			{"op": "delete", "id": "b-1"},
+			{"op": "delete", "id": "b-1"},
+			{"op": "update", "id": "b-2", "if_match": "\"1\"", "document": {"name": "Stale"}}
+		]}`)
+		assert.Equal(t, http.StatusMultiStatus, code)
+		assert.Equal(t, []int{204, 404, 412}, statuses(results))
+		assert.Equal(t, http.StatusNotFound, send("GET", "/documents/b-1", "").Code)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, body := range []string{
+			`{}`,
+			`{"operations": []}`,
+			`{"mode": "eventual", "operations": [{"op": "delete", "id": "b-2"}]}`,
+			`{"operations": [{"op": "rename", "id": "b-2"}]}`,
+			`{"operations": [{"op": "update", "id": "b-2"}]}`,
+			`{"operations": [{"op": "delete"}]}`,
+			`{"operations": [{"op": "patch", "id": "b-2", "patch": "name"}]}`,
+		} {
+			code, _ := batch(body)
+			assert.Equal(t, http.StatusBadRequest, code, body)
+		}
+		assert.Equal(t, http.StatusNotFound, send("POST", "/documents:import", `{}`).Code)
+	})
+}
+
+func TestDocumentController_Sharing(t *testing.T) {
+	router, controller := setupTestRouter()
+	// Stands in for JWTAuthMiddleware, taking the user from the headers
+	router.Use(func(c *gin.Context) {
+		c.Set("username", c.GetHeader("X-User"))
+		c.Set("role", c.GetHeader("X-Role"))
+		if groups := c.GetHeader("X-Groups"); groups != "" {
+			c.Set("groups", strings.Split(groups, ","))
+		}
+	})
+	router.POST("/documents", controller.CreateDocument)
+	router.GET("/documents", controller.ListDocuments)
+	router.GET("/documents/:id", controller.GetDocument)
+	router.PUT("/documents/:id", controller.UpdateDocument)
+	router.GET("/documents/:id/acl", controller.GetDocumentACL)
+	router.POST("/documents/:id/acl", controller.GrantDocumentAccess)
+	router.DELETE("/documents/:id/acl/:principal", controller.RevokeDocumentAccess)
+
+	send := func(user, method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		role, groups, _ := strings.Cut(user, "@")
+		if role == "root" {
+			req.Header.Set("X-User", "root")
+			req.Header.Set("X-Role", models.RoleAdmin)
+		} else {
+			req.Header.Set("X-User", role)
+			req.Header.Set("X-Role", models.RoleEditor)
+			req.Header.Set("X-Groups", groups)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	listed := func(user string) int {
+		var page models.DocumentPage
+		assert.NoError(t, json.Unmarshal(send(user, "GET", "/documents", "").Body.Bytes(), &page))
+		return page.Total
+	}
+
+	assert.Equal(t, http.StatusCreated, send("alice", "POST", "/documents", `{"id": "report", "name": "Report"}`).Code)
+	assert.Equal(t, http.StatusCreated, send("alice", "POST", "/documents", `{"id": "notes", "name": "Notes"}`).Code)
+	assert.Equal(t, http.StatusNotFound, send("bob", "GET", "/documents/report", "").Code)
+	assert.Equal(t, 0, listed("bob"))
+
+	t.Run("Grant", func(t *testing.T) {
+		w := send("alice", "POST", "/documents/report/acl", `{"principal": "user:bob", "level": "read"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var acl models.ACL
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &acl))
+		assert.Equal(t, "alice", acl.Owner)
+		assert.Len(t, acl.Grants, 1)
+		assert.Equal(t, http.StatusOK, send("alice", "POST", "/documents/report/acl", `{"principal": "group:finance", "level": "write"}`).Code)
+
+		assert.Equal(t, http.StatusBadRequest, send("alice", "POST", "/documents/report/acl", `{"principal": "bob", "level": "read"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("alice", "POST", "/documents/report/acl", `{"principal": "user:bob", "level": "owner"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("alice", "POST", "/documents/report/acl", `{"principal": "user:bob"}`).Code)
+		assert.Equal(t, http.StatusForbidden, send("bob", "POST", "/documents/report/acl", `{"principal": "user:bob", "level": "write"}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("bob", "POST", "/documents/notes/acl", `{"principal": "user:bob", "level": "read"}`).Code)
+	})
+
+	t.Run("Enforce", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("bob", "GET", "/documents/report", "").Code)
+		assert.Equal(t, http.StatusOK, send("bob", "GET", "/documents/report/acl", "").Code)
+		assert.Equal(t, http.StatusForbidden, send("bob", "PUT", "/documents/report", `{"name": "Mine"}`).Code)
+		assert.Equal(t, http.StatusOK, send("carol@finance", "PUT", "/documents/report", `{"name": "Q3 report"}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("carol@finance", "GET", "/documents/notes", "").Code)
+
+		assert.Equal(t, 2, listed("alice"))
+		assert.Equal(t, 1, listed("bob"))
+		assert.Equal(t, 1, listed("carol@finance"))
+		assert.Equal(t, 0, listed("dave@legal"))
+		assert.Equal(t, 2, listed("root"))
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, send("carol@finance", "DELETE", "/documents/report/acl/user:bob", "").Code)
+		assert.Equal(t, http.StatusOK, send("root", "DELETE", "/documents/report/acl/user:bob", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("alice", "DELETE", "/documents/report/acl/user:bob", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("bob", "GET", "/documents/report", "").Code)
+	})
+}
+
+func TestDocumentController_SetDocumentOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := models.NewDocumentStore()
+	controller := NewDocumentController(services.NewDocumentService(store))
+	store.CreateUser(context.Background(), models.User{Username: "bob"})
+	store.Create(models.WithActor(context.Background(), "alice"), models.Document{ID: "report", Name: "Report"})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("username", c.GetHeader("X-User"))
+		c.Set("role", models.RoleEditor)
+	})
+	router.PUT("/documents/:id/owner", controller.SetDocumentOwner)
+	send := func(user, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("alice", "/documents/report/owner", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("alice", "/documents/report/owner", `{"owner": "mallory"}`).Code)
+	assert.Equal(t, http.StatusNotFound, send("bob", "/documents/report/owner", `{"owner": "bob"}`).Code)
+	assert.Equal(t, http.StatusNotFound, send("alice", "/documents/missing/owner", `{"owner": "bob"}`).Code)
+
+	w := send("alice", "/documents/report/owner", `{"owner": "bob"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var acl models.ACL
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &acl))
+	assert.Equal(t, "bob", acl.Owner)
+	assert.Equal(t, http.StatusNotFound, send("alice", "/documents/report/owner", `{"owner": "alice"}`).Code)
+}
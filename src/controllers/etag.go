@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag renders a document version as a strong entity tag
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag advertises the version of the document being returned
+func setETag(c *gin.Context, doc models.Document) {
+	c.Header("ETag", etag(doc.Version))
+}
+
+// parseETag extracts the version from a single entity tag. Weak tags
+// (W/"3") are reported so callers can apply strong or weak comparison.
+func parseETag(tag string) (version int64, weak bool, ok bool) {
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "W/") {
+		weak = true
+		tag = tag[2:]
+	}
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, weak, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, weak, false
+	}
+	return version, weak, true
+}
+
+// ifMatchOptions turns an If-Match header into store write options
+func ifMatchOptions(c *gin.Context) []models.WriteOption {
+	return parseIfMatch(c.GetHeader("If-Match"))
+}
+
+// parseIfMatch turns a list of entity tags into store write options. "*"
+// only requires the document to exist, which every write to it already
+// does. Entity tags are compared strongly, so weak or malformed tags never
+// match.
+func parseIfMatch(header string) []models.WriteOption {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		if version, weak, ok := parseETag(tag); ok && !weak {
+			versions = append(versions, version)
+		}
+	}
+	return []models.WriteOption{models.IfMatch(versions...)}
+}
+
+// notModified reports whether the If-None-Match header matches doc, using
+// weak comparison as required for GET
+func notModified(c *gin.Context, doc models.Document) bool {
+	header := strings.TrimSpace(c.GetHeader("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if version, _, ok := parseETag(tag); ok && version == doc.Version {
+			return true
+		}
+	}
+	return false
+}
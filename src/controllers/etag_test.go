@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETag(t *testing.T) {
+	tests := []struct {
+		tag     string
+		version int64
+		weak    bool
+		ok      bool
+	}{
+		{`"3"`, 3, false, true},
+		{` W/"12" `, 12, true, true},
+		{`3`, 0, false, false},
+		{`"abc"`, 0, false, false},
+		{`"0"`, 0, false, false},
+		{`""`, 0, false, false},
+		{`W/`, 0, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			version, weak, ok := parseETag(tt.tag)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.weak, weak)
+			if tt.ok {
+				assert.Equal(t, tt.version, version)
+			}
+		})
+	}
+
+	assert.Equal(t, `"42"`, etag(42))
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"docstore-api/src/services"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SchemaController struct {
+	service services.SchemaService
+}
+
+func NewSchemaController(service services.SchemaService) *SchemaController {
+	return &SchemaController{
+		service: service,
+	}
+}
+
+// ListSchemas godoc
+// @Summary List document schemas
+// @Description Get the JSON Schemas registered for document types, ordered by type
+// @Tags schemas
+// @Produce json
+// @Success 200 {array} models.Schema
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/schemas [get]
+func (ctrl *SchemaController) ListSchemas(c *gin.Context) {
+	schemas, err := ctrl.service.ListSchemas(requestContext(c))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schemas)
+}
+
+// GetSchema godoc
+// @Summary Get the schema of a document type
+// @Description Get the JSON Schema registered for a document type
+// @Tags schemas
+// @Produce json
+// @Param type path string true "Document type"
+// @Success 200 {object} models.Schema
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/schemas/{type} [get]
+func (ctrl *SchemaController) GetSchema(c *gin.Context) {
+	schema, err := ctrl.service.GetSchema(requestContext(c), c.Param("type"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// PutSchema godoc
+// @Summary Register the schema of a document type
+// @Description Register the JSON Schema in the body for a document type, replacing any earlier version. From then on the metadata of documents of that type must conform to it when they are created or their metadata or type changes; documents already stored are not checked again. The schema applies to the metadata object, whose values are strings. Supported keywords include type, enum, const, string, number, array and object constraints, format, allOf, anyOf, oneOf, not and $ref within the schema.
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Param type path string true "Document type"
+// @Param schema body object true "JSON Schema for the metadata of documents of this type"
+// @Success 200 {object} models.Schema
+// @Success 201 {object} models.Schema
+// @Header 201 {string} Location "URL of the registered schema"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/schemas/{type} [put]
+func (ctrl *SchemaController) PutSchema(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schema, err := ctrl.service.PutSchema(requestContext(c), c.Param("type"), body)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	if schema.Version == 1 {
+		c.Header("Location", "/api/v1/schemas/"+url.PathEscape(schema.Type))
+		c.JSON(http.StatusCreated, schema)
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// DeleteSchema godoc
+// @Summary Delete the schema of a document type
+// @Description Stop validating the metadata of documents of a type
+// @Tags schemas
+// @Param type path string true "Document type"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/schemas/{type} [delete]
+func (ctrl *SchemaController) DeleteSchema(c *gin.Context) {
+	if err := ctrl.service.DeleteSchema(requestContext(c), c.Param("type")); err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSchemaTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	store := models.NewDocumentStore()
+	documents := NewDocumentController(services.NewDocumentService(store))
+	schemas := NewSchemaController(services.NewSchemaService(store))
+
+	router := gin.New()
+	router.POST("/documents", documents.CreateDocument)
+	router.PUT("/documents/:id", documents.UpdateDocument)
+	router.PATCH("/documents/:id", documents.PartialUpdateDocument)
+	router.GET("/schemas", schemas.ListSchemas)
+	router.GET("/schemas/:type", schemas.GetSchema)
+	router.PUT("/schemas/:type", schemas.PutSchema)
+	router.DELETE("/schemas/:type", schemas.DeleteSchema)
+	return router
+}
+
+func TestSchemaController_Schemas(t *testing.T) {
+	router := setupSchemaTestRouter()
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	invoice := `{"properties": {"number": {"pattern": "^INV-[0-9]+$"}}, "required": ["number"]}`
+
+	t.Run("Put", func(t *testing.T) {
+		w := send("PUT", "/schemas/invoice", invoice)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v1/schemas/invoice", w.Header().Get("Location"))
+		var schema models.Schema
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schema))
+		assert.Equal(t, int64(1), schema.Version)
+		assert.JSONEq(t, invoice, string(schema.Schema))
+
+		w = send("PUT", "/schemas/invoice", invoice)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schema))
+		assert.Equal(t, int64(2), schema.Version)
+
+		assert.Equal(t, http.StatusBadRequest, send("PUT", "/schemas/invoice", `{"type": "text"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("PUT", "/schemas/invoice", `{`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("PUT", "/schemas/in%20voice", `{}`).Code)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		w := send("POST", "/documents", `{"id": "inv-1", "name": "Invoice", "type": "invoice", "metadata": {"number": "42"}}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var response struct {
+			Errors []models.FieldError `json:"errors"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, []models.FieldError{
+			{Field: "metadata", Pointer: "/metadata/number", Message: `must match the pattern "^INV-[0-9]+$"`},
+		}, response.Errors)
+
+		assert.Equal(t, http.StatusCreated, send("POST", "/documents", `{"id": "inv-1", "name": "Invoice", "type": "invoice", "metadata": {"number": "INV-42"}}`).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, send("PUT", "/documents/inv-1", `{"name": "Invoice", "type": "invoice"}`).Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, send("PATCH", "/documents/inv-1", `{"metadata": {"number": "x"}}`).Code)
+		assert.Equal(t, http.StatusOK, send("PATCH", "/documents/inv-1", `{"name": "Paid invoice"}`).Code)
+	})
+
+	t.Run("GetAndList", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("GET", "/schemas/invoice", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/schemas/memo", "").Code)
+
+		w := send("GET", "/schemas", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var schemas []models.Schema
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schemas))
+		assert.Len(t, schemas, 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send("DELETE", "/schemas/invoice", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("DELETE", "/schemas/invoice", "").Code)
+		assert.Equal(t, http.StatusOK, send("PATCH", "/documents/inv-1", `{"metadata": {"number": "x"}}`).Code)
+	})
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of the resumable upload protocol
+const (
+	uploadOffsetHeader = "Upload-Offset"
+	uploadLengthHeader = "Upload-Length"
+)
+
+type UploadController struct {
+	service services.UploadService
+}
+
+func NewUploadController(service services.UploadService) *UploadController {
+	return &UploadController{
+		service: service,
+	}
+}
+
+// completeUploadRequest optionally repeats the checksum of the whole content
+type completeUploadRequest struct {
+	SHA256 string `json:"sha256"`
+}
+
+// bindOptionalJSON binds a JSON body if the request has one
+func bindOptionalJSON(c *gin.Context, v interface{}) error {
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return nil
+	}
+	if err := c.ShouldBindJSON(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// setUploadHeaders reports how far an upload has got
+func setUploadHeaders(c *gin.Context, session models.UploadSession) {
+	c.Header(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	if session.Size != nil {
+		c.Header(uploadLengthHeader, strconv.FormatInt(*session.Size, 10))
+	}
+}
+
+// CreateUpload godoc
+// @Summary Start a resumable content upload
+// @Description Open an upload session for a document's content. The content is then sent in chunks with PATCH and attached with complete. Declaring size and sha256 up front lets the server reject oversized chunks and corrupt content.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param upload body models.UploadParams false "Content type, total size and SHA-256 of the content"
+// @Success 201 {object} models.UploadSession
+// @Header 201 {string} Location "URL of the upload session"
+// @Header 201 {string} Upload-Offset "Bytes received so far"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/uploads [post]
+func (ctrl *UploadController) CreateUpload(c *gin.Context) {
+	var params models.UploadParams
+	if err := bindOptionalJSON(c, &params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := ctrl.service.CreateUpload(requestContext(c), c.Param("id"), params)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/documents/"+url.PathEscape(session.DocumentID)+"/uploads/"+session.ID)
+	setUploadHeaders(c, session)
+	c.JSON(http.StatusCreated, session)
+}
+
+// GetUpload godoc
+// @Summary Get an upload session
+// @Description Report how many bytes of an upload have been received, so an interrupted upload can be resumed from there
+// @Tags uploads
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param upload path string true "Upload ID"
+// @Success 200 {object} models.UploadSession
+// @Header 200 {string} Upload-Offset "Bytes received so far"
+// @Header 200 {string} Upload-Length "Declared total size, if any"
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/uploads/{upload} [get]
+func (ctrl *UploadController) GetUpload(c *gin.Context) {
+	session, err := ctrl.service.GetUpload(requestContext(c), c.Param("id"), c.Param("upload"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	setUploadHeaders(c, session)
+	c.JSON(http.StatusOK, session)
+}
+
+// AppendUpload godoc
+// @Summary Upload a chunk
+// @Description Append the request body to an upload. Upload-Offset must equal the bytes received so far; on a mismatch the current offset is returned with 409. If the body is cut short, the bytes received are kept.
+// @Tags uploads
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param upload path string true "Upload ID"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 200 {object} models.UploadSession
+// @Header 200 {string} Upload-Offset "Bytes received so far"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/uploads/{upload} [patch]
+func (ctrl *UploadController) AppendUpload(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header must be a non-negative integer"})
+		return
+	}
+
+	session, err := ctrl.service.AppendUpload(requestContext(c), c.Param("id"), c.Param("upload"), offset, c.Request.Body)
+	if session.ID != "" {
+		setUploadHeaders(c, session)
+	}
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// CompleteUpload godoc
+// @Summary Complete an upload
+// @Description Verify that all bytes have arrived and match the declared SHA-256, and the one in the body if given, then make them the document's content as a new revision. The session ends on success.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param id path string true "Document ID"
+// @Param upload path string true "Upload ID"
+// @Param checksum body completeUploadRequest false "Expected SHA-256 of the content"
+// @Param If-Match header string false "Only attach if the document still has one of these ETags"
+// @Success 200 {object} models.Document
+// @Header 200 {string} ETag "New document version"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/uploads/{upload}/complete [post]
+func (ctrl *UploadController) CompleteUpload(c *gin.Context) {
+	var req completeUploadRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	doc, err := ctrl.service.CompleteUpload(requestContext(c), c.Param("id"), c.Param("upload"), req.SHA256, ifMatchOptions(c)...)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	setETag(c, doc)
+	c.JSON(http.StatusOK, doc)
+}
+
+// CancelUpload godoc
+// @Summary Cancel an upload
+// @Description End an upload session and discard the bytes received
+// @Tags uploads
+// @Param id path string true "Document ID"
+// @Param upload path string true "Upload ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/documents/{id}/uploads/{upload} [delete]
+func (ctrl *UploadController) CancelUpload(c *gin.Context) {
+	if err := ctrl.service.CancelUpload(requestContext(c), c.Param("id"), c.Param("upload")); err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
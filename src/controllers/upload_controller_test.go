@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUploadTestRouter(t *testing.T) (*gin.Engine, models.Store) {
+	gin.SetMode(gin.TestMode)
+	uploads, err := models.NewUploadStore(t.TempDir(), time.Hour, 0)
+	if err != nil {
+		t.Fatalf("NewUploadStore() failed: %v", err)
+	}
+	t.Cleanup(func() { uploads.Close() })
+	store := models.NewDocumentStore()
+	controller := NewUploadController(services.NewUploadService(uploads, store))
+
+	router := gin.New()
+	router.POST("/documents/:id/uploads", controller.CreateUpload)
+	router.GET("/documents/:id/uploads/:upload", controller.GetUpload)
+	router.HEAD("/documents/:id/uploads/:upload", controller.GetUpload)
+	router.PATCH("/documents/:id/uploads/:upload", controller.AppendUpload)
+	router.POST("/documents/:id/uploads/:upload/complete", controller.CompleteUpload)
+	router.DELETE("/documents/:id/uploads/:upload", controller.CancelUpload)
+	return router, store
+}
+
+func TestUploadController_ResumableUpload(t *testing.T) {
+	router, store := setupUploadTestRouter(t)
+	store.Create(context.Background(), models.Document{ID: "u-1", Name: "Video"})
+
+	send := func(method, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, body)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	content := "0123456789abcdef"
+	sum := sha256.Sum256([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+
+	t.Run("Create for missing document", func(t *testing.T) {
+		w := send("POST", "/documents/nope/uploads", nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Create with invalid size", func(t *testing.T) {
+		w := send("POST", "/documents/u-1/uploads", strings.NewReader(`{"size": -5}`), map[string]string{"Content-Type": "application/json"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	var session models.UploadSession
+	var location string
+	t.Run("Create", func(t *testing.T) {
+		body := `{"content_type": "video/mp4", "size": 16, "sha256": "` + checksum + `"}`
+		w := send("POST", "/documents/u-1/uploads", strings.NewReader(body), map[string]string{"Content-Type": "application/json"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+		location = w.Header().Get("Location")
+		assert.Equal(t, "/documents/u-1/uploads/"+session.ID, strings.TrimPrefix(location, "/api/v1"))
+		assert.Equal(t, "0", w.Header().Get("Upload-Offset"))
+		assert.Equal(t, "video/mp4", session.ContentType)
+	})
+	path := "/documents/u-1/uploads/" + session.ID
+
+	t.Run("Append chunks", func(t *testing.T) {
+		w := send("PATCH", path, strings.NewReader(content[:10]), map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+
+		w = send("HEAD", path, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+		assert.Equal(t, "16", w.Header().Get("Upload-Length"))
+	})
+
+	t.Run("Append rejections", func(t *testing.T) {
+		w := send("PATCH", path, strings.NewReader("x"), nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send("PATCH", path, strings.NewReader(content[:10]), map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+
+		w = send("PATCH", path, strings.NewReader(content[10:]+"extra"), map[string]string{"Upload-Offset": "10"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		w = send("PATCH", "/documents/u-1/uploads/unknown", strings.NewReader("x"), map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Complete too early", func(t *testing.T) {
+		w := send("POST", path+"/complete", nil, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		w := send("PATCH", path, strings.NewReader(content[10:]), map[string]string{"Upload-Offset": "10"})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = send("POST", path+"/complete", strings.NewReader(`{"sha256": "`+strings.Repeat("0", 64)+`"}`), map[string]string{"Content-Type": "application/json"})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		w = send("POST", path+"/complete", nil, map[string]string{"If-Match": `"1"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+		var doc models.Document
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "video/mp4", doc.ContentType)
+		assert.Equal(t, int64(16), doc.ContentSize)
+		assert.Equal(t, checksum, doc.ContentSHA256)
+
+		assert.Equal(t, http.StatusNotFound, send("GET", path, nil, nil).Code)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		w := send("POST", "/documents/u-1/uploads", nil, nil)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+
+		w = send("DELETE", "/documents/u-1/uploads/"+session.ID, nil, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = send("DELETE", "/documents/u-1/uploads/"+session.ID, nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"docstore-api/src/services"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserController struct {
+	service services.UserService
+}
+
+func NewUserController(service services.UserService) *UserController {
+	return &UserController{
+		service: service,
+	}
+}
+
+// createUserRequest is the body of CreateUser
+type createUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// Role is reader, editor or admin; reader if omitted
+	Role string `json:"role"`
+}
+
+// updateUserRequest is the body of UpdateUser; omitted fields are left as
+// they are
+type updateUserRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+	// Groups replaces the groups the user belongs to
+	Groups *[]string `json:"groups"`
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Get the stored user accounts, ordered by name. The bootstrap admin configured through the environment is not listed. Admin only.
+// @Tags users
+// @Produce json
+// @Success 200 {array} models.User
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/users [get]
+func (ctrl *UserController) ListUsers(c *gin.Context) {
+	users, err := ctrl.service.ListUsers(requestContext(c))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create an account that can log in, with the role reader (the default), editor or admin. Usernames are 1 to 64 letters, digits, '-', '_', '.' and '@'; passwords 8 to 72 bytes. Passwords are stored as bcrypt hashes. Admin only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body createUserRequest true "Username, password and role"
+// @Success 201 {object} models.User
+// @Header 201 {string} Location "URL of the created user"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/users [post]
+func (ctrl *UserController) CreateUser(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := ctrl.service.CreateUser(requestContext(c), req.Username, req.Password, req.Role)
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Header("Location", "/api/v1/users/"+url.PathEscape(user.Username))
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Get a stored user account. Admin only.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} models.User
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/users/{username} [get]
+func (ctrl *UserController) GetUser(c *gin.Context) {
+	user, err := ctrl.service.GetUser(requestContext(c), c.Param("username"))
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser godoc
+// @Summary Change the role or groups of a user or disable it
+// @Description Change the role of an account or the groups it belongs to, which documents can be shared with, or disable it, so that it can no longer log in, or enable it again. Group names follow the rules of usernames. Access tokens already issued keep the role and groups they were issued with until they are refreshed. Admin only.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param user body updateUserRequest true "New role, groups and whether the account is disabled"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/users/{username} [patch]
+func (ctrl *UserController) UpdateUser(c *gin.Context) {
+	var req updateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == nil && req.Disabled == nil && req.Groups == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to change: set role, disabled or groups"})
+		return
+	}
+
+	user, err := ctrl.service.UpdateUser(requestContext(c), c.Param("username"),
+		services.UserChanges{Role: req.Role, Disabled: req.Disabled, Groups: req.Groups})
+	if err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Delete a stored user account. Admin only.
+// @Tags users
+// @Param username path string true "Username"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /api/v1/users/{username} [delete]
+func (ctrl *UserController) DeleteUser(c *gin.Context) {
+	if err := ctrl.service.DeleteUser(requestContext(c), c.Param("username")); err != nil {
+		respondWithStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"docstore-api/src/models"
+	"docstore-api/src/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUserTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	service, err := services.NewUserService(models.NewDocumentStore(), "admin", "password123")
+	if err != nil {
+		t.Fatalf("NewUserService() failed: %v", err)
+	}
+	users := NewUserController(service)
+
+	router := gin.New()
+	router.GET("/users", users.ListUsers)
+	router.POST("/users", users.CreateUser)
+	router.GET("/users/:username", users.GetUser)
+	router.PATCH("/users/:username", users.UpdateUser)
+	router.DELETE("/users/:username", users.DeleteUser)
+	return router
+}
+
+func TestUserController_Users(t *testing.T) {
+	router := setupUserTestRouter(t)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		w := send("POST", "/users", `{"username": "bob", "password": "correct horse"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/api/v1/users/bob", w.Header().Get("Location"))
+		assert.NotContains(t, w.Body.String(), "password")
+		var user models.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, "bob", user.Username)
+		assert.Equal(t, models.RoleReader, user.Role)
+		assert.False(t, user.Disabled)
+
+		w = send("POST", "/users", `{"username": "erin", "password": "correct horse", "role": "editor"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"role":"editor"`)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/users", `{"username": "carol", "password": "correct horse", "role": "owner"}`).Code)
+
+		assert.Equal(t, http.StatusConflict, send("POST", "/users", `{"username": "bob", "password": "correct horse"}`).Code)
+		assert.Equal(t, http.StatusConflict, send("POST", "/users", `{"username": "admin", "password": "correct horse"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/users", `{"username": "carol", "password": "short"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/users", `{"username": "bad name", "password": "correct horse"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, send("POST", "/users", `{"username": "carol"}`).Code)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		w := send("PATCH", "/users/bob", `{"disabled": true}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var user models.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.True(t, user.Disabled)
+		assert.Equal(t, models.RoleReader, user.Role)
+
+		w = send("PATCH", "/users/bob", `{"role": "editor"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.True(t, user.Disabled)
+		assert.Equal(t, models.RoleEditor, user.Role)
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/users/bob", `{"role": "owner"}`).Code)
+
+		w = send("PATCH", "/users/bob", `{"groups": ["finance", "audit", "finance"]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+		assert.Equal(t, []string{"audit", "finance"}, user.Groups)
+		assert.Equal(t, models.RoleEditor, user.Role)
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/users/bob", `{"groups": ["bad group"]}`).Code)
+
+		assert.Equal(t, http.StatusBadRequest, send("PATCH", "/users/bob", `{}`).Code)
+		assert.Equal(t, http.StatusNotFound, send("PATCH", "/users/carol", `{"disabled": true}`).Code)
+		assert.Equal(t, http.StatusConflict, send("PATCH", "/users/admin", `{"disabled": true}`).Code)
+	})
+
+	t.Run("Get and list", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("GET", "/users/bob", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("GET", "/users/carol", "").Code)
+
+		w := send("GET", "/users", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var users []models.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+		assert.Len(t, users, 2)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, send("DELETE", "/users/admin", "").Code)
+		assert.Equal(t, http.StatusNoContent, send("DELETE", "/users/bob", "").Code)
+		assert.Equal(t, http.StatusNotFound, send("DELETE", "/users/bob", "").Code)
+	})
+}
@@ -17,7 +17,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"docstore-api/src/config"
 	"docstore-api/src/controllers"
@@ -40,10 +47,30 @@ func main() {
 	log.Printf("Detected environment: %s", cfg.Environment)
 
 	// Create layers: Model -> Service -> Controller
-	store := models.NewDocumentStore()
+	store, err := models.NewStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage backend: %v", err)
+	}
+	stopContentGC := collectContentGarbage(store, cfg.ContentGCInterval)
+	uploads, err := models.NewUploadStore(cfg.UploadDir, cfg.UploadSessionTTL, cfg.UploadGCInterval)
+	if err != nil {
+		log.Fatalf("Failed to initialize upload sessions: %v", err)
+	}
 	documentService := services.NewDocumentService(store)
 	documentController := controllers.NewDocumentController(documentService)
-	authController := controllers.NewAuthController(cfg)
+	collectionService := services.NewCollectionService(store)
+	collectionController := controllers.NewCollectionController(collectionService, documentService)
+	schemaService := services.NewSchemaService(store)
+	schemaController := controllers.NewSchemaController(schemaService)
+	uploadService := services.NewUploadService(uploads, store)
+	uploadController := controllers.NewUploadController(uploadService)
+	userService, err := services.NewUserService(store, cfg.AdminUser, cfg.AdminPass)
+	if err != nil {
+		log.Fatalf("Failed to initialize users: %v", err)
+	}
+	userController := controllers.NewUserController(userService)
+	sessionService := services.NewSessionService(store)
+	authController := controllers.NewAuthController(cfg, userService, sessionService)
 	healthController := controllers.NewHealthController(cfg)
 
 	// Setup Gin router based on environment
@@ -82,7 +109,8 @@ func main() {
 		}
 
 		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
-		corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+		corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "If-Match", "If-None-Match", "Range", "If-Range", "Upload-Offset"}
+		corsConfig.ExposeHeaders = []string{"ETag", "Content-Length", "Content-Range", "Accept-Ranges", "Location", "Upload-Offset", "Upload-Length"}
 		corsConfig.AllowCredentials = true
 		r.Use(cors.New(corsConfig))
 	} else {
@@ -97,25 +125,103 @@ func main() {
 	r.GET("/metrics", healthController.Metrics)
 	log.Printf("Metrics endpoint registered at: /metrics")
 
+	// Keys other services verify tokens with (no authentication required)
+	r.GET("/.well-known/jwks.json", authController.JWKS)
+
 	// API routes
 	v1 := r.Group("/api/v1")
 	{
-		// Auth routes (no JWT required)
+		// Access tokens are checked against the sessions they were issued
+		// for, so that logging out or reusing a refresh token revokes them
+		authenticate := middleware.JWTAuthMiddleware(cfg, sessionService)
+
+		// Auth routes (no JWT required, but to log out)
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/login", authController.Login)
+			auth.POST("/refresh", authController.Refresh)
+			auth.POST("/logout", authenticate, authController.Logout)
 		}
 
+		// Every protected route checks the permission it needs against the
+		// role in the token: readers may only read, editors also write and
+		// admins also manage schemas and users. Besides, users other than
+		// admins may only use the documents they own or that are shared
+		// with them.
+		read := middleware.RequirePermission(middleware.PermissionReadDocuments)
+		write := middleware.RequirePermission(middleware.PermissionWriteDocuments)
+
+		// Protected bulk writes (JWT required). The path is a custom method,
+		// so the route parameter holds ":batch".
+		v1.POST("/documents:method", authenticate, write, documentController.BatchDocuments)
+
 		// Protected document routes (JWT required)
 		documents := v1.Group("/documents")
-		documents.Use(middleware.JWTAuthMiddleware(cfg))
+		documents.Use(authenticate)
+		{
+			documents.POST("", write, documentController.CreateDocument)
+			documents.GET("", read, documentController.ListDocuments)
+			documents.GET("/search", read, documentController.SearchDocuments)
+			documents.GET("/:id", read, documentController.GetDocument)
+			documents.PUT("/:id", write, documentController.UpdateDocument)
+			documents.PATCH("/:id", write, documentController.PartialUpdateDocument)
+			documents.DELETE("/:id", write, documentController.DeleteDocument)
+			documents.POST("/:id/move", write, documentController.MoveDocument)
+			documents.POST("/:id/tags", write, documentController.AddDocumentTags)
+			documents.DELETE("/:id/tags/:tag", write, documentController.RemoveDocumentTag)
+			documents.GET("/:id/versions", read, documentController.ListDocumentVersions)
+			documents.GET("/:id/versions/:rev", read, documentController.GetDocumentVersion)
+			documents.POST("/:id/versions/:rev/restore", write, documentController.RestoreDocumentVersion)
+			documents.PUT("/:id/content", write, documentController.UploadDocumentContent)
+			documents.GET("/:id/content", read, documentController.DownloadDocumentContent)
+			documents.HEAD("/:id/content", read, documentController.DownloadDocumentContent)
+			documents.GET("/:id/acl", read, documentController.GetDocumentACL)
+			documents.POST("/:id/acl", write, documentController.GrantDocumentAccess)
+			documents.DELETE("/:id/acl/:principal", write, documentController.RevokeDocumentAccess)
+			documents.PUT("/:id/owner", write, documentController.SetDocumentOwner)
+			// Upload sessions only serve writing content, so even reading
+			// their progress takes write permission
+			documents.POST("/:id/uploads", write, uploadController.CreateUpload)
+			documents.GET("/:id/uploads/:upload", write, uploadController.GetUpload)
+			documents.HEAD("/:id/uploads/:upload", write, uploadController.GetUpload)
+			documents.PATCH("/:id/uploads/:upload", write, uploadController.AppendUpload)
+			documents.POST("/:id/uploads/:upload/complete", write, uploadController.CompleteUpload)
+			documents.DELETE("/:id/uploads/:upload", write, uploadController.CancelUpload)
+		}
+
+		// Protected collection routes (JWT required). Paths nest, so the
+		// collection path is matched as a whole; one ending in /documents
+		// addresses the collection's documents.
+		collections := v1.Group("/collections")
+		collections.Use(authenticate)
+		{
+			collections.GET("", read, collectionController.GetCollection)
+			collections.GET("/*path", read, collectionController.GetCollection)
+			collections.POST("/*path", write, collectionController.CreateCollection)
+			collections.PATCH("/*path", write, collectionController.MoveCollection)
+			collections.DELETE("/*path", write, collectionController.DeleteCollection)
+		}
+
+		// Protected schema routes (JWT required; admins register schemas)
+		manageSchemas := middleware.RequirePermission(middleware.PermissionManageSchemas)
+		schemas := v1.Group("/schemas")
+		schemas.Use(authenticate)
+		{
+			schemas.GET("", read, schemaController.ListSchemas)
+			schemas.GET("/:type", read, schemaController.GetSchema)
+			schemas.PUT("/:type", manageSchemas, schemaController.PutSchema)
+			schemas.DELETE("/:type", manageSchemas, schemaController.DeleteSchema)
+		}
+
+		// User administration (JWT required, admins only)
+		users := v1.Group("/users")
+		users.Use(authenticate, middleware.RequirePermission(middleware.PermissionManageUsers))
 		{
-			documents.POST("", documentController.CreateDocument)
-			documents.GET("", documentController.ListDocuments)
-			documents.GET("/:id", documentController.GetDocument)
-			documents.PUT("/:id", documentController.UpdateDocument)
-			documents.PATCH("/:id", documentController.PartialUpdateDocument)
-			documents.DELETE("/:id", documentController.DeleteDocument)
+			users.GET("", userController.ListUsers)
+			users.POST("", userController.CreateUser)
+			users.GET("/:username", userController.GetUser)
+			users.PATCH("/:username", userController.UpdateUser)
+			users.DELETE("/:username", userController.DeleteUser)
 		}
 	}
 
@@ -142,27 +248,91 @@ func main() {
 		},
 	}
 
-	for _, doc := range sampleDocs {
-		if err := store.Create(doc); err != nil {
-			log.Printf("Error creating sample document %s: %v", doc.ID, err)
+	// Durable backends keep their data across restarts, so only seed an empty store
+	existing, err := store.List(context.Background(), models.ListOptions{Limit: 1})
+	if err != nil {
+		log.Fatalf("Failed to read storage backend: %v", err)
+	}
+	if existing.Total == 0 {
+		for _, doc := range sampleDocs {
+			if err := store.Create(context.Background(), doc); err != nil {
+				log.Printf("Error creating sample document %s: %v", doc.ID, err)
+			}
 		}
 	}
 
 	// Start server with HTTPS or HTTP based on configuration
-	if cfg.EnableHTTPS {
-		log.Printf("Starting HTTPS server on :%s", cfg.ServerPort)
-		log.Printf("Using cert file: %s, key file: %s", cfg.CertFile, cfg.KeyFile)
-		log.Printf("Swagger UI available at: https://localhost:%s/swagger/index.html", cfg.ServerPort)
+	srv := &http.Server{
+		Addr:    ":" + cfg.ServerPort,
+		Handler: r,
+	}
 
-		if err := r.RunTLS(":"+cfg.ServerPort, cfg.CertFile, cfg.KeyFile); err != nil {
-			log.Fatal("Failed to start HTTPS server:", err)
+	go func() {
+		var err error
+		if cfg.EnableHTTPS {
+			log.Printf("Starting HTTPS server on :%s", cfg.ServerPort)
+			log.Printf("Using cert file: %s, key file: %s", cfg.CertFile, cfg.KeyFile)
+			log.Printf("Swagger UI available at: https://localhost:%s/swagger/index.html", cfg.ServerPort)
+			err = srv.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+		} else {
+			log.Printf("Starting HTTP server on :%s", cfg.ServerPort)
+			log.Printf("Swagger UI available at: http://localhost:%s/swagger/index.html", cfg.ServerPort)
+			err = srv.ListenAndServe()
 		}
-	} else {
-		log.Printf("Starting HTTP server on :%s", cfg.ServerPort)
-		log.Printf("Swagger UI available at: http://localhost:%s/swagger/index.html", cfg.ServerPort)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Wait for a termination signal, then drain requests and flush storage
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Printf("Shutting down server...")
 
-		if err := r.Run(":" + cfg.ServerPort); err != nil {
-			log.Fatal("Failed to start HTTP server:", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	if err := uploads.Close(); err != nil {
+		log.Printf("Failed to stop upload session cleanup: %v", err)
+	}
+	stopContentGC()
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close storage backend: %v", err)
+	}
+}
+
+// collectContentGarbage removes stored content that no document references
+// every interval, until the returned function is called. Content is freed as
+// soon as its last document goes; this catches what a crash left behind.
+func collectContentGarbage(store models.Store, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				n, err := store.CollectGarbage(context.Background())
+				if err != nil {
+					log.Printf("Failed to collect unreferenced content: %v", err)
+				} else if n > 0 {
+					log.Printf("Removed %d unreferenced content files", n)
+				}
+			}
 		}
+	}()
+	return func() {
+		close(quit)
+		<-done
 	}
 }
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"docstore-api/src/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey is returned for tokens signed with a key, or by an
+// algorithm, that is not configured
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and public key of Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// newJWK describes an RSA or Ed25519 public key. Its ID is the key's
+// RFC 7638 thumbprint, so it follows from the key alone and stays the same
+// when the key is moved from signing to verifying only.
+func newJWK(key crypto.PublicKey) (JWK, error) {
+	var jwk JWK
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{
+			KeyType:   "RSA",
+			Algorithm: config.JWTAlgorithmRS256,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		jwk = JWK{
+			KeyType:   "OKP",
+			Algorithm: config.JWTAlgorithmEdDSA,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	// The thumbprint hashes the required members in lexicographic order,
+	// which is the order encoding/json writes map keys in
+	members := map[string]string{"kty": jwk.KeyType, "n": jwk.N, "e": jwk.E}
+	if jwk.KeyType == "OKP" {
+		members = map[string]string{"kty": jwk.KeyType, "crv": jwk.Curve, "x": jwk.X}
+	}
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return JWK{}, err
+	}
+	sum := sha256.Sum256(canonical)
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(sum[:])
+	jwk.Use = "sig"
+	return jwk, nil
+}
+
+// verificationKeys returns the public keys tokens may be signed with: the
+// signing key's first, then those of retired keys
+func verificationKeys(cfg *config.Config) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	if cfg.JWTSigningKey != nil {
+		keys = append(keys, cfg.JWTSigningKey.Public())
+	}
+	return append(keys, cfg.JWTVerificationKeys...)
+}
+
+// PublicKeys returns the key set other services verify tokens with. It is
+// empty for HS256, whose secret is never published.
+func PublicKeys(cfg *config.Config) (JWKS, error) {
+	jwks := JWKS{Keys: make([]JWK, 0)}
+	for _, key := range verificationKeys(cfg) {
+		jwk, err := newJWK(key)
+		if err != nil {
+			return JWKS{}, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
+
+// signingKey returns the method and key to sign tokens with and the ID to
+// put in their kid header, if any
+func signingKey(cfg *config.Config) (jwt.SigningMethod, interface{}, string, error) {
+	switch cfg.JWTAlgorithm {
+	case "", config.JWTAlgorithmHS256:
+		return jwt.SigningMethodHS256, []byte(cfg.JWTSecret), "", nil
+	case config.JWTAlgorithmRS256, config.JWTAlgorithmEdDSA:
+	default:
+		return nil, nil, "", fmt.Errorf("%w: algorithm %q", ErrUnknownKey, cfg.JWTAlgorithm)
+	}
+	if cfg.JWTSigningKey == nil {
+		return nil, nil, "", fmt.Errorf("%w: no %s signing key", ErrUnknownKey, cfg.JWTAlgorithm)
+	}
+	jwk, err := newJWK(cfg.JWTSigningKey.Public())
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if jwk.Algorithm != cfg.JWTAlgorithm {
+		return nil, nil, "", fmt.Errorf("%w: %s key cannot sign %s tokens", ErrUnknownKey, jwk.Algorithm, cfg.JWTAlgorithm)
+	}
+	return jwt.GetSigningMethod(cfg.JWTAlgorithm), cfg.JWTSigningKey, jwk.KeyID, nil
+}
+
+// acceptsHS256 reports whether HS256 tokens are valid: those are signed
+// with the secret, which under RS256 or EdDSA is only accepted while
+// JWTAcceptHS256 is on, during the migration from HS256
+func acceptsHS256(cfg *config.Config) bool {
+	switch cfg.JWTAlgorithm {
+	case "", config.JWTAlgorithmHS256:
+		return cfg.JWTSecret != ""
+	}
+	return cfg.JWTAcceptHS256 && cfg.JWTSecret != ""
+}
+
+// verificationKey finds the key a token was signed with: the configured
+// key whose ID is in its kid header, used only by the algorithm that key
+// belongs to, or for HS256 tokens without one the secret, if accepted
+func verificationKey(cfg *config.Config) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if token.Method.Alg() != config.JWTAlgorithmHS256 || !acceptsHS256(cfg) {
+				return nil, ErrUnknownKey
+			}
+			return []byte(cfg.JWTSecret), nil
+		}
+		for _, key := range verificationKeys(cfg) {
+			jwk, err := newJWK(key)
+			if err != nil {
+				return nil, err
+			}
+			if jwk.KeyID == kid {
+				if token.Method.Alg() != jwk.Algorithm {
+					return nil, fmt.Errorf("%w: key %s is not for %s", ErrUnknownKey, kid, token.Method.Alg())
+				}
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+}
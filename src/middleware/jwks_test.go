@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"docstore-api/src/config"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJWK_Thumbprint(t *testing.T) {
+	// The example key of RFC 7638, section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	assert.NoError(t, err)
+
+	jwk, err := newJWK(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	assert.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.KeyID)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.Equal(t, "RS256", jwk.Algorithm)
+	assert.Equal(t, "sig", jwk.Use)
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		algorithm string
+		cfg       *config.Config
+	}{
+		{"RS256", &config.Config{JWTAlgorithm: config.JWTAlgorithmRS256, JWTSigningKey: rsaKey}},
+		{"EdDSA", &config.Config{JWTAlgorithm: config.JWTAlgorithmEdDSA, JWTSigningKey: edKey}},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			token, err := GenerateToken("testuser", "reader", nil, "session-1", tt.cfg)
+			assert.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.algorithm, parsed.Method.Alg())
+			jwks, err := PublicKeys(tt.cfg)
+			assert.NoError(t, err)
+			if !assert.Len(t, jwks.Keys, 1) {
+				return
+			}
+			assert.Equal(t, jwks.Keys[0].KeyID, parsed.Header["kid"])
+			assert.Equal(t, tt.algorithm, jwks.Keys[0].Algorithm)
+
+			claims, err := ValidateToken(token, tt.cfg, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "testuser", claims.Username)
+
+			refresh, _, err := GenerateRefreshToken("testuser", "session-1", "refresh-1", tt.cfg)
+			assert.NoError(t, err)
+			_, err = ValidateRefreshToken(refresh, tt.cfg)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	before := &config.Config{JWTSecret: "test-secret-key"}
+	hs256Token, err := GenerateToken("testuser", "reader", nil, "", before)
+	assert.NoError(t, err)
+	rotating := &config.Config{JWTAlgorithm: config.JWTAlgorithmRS256, JWTSigningKey: oldKey}
+	oldToken, err := GenerateToken("testuser", "reader", nil, "", rotating)
+	assert.NoError(t, err)
+
+	// Signing moves to the new key; the old one and the secret only verify
+	// until their tokens expire
+	after := &config.Config{
+		JWTSecret:           "test-secret-key",
+		JWTAcceptHS256:      true,
+		JWTAlgorithm:        config.JWTAlgorithmEdDSA,
+		JWTSigningKey:       newKey,
+		JWTVerificationKeys: []crypto.PublicKey{oldKey.Public()},
+	}
+	newToken, err := GenerateToken("testuser", "reader", nil, "", after)
+	assert.NoError(t, err)
+	for _, token := range []string{hs256Token, oldToken, newToken} {
+		_, err := ValidateToken(token, after, nil)
+		assert.NoError(t, err)
+	}
+	jwks, err := PublicKeys(after)
+	assert.NoError(t, err)
+	if !assert.Len(t, jwks.Keys, 2) {
+		return
+	}
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+
+	// Once the old key and the secret are dropped, their tokens stop
+	// working. A secret still set no longer verifies once the migration is
+	// over.
+	retired := &config.Config{JWTAlgorithm: config.JWTAlgorithmEdDSA, JWTSigningKey: newKey}
+	for _, token := range []string{hs256Token, oldToken} {
+		_, err := ValidateToken(token, retired, nil)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	}
+	retired.JWTSecret = "test-secret-key"
+	_, err = ValidateToken(hs256Token, retired, nil)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = ValidateToken(newToken, retired, nil)
+	assert.NoError(t, err)
+}
+
+func TestVerificationKey_RejectsForgeries(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	cfg := &config.Config{JWTAlgorithm: config.JWTAlgorithmEdDSA, JWTSigningKey: key}
+	jwks, err := PublicKeys(cfg)
+	assert.NoError(t, err)
+	kid := jwks.Keys[0].KeyID
+
+	claims := &Claims{
+		Username: "mallory",
+		Role:     "admin",
+		Type:     TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "forged",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	// An HS256 token keyed with the public key, which anyone can fetch
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = kid
+	publicKey, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	token, err := forged.SignedString(publicKey)
+	assert.NoError(t, err)
+	_, err = ValidateToken(token, cfg, nil)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// A token signed with another key under this key's ID
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	forged = jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	forged.Header["kid"] = kid
+	token, err = forged.SignedString(other)
+	assert.NoError(t, err)
+	_, err = ValidateToken(token, cfg, nil)
+	assert.Error(t, err)
+
+	// An HS256 token without a kid, while no secret is configured
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(""))
+	assert.NoError(t, err)
+	_, err = ValidateToken(token, cfg, nil)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -1,41 +1,126 @@
 package middleware
 
 import (
+	"context"
 	"docstore-api/src/config"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Kinds of token, told apart by their typ claim so that neither can be
+// used as the other
+const (
+	// TokenTypeAccess tokens are sent with every request
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh tokens are only exchanged for new tokens at
+	// /auth/refresh
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	// ErrTokenRevoked is returned for tokens revoked before they expired
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrWrongTokenType is returned when a refresh token is used as an
+	// access token or the other way around
+	ErrWrongTokenType = errors.New("wrong token type")
 )
 
 type Claims struct {
 	Username string `json:"username"`
+	// Role decides what the bearer may do; see RequirePermission
+	Role string `json:"role"`
+	// Groups are the groups the bearer belongs to, which documents can be
+	// shared with
+	Groups []string `json:"groups,omitempty"`
+	// Type is TokenTypeAccess or TokenTypeRefresh
+	Type string `json:"typ"`
+	// SessionID identifies the login the token was issued for; every
+	// token refreshed from it carries the same one
+	SessionID string `json:"sid,omitempty"`
+	// RegisteredClaims.ID, the jti, identifies the token itself
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(username string, cfg *config.Config) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// RevocationList tells which tokens were revoked before they expired
+type RevocationList interface {
+	// IsRevoked reports whether token tokenID, issued for session
+	// sessionID, was revoked, by itself or along with its session
+	IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
+}
+
+// NewTokenID returns a random identifier for a token or session
+func NewTokenID() string {
+	return uuid.NewString()
+}
+
+// AccessTokenTTL and RefreshTokenTTL return the configured token lifetimes,
+// or the defaults for configurations that leave them unset
+func AccessTokenTTL(cfg *config.Config) time.Duration {
+	if cfg.AccessTokenTTL > 0 {
+		return cfg.AccessTokenTTL
 	}
+	return config.DefaultAccessTokenTTL
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.JWTSecret))
+func RefreshTokenTTL(cfg *config.Config) time.Duration {
+	if cfg.RefreshTokenTTL > 0 {
+		return cfg.RefreshTokenTTL
+	}
+	return config.DefaultRefreshTokenTTL
+}
+
+// signToken sets the type, ID and lifetime of claims and signs them with
+// the configured key
+func signToken(claims *Claims, tokenType, tokenID string, ttl time.Duration, cfg *config.Config) (string, error) {
+	method, key, kid, err := signingKey(cfg)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.Type = tokenType
+	claims.ID = tokenID
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(key)
+}
+
+// GenerateToken generates a short-lived access token for a user with role,
+// belonging to groups, issued for session sessionID
+func GenerateToken(username, role string, groups []string, sessionID string, cfg *config.Config) (string, error) {
+	claims := &Claims{Username: username, Role: role, Groups: groups, SessionID: sessionID}
+	return signToken(claims, TokenTypeAccess, NewTokenID(), AccessTokenTTL(cfg), cfg)
+}
+
+// GenerateRefreshToken generates refresh token tokenID of session
+// sessionID and returns it with the time it expires
+func GenerateRefreshToken(username, sessionID, tokenID string, cfg *config.Config) (string, time.Time, error) {
+	claims := &Claims{Username: username, SessionID: sessionID}
+	token, err := signToken(claims, TokenTypeRefresh, tokenID, RefreshTokenTTL(cfg), cfg)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, claims.ExpiresAt.Time, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
+// parseToken verifies the signature and expiry of a token of tokenType and
+// returns its claims
+func parseToken(tokenString, tokenType string, cfg *config.Config) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey(cfg),
+		jwt.WithValidMethods([]string{config.JWTAlgorithmHS256, config.JWTAlgorithmRS256, config.JWTAlgorithmEdDSA}),
+		jwt.WithExpirationRequired())
 
 	if err != nil {
 		return nil, err
@@ -45,11 +130,47 @@ func ValidateToken(tokenString string, cfg *config.Config) (*Claims, error) {
 		return nil, jwt.ErrSignatureInvalid
 	}
 
+	if claims.Type != tokenType {
+		return nil, ErrWrongTokenType
+	}
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: jti", jwt.ErrTokenRequiredClaimMissing)
+	}
+
 	return claims, nil
 }
 
-// JWTAuthMiddleware is the middleware function for JWT authentication
-func JWTAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// ValidateToken validates an access token and returns the claims. Tokens
+// revocations lists as revoked fail with ErrTokenRevoked; a nil list
+// revokes nothing.
+func ValidateToken(tokenString string, cfg *config.Config, revocations RevocationList) (*Claims, error) {
+	claims, err := parseToken(tokenString, TokenTypeAccess, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if revocations != nil {
+		revoked, err := revocations.IsRevoked(context.Background(), claims.ID, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// ValidateRefreshToken validates a refresh token and returns the claims.
+// Whether it may still be exchanged is up to its session.
+func ValidateRefreshToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeRefresh, cfg)
+}
+
+// JWTAuthMiddleware is the middleware function for JWT authentication. It
+// accepts access tokens that revocations does not list as revoked.
+func JWTAuthMiddleware(cfg *config.Config, revocations RevocationList) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -69,7 +190,12 @@ func JWTAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// Validate the token
-		claims, err := ValidateToken(tokenString, cfg)
+		claims, err := ValidateToken(tokenString, cfg, revocations)
+		if errors.Is(err, ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -78,6 +204,9 @@ func JWTAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		// Set user info in context
 		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+		c.Set("groups", claims.Groups)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"docstore-api/src/config"
 	"encoding/json"
 	"net/http"
@@ -38,7 +39,7 @@ func TestGenerateToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateToken(tt.username, cfg)
+			token, err := GenerateToken(tt.username, "reader", nil, "", cfg)
 
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
@@ -48,18 +49,22 @@ func TestGenerateToken(t *testing.T) {
 			assert.Greater(t, parts, 50, "Token should be reasonably long")
 
 			// Verify we can parse the token back
-			claims, err := ValidateToken(token, cfg)
+			claims, err := ValidateToken(token, cfg, nil)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.username, claims.Username)
+			assert.Equal(t, "reader", claims.Role)
 
-			// Verify expiration is set correctly (24 hours from now)
-			expectedExpiry := time.Now().Add(24 * time.Hour)
+			// Verify expiration is set correctly (the default access token
+			// lifetime from now)
+			expectedExpiry := time.Now().Add(config.DefaultAccessTokenTTL)
 			actualExpiry := claims.ExpiresAt.Time
 
 			// Allow 1 minute tolerance for test execution time
 			timeDiff := actualExpiry.Sub(expectedExpiry)
 			assert.True(t, timeDiff < time.Minute && timeDiff > -time.Minute,
-				"Token expiry should be approximately 24 hours from now")
+				"Token expiry should be approximately 15 minutes from now")
+			assert.Equal(t, TokenTypeAccess, claims.Type)
+			assert.NotEmpty(t, claims.ID)
 		})
 	}
 }
@@ -70,7 +75,7 @@ func TestValidateToken(t *testing.T) {
 	}
 
 	// Generate a valid token for testing
-	validToken, err := GenerateToken("testuser", cfg)
+	validToken, err := GenerateToken("testuser", "reader", nil, "", cfg)
 	assert.NoError(t, err)
 
 	tests := []struct {
@@ -104,7 +109,7 @@ func TestValidateToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			claims, err := ValidateToken(tt.token, cfg)
+			claims, err := ValidateToken(tt.token, cfg, nil)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -123,11 +128,11 @@ func TestValidateTokenWithWrongSecret(t *testing.T) {
 	cfg2 := &config.Config{JWTSecret: "secret2"}
 
 	// Generate token with first secret
-	token, err := GenerateToken("testuser", cfg1)
+	token, err := GenerateToken("testuser", "reader", nil, "", cfg1)
 	assert.NoError(t, err)
 
 	// Try to validate with different secret
-	claims, err := ValidateToken(token, cfg2)
+	claims, err := ValidateToken(token, cfg2, nil)
 	assert.Error(t, err)
 	assert.Nil(t, claims)
 }
@@ -140,7 +145,9 @@ func TestExpiredToken(t *testing.T) {
 	// Create an expired token manually
 	expiredClaims := &Claims{
 		Username: "testuser",
+		Type:     TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "expired",
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-1 * time.Hour)), // Expired 1 hour ago
 			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)), // Issued 2 hours ago
 		},
@@ -151,7 +158,7 @@ func TestExpiredToken(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Try to validate expired token
-	claims, err := ValidateToken(expiredTokenString, cfg)
+	claims, err := ValidateToken(expiredTokenString, cfg, nil)
 	assert.Error(t, err)
 	assert.Nil(t, claims)
 }
@@ -164,7 +171,7 @@ func TestJWTAuthMiddleware(t *testing.T) {
 	}
 
 	// Generate a valid token for testing
-	validToken, err := GenerateToken("testuser", cfg)
+	validToken, err := GenerateToken("testuser", "reader", nil, "", cfg)
 	assert.NoError(t, err)
 
 	tests := []struct {
@@ -217,7 +224,7 @@ func TestJWTAuthMiddleware(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create a test router with the middleware
 			router := gin.New()
-			router.Use(JWTAuthMiddleware(cfg))
+			router.Use(JWTAuthMiddleware(cfg, nil))
 
 			// Add a test endpoint that should only be reached if middleware passes
 			router.GET("/protected", func(c *gin.Context) {
@@ -272,7 +279,7 @@ func TestJWTAuthMiddleware_Integration(t *testing.T) {
 
 	// Protected endpoints (with middleware)
 	protected := router.Group("/api")
-	protected.Use(JWTAuthMiddleware(cfg))
+	protected.Use(JWTAuthMiddleware(cfg, nil))
 	{
 		protected.GET("/user", func(c *gin.Context) {
 			username, _ := c.Get("username")
@@ -304,7 +311,7 @@ func TestJWTAuthMiddleware_Integration(t *testing.T) {
 
 	// Test protected endpoint with valid token (should work)
 	t.Run("protected endpoint with valid token", func(t *testing.T) {
-		token, err := GenerateToken("integrationuser", cfg)
+		token, err := GenerateToken("integrationuser", "reader", nil, "", cfg)
 		assert.NoError(t, err)
 
 		req, _ := http.NewRequest("GET", "/api/user", nil)
@@ -340,19 +347,19 @@ func TestTokenLifecycle(t *testing.T) {
 	username := "lifecycleuser"
 
 	// Step 1: Generate token
-	token, err := GenerateToken(username, cfg)
+	token, err := GenerateToken(username, "reader", nil, "", cfg)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
 	// Step 2: Validate token
-	claims, err := ValidateToken(token, cfg)
+	claims, err := ValidateToken(token, cfg, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, username, claims.Username)
 
 	// Step 3: Use token in middleware
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.Use(JWTAuthMiddleware(cfg))
+	router.Use(JWTAuthMiddleware(cfg, nil))
 	router.GET("/test", func(c *gin.Context) {
 		contextUsername, exists := c.Get("username")
 		assert.True(t, exists)
@@ -366,3 +373,111 @@ func TestTokenLifecycle(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestJWTAuthMiddleware_Groups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWTSecret: "test-secret-key",
+	}
+
+	token, err := GenerateToken("testuser", "reader", []string{"audit", "finance"}, "", cfg)
+	assert.NoError(t, err)
+	claims, err := ValidateToken(token, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"audit", "finance"}, claims.Groups)
+
+	router := gin.New()
+	router.Use(JWTAuthMiddleware(cfg, nil))
+	router.GET("/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"groups": c.GetStringSlice("groups")})
+	})
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"groups": ["audit", "finance"]}`, w.Body.String())
+}
+
+// revocationList is a RevocationList revoking the listed tokens and
+// sessions
+type revocationList struct {
+	tokens, sessions map[string]bool
+}
+
+func (l revocationList) IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	return l.tokens[tokenID] || l.sessions[sessionID], nil
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret:       "test-secret-key",
+		RefreshTokenTTL: time.Hour,
+	}
+
+	token, expiresAt, err := GenerateRefreshToken("testuser", "session-1", "refresh-1", cfg)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	claims, err := ValidateRefreshToken(token, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", claims.Username)
+	assert.Equal(t, "session-1", claims.SessionID)
+	assert.Equal(t, "refresh-1", claims.ID)
+	assert.Equal(t, TokenTypeRefresh, claims.Type)
+	assert.Equal(t, expiresAt, claims.ExpiresAt.Time)
+
+	// Neither kind of token is accepted as the other
+	_, err = ValidateToken(token, cfg, nil)
+	assert.ErrorIs(t, err, ErrWrongTokenType)
+	access, err := GenerateToken("testuser", "reader", nil, "session-1", cfg)
+	assert.NoError(t, err)
+	_, err = ValidateRefreshToken(access, cfg)
+	assert.ErrorIs(t, err, ErrWrongTokenType)
+}
+
+func TestValidateToken_Revoked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		JWTSecret:      "test-secret-key",
+		AccessTokenTTL: time.Minute,
+	}
+
+	revokedToken, err := GenerateToken("testuser", "reader", nil, "session-1", cfg)
+	assert.NoError(t, err)
+	claims, err := ValidateToken(revokedToken, cfg, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "session-1", claims.SessionID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt.Time, 5*time.Second)
+
+	revokedSession, err := GenerateToken("testuser", "reader", nil, "session-2", cfg)
+	assert.NoError(t, err)
+	liveToken, err := GenerateToken("testuser", "reader", nil, "session-1", cfg)
+	assert.NoError(t, err)
+
+	revocations := revocationList{
+		tokens:   map[string]bool{claims.ID: true},
+		sessions: map[string]bool{"session-2": true},
+	}
+	_, err = ValidateToken(revokedToken, cfg, revocations)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = ValidateToken(revokedSession, cfg, revocations)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	_, err = ValidateToken(liveToken, cfg, revocations)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(JWTAuthMiddleware(cfg, revocations))
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	for token, code := range map[string]int{revokedToken: http.StatusUnauthorized, liveToken: http.StatusOK} {
+		req, _ := http.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code)
+	}
+}
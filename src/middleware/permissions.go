@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"docstore-api/src/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is an action a route requires the caller's role to allow
+type Permission string
+
+const (
+	// PermissionReadDocuments allows reading documents, their content and
+	// history, collections and schemas
+	PermissionReadDocuments Permission = "documents:read"
+	// PermissionWriteDocuments allows creating, changing and deleting
+	// documents and collections
+	PermissionWriteDocuments Permission = "documents:write"
+	// PermissionManageSchemas allows registering and deleting schemas
+	PermissionManageSchemas Permission = "schemas:manage"
+	// PermissionManageUsers allows administering user accounts
+	PermissionManageUsers Permission = "users:manage"
+)
+
+// rolePermissions lists what each role allows; every role includes the
+// permissions of the ones below it
+var rolePermissions = map[string][]Permission{
+	models.RoleReader: {PermissionReadDocuments},
+	models.RoleEditor: {PermissionReadDocuments, PermissionWriteDocuments},
+	models.RoleAdmin:  {PermissionReadDocuments, PermissionWriteDocuments, PermissionManageSchemas, PermissionManageUsers},
+}
+
+// HasPermission reports whether role allows permission. Unknown roles,
+// including the empty one of tokens issued before roles existed, allow
+// nothing.
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission lets a request through only if the role of its token
+// allows permission. It must run after JWTAuthMiddleware: requests it did
+// not authenticate are answered 401, authenticated ones whose role falls
+// short 403.
+func RequirePermission(permission Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, authenticated := c.Get("username"); !authenticated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+		if !HasPermission(c.GetString("role"), permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions", "required": permission})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
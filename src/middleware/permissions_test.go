@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"docstore-api/src/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role    string
+		allowed []Permission
+		denied  []Permission
+	}{
+		{
+			role:    "reader",
+			allowed: []Permission{PermissionReadDocuments},
+			denied:  []Permission{PermissionWriteDocuments, PermissionManageSchemas, PermissionManageUsers},
+		},
+		{
+			role:    "editor",
+			allowed: []Permission{PermissionReadDocuments, PermissionWriteDocuments},
+			denied:  []Permission{PermissionManageSchemas, PermissionManageUsers},
+		},
+		{
+			role:    "admin",
+			allowed: []Permission{PermissionReadDocuments, PermissionWriteDocuments, PermissionManageSchemas, PermissionManageUsers},
+		},
+		{
+			role:   "",
+			denied: []Permission{PermissionReadDocuments},
+		},
+		{
+			role:   "owner",
+			denied: []Permission{PermissionReadDocuments},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, p := range tt.allowed {
+			assert.True(t, HasPermission(tt.role, p), "%q should allow %s", tt.role, p)
+		}
+		for _, p := range tt.denied {
+			assert.False(t, HasPermission(tt.role, p), "%q should not allow %s", tt.role, p)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{
+		JWTSecret: "test-secret-key",
+	}
+
+	router := gin.New()
+	documents := router.Group("/documents", JWTAuthMiddleware(cfg, nil))
+	documents.GET("", RequirePermission(PermissionReadDocuments), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "read"})
+	})
+	documents.POST("", RequirePermission(PermissionWriteDocuments), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"message": "written"})
+	})
+	router.GET("/unauthenticated", RequirePermission(PermissionReadDocuments), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "read"})
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		role           string
+		expectedStatus int
+	}{
+		{name: "reader can read", method: "GET", path: "/documents", role: "reader", expectedStatus: http.StatusOK},
+		{name: "reader cannot write", method: "POST", path: "/documents", role: "reader", expectedStatus: http.StatusForbidden},
+		{name: "editor can write", method: "POST", path: "/documents", role: "editor", expectedStatus: http.StatusCreated},
+		{name: "admin can write", method: "POST", path: "/documents", role: "admin", expectedStatus: http.StatusCreated},
+		{name: "token without role", method: "GET", path: "/documents", role: "", expectedStatus: http.StatusForbidden},
+		{name: "no token", method: "GET", path: "/documents", expectedStatus: http.StatusUnauthorized},
+		{name: "no authentication middleware", method: "GET", path: "/unauthenticated", role: "admin", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.name != "no token" {
+				token, err := GenerateToken("testuser", tt.role, nil, "", cfg)
+				assert.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), "Insufficient permissions")
+			}
+		})
+	}
+}
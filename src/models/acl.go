@@ -0,0 +1,324 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Levels of access to a document, from least to most. Documents are shared
+// at read or write level; write implies read. The owner, the user who
+// created the document unless it was given to someone else since, may also
+// share it.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessOwner = "owner"
+)
+
+// Prefixes of the principals a document can be shared with, as in
+// "user:bob" or "group:finance"
+const (
+	PrincipalUser  = "user:"
+	PrincipalGroup = "group:"
+)
+
+var (
+	// ErrInvalidGrant is returned for grants to malformed principals or at
+	// levels other than read and write
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrGrantNotFound is returned when revoking access a principal was
+	// not granted
+	ErrGrantNotFound = errors.New("grant not found")
+	// ErrAccessDenied is returned when the viewer can see a document but
+	// not use it as asked
+	ErrAccessDenied = errors.New("access denied")
+)
+
+// Grant shares a document with a user or group
+type Grant struct {
+	// Principal is "user:<username>" or "group:<group>"
+	Principal string    `json:"principal"`
+	Level     string    `json:"level"`
+	GrantedAt time.Time `json:"granted_at"`
+	GrantedBy string    `json:"granted_by"`
+}
+
+// ACL lists who may use a document besides its owner and admins, ordered
+// by principal
+type ACL struct {
+	DocumentID string  `json:"document_id"`
+	Owner      string  `json:"owner"`
+	Grants     []Grant `json:"grants"`
+}
+
+// Viewer is a user whose access to documents is limited to the ones they
+// own or that were shared with them or one of their groups. Requests
+// carrying no viewer (see WithViewer) see every document.
+type Viewer struct {
+	Username string
+	Groups   []string
+}
+
+type viewerKey struct{}
+
+// WithViewer returns a context limiting the documents listed, searched and
+// authorized to those viewer may see
+func WithViewer(ctx context.Context, viewer Viewer) context.Context {
+	return context.WithValue(ctx, viewerKey{}, viewer)
+}
+
+// ViewerFromContext returns the viewer stored by WithViewer, if any
+func ViewerFromContext(ctx context.Context) (Viewer, bool) {
+	viewer, ok := ctx.Value(viewerKey{}).(Viewer)
+	return viewer, ok
+}
+
+// principals returns the principals that grant the viewer access
+func (v Viewer) principals() []string {
+	principals := make([]string, 0, 1+len(v.Groups))
+	principals = append(principals, PrincipalUser+v.Username)
+	for _, group := range v.Groups {
+		principals = append(principals, PrincipalGroup+group)
+	}
+	return principals
+}
+
+// owns reports whether the viewer is owner. Documents written before
+// authors were recorded, and those whose owner was deleted, belong to no
+// one until an admin gives them an owner (see Store.SetOwner).
+func (v Viewer) owns(owner string) bool {
+	return owner != "" && owner == v.Username
+}
+
+// accessRank orders the access levels; unknown levels grant nothing
+func accessRank(level string) int {
+	switch level {
+	case AccessRead:
+		return 1
+	case AccessWrite:
+		return 2
+	case AccessOwner:
+		return 3
+	}
+	return 0
+}
+
+// Access returns the highest level at which the viewer may use the
+// document acl belongs to, or "" if they may not see it
+func (v Viewer) Access(acl ACL) string {
+	if v.owns(acl.Owner) {
+		return AccessOwner
+	}
+	access := ""
+	for _, grant := range acl.Grants {
+		if v.grantedBy(grant) && accessRank(grant.Level) > accessRank(access) {
+			access = grant.Level
+		}
+	}
+	return access
+}
+
+// grantedBy reports whether grant applies to the viewer
+func (v Viewer) grantedBy(grant Grant) bool {
+	for _, principal := range v.principals() {
+		if grant.Principal == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks that the viewer may use the document acl belongs to at
+// level. Documents they may not see at all are reported as
+// ErrDocumentNotFound, so that their existence is not disclosed.
+func (v Viewer) Authorize(acl ACL, level string) error {
+	access := v.Access(acl)
+	switch {
+	case access == "":
+		return ErrDocumentNotFound
+	case accessRank(access) < accessRank(level):
+		return fmt.Errorf("%w: %s access to document %s is required", ErrAccessDenied, level, acl.DocumentID)
+	}
+	return nil
+}
+
+// authorizeViewer checks that the viewer in ctx, if any, may use the
+// document acl belongs to at level. Stores call it for writes that check
+// access atomically with what they change, such as the operations of a
+// batch.
+func authorizeViewer(ctx context.Context, acl ACL, level string) error {
+	viewer, ok := ViewerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return viewer.Authorize(acl, level)
+}
+
+// canSee reports whether the viewer may read the document acl belongs to
+func (v Viewer) canSee(acl ACL) bool {
+	return v.Access(acl) != ""
+}
+
+// checkGrant validates the principal and level of a grant
+func checkGrant(principal, level string) error {
+	if level != AccessRead && level != AccessWrite {
+		return fmt.Errorf("%w: level %q must be %s or %s", ErrInvalidGrant, level, AccessRead, AccessWrite)
+	}
+	var err error
+	switch {
+	case strings.HasPrefix(principal, PrincipalUser):
+		err = checkUsername(strings.TrimPrefix(principal, PrincipalUser))
+	case strings.HasPrefix(principal, PrincipalGroup):
+		err = checkGroupName(strings.TrimPrefix(principal, PrincipalGroup))
+	default:
+		return fmt.Errorf("%w: principal %q must start with %q or %q", ErrInvalidGrant, principal, PrincipalUser, PrincipalGroup)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+	return nil
+}
+
+// grantAccess returns grants with principal given level, replacing any
+// earlier grant to it
+func grantAccess(ctx context.Context, grants []Grant, principal, level string) []Grant {
+	grant := Grant{Principal: principal, Level: level, GrantedAt: time.Now().UTC(), GrantedBy: ActorFromContext(ctx)}
+	updated := make([]Grant, 0, len(grants)+1)
+	for _, g := range grants {
+		if g.Principal != principal {
+			updated = append(updated, g)
+		}
+	}
+	updated = append(updated, grant)
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Principal < updated[j].Principal })
+	return updated
+}
+
+// revokeAccess returns grants without the one to principal, or
+// ErrGrantNotFound if there is none
+func revokeAccess(grants []Grant, principal string) ([]Grant, error) {
+	updated := make([]Grant, 0, len(grants))
+	for _, g := range grants {
+		if g.Principal != principal {
+			updated = append(updated, g)
+		}
+	}
+	if len(updated) == len(grants) {
+		return nil, ErrGrantNotFound
+	}
+	return updated, nil
+}
+
+func (s *DocumentStore) GetACL(ctx context.Context, id string) (ACL, error) {
+	if err := ctx.Err(); err != nil {
+		return ACL{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return ACL{}, ErrDocumentNotFound
+	}
+	return s.acl(doc), nil
+}
+
+// acl returns the ACL of doc. Callers must hold mu.
+func (s *DocumentStore) acl(doc Document) ACL {
+	grants := s.grants[doc.ID]
+	if grants == nil {
+		grants = []Grant{}
+	}
+	return ACL{DocumentID: doc.ID, Owner: s.owner(doc), Grants: grants}
+}
+
+// owner returns who owns doc: its creator, unless it was given to someone
+// else or its owner was deleted since. Callers must hold mu.
+func (s *DocumentStore) owner(doc Document) string {
+	if owner, ok := s.owners[doc.ID]; ok {
+		return owner
+	}
+	return doc.CreatedBy
+}
+
+// disown leaves the documents owned by username without an owner and drops
+// what was shared with them, so that a user created later under the same
+// name inherits neither. Callers must hold mu for writing.
+func (s *DocumentStore) disown(username string) {
+	for id, doc := range s.documents {
+		if s.owner(doc) == username {
+			s.owners[id] = ""
+		}
+	}
+	for id, grants := range s.grants {
+		if updated, err := revokeAccess(grants, PrincipalUser+username); err == nil {
+			s.apply(walRecord{Op: walOpPutACL, ID: id, Grants: updated})
+		}
+	}
+}
+
+func (s *DocumentStore) GrantAccess(ctx context.Context, id, principal, level string) (ACL, error) {
+	if err := ctx.Err(); err != nil {
+		return ACL{}, err
+	}
+	if err := checkGrant(principal, level); err != nil {
+		return ACL{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return ACL{}, ErrDocumentNotFound
+	}
+	grants := grantAccess(ctx, s.grants[id], principal, level)
+	if err := s.commit(walRecord{Op: walOpPutACL, ID: id, Grants: grants}); err != nil {
+		return ACL{}, err
+	}
+	return s.acl(doc), nil
+}
+
+func (s *DocumentStore) RevokeAccess(ctx context.Context, id, principal string) (ACL, error) {
+	if err := ctx.Err(); err != nil {
+		return ACL{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return ACL{}, ErrDocumentNotFound
+	}
+	grants, err := revokeAccess(s.grants[id], principal)
+	if err != nil {
+		return ACL{}, err
+	}
+	if err := s.commit(walRecord{Op: walOpPutACL, ID: id, Grants: grants}); err != nil {
+		return ACL{}, err
+	}
+	return s.acl(doc), nil
+}
+
+func (s *DocumentStore) SetOwner(ctx context.Context, id, owner string) (ACL, error) {
+	if err := ctx.Err(); err != nil {
+		return ACL{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return ACL{}, ErrDocumentNotFound
+	}
+	if _, ok := s.users[owner]; !ok {
+		return ACL{}, fmt.Errorf("%w: owner %q is not a user", ErrInvalidGrant, owner)
+	}
+	if err := s.commit(walRecord{Op: walOpPutOwner, ID: id, Owner: owner}); err != nil {
+		return ACL{}, err
+	}
+	return s.acl(doc), nil
+}
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestViewer_Authorize(t *testing.T) {
+	acl := ACL{DocumentID: "doc", Owner: "alice", Grants: []Grant{
+		{Principal: "user:bob", Level: AccessRead},
+		{Principal: "group:finance", Level: AccessWrite},
+	}}
+	tests := []struct {
+		viewer Viewer
+		access string
+	}{
+		{Viewer{Username: "alice"}, AccessOwner},
+		{Viewer{Username: "bob"}, AccessRead},
+		{Viewer{Username: "bob", Groups: []string{"finance"}}, AccessWrite},
+		{Viewer{Username: "carol", Groups: []string{"legal"}}, ""},
+		{Viewer{Username: "finance"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.viewer.Access(acl); got != tt.access {
+			t.Errorf("Access() for %+v = %q, want %q", tt.viewer, got, tt.access)
+		}
+	}
+
+	bob := Viewer{Username: "bob"}
+	if err := bob.Authorize(acl, AccessRead); err != nil {
+		t.Errorf("expected bob to read, got %v", err)
+	}
+	if err := bob.Authorize(acl, AccessWrite); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected ErrAccessDenied, got %v", err)
+	}
+	if err := (Viewer{Username: "carol"}).Authorize(acl, AccessRead); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got %v", err)
+	}
+	if err := (Viewer{Username: ""}).Authorize(ACL{DocumentID: "legacy"}, AccessRead); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected documents without an owner to be hidden, got %v", err)
+	}
+}
+
+func TestStoreContract_ACL(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			alice := WithActor(context.Background(), "alice")
+			for _, id := range []string{"a1", "a2", "a3"} {
+				if err := store.Create(alice, Document{ID: id, Name: "quarterly report " + id}); err != nil {
+					t.Fatalf("Create() failed: %v", err)
+				}
+			}
+			store.Create(WithActor(context.Background(), "bob"), Document{ID: "b1", Name: "bob's report"})
+
+			acl, err := store.GetACL(alice, "a1")
+			if err != nil || acl.Owner != "alice" || len(acl.Grants) != 0 {
+				t.Fatalf("GetACL() = %+v, %v", acl, err)
+			}
+			store.GrantAccess(alice, "a1", "user:bob", AccessRead)
+			acl, err = store.GrantAccess(alice, "a1", "user:bob", AccessWrite)
+			if err != nil || len(acl.Grants) != 1 || acl.Grants[0].Level != AccessWrite || acl.Grants[0].GrantedBy != "alice" {
+				t.Errorf("GrantAccess() = %+v, %v", acl, err)
+			}
+			acl, err = store.GrantAccess(alice, "a2", "group:finance", AccessRead)
+			if err != nil || len(acl.Grants) != 1 || acl.Grants[0].GrantedAt.IsZero() {
+				t.Errorf("GrantAccess() = %+v, %v", acl, err)
+			}
+			for _, grant := range []struct{ principal, level string }{
+				{"bob", AccessRead}, {"user:bad name", AccessRead}, {"group:", AccessRead}, {"user:bob", AccessOwner},
+			} {
+				if _, err := store.GrantAccess(alice, "a1", grant.principal, grant.level); !errors.Is(err, ErrInvalidGrant) {
+					t.Errorf("GrantAccess(%q, %q): expected ErrInvalidGrant, got %v", grant.principal, grant.level, err)
+				}
+			}
+			if _, err := store.GrantAccess(alice, "missing", "user:bob", AccessRead); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			visible := func(viewer Viewer) (int, int) {
+				t.Helper()
+				ctx := WithViewer(context.Background(), viewer)
+				page, err := store.List(ctx, ListOptions{Limit: 1})
+				if err != nil {
+					t.Fatalf("List() failed: %v", err)
+				}
+				results, err := store.Search(ctx, "report", 10)
+				if err != nil {
+					t.Fatalf("Search() failed: %v", err)
+				}
+				return page.Total, results.Total
+			}
+			for _, tt := range []struct {
+				viewer Viewer
+				want   int
+			}{
+				{Viewer{Username: "alice"}, 3},
+				{Viewer{Username: "bob"}, 2},
+				{Viewer{Username: "bob", Groups: []string{"finance"}}, 3},
+				{Viewer{Username: "carol", Groups: []string{"finance"}}, 1},
+				{Viewer{Username: "carol"}, 0},
+			} {
+				if listed, found := visible(tt.viewer); listed != tt.want || found != tt.want {
+					t.Errorf("viewer %+v lists %d and finds %d documents, want %d", tt.viewer, listed, found, tt.want)
+				}
+			}
+			if page, _ := store.List(alice, ListOptions{}); page.Total != 4 {
+				t.Errorf("expected every document without a viewer, got %d", page.Total)
+			}
+
+			acl, err = store.RevokeAccess(alice, "a1", "user:bob")
+			if err != nil || len(acl.Grants) != 0 {
+				t.Errorf("RevokeAccess() = %+v, %v", acl, err)
+			}
+			if _, err := store.RevokeAccess(alice, "a1", "user:bob"); !errors.Is(err, ErrGrantNotFound) {
+				t.Errorf("expected ErrGrantNotFound, got %v", err)
+			}
+
+			store.Delete(alice, "a2")
+			store.Create(alice, Document{ID: "a2", Name: "again"})
+			if acl, err := store.GetACL(alice, "a2"); err != nil || len(acl.Grants) != 0 {
+				t.Errorf("expected the grants to go with the deleted document, got %+v, %v", acl, err)
+			}
+		})
+	}
+}
+
+func TestStoreContract_Ownership(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			for _, username := range []string{"alice", "bob"} {
+				if _, err := store.CreateUser(ctx, User{Username: username}); err != nil {
+					t.Fatalf("CreateUser() failed: %v", err)
+				}
+			}
+			alice := WithActor(ctx, "alice")
+			store.Create(alice, Document{ID: "a1", Name: "alice's report"})
+			store.Create(WithActor(ctx, "bob"), Document{ID: "b1", Name: "bob's report"})
+			store.GrantAccess(WithActor(ctx, "bob"), "b1", "user:alice", AccessWrite)
+			store.GrantAccess(WithActor(ctx, "bob"), "b1", "group:finance", AccessRead)
+
+			if err := store.DeleteUser(ctx, "alice"); err != nil {
+				t.Fatalf("DeleteUser() failed: %v", err)
+			}
+			if acl, err := store.GetACL(ctx, "a1"); err != nil || acl.Owner != "" {
+				t.Errorf("expected a deleted user's document to have no owner, got %+v, %v", acl, err)
+			}
+			if acl, err := store.GetACL(ctx, "b1"); err != nil || len(acl.Grants) != 1 || acl.Grants[0].Principal != "group:finance" {
+				t.Errorf("expected the grants to a deleted user to be revoked, got %+v, %v", acl, err)
+			}
+			if doc, _ := store.Get(ctx, "a1"); doc.CreatedBy != "alice" {
+				t.Errorf("expected the author to be kept, got %q", doc.CreatedBy)
+			}
+
+			// A new account under the same name inherits nothing
+			store.CreateUser(ctx, User{Username: "alice"})
+			viewer := WithViewer(ctx, Viewer{Username: "alice"})
+			if page, err := store.List(viewer, ListOptions{}); err != nil || page.Total != 0 {
+				t.Errorf("List() for the new alice = %+v, %v", page, err)
+			}
+			if results, err := store.Search(viewer, "report", 10); err != nil || results.Total != 0 {
+				t.Errorf("Search() for the new alice = %+v, %v", results, err)
+			}
+
+			acl, err := store.SetOwner(ctx, "a1", "bob")
+			if err != nil || acl.Owner != "bob" {
+				t.Errorf("SetOwner() = %+v, %v", acl, err)
+			}
+			if page, _ := store.List(WithViewer(ctx, Viewer{Username: "bob"}), ListOptions{}); page.Total != 2 {
+				t.Errorf("expected bob to see the document given to them, got %d", page.Total)
+			}
+			if _, err := store.SetOwner(ctx, "a1", "mallory"); !errors.Is(err, ErrInvalidGrant) {
+				t.Errorf("expected ErrInvalidGrant for an unknown owner, got %v", err)
+			}
+			if _, err := store.SetOwner(ctx, "missing", "bob"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			store.Delete(ctx, "a1")
+			store.Create(alice, Document{ID: "a1", Name: "again"})
+			if acl, _ := store.GetACL(ctx, "a1"); acl.Owner != "alice" {
+				t.Errorf("expected a recreated document to be owned by its creator, got %q", acl.Owner)
+			}
+		})
+	}
+}
+
+// TestStoreACL_Reopen checks that durable backends keep grants, groups and
+// owners across restarts
+func TestStoreACL_Reopen(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	populate := func(store Store) {
+		store.CreateUser(ctx, User{Username: "bob", Groups: []string{"finance", "audit", "finance"}})
+		store.CreateUser(ctx, User{Username: "carol"})
+		store.Create(ctx, Document{ID: "a1", Name: "shared"})
+		store.GrantAccess(ctx, "a1", "group:finance", AccessWrite)
+		store.SetOwner(ctx, "a1", "bob")
+		store.Create(WithActor(ctx, "carol"), Document{ID: "c1", Name: "orphaned"})
+		store.DeleteUser(ctx, "carol")
+	}
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		if acl, err := store.GetACL(ctx, "a1"); err != nil || acl.Owner != "bob" || len(acl.Grants) != 1 || acl.Grants[0].Principal != "group:finance" {
+			t.Errorf("GetACL() after reopen = %+v, %v", acl, err)
+		}
+		if acl, err := store.GetACL(ctx, "c1"); err != nil || acl.Owner != "" {
+			t.Errorf("GetACL() of a deleted user's document after reopen = %+v, %v", acl, err)
+		}
+		if user, err := store.GetUser(ctx, "bob"); err != nil || len(user.Groups) != 2 || user.Groups[0] != "audit" {
+			t.Errorf("GetUser() after reopen = %+v, %v", user, err)
+		}
+	}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	populate(fileStore)
+	fileStore.Compact()
+	fileStore.GrantAccess(ctx, "a1", "group:finance", AccessWrite)
+	fileStore.SetOwner(ctx, "a1", "bob")
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	check(t, reopenedFile)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	populate(sqliteStore)
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	check(t, reopenedSQLite)
+}
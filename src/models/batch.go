@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MaxBatchOperations bounds the number of operations in one batch
+const MaxBatchOperations = 1000
+
+// Operations a batch can perform
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchPatch  = "patch"
+	BatchDelete = "delete"
+)
+
+var (
+	// ErrInvalidBatch is returned for batches that are empty, too large or
+	// hold an operation of an unknown kind
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrBatchAborted is reported for the operations of an atomic batch
+	// that succeeded but were not applied because another one failed
+	ErrBatchAborted = errors.New("batch aborted: another operation failed")
+)
+
+// BatchOperation is one write of a batch. Create stores Document under ID,
+// Update replaces the document ID with Document as Update does, Patch
+// applies Patch to it and Delete removes it. Options apply to the operation
+// alone.
+type BatchOperation struct {
+	Op       string
+	ID       string
+	Document Document
+	Patch    DocumentPatch
+	Options  []WriteOption
+}
+
+// BatchResult is the outcome of one operation of a batch: the document as
+// written, or why the operation failed. Deletes leave Document empty.
+type BatchResult struct {
+	Document Document
+	Err      error
+}
+
+// checkBatch rejects batches that cannot be run at all
+func checkBatch(ops []BatchOperation) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("%w: no operations", ErrInvalidBatch)
+	}
+	if len(ops) > MaxBatchOperations {
+		return fmt.Errorf("%w: more than %d operations", ErrInvalidBatch, MaxBatchOperations)
+	}
+	return nil
+}
+
+// abortBatch marks the succeeded operations of a failed atomic batch as
+// aborted and reports whether the batch failed
+func abortBatch(results []BatchResult) bool {
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+	return true
+}
+
+// batchView is the store as seen by the operations of a batch: the
+// documents earlier operations wrote, layered over the stored ones
+type batchView struct {
+	store *DocumentStore
+	// written maps the IDs written so far to their new state, nil once
+	// deleted, and tombstones the deleted ones to their last version
+	written    map[string]*Document
+	tombstones map[string]int64
+}
+
+func (v *batchView) get(id string) (Document, bool) {
+	if doc, ok := v.written[id]; ok {
+		if doc == nil {
+			return Document{}, false
+		}
+		return *doc, true
+	}
+	doc, ok := v.store.documents[id]
+	return doc, ok
+}
+
+// latestRevision is DocumentStore.latestRevision as seen by the batch
+func (v *batchView) latestRevision(id string) int64 {
+	if doc, ok := v.written[id]; ok {
+		if doc == nil {
+			return v.tombstones[id]
+		}
+		return doc.Version
+	}
+	return v.store.latestRevision(id)
+}
+
+// acl is DocumentStore.acl as seen by the batch: a document deleted earlier
+// in it took its grants and owner with it, so one created again under its
+// ID is owned by its creator alone
+func (v *batchView) acl(doc Document) ACL {
+	if _, deleted := v.tombstones[doc.ID]; deleted {
+		return ACL{DocumentID: doc.ID, Owner: doc.CreatedBy, Grants: []Grant{}}
+	}
+	return v.store.acl(doc)
+}
+
+// stage checks op, and the viewer's access to the document it writes,
+// against the view and returns the record that performs it
+func (v *batchView) stage(ctx context.Context, op BatchOperation) (walRecord, error) {
+	if op.Op == BatchCreate {
+		if err := ValidateDocumentID(op.ID); err != nil {
+			return walRecord{}, err
+		}
+		if _, exists := v.get(op.ID); exists {
+			return walRecord{}, ErrDocumentExists
+		}
+		doc := op.Document
+		doc.ID, doc.ContentInfo = op.ID, ContentInfo{}
+		return v.store.preparePut(ctx, doc, nil, v.latestRevision(op.ID))
+	}
+
+	current, exists := v.get(op.ID)
+	if !exists {
+		return walRecord{}, ErrDocumentNotFound
+	}
+	if err := authorizeViewer(ctx, v.acl(current), AccessWrite); err != nil {
+		return walRecord{}, err
+	}
+	if err := collectWriteOptions(op.Options).check(current); err != nil {
+		return walRecord{}, err
+	}
+	switch op.Op {
+	case BatchUpdate:
+		doc := op.Document
+		doc.ID, doc.ContentInfo, doc.CollectionID = op.ID, current.ContentInfo, current.CollectionID
+		return v.store.preparePut(ctx, doc, &current, v.latestRevision(op.ID))
+	case BatchPatch:
+		if op.Patch == nil {
+			return walRecord{}, fmt.Errorf("%w: patch operation without a patch", ErrInvalidBatch)
+		}
+		doc, err := applyPatch(current, op.Patch)
+		if err != nil {
+			return walRecord{}, err
+		}
+		return v.store.preparePut(ctx, doc, &current, v.latestRevision(op.ID))
+	case BatchDelete:
+		return walRecord{Op: walOpDelete, ID: op.ID}, nil
+	}
+	return walRecord{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidBatch, op.Op)
+}
+
+func (s *DocumentStore) Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkBatch(ops); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results, records, released := s.stageBatch(ctx, ops)
+	if atomic && abortBatch(results) {
+		return results, nil
+	}
+	if err := s.commitBatch(records, released); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// stageBatch checks every operation against the outcome of the ones before
+// it. It returns the results, the records of the operations that succeeded
+// and the content their deletes release. Callers must hold mu for writing.
+func (s *DocumentStore) stageBatch(ctx context.Context, ops []BatchOperation) ([]BatchResult, []walRecord, []string) {
+	view := &batchView{store: s, written: make(map[string]*Document), tombstones: make(map[string]int64)}
+	results := make([]BatchResult, len(ops))
+	var records []walRecord
+	var released []string
+	for i, op := range ops {
+		current, _ := view.get(op.ID)
+		rec, err := view.stage(ctx, op)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		records = append(records, rec)
+		if rec.Doc == nil {
+			view.tombstones[op.ID] = view.latestRevision(op.ID)
+		}
+		view.written[op.ID] = rec.Doc
+		if rec.Doc != nil {
+			results[i].Document = *rec.Doc
+		} else if current.HasContent() {
+			released = append(released, current.ContentSHA256)
+		}
+	}
+	return results, records, released
+}
+
+// commitBatch journals records in one frame, applies them and then releases
+// the content of deleted documents. Callers must hold mu for writing.
+func (s *DocumentStore) commitBatch(records []walRecord, released []string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.commit(walRecord{Op: walOpBatch, Batch: records}); err != nil {
+		return err
+	}
+	for _, sha := range released {
+		s.blobs.release(sha)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// batchErrors returns the error of every result, nil for those that succeeded
+func batchErrors(results []BatchResult) []error {
+	errs := make([]error, len(results))
+	for i, result := range results {
+		errs[i] = result.Err
+	}
+	return errs
+}
+
+func TestStoreContract_Batch(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			store.Create(ctx, Document{ID: "a", Name: "Alpha"})
+			store.Create(ctx, Document{ID: "b", Name: "Beta"})
+
+			if _, err := store.Batch(ctx, nil, false); !errors.Is(err, ErrInvalidBatch) {
+				t.Errorf("expected ErrInvalidBatch for an empty batch, got %v", err)
+			}
+
+			merge, _ := ParseMergePatch([]byte(`{"description": "patched"}`))
+			results, err := store.Batch(ctx, []BatchOperation{
+				{Op: BatchCreate, ID: "c", Document: Document{Name: "Gamma quarterly"}},
+				{Op: BatchUpdate, ID: "a", Document: Document{Name: "Alpha 2"}},
+				{Op: BatchPatch, ID: "c", Patch: merge},
+				{Op: BatchDelete, ID: "missing"},
+				{Op: BatchCreate, ID: "a"},
+				{Op: BatchDelete, ID: "b", Options: []WriteOption{IfMatch(99)}},
+				{Op: "rename", ID: "b"},
+				{Op: BatchCreate, ID: "bad id"},
+			}, false)
+			if err != nil {
+				t.Fatalf("Batch() failed: %v", err)
+			}
+			wantErrs := []error{nil, nil, nil, ErrDocumentNotFound, ErrDocumentExists, ErrPreconditionFailed, ErrInvalidBatch, ErrInvalidDocumentID}
+			for i, got := range batchErrors(results) {
+				if !errors.Is(got, wantErrs[i]) || (wantErrs[i] == nil) != (got == nil) {
+					t.Errorf("operation %d: err = %v, want %v", i, got, wantErrs[i])
+				}
+			}
+			if results[2].Document.Version != 2 || results[2].Document.Description != "patched" {
+				t.Errorf("patch of a document created in the batch = %+v", results[2].Document)
+			}
+			if doc, err := store.Get(ctx, "c"); err != nil || doc.Version != 2 || doc.Name != "Gamma quarterly" {
+				t.Errorf("Get(c) = %+v, %v", doc, err)
+			}
+			if doc, _ := store.Get(ctx, "a"); doc.Version != 2 || doc.Name != "Alpha 2" {
+				t.Errorf("Get(a) = %+v", doc)
+			}
+			if found, _ := store.Search(ctx, "quarterly", 10); found.Total != 1 {
+				t.Errorf("expected a created document to be searchable, got %+v", found)
+			}
+
+			// Atomic batches apply everything or nothing
+			results, err = store.Batch(ctx, []BatchOperation{
+				{Op: BatchCreate, ID: "d"},
+				{Op: BatchDelete, ID: "a"},
+				{Op: BatchUpdate, ID: "missing"},
+			}, true)
+			if err != nil {
+				t.Fatalf("Batch() failed: %v", err)
+			}
+			wantErrs = []error{ErrBatchAborted, ErrBatchAborted, ErrDocumentNotFound}
+			for i, got := range batchErrors(results) {
+				if !errors.Is(got, wantErrs[i]) {
+					t.Errorf("operation %d: err = %v, want %v", i, got, wantErrs[i])
+				}
+			}
+			if _, err := store.Get(ctx, "d"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected the aborted create to be undone, got %v", err)
+			}
+			if _, err := store.Get(ctx, "a"); err != nil {
+				t.Errorf("expected the aborted delete to be undone, got %v", err)
+			}
+
+			// A document deleted and created again starts a new history
+			results, err = store.Batch(ctx, []BatchOperation{
+				{Op: BatchDelete, ID: "a"},
+				{Op: BatchCreate, ID: "a", Document: Document{Name: "Alpha again"}},
+			}, true)
+			if err != nil || results[0].Err != nil || results[1].Err != nil {
+				t.Fatalf("Batch() = %+v, %v", results, err)
+			}
+			if history, _ := store.ListRevisions(ctx, "a"); len(history) != 1 || history[0].Document.Name != "Alpha again" {
+				t.Errorf("expected a fresh history, got %+v", history)
+			}
+		})
+	}
+}
+
+func TestStoreContract_BatchAccess(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			alice := WithActor(context.Background(), "alice")
+			for _, id := range []string{"taken", "shared", "readonly"} {
+				store.Create(alice, Document{ID: id, Name: "Alice's"})
+			}
+			store.GrantAccess(alice, "shared", "user:bob", AccessWrite)
+			store.GrantAccess(alice, "readonly", "user:bob", AccessRead)
+			store.GrantAccess(alice, "shared", "user:carol", AccessWrite)
+
+			// Creating an ID someone else took does not make it bob's, and
+			// deleting a document takes its grants with it
+			bob := WithViewer(WithActor(context.Background(), "bob"), Viewer{Username: "bob"})
+			results, err := store.Batch(bob, []BatchOperation{
+				{Op: BatchCreate, ID: "taken", Document: Document{Name: "Bob's"}},
+				{Op: BatchUpdate, ID: "taken", Document: Document{Name: "Bob's"}},
+				{Op: BatchDelete, ID: "taken"},
+				{Op: BatchCreate, ID: "new", Document: Document{Name: "Bob's"}},
+				{Op: BatchUpdate, ID: "new", Document: Document{Name: "Bob's v2"}},
+				{Op: BatchUpdate, ID: "readonly", Document: Document{Name: "Bob's"}},
+				{Op: BatchDelete, ID: "shared"},
+				{Op: BatchCreate, ID: "shared", Document: Document{Name: "Bob's"}},
+				{Op: BatchUpdate, ID: "shared", Document: Document{Name: "Bob's v2"}},
+			}, false)
+			if err != nil {
+				t.Fatalf("Batch() failed: %v", err)
+			}
+			errs := batchErrors(results)
+			for i, want := range []error{ErrDocumentExists, ErrDocumentNotFound, ErrDocumentNotFound, nil, nil, ErrAccessDenied, nil, nil, nil} {
+				if !errors.Is(errs[i], want) || (want == nil && errs[i] != nil) {
+					t.Errorf("operation %d: got %v, want %v", i, errs[i], want)
+				}
+			}
+			if doc, _ := store.Get(alice, "taken"); doc.Name != "Alice's" {
+				t.Errorf("expected alice's document to be left alone, got %+v", doc)
+			}
+			if acl, err := store.GetACL(alice, "shared"); err != nil || acl.Owner != "bob" || len(acl.Grants) != 0 {
+				t.Errorf("GetACL() of the recreated document = %+v, %v", acl, err)
+			}
+
+			carol := WithViewer(WithActor(context.Background(), "carol"), Viewer{Username: "carol"})
+			results, _ = store.Batch(carol, []BatchOperation{{Op: BatchDelete, ID: "shared"}}, true)
+			if !errors.Is(results[0].Err, ErrDocumentNotFound) {
+				t.Errorf("expected the grants of the deleted document not to carry over, got %v", results[0].Err)
+			}
+		})
+	}
+}
+
+func TestFileStore_BatchReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "One"})
+	store.Batch(ctx, []BatchOperation{
+		{Op: BatchCreate, ID: "2", Document: Document{Name: "Two"}},
+		{Op: BatchDelete, ID: "1"},
+	}, true)
+	// Simulate a crash: the log is not compacted
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if _, err := reopened.Get(ctx, "1"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected 1 to stay deleted, got %v", err)
+	}
+	if doc, err := reopened.Get(ctx, "2"); err != nil || doc.Name != "Two" {
+		t.Errorf("Get(2) = %+v, %v", doc, err)
+	}
+}
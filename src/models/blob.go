@@ -0,0 +1,384 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// blobDirName holds the blobs inside a content directory, fanned out
+	// over subdirectories named after the first two digits of the hash
+	blobDirName = "sha256"
+	// stagingPrefix names uploads being received into a content directory
+	stagingPrefix = ".upload-"
+	// stagingGracePeriod is how long a staged upload may sit untouched
+	// before the garbage collector takes it for abandoned
+	stagingGracePeriod = time.Hour
+)
+
+// blobStore keeps content addressed by its SHA-256, so documents with
+// identical content share one copy. It counts the documents referencing
+// each blob and frees a blob when the last reference is released.
+//
+// Uploads are staged first, so the bytes stream in without the document
+// store's locks held; commit then stores them and takes a reference, which
+// the caller releases again if its document write fails.
+type blobStore struct {
+	mu      sync.Mutex
+	refs    map[string]int
+	backend blobBackend
+}
+
+// blobBackend is where a blobStore keeps its bytes
+type blobBackend interface {
+	stage(r io.Reader) (*stagedContent, error)
+	discard(staged *stagedContent)
+	// store makes staged bytes available under their hash; the caller
+	// guarantees no blob with that hash is stored
+	store(staged *stagedContent) error
+	open(sum string) (io.ReadSeekCloser, error)
+	remove(sum string) error
+	// list returns the hashes of every stored blob
+	list() ([]string, error)
+	// sweep removes staged uploads abandoned before the given time
+	sweep(before time.Time) (int, error)
+}
+
+func newBlobStore(backend blobBackend) *blobStore {
+	return &blobStore{refs: make(map[string]int), backend: backend}
+}
+
+func newMemBlobStore() *blobStore {
+	return newBlobStore(&memBlobs{blobs: make(map[string][]byte)})
+}
+
+// newDirBlobStore keeps blobs in files under dir
+func newDirBlobStore(dir string) (*blobStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, blobDirName), 0o750); err != nil {
+		return nil, fmt.Errorf("create content directory: %w", err)
+	}
+	return newBlobStore(&dirBlobs{dir: dir}), nil
+}
+
+// openDirBlobStore opens the blobs of a durable store whose documents
+// reference the content in refs, keyed by document ID. Content left by
+// earlier versions is migrated and unreferenced blobs are collected.
+func openDirBlobStore(dir string, refs map[string]string) (*blobStore, error) {
+	if err := migrateLegacyContent(dir, refs); err != nil {
+		return nil, err
+	}
+	blobs, err := newDirBlobStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, sum := range refs {
+		blobs.retain(sum)
+	}
+	if n, err := blobs.collectGarbage(time.Now()); err != nil {
+		log.Printf("Failed to collect unreferenced content: %v", err)
+	} else if n > 0 {
+		log.Printf("Removed %d unreferenced content files", n)
+	}
+	return blobs, nil
+}
+
+func (b *blobStore) stage(r io.Reader) (*stagedContent, error) {
+	return b.backend.stage(r)
+}
+
+func (b *blobStore) discard(staged *stagedContent) {
+	b.backend.discard(staged)
+}
+
+// commit stores staged bytes, unless a blob with the same hash exists
+// already, and takes a reference to the blob
+func (b *blobStore) commit(staged *stagedContent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refs[staged.sha256] > 0 {
+		b.backend.discard(staged)
+	} else if err := b.backend.store(staged); err != nil {
+		return err
+	}
+	b.refs[staged.sha256]++
+	return nil
+}
+
+// retain takes a reference to a stored blob, as when the documents of a
+// durable store are loaded
+func (b *blobStore) retain(sum string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs[sum]++
+}
+
+// release drops a reference and frees the blob once none are left. A blob
+// that cannot be removed now is left to the garbage collector.
+func (b *blobStore) release(sum string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.refs[sum]--; b.refs[sum] > 0 {
+		return
+	}
+	delete(b.refs, sum)
+	if err := b.backend.remove(sum); err != nil {
+		log.Printf("Failed to remove blob %s: %v", sum, err)
+	}
+}
+
+func (b *blobStore) open(sum string) (io.ReadSeekCloser, error) {
+	return b.backend.open(sum)
+}
+
+// collectGarbage removes the blobs no document references, such as those
+// left by a crash between storing a blob and writing its document, and the
+// uploads staged but abandoned before now. It returns how many it removed.
+func (b *blobStore) collectGarbage(now time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sums, err := b.backend.list()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, sum := range sums {
+		if b.refs[sum] > 0 {
+			continue
+		}
+		if err := b.backend.remove(sum); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	swept, err := b.backend.sweep(now.Add(-stagingGracePeriod))
+	return removed + swept, err
+}
+
+// memBlobs keeps blobs in memory
+type memBlobs struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func (m *memBlobs) stage(r io.Reader) (*stagedContent, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &stagedContent{size: int64(len(data)), sha256: hex.EncodeToString(sum[:]), data: data}, nil
+}
+
+func (m *memBlobs) discard(*stagedContent) {}
+
+func (m *memBlobs) store(staged *stagedContent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[staged.sha256] = staged.data
+	return nil
+}
+
+func (m *memBlobs) open(sum string) (io.ReadSeekCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[sum]
+	if !ok {
+		return nil, ErrContentNotFound
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (m *memBlobs) remove(sum string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, sum)
+	return nil
+}
+
+func (m *memBlobs) list() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sums := make([]string, 0, len(m.blobs))
+	for sum := range m.blobs {
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
+
+func (m *memBlobs) sweep(time.Time) (int, error) { return 0, nil }
+
+type nopSeekCloser struct{ io.ReadSeeker }
+
+func (nopSeekCloser) Close() error { return nil }
+
+// dirBlobs keeps each blob in a file under dir/sha256. Uploads are written
+// to a temporary file in dir and renamed into place, so readers never see
+// partial content, and an open stream survives the blob being freed.
+type dirBlobs struct {
+	dir string
+}
+
+func (d *dirBlobs) path(sum string) string {
+	return filepath.Join(d.dir, blobDirName, sum[:2], sum)
+}
+
+func (d *dirBlobs) stage(r io.Reader) (*stagedContent, error) {
+	f, err := os.CreateTemp(d.dir, stagingPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("stage content: %w", err)
+	}
+	staged := &stagedContent{path: f.Name()}
+
+	hash := sha256.New()
+	staged.size, err = io.Copy(io.MultiWriter(f, hash), r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(staged.path)
+		return nil, err
+	}
+	staged.sha256 = hex.EncodeToString(hash.Sum(nil))
+	return staged, nil
+}
+
+func (d *dirBlobs) discard(staged *stagedContent) {
+	os.Remove(staged.path)
+}
+
+func (d *dirBlobs) store(staged *stagedContent) error {
+	path := d.path(staged.sha256)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		os.Remove(staged.path)
+		return fmt.Errorf("store content: %w", err)
+	}
+	if err := os.Rename(staged.path, path); err != nil {
+		os.Remove(staged.path)
+		return fmt.Errorf("store content: %w", err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func (d *dirBlobs) open(sum string) (io.ReadSeekCloser, error) {
+	if !isSHA256Hex(sum) {
+		return nil, ErrContentNotFound
+	}
+	f, err := os.Open(d.path(sum))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrContentNotFound
+	}
+	return f, err
+}
+
+func (d *dirBlobs) remove(sum string) error {
+	if !isSHA256Hex(sum) {
+		return nil
+	}
+	err := os.Remove(d.path(sum))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *dirBlobs) list() ([]string, error) {
+	root := filepath.Join(d.dir, blobDirName)
+	fanout, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("list blobs: %w", err)
+	}
+	var sums []string
+	for _, sub := range fanout {
+		if !sub.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(root, sub.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("list blobs: %w", err)
+		}
+		for _, entry := range entries {
+			if isSHA256Hex(entry.Name()) && strings.HasPrefix(entry.Name(), sub.Name()) {
+				sums = append(sums, entry.Name())
+			}
+		}
+	}
+	return sums, nil
+}
+
+func (d *dirBlobs) sweep(before time.Time) (int, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return 0, fmt.Errorf("sweep staged content: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(d.dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// migrateLegacyContent moves content stored by document ID, as earlier
+// versions did, into blobs. refs maps the ID of each document with content
+// to its hash; files of other documents are removed.
+func migrateLegacyContent(dir string, refs map[string]string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read content directory: %w", err)
+	}
+	blobs := &dirBlobs{dir: dir}
+	byFile := make(map[string]string, len(refs))
+	for id, sum := range refs {
+		byFile[base64.RawURLEncoding.EncodeToString([]byte(id))] = sum
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		sum, ok := byFile[entry.Name()]
+		if !ok || !isSHA256Hex(sum) {
+			os.Remove(path)
+			continue
+		}
+		if _, err := os.Stat(blobs.path(sum)); err == nil {
+			os.Remove(path)
+			continue
+		}
+		target := blobs.path(sum)
+		if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return fmt.Errorf("migrate content: %w", err)
+		}
+		if err := os.Rename(path, target); err != nil {
+			return fmt.Errorf("migrate content: %w", err)
+		}
+	}
+	return syncDir(dir)
+}
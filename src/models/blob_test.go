@@ -0,0 +1,157 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countBlobs returns how many blobs a durable store keeps in dir
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	sums, err := (&dirBlobs{dir: filepath.Join(dir, contentDirName)}).list()
+	if err != nil {
+		t.Fatalf("listing blobs failed: %v", err)
+	}
+	return len(sums)
+}
+
+func TestStoreContract_SharedContent(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			for _, id := range []string{"1", "2", "3"} {
+				store.Create(ctx, Document{ID: id})
+				store.PutContent(ctx, id, "text/plain", strings.NewReader("shared attachment"))
+			}
+			store.PutContent(ctx, "3", "text/plain", strings.NewReader("replaced"))
+
+			if err := store.Delete(ctx, "1"); err != nil {
+				t.Fatalf("Delete() failed: %v", err)
+			}
+			if _, data := readContent(t, store, "2"); data != "shared attachment" {
+				t.Errorf("deleting one document freed content another references: %q", data)
+			}
+			if n, err := store.CollectGarbage(ctx); err != nil || n != 0 {
+				t.Errorf("CollectGarbage() = %d, %v while all content is referenced", n, err)
+			}
+
+			// The last reference frees the blob, so new uploads store it anew
+			store.Delete(ctx, "2")
+			store.Create(ctx, Document{ID: "4"})
+			store.PutContent(ctx, "4", "text/plain", strings.NewReader("shared attachment"))
+			if _, data := readContent(t, store, "4"); data != "shared attachment" {
+				t.Errorf("re-uploaded content = %q", data)
+			}
+			if _, data := readContent(t, store, "3"); data != "replaced" {
+				t.Errorf("replaced content = %q", data)
+			}
+		})
+	}
+}
+
+func TestBlobStore_Deduplicates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openTestFileStore(t, dir)
+	for _, id := range []string{"1", "2"} {
+		store.Create(ctx, Document{ID: id})
+		store.PutContent(ctx, id, "text/plain", strings.NewReader("identical bytes"))
+	}
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("expected identical content to be stored once, found %d blobs", n)
+	}
+
+	// References are counted again from the documents on reopen
+	store.Close()
+	store = openTestFileStore(t, dir)
+	defer store.Close()
+	store.Delete(ctx, "1")
+	if n := countBlobs(t, dir); n != 1 {
+		t.Errorf("blob freed while still referenced, found %d blobs", n)
+	}
+	store.Delete(ctx, "2")
+	if n := countBlobs(t, dir); n != 0 {
+		t.Errorf("expected the unreferenced blob to be freed, found %d blobs", n)
+	}
+}
+
+func TestBlobStore_CollectGarbage(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := newDirBlobStore(dir)
+	if err != nil {
+		t.Fatalf("newDirBlobStore() failed: %v", err)
+	}
+
+	kept, _ := blobs.stage(strings.NewReader("referenced"))
+	blobs.commit(kept)
+	// A blob stored for a document write that never happened
+	orphan, _ := blobs.stage(strings.NewReader("orphaned"))
+	blobs.commit(orphan)
+	blobs.refs[orphan.sha256] = 0
+	// An upload still being received, and one abandoned long ago
+	blobs.stage(strings.NewReader("in flight"))
+	abandoned, _ := blobs.stage(strings.NewReader("abandoned"))
+	old := time.Now().Add(-2 * stagingGracePeriod)
+	os.Chtimes(abandoned.path, old, old)
+
+	n, err := blobs.collectGarbage(time.Now())
+	if err != nil || n != 2 {
+		t.Errorf("collectGarbage() = %d, %v, want 2 removed", n, err)
+	}
+	if _, err := blobs.open(orphan.sha256); !errors.Is(err, ErrContentNotFound) {
+		t.Errorf("expected the orphaned blob to be removed, got %v", err)
+	}
+	if _, err := os.Stat(abandoned.path); !os.IsNotExist(err) {
+		t.Errorf("expected the abandoned upload to be removed")
+	}
+	stream, err := blobs.open(kept.sha256)
+	if err != nil {
+		t.Fatalf("referenced blob was removed: %v", err)
+	}
+	defer stream.Close()
+
+	// An open stream keeps reading after the blob is freed
+	blobs.release(kept.sha256)
+	if data, _ := io.ReadAll(stream); string(data) != "referenced" {
+		t.Errorf("open stream read %q after release", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, blobDirName, kept.sha256[:2])); len(entries) != 0 {
+		t.Errorf("expected the released blob to be removed")
+	}
+}
+
+func TestBlobStore_MigratesLegacyContent(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "a/b"})
+	store.PutContent(ctx, "a/b", "text/plain", strings.NewReader("from an older version"))
+	store.Close()
+
+	// Lay the content out the way it was stored by document ID
+	content := filepath.Join(dir, contentDirName)
+	os.RemoveAll(filepath.Join(content, blobDirName))
+	legacy := func(id string) string {
+		return filepath.Join(content, base64.RawURLEncoding.EncodeToString([]byte(id)))
+	}
+	os.WriteFile(legacy("a/b"), []byte("from an older version"), 0o640)
+	os.WriteFile(legacy("deleted"), []byte("no document"), 0o640)
+
+	store = openTestFileStore(t, dir)
+	defer store.Close()
+	if _, data := readContent(t, store, "a/b"); data != "from an older version" {
+		t.Errorf("migrated content = %q", data)
+	}
+	entries, _ := os.ReadDir(content)
+	if len(entries) != 1 || entries[0].Name() != blobDirName {
+		t.Errorf("expected only the blob directory to remain, found %d entries", len(entries))
+	}
+}
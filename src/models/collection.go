@@ -0,0 +1,409 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxCollectionDepth bounds how deeply collections nest
+const maxCollectionDepth = 32
+
+// reservedCollectionNames are path segments routed to other endpoints
+var reservedCollectionNames = map[string]bool{"documents": true}
+
+var (
+	// ErrInvalidCollectionPath is returned for malformed collection paths and
+	// for moves that would place a collection inside itself
+	ErrInvalidCollectionPath = errors.New("invalid collection path")
+	// ErrCollectionNotFound is returned when no collection exists at a path
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionExists is returned when a collection already exists at a path
+	ErrCollectionExists = errors.New("collection already exists")
+	// ErrCollectionNotEmpty is returned when deleting a collection that still
+	// holds documents or collections
+	ErrCollectionNotEmpty = errors.New("collection is not empty")
+)
+
+// Collection is a named folder of documents. Collections nest, and a
+// collection's Path joins the names of its ancestors and its own, as in
+// "/contracts/2026/q3". The root, "/", holds the top-level collections and
+// documents that were put in no collection; it is not a Collection itself.
+type Collection struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Path is derived from the names up the tree; it is not stored, so
+	// renaming a collection moves everything below it at once
+	Path      string    `json:"path"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+}
+
+// ParseCollectionPath splits a path such as "/contracts/2026/q3" into its
+// names. The root is "/" (or ""). Names follow the rules of document IDs,
+// and "documents" is reserved.
+func ParseCollectionPath(path string) ([]string, error) {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil, nil
+	}
+	names := strings.Split(trimmed, "/")
+	if len(names) > maxCollectionDepth {
+		return nil, fmt.Errorf("%w: deeper than %d levels", ErrInvalidCollectionPath, maxCollectionDepth)
+	}
+	for _, name := range names {
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("%w: empty name in %q", ErrInvalidCollectionPath, path)
+		case len(name) > maxDocumentIDLength:
+			return nil, fmt.Errorf("%w: name longer than %d characters", ErrInvalidCollectionPath, maxDocumentIDLength)
+		case name == "." || name == ".." || reservedCollectionNames[name]:
+			return nil, fmt.Errorf("%w: %q is not allowed", ErrInvalidCollectionPath, name)
+		}
+		for _, r := range name {
+			if !isUnreserved(r) {
+				return nil, fmt.Errorf("%w: character %q is not allowed", ErrInvalidCollectionPath, r)
+			}
+		}
+	}
+	return names, nil
+}
+
+// collectionPath joins names into a canonical path
+func collectionPath(names []string) string {
+	return "/" + strings.Join(names, "/")
+}
+
+func newCollectionID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("generate collection id: %w", err)
+	}
+	return id.String(), nil
+}
+
+// newCollection prepares a collection created by the user in ctx
+func newCollection(ctx context.Context, name, parentID string) (Collection, error) {
+	id, err := newCollectionID()
+	if err != nil {
+		return Collection{}, err
+	}
+	return Collection{ID: id, Name: name, ParentID: parentID, CreatedAt: time.Now().UTC(), CreatedBy: ActorFromContext(ctx)}, nil
+}
+
+// collectionTree holds the collections of a DocumentStore and the documents
+// each one holds directly. The root has the empty ID. It is not safe for
+// concurrent use; DocumentStore guards it with its lock.
+type collectionTree struct {
+	byID     map[string]Collection
+	children map[string]map[string]string   // parent ID -> name -> ID
+	members  map[string]map[string]struct{} // collection ID -> document IDs
+}
+
+func newCollectionTree() *collectionTree {
+	return &collectionTree{
+		byID:     make(map[string]Collection),
+		children: make(map[string]map[string]string),
+		members:  make(map[string]map[string]struct{}),
+	}
+}
+
+// put adds or replaces a collection; a replaced one may have a new name
+// or parent
+func (t *collectionTree) put(c Collection) {
+	if previous, ok := t.byID[c.ID]; ok {
+		delete(t.children[previous.ParentID], previous.Name)
+	}
+	c.Path = ""
+	t.byID[c.ID] = c
+	if t.children[c.ParentID] == nil {
+		t.children[c.ParentID] = make(map[string]string)
+	}
+	t.children[c.ParentID][c.Name] = c.ID
+}
+
+func (t *collectionTree) remove(id string) {
+	if c, ok := t.byID[id]; ok {
+		delete(t.children[c.ParentID], c.Name)
+		delete(t.byID, id)
+		delete(t.children, id)
+	}
+}
+
+func (t *collectionTree) addMember(doc Document) {
+	set, ok := t.members[doc.CollectionID]
+	if !ok {
+		set = make(map[string]struct{})
+		t.members[doc.CollectionID] = set
+	}
+	set[doc.ID] = struct{}{}
+}
+
+func (t *collectionTree) removeMember(doc Document) {
+	delete(t.members[doc.CollectionID], doc.ID)
+}
+
+// resolve returns the ID of the collection at the path names spell out
+func (t *collectionTree) resolve(names []string) (string, error) {
+	id := ""
+	for _, name := range names {
+		child, ok := t.children[id][name]
+		if !ok {
+			return "", ErrCollectionNotFound
+		}
+		id = child
+	}
+	return id, nil
+}
+
+// get returns a collection with its path filled in
+func (t *collectionTree) get(id string) Collection {
+	c := t.byID[id]
+	var names []string
+	for parent := c; parent.ID != ""; parent = t.byID[parent.ParentID] {
+		names = append(names, parent.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	c.Path = collectionPath(names)
+	return c
+}
+
+// descendants returns the IDs of the collections below id, breadth first
+func (t *collectionTree) descendants(id string) []string {
+	var ids []string
+	queue := []string{id}
+	for len(queue) > 0 {
+		for _, child := range t.children[queue[0]] {
+			ids = append(ids, child)
+			queue = append(queue, child)
+		}
+		queue = queue[1:]
+	}
+	return ids
+}
+
+// scope returns the IDs of the documents a listing of the collection at
+// path covers. ok is false when it covers every document.
+func (t *collectionTree) scope(path string, recursive bool) (ids []string, ok bool, err error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+	root, err := t.resolve(names)
+	if err != nil {
+		return nil, false, err
+	}
+	if root == "" && recursive {
+		return nil, false, nil
+	}
+	collections := []string{root}
+	if recursive {
+		collections = append(collections, t.descendants(root)...)
+	}
+	for _, id := range collections {
+		for doc := range t.members[id] {
+			ids = append(ids, doc)
+		}
+	}
+	return ids, true, nil
+}
+
+// sortCollections orders collections by path
+func sortCollections(collections []Collection) {
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Path < collections[j].Path })
+}
+
+func (s *DocumentStore) CreateCollection(ctx context.Context, path string) (Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return Collection{}, err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 {
+		return Collection{}, ErrCollectionExists
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.collections.resolve(names); err == nil {
+		return Collection{}, ErrCollectionExists
+	}
+	// Missing ancestors are created on the way down
+	parent := ""
+	for _, name := range names {
+		if id, ok := s.collections.children[parent][name]; ok {
+			parent = id
+			continue
+		}
+		c, err := newCollection(ctx, name, parent)
+		if err != nil {
+			return Collection{}, err
+		}
+		if err := s.commit(walRecord{Op: walOpPutCollection, ID: c.ID, Collection: &c}); err != nil {
+			return Collection{}, err
+		}
+		parent = c.ID
+	}
+	return s.collections.get(parent), nil
+}
+
+func (s *DocumentStore) GetCollection(ctx context.Context, path string) (Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return Collection{}, err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 {
+		return Collection{Path: "/"}, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, err := s.collections.resolve(names)
+	if err != nil {
+		return Collection{}, err
+	}
+	return s.collections.get(id), nil
+}
+
+func (s *DocumentStore) ListCollections(ctx context.Context, path string, recursive bool) ([]Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, err := s.collections.resolve(names)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if recursive {
+		ids = s.collections.descendants(id)
+	} else {
+		for _, child := range s.collections.children[id] {
+			ids = append(ids, child)
+		}
+	}
+	collections := make([]Collection, 0, len(ids))
+	for _, child := range ids {
+		collections = append(collections, s.collections.get(child))
+	}
+	sortCollections(collections)
+	return collections, nil
+}
+
+func (s *DocumentStore) MoveCollection(ctx context.Context, path, newPath string) (Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return Collection{}, err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	newNames, err := ParseCollectionPath(newPath)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 || len(newNames) == 0 {
+		return Collection{}, fmt.Errorf("%w: the root cannot be moved", ErrInvalidCollectionPath)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.collections.resolve(names)
+	if err != nil {
+		return Collection{}, err
+	}
+	parent, err := s.collections.resolve(newNames[:len(newNames)-1])
+	if err != nil {
+		return Collection{}, err
+	}
+	if _, err := s.collections.resolve(newNames); err == nil {
+		return Collection{}, ErrCollectionExists
+	}
+	for ancestor := parent; ancestor != ""; ancestor = s.collections.byID[ancestor].ParentID {
+		if ancestor == id {
+			return Collection{}, fmt.Errorf("%w: cannot move a collection into itself", ErrInvalidCollectionPath)
+		}
+	}
+
+	c := s.collections.byID[id]
+	c.Name, c.ParentID = newNames[len(newNames)-1], parent
+	if err := s.commit(walRecord{Op: walOpPutCollection, ID: id, Collection: &c}); err != nil {
+		return Collection{}, err
+	}
+	return s.collections.get(id), nil
+}
+
+func (s *DocumentStore) DeleteCollection(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: the root cannot be deleted", ErrInvalidCollectionPath)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.collections.resolve(names)
+	if err != nil {
+		return err
+	}
+	if len(s.collections.children[id]) > 0 || len(s.collections.members[id]) > 0 {
+		return ErrCollectionNotEmpty
+	}
+	return s.commit(walRecord{Op: walOpDeleteCollection, ID: id})
+}
+
+func (s *DocumentStore) MoveDocument(ctx context.Context, id, path string, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Document{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(doc); err != nil {
+		return Document{}, err
+	}
+	collection, err := s.collections.resolve(names)
+	if err != nil {
+		return Document{}, err
+	}
+	if collection == doc.CollectionID {
+		return doc, nil
+	}
+	doc.CollectionID = collection
+	if err := s.put(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
+}
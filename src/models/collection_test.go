@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCollectionPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", nil},
+		{"", nil},
+		{"/contracts", []string{"contracts"}},
+		{"contracts/2026/q3/", []string{"contracts", "2026", "q3"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCollectionPath(tt.path)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCollectionPath(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{"/a//b", "/a/../b", "/documents", "/a b", "/" + strings.Repeat("x", maxDocumentIDLength+1), strings.Repeat("/a", maxCollectionDepth+1)}
+	for _, path := range invalid {
+		if _, err := ParseCollectionPath(path); !errors.Is(err, ErrInvalidCollectionPath) {
+			t.Errorf("ParseCollectionPath(%q) = %v, want ErrInvalidCollectionPath", path, err)
+		}
+	}
+}
+
+// collectionPaths lists the paths of collections in order
+func collectionPaths(collections []Collection) []string {
+	paths := make([]string, 0, len(collections))
+	for _, c := range collections {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+func TestStoreContract_Collections(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := WithActor(context.Background(), "alice")
+
+			c, err := store.CreateCollection(ctx, "/contracts/2026/q3")
+			if err != nil || c.Path != "/contracts/2026/q3" || c.Name != "q3" || c.ID == "" || c.CreatedBy != "alice" {
+				t.Fatalf("CreateCollection() = %+v, %v", c, err)
+			}
+			if _, err := store.CreateCollection(ctx, "/contracts/2026/q3"); !errors.Is(err, ErrCollectionExists) {
+				t.Errorf("expected ErrCollectionExists, got %v", err)
+			}
+			store.CreateCollection(ctx, "/contracts/2025")
+			store.CreateCollection(ctx, "/reports")
+
+			parent, err := store.GetCollection(ctx, "/contracts/2026")
+			if err != nil || parent.Path != "/contracts/2026" {
+				t.Errorf("GetCollection() = %+v, %v", parent, err)
+			}
+			if c.ParentID != parent.ID {
+				t.Errorf("parent_id = %q, want %q", c.ParentID, parent.ID)
+			}
+			if _, err := store.GetCollection(ctx, "/missing"); !errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("expected ErrCollectionNotFound, got %v", err)
+			}
+
+			children, err := store.ListCollections(ctx, "/", false)
+			if got := collectionPaths(children); err != nil || !reflect.DeepEqual(got, []string{"/contracts", "/reports"}) {
+				t.Errorf("ListCollections(/) = %v, %v", got, err)
+			}
+			all, err := store.ListCollections(ctx, "/contracts", true)
+			want := []string{"/contracts/2025", "/contracts/2026", "/contracts/2026/q3"}
+			if got := collectionPaths(all); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("ListCollections(/contracts, recursive) = %v, %v, want %v", got, err, want)
+			}
+
+			store.Create(ctx, Document{ID: "root", Name: "Root"})
+			store.Create(ctx, Document{ID: "q3", Name: "Q3", CollectionID: c.ID})
+			store.Create(ctx, Document{ID: "2026", Name: "Year", CollectionID: parent.ID})
+			if err := store.Create(ctx, Document{ID: "bad", CollectionID: "missing"}); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation for an unknown collection, got %v", err)
+			}
+
+			doc, err := store.MoveDocument(ctx, "root", "/reports")
+			if err != nil || doc.Version != 2 || doc.CollectionID == "" {
+				t.Errorf("MoveDocument() = %+v, %v", doc, err)
+			}
+			if doc, err := store.MoveDocument(ctx, "root", "/reports"); err != nil || doc.Version != 2 {
+				t.Errorf("MoveDocument() into the same collection = %+v, %v, want version 2 kept", doc, err)
+			}
+			if _, err := store.MoveDocument(ctx, "root", "/missing"); !errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("expected ErrCollectionNotFound, got %v", err)
+			}
+			if _, err := store.MoveDocument(ctx, "root", "/", IfMatch(1)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			// Replacing a document keeps it where it is
+			store.Update(ctx, "root", Document{Name: "Renamed"})
+			if got, _ := store.Get(ctx, "root"); got.CollectionID != doc.CollectionID {
+				t.Errorf("Update() moved the document to %q", got.CollectionID)
+			}
+
+			listings := []struct {
+				name string
+				opts ListOptions
+				want []string
+			}{
+				{"root", ListOptions{Collection: "/"}, []string{}},
+				{"everything", ListOptions{Collection: "/", Recursive: true}, []string{"2026", "q3", "root"}},
+				{"direct", ListOptions{Collection: "/contracts/2026"}, []string{"2026"}},
+				{"recursive", ListOptions{Collection: "/contracts", Recursive: true}, []string{"2026", "q3"}},
+				{"with tag", ListOptions{Collection: "/contracts", Recursive: true, Tags: []string{"missing"}}, []string{}},
+			}
+			for _, tt := range listings {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: List() = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+			if _, err := store.List(ctx, ListOptions{Collection: "/missing", Limit: 10}); !errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("expected ErrCollectionNotFound, got %v", err)
+			}
+
+			// Moving a collection takes its subtree and documents along
+			moved, err := store.MoveCollection(ctx, "/contracts/2026", "/archive")
+			if err != nil || moved.Path != "/archive" || moved.Name != "archive" || moved.ParentID != "" {
+				t.Errorf("MoveCollection() = %+v, %v", moved, err)
+			}
+			if got, err := store.GetCollection(ctx, "/archive/q3"); err != nil || got.ID != c.ID {
+				t.Errorf("GetCollection(/archive/q3) = %+v, %v", got, err)
+			}
+			if got := listIDs(t, store, ListOptions{Collection: "/archive", Recursive: true}); !reflect.DeepEqual(got, []string{"2026", "q3"}) {
+				t.Errorf("after MoveCollection: /archive = %v", got)
+			}
+			if _, err := store.MoveCollection(ctx, "/archive", "/archive/q3/inner"); !errors.Is(err, ErrInvalidCollectionPath) {
+				t.Errorf("expected ErrInvalidCollectionPath moving into itself, got %v", err)
+			}
+			if _, err := store.MoveCollection(ctx, "/archive", "/reports"); !errors.Is(err, ErrCollectionExists) {
+				t.Errorf("expected ErrCollectionExists, got %v", err)
+			}
+			if _, err := store.MoveCollection(ctx, "/archive", "/missing/archive"); !errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("expected ErrCollectionNotFound, got %v", err)
+			}
+
+			if err := store.DeleteCollection(ctx, "/archive"); !errors.Is(err, ErrCollectionNotEmpty) {
+				t.Errorf("expected ErrCollectionNotEmpty, got %v", err)
+			}
+			store.Delete(ctx, "q3")
+			if err := store.DeleteCollection(ctx, "/archive/q3"); err != nil {
+				t.Errorf("DeleteCollection() failed: %v", err)
+			}
+			if _, err := store.GetCollection(ctx, "/archive/q3"); !errors.Is(err, ErrCollectionNotFound) {
+				t.Errorf("expected ErrCollectionNotFound after delete, got %v", err)
+			}
+			if err := store.DeleteCollection(ctx, "/"); !errors.Is(err, ErrInvalidCollectionPath) {
+				t.Errorf("expected ErrInvalidCollectionPath deleting the root, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreCollections_Reopen checks that durable backends keep collections
+// and document placement across restarts
+func TestStoreCollections_Reopen(t *testing.T) {
+	ctx := context.Background()
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		all, err := store.ListCollections(ctx, "/", true)
+		if got := collectionPaths(all); err != nil || !reflect.DeepEqual(got, []string{"/a", "/a/b", "/c"}) {
+			t.Errorf("ListCollections() after reopen = %v, %v", got, err)
+		}
+		if got := listIDs(t, store, ListOptions{Collection: "/a/b"}); !reflect.DeepEqual(got, []string{"1", "2"}) {
+			t.Errorf("listing /a/b after reopen = %v, want [1 2]", got)
+		}
+	}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.CreateCollection(ctx, "/a/b")
+	fileStore.Create(ctx, Document{ID: "1"})
+	fileStore.MoveDocument(ctx, "1", "/a/b")
+	fileStore.Compact()
+	fileStore.CreateCollection(ctx, "/c")
+	fileStore.Create(ctx, Document{ID: "2"})
+	fileStore.MoveDocument(ctx, "2", "/a/b")
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	check(t, reopenedFile)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.CreateCollection(ctx, "/a/b")
+	sqliteStore.CreateCollection(ctx, "/c")
+	for _, id := range []string{"1", "2"} {
+		sqliteStore.Create(ctx, Document{ID: id})
+		sqliteStore.MoveDocument(ctx, id, "/a/b")
+	}
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	check(t, reopenedSQLite)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// DefaultContentType is recorded for uploads that do not declare a type
+const DefaultContentType = "application/octet-stream"
+
+// ErrContentNotFound is returned when reading the content of a document
+// that has none
+var ErrContentNotFound = errors.New("document has no content")
+
+// ContentInfo describes the binary content attached to a document. It is
+// managed by the store: only PutContent changes it.
+type ContentInfo struct {
+	ContentType   string `json:"content_type,omitempty"`
+	ContentSize   int64  `json:"content_size,omitempty"`
+	ContentSHA256 string `json:"content_sha256,omitempty"`
+}
+
+// HasContent reports whether content has been uploaded
+func (c ContentInfo) HasContent() bool {
+	return c.ContentSHA256 != ""
+}
+
+// Content is an open stream of a document's content. Document is the state
+// the content belongs to; the caller must Close the stream.
+type Content struct {
+	Document Document
+	io.ReadSeekCloser
+}
+
+// stagedContent is an upload that has been received but not yet attached
+type stagedContent struct {
+	size   int64
+	sha256 string
+	data   []byte // memBlobs
+	path   string // dirBlobs
+}
+
+// info describes the staged bytes as content of the given type
+func (sc *stagedContent) info(contentType string) ContentInfo {
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	return ContentInfo{ContentType: contentType, ContentSize: sc.size, ContentSHA256: sc.sha256}
+}
+
+func (s *DocumentStore) PutContent(ctx context.Context, id, contentType string, r io.Reader, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	staged, err := s.blobs.stage(r)
+	if err != nil {
+		return Document{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.documents[id]
+	if !exists {
+		s.blobs.discard(staged)
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(current); err != nil {
+		s.blobs.discard(staged)
+		return Document{}, err
+	}
+	if err := s.blobs.commit(staged); err != nil {
+		return Document{}, err
+	}
+
+	doc := current
+	doc.ContentInfo = staged.info(contentType)
+	if err := s.put(ctx, doc); err != nil {
+		s.blobs.release(staged.sha256)
+		return Document{}, err
+	}
+	if current.HasContent() {
+		s.blobs.release(current.ContentSHA256)
+	}
+	return s.documents[id], nil
+}
+
+func (s *DocumentStore) OpenContent(ctx context.Context, id string) (Content, error) {
+	if err := ctx.Err(); err != nil {
+		return Content{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return Content{}, ErrDocumentNotFound
+	}
+	if !doc.HasContent() {
+		return Content{}, ErrContentNotFound
+	}
+	stream, err := s.blobs.open(doc.ContentSHA256)
+	if err != nil {
+		return Content{}, err
+	}
+	return Content{Document: doc, ReadSeekCloser: stream}, nil
+}
+
+func (s *DocumentStore) CollectGarbage(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.blobs.collectGarbage(time.Now())
+}
+
+// contentRefs maps the ID of every document with content to its hash
+func (s *DocumentStore) contentRefs() map[string]string {
+	refs := make(map[string]string)
+	for id, doc := range s.documents {
+		if doc.HasContent() {
+			refs[id] = doc.ContentSHA256
+		}
+	}
+	return refs
+}
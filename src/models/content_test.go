@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readContent(t *testing.T, store Store, id string) (Content, string) {
+	t.Helper()
+	content, err := store.OpenContent(context.Background(), id)
+	if err != nil {
+		t.Fatalf("OpenContent(%q) failed: %v", id, err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatalf("reading content failed: %v", err)
+	}
+	return content, string(data)
+}
+
+func TestStoreContract_Content(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			store.Create(ctx, Document{ID: "1", Name: "Report"})
+
+			if _, err := store.OpenContent(ctx, "1"); !errors.Is(err, ErrContentNotFound) {
+				t.Errorf("expected ErrContentNotFound before upload, got %v", err)
+			}
+
+			body := "%PDF-1.7 quarterly numbers"
+			sum := sha256.Sum256([]byte(body))
+			doc, err := store.PutContent(WithActor(ctx, "alice"), "1", "application/pdf", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("PutContent() failed: %v", err)
+			}
+			want := ContentInfo{ContentType: "application/pdf", ContentSize: int64(len(body)), ContentSHA256: hex.EncodeToString(sum[:])}
+			if doc.ContentInfo != want || doc.Version != 2 || doc.UpdatedBy != "alice" || doc.Name != "Report" {
+				t.Errorf("PutContent() = %+v, want content %+v at version 2", doc, want)
+			}
+
+			content, data := readContent(t, store, "1")
+			if data != body || !reflect.DeepEqual(content.Document, doc) {
+				t.Errorf("OpenContent() = %q for %+v", data, content.Document)
+			}
+
+			// Metadata writes keep the content; restores do not bring back old content
+			store.Update(ctx, "1", Document{Name: "Report v2"})
+			store.PartialUpdate(ctx, "1", map[string]interface{}{"description": "Annotated"})
+			store.RestoreRevision(ctx, "1", 1)
+			current, _ := store.Get(ctx, "1")
+			if current.ContentInfo != want {
+				t.Errorf("content changed by metadata writes: %+v", current)
+			}
+
+			doc, err = store.PutContent(ctx, "1", "", strings.NewReader(""))
+			if err != nil || doc.ContentType != DefaultContentType || doc.ContentSize != 0 || !doc.HasContent() {
+				t.Errorf("empty upload = %+v, %v", doc, err)
+			}
+			if _, data := readContent(t, store, "1"); data != "" {
+				t.Errorf("expected empty content, got %q", data)
+			}
+
+			if _, err := store.PutContent(ctx, "1", "text/plain", strings.NewReader("stale"), IfMatch(1)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			if _, err := store.PutContent(ctx, "missing", "text/plain", strings.NewReader("x")); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+			if _, err := store.OpenContent(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			// A recreated document does not inherit the deleted one's content
+			store.Delete(ctx, "1")
+			store.Create(ctx, Document{ID: "1", ContentInfo: want})
+			if _, err := store.OpenContent(ctx, "1"); !errors.Is(err, ErrContentNotFound) {
+				t.Errorf("expected ErrContentNotFound after recreate, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreContent_Reopen(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.Create(ctx, Document{ID: "1"})
+	fileStore.PutContent(ctx, "1", "text/plain", strings.NewReader("kept on disk"))
+	fileStore.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	if _, data := readContent(t, reopenedFile, "1"); data != "kept on disk" {
+		t.Errorf("file store content after reopen = %q", data)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.Create(ctx, Document{ID: "1"})
+	sqliteStore.PutContent(ctx, "1", "text/plain", strings.NewReader("kept in files"))
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	content, data := readContent(t, reopenedSQLite, "1")
+	if data != "kept in files" || content.Document.ContentType != "text/plain" {
+		t.Errorf("sqlite content after reopen = %q (%+v)", data, content.Document)
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the username performing the operation
+func WithActor(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, actorKey{}, username)
+}
+
+// ActorFromContext returns the username stored by WithActor, or "" if none
+func ActorFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(actorKey{}).(string)
+	return username
+}
@@ -1,131 +1,468 @@
 package models
 
 import (
-	"errors"
-	"reflect"
+	"context"
 	"sync"
+	"time"
 )
 
 type Document struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Type names the kind of document; if a Schema is registered for it,
+	// the metadata must conform to it
+	Type string `json:"type,omitempty"`
+	// Version is the number of the document's latest revision. It is managed
+	// by the store (client-supplied values are ignored) and backs the ETag.
+	Version int64 `json:"version"`
+	// CreatedAt, UpdatedAt, CreatedBy and UpdatedBy are likewise set by the
+	// store from the clock and the authenticated user of each write.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedBy string    `json:"created_by"`
+	UpdatedBy string    `json:"updated_by"`
+	// CollectionID is the collection holding the document, empty for the
+	// root. It is chosen on create and changed only by moving the document.
+	CollectionID string `json:"collection_id,omitempty"`
+	// Metadata holds user-defined key/value pairs and Tags a set of labels;
+	// both can be filtered on when listing. Stores keep tags sorted and
+	// deduplicated. Documents returned by a store share these with it and
+	// must not be modified in place.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	ContentInfo
 }
 
+// serverManagedFields are the JSON names of the fields only the store may set
+var serverManagedFields = map[string]bool{
+	"id":         true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+	"created_by": true,
+	"updated_by": true,
+	// Set on create and through MoveDocument
+	"collection_id": true,
+	// Set through PutContent
+	"content_type":   true,
+	"content_size":   true,
+	"content_sha256": true,
+}
+
+// stamp records a write of doc by the user in ctx. The creation fields are
+// carried over from previous, the stored state being replaced, if there is one.
+func stamp(ctx context.Context, doc *Document, previous *Document) {
+	now := time.Now().UTC()
+	actor := ActorFromContext(ctx)
+	if previous != nil {
+		doc.CreatedAt, doc.CreatedBy = previous.CreatedAt, previous.CreatedBy
+	} else {
+		doc.CreatedAt, doc.CreatedBy = now, actor
+	}
+	doc.UpdatedAt, doc.UpdatedBy = now, actor
+}
+
+// DocumentStore is the in-memory Store implementation backed by a map
 type DocumentStore struct {
 	mu        sync.RWMutex
 	documents map[string]Document
+	revisions map[string][]Revision
+	index     *searchIndex
+	labels    *labelIndex
+	// collections is the collection hierarchy and which documents each
+	// collection holds
+	collections *collectionTree
+	// schemas holds the registered schemas by type, and compiledSchemas
+	// the same compiled for validation
+	schemas         map[string]Schema
+	compiledSchemas map[string]*jsonSchema
+	// users holds the accounts that can log in, by name
+	users map[string]User
+	// grants holds who each document is shared with, by document ID
+	grants map[string][]Grant
+	// owners holds the owner of every document that was given to someone
+	// else than its creator, or left without one (""), by document ID
+	owners map[string]string
+	// tombstones holds the last version of every deleted document, by ID,
+	// so that one created again under its ID continues from there and
+	// versions, and the ETags made of them, are never reused
+	tombstones map[string]int64
+	// sessions holds the logins that can still be refreshed, by ID, and
+	// revokedTokens the expiry of each token revoked before it expired
+	sessions      map[string]Session
+	revokedTokens map[string]time.Time
+	blobs         *blobStore
+	// transactions holds the open transactions, which are handed the
+	// state every write replaces
+	transactions map[*memTx]struct{}
+
+	// journal, when set, durably records every mutation before it is
+	// applied to the map. It is always invoked with mu held for writing.
+	journal journal
 }
 
+var _ Store = (*DocumentStore)(nil)
+
 func NewDocumentStore() *DocumentStore {
 	return &DocumentStore{
-		documents: make(map[string]Document),
+		documents:       make(map[string]Document),
+		revisions:       make(map[string][]Revision),
+		index:           newSearchIndex(),
+		labels:          newLabelIndex(),
+		collections:     newCollectionTree(),
+		schemas:         make(map[string]Schema),
+		compiledSchemas: make(map[string]*jsonSchema),
+		users:           make(map[string]User),
+		grants:          make(map[string][]Grant),
+		owners:          make(map[string]string),
+		tombstones:      make(map[string]int64),
+		sessions:        make(map[string]Session),
+		revokedTokens:   make(map[string]time.Time),
+		blobs:           newMemBlobStore(),
+		transactions:    make(map[*memTx]struct{}),
 	}
 }
 
-func (s *DocumentStore) Create(doc Document) error {
+func (s *DocumentStore) Create(ctx context.Context, doc Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if _, exists := s.documents[doc.ID]; exists {
-		return errors.New("document already exists")
+		return ErrDocumentExists
 	}
-	s.documents[doc.ID] = doc
-	return nil
+	doc.ContentInfo = ContentInfo{}
+	return s.put(ctx, doc)
 }
 
-func (s *DocumentStore) Get(id string) (Document, error) {
+func (s *DocumentStore) Get(ctx context.Context, id string) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	doc, exists := s.documents[id]
 	if !exists {
-		return Document{}, errors.New("document not found")
+		return Document{}, ErrDocumentNotFound
 	}
 	return doc, nil
 }
 
-func (s *DocumentStore) Delete(id string) error {
+func (s *DocumentStore) Patch(ctx context.Context, id string, patch DocumentPatch, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.documents[id]
+	if !exists {
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(current); err != nil {
+		return Document{}, err
+	}
+
+	doc, err := applyPatch(current, patch)
+	if err != nil {
+		return Document{}, err
+	}
+	if err := s.put(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
+}
+
+func (s *DocumentStore) UpdateTags(ctx context.Context, id string, add, remove []string, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, exists := s.documents[id]
+	if !exists {
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(doc); err != nil {
+		return Document{}, err
+	}
+
+	tags, changed := retag(doc.Tags, add, remove)
+	if !changed {
+		return doc, nil
+	}
+	doc.Tags = tags
+	if err := s.put(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string, opts ...WriteOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.documents[id]; !exists {
-		return errors.New("document not found")
+	current, exists := s.documents[id]
+	if !exists {
+		return ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(current); err != nil {
+		return err
 	}
 
-	delete(s.documents, id)
+	if err := s.commit(walRecord{Op: walOpDelete, ID: id}); err != nil {
+		return err
+	}
+	if current.HasContent() {
+		s.blobs.release(current.ContentSHA256)
+	}
 	return nil
 }
 
-func (s *DocumentStore) List() []Document {
+func (s *DocumentStore) List(ctx context.Context, opts ListOptions) (DocumentPage, error) {
+	if err := ctx.Err(); err != nil {
+		return DocumentPage{}, err
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	docs := make([]Document, 0, len(s.documents))
-	for _, doc := range s.documents {
-		docs = append(docs, doc)
+	ids, ok := s.labels.lookup(opts)
+	if opts.Collection != "" {
+		inCollection, scoped, err := s.collections.scope(opts.Collection, opts.Recursive)
+		if err != nil {
+			return DocumentPage{}, err
+		}
+		if scoped && ok {
+			ids = intersect(ids, inCollection)
+		} else if scoped {
+			ids, ok = inCollection, true
+		}
 	}
-	return docs
+
+	visible := s.visibleTo(ctx)
+	var docs []Document
+	if ok {
+		docs = make([]Document, 0, len(ids))
+		for _, id := range ids {
+			if doc := s.documents[id]; visible == nil || visible(doc) {
+				docs = append(docs, doc)
+			}
+		}
+	} else {
+		docs = make([]Document, 0, len(s.documents))
+		for _, doc := range s.documents {
+			if visible == nil || visible(doc) {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return paginate(docs, opts)
+}
+
+// visibleTo returns whether the viewer in ctx may see a document, or nil if
+// there is no viewer and every document is visible. Callers must hold mu
+// while using it.
+func (s *DocumentStore) visibleTo(ctx context.Context) func(doc Document) bool {
+	viewer, ok := ViewerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return func(doc Document) bool { return viewer.canSee(s.acl(doc)) }
+}
+
+func (s *DocumentStore) Search(ctx context.Context, query string, limit int) (SearchResults, error) {
+	if err := ctx.Err(); err != nil {
+		return SearchResults{}, err
+	}
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index.search(q, clampSearchLimit(limit), s.visibleTo(ctx)), nil
 }
 
-func (s *DocumentStore) Update(id string, doc Document) error {
+func (s *DocumentStore) Update(ctx context.Context, id string, doc Document, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.documents[id]; !exists {
-		return errors.New("document not found")
+	current, exists := s.documents[id]
+	if !exists {
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(current); err != nil {
+		return Document{}, err
 	}
 
-	// Ensure the document ID matches the path parameter
+	// Ensure the document ID matches the path parameter; content is only
+	// replaced through PutContent and the collection by MoveDocument
 	doc.ID = id
-	s.documents[id] = doc
-	return nil
+	doc.ContentInfo = current.ContentInfo
+	doc.CollectionID = current.CollectionID
+	if err := s.put(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
 }
 
-func (s *DocumentStore) PartialUpdate(id string, updates map[string]interface{}) error {
+func (s *DocumentStore) PartialUpdate(ctx context.Context, id string, updates map[string]interface{}, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	doc, exists := s.documents[id]
 	if !exists {
-		return errors.New("document not found")
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(doc); err != nil {
+		return Document{}, err
 	}
 
-	// Use reflection to automatically detect and update attributes
-	docValue := reflect.ValueOf(&doc).Elem()
-	docType := reflect.TypeOf(doc)
+	if err := applyPartialUpdate(&doc, updates); err != nil {
+		return Document{}, err
+	}
+	if err := s.put(ctx, doc); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
+}
 
-	for key, value := range updates {
-		// Skip ID field to prevent modification
-		if key == "id" {
-			continue
-		}
+// Close releases resources held by the store. The in-memory store holds none.
+func (s *DocumentStore) Close() error {
+	return nil
+}
 
-		// Find the field by JSON tag or field name
-		fieldIndex := -1
-		for i := 0; i < docType.NumField(); i++ {
-			field := docType.Field(i)
-			jsonTag := field.Tag.Get("json")
-			// Check if the key matches the JSON tag or field name
-			if jsonTag == key || field.Name == key {
-				fieldIndex = i
-				break
-			}
-		}
+// put stores doc as the current state under the next version number and
+// records it as a new revision. Callers must hold mu for writing.
+func (s *DocumentStore) put(ctx context.Context, doc Document) error {
+	var previous *Document
+	if current, exists := s.documents[doc.ID]; exists {
+		previous = &current
+	}
+	rec, err := s.preparePut(ctx, doc, previous, s.latestRevision(doc.ID))
+	if err != nil {
+		return err
+	}
+	return s.commit(rec)
+}
 
-		// If field found, update it only if types match exactly
-		if fieldIndex >= 0 {
-			field := docValue.Field(fieldIndex)
-			if field.CanSet() {
-				valueReflect := reflect.ValueOf(value)
-				// Only update if the types match exactly (no conversion)
-				if valueReflect.Type() == field.Type() {
-					field.Set(valueReflect)
-				}
-				// Invalid types are silently ignored
-			}
-		}
-		// Unknown fields are silently ignored
+// latestRevision returns the number of the newest revision recorded for id,
+// or of the last one of a deleted document, or 0 if there is none. Callers
+// must hold mu.
+func (s *DocumentStore) latestRevision(id string) int64 {
+	latest := s.documents[id].Version
+	if history := s.revisions[id]; len(history) > 0 && history[len(history)-1].Revision > latest {
+		latest = history[len(history)-1].Revision
 	}
+	if tombstone := s.tombstones[id]; tombstone > latest {
+		latest = tombstone
+	}
+	return latest
+}
 
-	s.documents[id] = doc
+// preparePut validates doc as the state replacing previous (nil on create)
+// and returns the record that writes it as revision latest+1. Callers must
+// hold mu.
+func (s *DocumentStore) preparePut(ctx context.Context, doc Document, previous *Document, latest int64) (walRecord, error) {
+	if err := normalizeLabels(&doc); err != nil {
+		return walRecord{}, err
+	}
+	if _, ok := s.collections.byID[doc.CollectionID]; doc.CollectionID != "" && !ok {
+		return walRecord{}, &ValidationError{Errors: []FieldError{{Field: "collection_id", Message: "no such collection"}}}
+	}
+	if err := checkDocumentSchema(doc, previous, s.compiledSchemas[doc.Type]); err != nil {
+		return walRecord{}, err
+	}
+	stamp(ctx, &doc, previous)
+	doc.Version = latest + 1
+	return walRecord{Op: walOpPut, ID: doc.ID, Doc: &doc, Rev: newRevision(doc)}, nil
+}
+
+// commit journals a mutation (if a journal is attached) and then applies it.
+// Callers must hold mu for writing.
+func (s *DocumentStore) commit(rec walRecord) error {
+	if s.journal != nil {
+		if err := s.journal.append(&rec); err != nil {
+			return err
+		}
+	}
+	s.preserve(rec)
+	s.apply(rec)
 	return nil
 }
+
+// apply performs a journaled mutation on the map without recording it again
+func (s *DocumentStore) apply(rec walRecord) {
+	switch rec.Op {
+	case walOpPut:
+		if previous, ok := s.documents[rec.ID]; ok {
+			s.labels.remove(previous)
+			s.collections.removeMember(previous)
+		}
+		s.documents[rec.ID] = *rec.Doc
+		delete(s.tombstones, rec.ID)
+		s.labels.add(*rec.Doc)
+		s.collections.addMember(*rec.Doc)
+		if rec.Rev != nil {
+			s.revisions[rec.ID] = append(s.revisions[rec.ID], *rec.Rev)
+		}
+		s.index.add(*rec.Doc)
+	case walOpDelete:
+		if previous, ok := s.documents[rec.ID]; ok {
+			s.labels.remove(previous)
+			s.collections.removeMember(previous)
+			s.tombstones[rec.ID] = s.latestRevision(rec.ID)
+		}
+		delete(s.documents, rec.ID)
+		delete(s.revisions, rec.ID)
+		delete(s.grants, rec.ID)
+		delete(s.owners, rec.ID)
+		s.index.remove(rec.ID)
+	case walOpPutCollection:
+		s.collections.put(*rec.Collection)
+	case walOpDeleteCollection:
+		s.collections.remove(rec.ID)
+	case walOpPutSchema:
+		s.schemas[rec.ID] = *rec.Schema
+		// Schemas are checked before they are journaled, so this compiles
+		s.compiledSchemas[rec.ID], _ = compileJSONSchema(rec.Schema.Schema)
+	case walOpDeleteSchema:
+		delete(s.schemas, rec.ID)
+		delete(s.compiledSchemas, rec.ID)
+	case walOpPutUser:
+		s.users[rec.ID] = rec.User.user()
+	case walOpDeleteUser:
+		delete(s.users, rec.ID)
+		s.disown(rec.ID)
+	case walOpPutACL:
+		if len(rec.Grants) == 0 {
+			delete(s.grants, rec.ID)
+		} else {
+			s.grants[rec.ID] = rec.Grants
+		}
+	case walOpPutOwner:
+		s.owners[rec.ID] = rec.Owner
+	case walOpPutSession:
+		s.sessions[rec.ID] = *rec.Session
+	case walOpRevokeToken:
+		s.revokedTokens[rec.ID] = *rec.Time
+	case walOpExpireSessions:
+		s.expireSessions(*rec.Time)
+	case walOpBatch:
+		for _, item := range rec.Batch {
+			s.apply(item)
+		}
+	}
+}
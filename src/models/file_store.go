@@ -0,0 +1,434 @@
+package models
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WAL fsync policies selectable through WAL_SYNC
+const (
+	SyncAlways   = "always"   // fsync after every record
+	SyncInterval = "interval" // fsync in the background every SyncInterval
+	SyncNever    = "never"    // leave flushing to the operating system
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+	contentDirName   = "content"
+)
+
+// FileStoreOptions configures a FileStore
+type FileStoreOptions struct {
+	Dir              string
+	SyncPolicy       string
+	SyncInterval     time.Duration
+	CompactThreshold int
+}
+
+// snapshot is the compacted on-disk image of the store
+type snapshot struct {
+	LSN       uint64                `json:"lsn"`
+	Documents []Document            `json:"documents"`
+	Revisions map[string][]Revision `json:"revisions,omitempty"`
+	// Collections holds every collection, parents before their children
+	Collections []Collection `json:"collections,omitempty"`
+	Schemas     []Schema     `json:"schemas,omitempty"`
+	Users       []storedUser `json:"users,omitempty"`
+	// ACLs holds the grants of every shared document, by document ID
+	ACLs map[string][]Grant `json:"acls,omitempty"`
+	// Owners holds the owners of documents not owned by their creator
+	Owners map[string]string `json:"owners,omitempty"`
+	// Tombstones holds the last version of every deleted document
+	Tombstones map[string]int64 `json:"tombstones,omitempty"`
+	// Sessions and RevokedTokens are kept until they expire
+	Sessions      []Session            `json:"sessions,omitempty"`
+	RevokedTokens map[string]time.Time `json:"revoked_tokens,omitempty"`
+}
+
+// FileStore is a durable Store. Documents are served from an in-memory
+// DocumentStore while every mutation is first appended to a write-ahead log
+// on disk. On startup the latest snapshot is loaded and the log replayed on
+// top of it; the log is periodically compacted into a new snapshot.
+type FileStore struct {
+	*DocumentStore
+
+	opts FileStoreOptions
+	wal  *os.File
+
+	// The fields below are guarded by DocumentStore.mu: written with the
+	// write lock held (append), or with the read lock and compactMu held
+	// (compact), which keeps out appends and other compactions alike.
+	lsn        uint64
+	walSize    int64
+	walRecords int
+
+	// compactMu serializes compactions, whether run by the background
+	// loop, Close or a caller of Compact
+	compactMu sync.Mutex
+	compactCh chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore opens (or creates) a file-backed store in opts.Dir and
+// recovers its state from the snapshot and write-ahead log found there.
+func NewFileStore(opts FileStoreOptions) (*FileStore, error) {
+	switch opts.SyncPolicy {
+	case "":
+		opts.SyncPolicy = SyncAlways
+	case SyncAlways, SyncNever:
+	case SyncInterval:
+		if opts.SyncInterval <= 0 {
+			return nil, errors.New("wal sync interval must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unknown wal sync policy %q", opts.SyncPolicy)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	s := &FileStore{
+		DocumentStore: NewDocumentStore(),
+		opts:          opts,
+		compactCh:     make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.openWAL(); err != nil {
+		return nil, err
+	}
+	s.backfillMetadata()
+	blobs, err := openDirBlobStore(filepath.Join(opts.Dir, contentDirName), s.contentRefs())
+	if err != nil {
+		s.wal.Close()
+		return nil, err
+	}
+	s.blobs = blobs
+
+	s.journal = s
+	s.wg.Add(1)
+	go s.background()
+
+	log.Printf("File store opened in %s: %d documents recovered (lsn %d)",
+		opts.Dir, len(s.documents), s.lsn)
+	return s, nil
+}
+
+// loadSnapshot restores the documents captured by the last compaction
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.opts.Dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	for _, c := range snap.Collections {
+		s.collections.put(c)
+	}
+	for _, schema := range snap.Schemas {
+		s.apply(walRecord{Op: walOpPutSchema, ID: schema.Type, Schema: &schema})
+	}
+	for _, user := range snap.Users {
+		s.users[user.Username] = user.user()
+	}
+	for _, doc := range snap.Documents {
+		s.documents[doc.ID] = doc
+		s.index.add(doc)
+		s.labels.add(doc)
+		s.collections.addMember(doc)
+	}
+	for id, history := range snap.Revisions {
+		s.revisions[id] = history
+	}
+	for id, grants := range snap.ACLs {
+		s.grants[id] = grants
+	}
+	for id, owner := range snap.Owners {
+		s.owners[id] = owner
+	}
+	for id, version := range snap.Tombstones {
+		s.tombstones[id] = version
+	}
+	for _, session := range snap.Sessions {
+		s.sessions[session.ID] = session
+	}
+	for id, expiresAt := range snap.RevokedTokens {
+		s.revokedTokens[id] = expiresAt
+	}
+	s.lsn = snap.LSN
+	return nil
+}
+
+// backfillMetadata fills in the timestamps and authors of documents written
+// before the store recorded them, using their first and latest revisions
+func (s *FileStore) backfillMetadata() {
+	for id, doc := range s.documents {
+		history := s.revisions[id]
+		if !doc.CreatedAt.IsZero() || len(history) == 0 {
+			continue
+		}
+		first, latest := history[0], history[len(history)-1]
+		doc.CreatedAt, doc.CreatedBy = first.Timestamp, first.Author
+		doc.UpdatedAt, doc.UpdatedBy = latest.Timestamp, latest.Author
+		s.documents[id] = doc
+		s.index.add(doc)
+	}
+}
+
+// openWAL replays the write-ahead log and positions it for appending.
+// A torn frame at the tail (from a crash mid-write) is truncated away.
+func (s *FileStore) openWAL() error {
+	path := filepath.Join(s.opts.Dir, walFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("open wal: %w", err)
+	}
+
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		rec, n, err := readWALFrame(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("WAL %s: discarding damaged tail at offset %d: %v", path, offset, err)
+			break
+		}
+		offset += int64(n)
+		s.walRecords++
+
+		// Records already folded into the snapshot are skipped
+		if rec.LSN <= s.lsn {
+			continue
+		}
+		s.apply(rec)
+		s.lsn = rec.LSN
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("seek wal: %w", err)
+	}
+
+	s.wal = f
+	s.walSize = offset
+	return nil
+}
+
+// append writes a record to the log, honouring the sync policy. On failure
+// the log is rolled back to its previous length so no partial frame remains.
+func (s *FileStore) append(rec *walRecord) error {
+	rec.LSN = s.lsn + 1
+	frame, err := encodeWALFrame(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.wal.Write(frame); err != nil {
+		s.rollbackWAL()
+		return fmt.Errorf("append wal: %w", err)
+	}
+	if s.opts.SyncPolicy == SyncAlways {
+		if err := s.wal.Sync(); err != nil {
+			s.rollbackWAL()
+			return fmt.Errorf("sync wal: %w", err)
+		}
+	}
+
+	s.lsn = rec.LSN
+	s.walSize += int64(len(frame))
+	s.walRecords++
+
+	if s.opts.CompactThreshold > 0 && s.walRecords >= s.opts.CompactThreshold {
+		select {
+		case s.compactCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) rollbackWAL() {
+	if err := s.wal.Truncate(s.walSize); err != nil {
+		log.Printf("Failed to roll back wal to offset %d: %v", s.walSize, err)
+		return
+	}
+	if _, err := s.wal.Seek(s.walSize, io.SeekStart); err != nil {
+		log.Printf("Failed to reposition wal at offset %d: %v", s.walSize, err)
+	}
+}
+
+// background runs the periodic fsync and compaction requests
+func (s *FileStore) background() {
+	defer s.wg.Done()
+
+	var tick <-chan time.Time
+	if s.opts.SyncPolicy == SyncInterval {
+		ticker := time.NewTicker(s.opts.SyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-tick:
+			if err := s.wal.Sync(); err != nil {
+				log.Printf("Failed to sync wal: %v", err)
+			}
+		case <-s.compactCh:
+			if err := s.Compact(); err != nil {
+				log.Printf("Failed to compact wal: %v", err)
+			}
+		}
+	}
+}
+
+// Compact writes the current documents to a new snapshot and empties the
+// log. Writers are blocked for the duration; readers are not. Concurrent
+// calls run one after the other.
+func (s *FileStore) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.walRecords == 0 {
+		return nil
+	}
+
+	snap := snapshot{
+		LSN:           s.lsn,
+		Documents:     make([]Document, 0, len(s.documents)),
+		Revisions:     s.revisions,
+		ACLs:          s.grants,
+		Owners:        s.owners,
+		Tombstones:    s.tombstones,
+		RevokedTokens: s.revokedTokens,
+	}
+	for _, session := range s.sessions {
+		snap.Sessions = append(snap.Sessions, session)
+	}
+	for _, doc := range s.documents {
+		snap.Documents = append(snap.Documents, doc)
+	}
+	for _, id := range s.collections.descendants("") {
+		snap.Collections = append(snap.Collections, s.collections.byID[id])
+	}
+	for _, schema := range s.schemas {
+		snap.Schemas = append(snap.Schemas, schema)
+	}
+	for _, user := range s.users {
+		snap.Users = append(snap.Users, *newStoredUser(user))
+	}
+	if err := writeFileAtomic(filepath.Join(s.opts.Dir, snapshotFileName), snap); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	// A crash before the truncation below is harmless: every record left in
+	// the log has an LSN covered by the snapshot and is skipped on replay.
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek wal: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	s.walSize = 0
+	s.walRecords = 0
+	return nil
+}
+
+// Close stops background work, compacts the log and closes it
+func (s *FileStore) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+
+		if cerr := s.Compact(); cerr != nil {
+			log.Printf("Failed to compact wal on close: %v", cerr)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if serr := s.wal.Sync(); serr != nil {
+			err = serr
+		}
+		if cerr := s.wal.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// writeFileAtomic marshals v to path via a synced temporary file and rename
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestFileStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(FileStoreOptions{Dir: dir, SyncPolicy: SyncAlways})
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	return store
+}
+
+func TestFileStore_RecoversAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "One", Description: "First"})
+	store.Create(ctx, Document{ID: "2", Name: "Two", Description: "Second"})
+	store.Update(ctx, "1", Document{Name: "One v2", Description: "First updated"})
+	store.PartialUpdate(ctx, "2", map[string]interface{}{"name": "Two v2"})
+	store.Create(ctx, Document{ID: "3", Name: "Three"})
+	store.Delete(ctx, "3")
+
+	// Simulate a crash: drop the handle without compacting
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	page, _ := reopened.List(ctx, ListOptions{})
+	docs := page.Documents
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents after replay, got %d", len(docs))
+	}
+
+	doc1, err := reopened.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Get() failed after replay: %v", err)
+	}
+	if doc1.Name != "One v2" || doc1.Description != "First updated" {
+		t.Errorf("update not replayed, got %+v", doc1)
+	}
+
+	doc2, _ := reopened.Get(ctx, "2")
+	if doc2.Name != "Two v2" || doc2.Description != "Second" {
+		t.Errorf("partial update not replayed, got %+v", doc2)
+	}
+
+	if _, err := reopened.Get(ctx, "3"); err != ErrDocumentNotFound {
+		t.Errorf("deleted document should stay deleted, got %v", err)
+	}
+}
+
+func TestFileStore_CompactWritesSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "One"})
+	store.Create(ctx, Document{ID: "2", Name: "Two"})
+
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact() failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatalf("stat wal: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected empty wal after compaction, got %d bytes", info.Size())
+	}
+
+	// Mutations after the snapshot land in the fresh log
+	store.Delete(ctx, "1")
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	page, _ := reopened.List(ctx, ListOptions{})
+	docs := page.Documents
+	if len(docs) != 1 || docs[0].ID != "2" {
+		t.Errorf("expected only document 2 after recovery, got %+v", docs)
+	}
+}
+
+func TestFileStore_SkipsRecordsCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "One"})
+	store.Delete(ctx, "1")
+	store.Create(ctx, Document{ID: "1", Name: "One again"})
+
+	// Crash after the snapshot was written but before the log was truncated
+	snap := snapshot{LSN: store.lsn, Documents: []Document{{ID: "1", Name: "One again"}}}
+	if err := writeFileAtomic(filepath.Join(dir, snapshotFileName), snap); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	doc, err := reopened.Get(ctx, "1")
+	if err != nil || doc.Name != "One again" {
+		t.Errorf("expected snapshot state to win, got %+v (%v)", doc, err)
+	}
+}
+
+func TestFileStore_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "One"})
+	store.wal.Close()
+
+	// Append half a frame as if the process died mid-write
+	frame, _ := encodeWALFrame(&walRecord{LSN: 99, Op: walOpPut, ID: "2", Doc: &Document{ID: "2"}})
+	f, _ := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(frame[:len(frame)/2])
+	f.Close()
+
+	reopened := openTestFileStore(t, dir)
+	page, _ := reopened.List(ctx, ListOptions{})
+	docs := page.Documents
+	if len(docs) != 1 {
+		t.Fatalf("expected torn record to be discarded, got %d documents", len(docs))
+	}
+
+	// The log must accept new records after the damaged tail is removed
+	if err := reopened.Create(ctx, Document{ID: "3", Name: "Three"}); err != nil {
+		t.Fatalf("Create() after recovery failed: %v", err)
+	}
+	reopened.wal.Close()
+
+	again := openTestFileStore(t, dir)
+	defer again.Close()
+	if _, err := again.Get(ctx, "3"); err != nil {
+		t.Errorf("record written after recovery was lost: %v", err)
+	}
+}
+
+func TestFileStore_CompactThreshold(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewFileStore(FileStoreOptions{Dir: dir, SyncPolicy: SyncNever, CompactThreshold: 3})
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		store.Create(ctx, Document{ID: id})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected background compaction to write a snapshot")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileStore_ConcurrentCompact(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Compactions requested by the background loop, by writers and by the
+	// store's own callers run alongside each other and alongside writes
+	store, err := NewFileStore(FileStoreOptions{Dir: dir, SyncPolicy: SyncNever, CompactThreshold: 1})
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				store.Create(ctx, Document{ID: fmt.Sprintf("%d-%d", w, i)})
+				if err := store.Compact(); err != nil {
+					t.Errorf("Compact() failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if page, err := reopened.List(ctx, ListOptions{Limit: MaxPageSize}); err != nil || page.Total != 80 {
+		t.Errorf("expected 80 documents after reopening, got %d (%v)", page.Total, err)
+	}
+}
+
+func TestFileStore_InvalidOptions(t *testing.T) {
+	if _, err := NewFileStore(FileStoreOptions{Dir: t.TempDir(), SyncPolicy: "sometimes"}); err == nil {
+		t.Error("expected error for unknown sync policy")
+	}
+	if _, err := NewFileStore(FileStoreOptions{Dir: t.TempDir(), SyncPolicy: SyncInterval}); err == nil {
+		t.Error("expected error for interval policy without interval")
+	}
+}
+
+func TestFileStore_CloseCompacts(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewFileStore(FileStoreOptions{Dir: dir, SyncPolicy: SyncInterval, SyncInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewFileStore() failed: %v", err)
+	}
+	store.Create(ctx, Document{ID: "1", Name: "One"})
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	if reopened.walRecords != 0 {
+		t.Errorf("expected empty wal after clean shutdown, got %d records", reopened.walRecords)
+	}
+	if _, err := reopened.Get(ctx, "1"); err != nil {
+		t.Errorf("document lost across clean shutdown: %v", err)
+	}
+}
+
+func TestFileStore_RecoversRevisions(t *testing.T) {
+	dir := t.TempDir()
+	ctx := WithActor(context.Background(), "alice")
+
+	store := openTestFileStore(t, dir)
+	store.Create(ctx, Document{ID: "1", Name: "v1"})
+	store.Update(ctx, "1", Document{Name: "v2"})
+	store.Compact()
+	store.Update(ctx, "1", Document{Name: "v3"})
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	history, err := reopened.ListRevisions(ctx, "1")
+	if err != nil {
+		t.Fatalf("ListRevisions() failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 revisions across snapshot and log, got %d", len(history))
+	}
+	for i, name := range []string{"v1", "v2", "v3"} {
+		if history[i].Document.Name != name || history[i].Author != "alice" {
+			t.Errorf("revision %d = %+v, want %s by alice", i+1, history[i], name)
+		}
+	}
+}
+
+func TestFileStore_RecoversTombstones(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openTestFileStore(t, dir)
+	for _, id := range []string{"1", "2"} {
+		store.Create(ctx, Document{ID: id, Name: "v1"})
+		store.Update(ctx, id, Document{Name: "v2"})
+	}
+	store.Delete(ctx, "1")
+	store.Compact()
+	store.Delete(ctx, "2")
+	store.wal.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+
+	for _, id := range []string{"1", "2"} {
+		if err := reopened.Create(ctx, Document{ID: id, Name: "again"}); err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+		if doc, _ := reopened.Get(ctx, id); doc.Version != 3 {
+			t.Errorf("document %s recreated at version %d, want 3", id, doc.Version)
+		}
+	}
+}
+
+func TestFileStore_BackfillsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// A snapshot written before documents carried timestamps and authors
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	latest := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	snap := snapshot{
+		LSN:       2,
+		Documents: []Document{{ID: "1", Name: "One", Version: 2}},
+		Revisions: map[string][]Revision{"1": {
+			{Revision: 1, Timestamp: first, Author: "alice"},
+			{Revision: 2, Timestamp: latest, Author: "bob"},
+		}},
+	}
+	if err := writeFileAtomic(filepath.Join(dir, snapshotFileName), snap); err != nil {
+		t.Fatalf("write snapshot: %v", err)
+	}
+
+	store := openTestFileStore(t, dir)
+	defer store.Close()
+
+	doc, err := store.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if doc.CreatedBy != "alice" || doc.UpdatedBy != "bob" || !doc.CreatedAt.Equal(first) || !doc.UpdatedAt.Equal(latest) {
+		t.Errorf("expected metadata backfilled from history, got %+v", doc)
+	}
+}
@@ -0,0 +1,418 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidFilter is wrapped by every *FilterError
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// FilterError reports a filter expression that could not be parsed. Position
+// is the 1-based character offset of Token within the expression.
+type FilterError struct {
+	Position int
+	Token    string
+	Message  string
+}
+
+func (e *FilterError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid filter: %s at end of expression", e.Message)
+	}
+	return fmt.Sprintf("invalid filter: %s at position %d (%q)", e.Message, e.Position, e.Token)
+}
+
+func (e *FilterError) Unwrap() error { return ErrInvalidFilter }
+
+// Filter is a node of a parsed filter expression
+type Filter interface {
+	match(doc Document) bool
+	String() string
+}
+
+// AndFilter matches when both operands match
+type AndFilter struct{ Left, Right Filter }
+
+// OrFilter matches when either operand matches
+type OrFilter struct{ Left, Right Filter }
+
+// NotFilter matches when its operand does not
+type NotFilter struct{ Operand Filter }
+
+// Comparison tests one document field against a literal
+type Comparison struct {
+	Field string
+	Op    string
+	Value string
+
+	number int64
+	time   time.Time
+}
+
+// Comparison operators. The word operators are written field:op:value.
+const (
+	OpEq       = "="
+	OpNe       = "!="
+	OpLt       = "<"
+	OpLe       = "<="
+	OpGt       = ">"
+	OpGe       = ">="
+	OpPrefix   = "prefix"
+	OpSuffix   = "suffix"
+	OpContains = "contains"
+)
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindNumber
+	kindTime
+)
+
+// filterFields lists the fields a filter may reference
+var filterFields = map[string]fieldKind{
+	"id":          kindString,
+	"name":        kindString,
+	"description": kindString,
+	"version":     kindNumber,
+	"created_at":  kindTime,
+	"updated_at":  kindTime,
+	"created_by":  kindString,
+	"updated_by":  kindString,
+}
+
+func (f *AndFilter) match(doc Document) bool { return f.Left.match(doc) && f.Right.match(doc) }
+func (f *OrFilter) match(doc Document) bool  { return f.Left.match(doc) || f.Right.match(doc) }
+func (f *NotFilter) match(doc Document) bool { return !f.Operand.match(doc) }
+
+func (f *AndFilter) String() string { return "(" + f.Left.String() + " AND " + f.Right.String() + ")" }
+func (f *OrFilter) String() string  { return "(" + f.Left.String() + " OR " + f.Right.String() + ")" }
+func (f *NotFilter) String() string { return "NOT " + f.Operand.String() }
+func (c *Comparison) String() string {
+	return c.Field + " " + c.Op + " " + strconv.Quote(c.Value)
+}
+
+func (c *Comparison) match(doc Document) bool {
+	switch filterFields[c.Field] {
+	case kindNumber:
+		return compareWith(c.Op, cmpInt(doc.Version, c.number))
+	case kindTime:
+		t := doc.CreatedAt
+		if c.Field == "updated_at" {
+			t = doc.UpdatedAt
+		}
+		return compareWith(c.Op, t.Compare(c.time))
+	}
+
+	var s string
+	switch c.Field {
+	case "id":
+		s = doc.ID
+	case "name":
+		s = doc.Name
+	case "description":
+		s = doc.Description
+	case "created_by":
+		s = doc.CreatedBy
+	case "updated_by":
+		s = doc.UpdatedBy
+	}
+	return matchString(c.Op, s, c.Value)
+}
+
+// matchString applies op to a text field. Substring operators are
+// case-insensitive; ordering operators are not.
+func matchString(op, s, value string) bool {
+	switch op {
+	case OpPrefix:
+		return strings.HasPrefix(strings.ToLower(s), strings.ToLower(value))
+	case OpSuffix:
+		return strings.HasSuffix(strings.ToLower(s), strings.ToLower(value))
+	case OpContains:
+		return strings.Contains(strings.ToLower(s), strings.ToLower(value))
+	}
+	return compareWith(op, strings.Compare(s, value))
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareWith applies an ordering operator to the result of a three-way comparison
+func compareWith(op string, c int) bool {
+	switch op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLe:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGe:
+		return c >= 0
+	}
+	return false
+}
+
+// ParseFilter parses a filter expression such as
+//
+//	name:prefix:Getting AND (created_at>2026-01-01 OR NOT description:contains:"draft copy")
+//
+// Comparisons are field, operator, value. Operators are =, !=, <, <=, >, >=
+// and the string matchers :prefix:, :suffix: and :contains:. Values containing
+// spaces, parentheses or colons are double-quoted. Comparisons are combined
+// with AND, OR, NOT and parentheses; AND binds tighter than OR.
+func ParseFilter(expr string) (Filter, error) {
+	p := &filterParser{input: []rune(expr)}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorAt(p.pos, "expected a comparison")
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorAt(p.pos, "expected AND, OR or end of filter")
+	}
+	return f, nil
+}
+
+// filterParser is a recursive-descent parser that tokenizes on demand, since
+// whether ':' is an operator or part of a value depends on the position
+type filterParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *filterParser) eof() bool { return p.pos >= len(p.input) }
+
+func (p *filterParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// errorAt reports the token starting at pos: up to the next space or parenthesis
+func (p *filterParser) errorAt(pos int, message string) *FilterError {
+	end := pos
+	for end < len(p.input) && !unicode.IsSpace(p.input[end]) && !isFilterDelimiter(p.input[end]) {
+		end++
+	}
+	if end == pos && end < len(p.input) {
+		end++
+	}
+	return &FilterError{Position: pos + 1, Token: string(p.input[pos:end]), Message: message}
+}
+
+func isFilterDelimiter(r rune) bool { return r == '(' || r == ')' }
+
+// keyword consumes word if it is the next token
+func (p *filterParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.input) || string(p.input[p.pos:end]) != word {
+		return false
+	}
+	if end < len(p.input) && !unicode.IsSpace(p.input[end]) && p.input[end] != '(' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *filterParser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrFilter{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndFilter{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (Filter, error) {
+	if p.keyword("NOT") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotFilter{Operand: operand}, nil
+	}
+
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorAt(p.pos, "expected a comparison")
+	}
+	if p.input[p.pos] == '(' {
+		open := p.pos
+		p.pos++
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.input[p.pos] != ')' {
+			if p.eof() {
+				return nil, p.errorAt(open, "unclosed parenthesis")
+			}
+			return nil, p.errorAt(p.pos, "expected )")
+		}
+		p.pos++
+		return f, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (Filter, error) {
+	start := p.pos
+	for !p.eof() && (unicode.IsLetter(p.input[p.pos]) || p.input[p.pos] == '_') {
+		p.pos++
+	}
+	field := string(p.input[start:p.pos])
+	if field == "" {
+		return nil, p.errorAt(start, "expected a field name")
+	}
+	kind, known := filterFields[field]
+	if !known {
+		return nil, p.errorAt(start, "unknown field (use id, name, description, version, created_at, updated_at, created_by or updated_by)")
+	}
+
+	opStart := p.pos
+	op, err := p.parseOperator()
+	if err != nil {
+		return nil, err
+	}
+	if kind != kindString && (op == OpPrefix || op == OpSuffix || op == OpContains) {
+		return nil, p.errorAt(opStart, "operator "+op+" only applies to text fields")
+	}
+
+	valueStart := p.pos
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Comparison{Field: field, Op: op, Value: value}
+	switch kind {
+	case kindNumber:
+		if c.number, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, p.errorAt(valueStart, "expected an integer")
+		}
+	case kindTime:
+		if c.time, err = parseFilterTime(value); err != nil {
+			return nil, p.errorAt(valueStart, "expected a date (2006-01-02) or RFC 3339 timestamp")
+		}
+	}
+	return c, nil
+}
+
+func (p *filterParser) parseOperator() (string, error) {
+	start := p.pos
+	if p.eof() {
+		return "", p.errorAt(start, "expected an operator")
+	}
+	rest := string(p.input[p.pos:])
+	for _, op := range []string{OpNe, OpLe, OpGe, OpEq, OpLt, OpGt} {
+		if strings.HasPrefix(rest, op) {
+			p.pos += len(op)
+			return op, nil
+		}
+	}
+	if p.input[p.pos] == ':' {
+		p.pos++
+		nameStart := p.pos
+		for !p.eof() && unicode.IsLetter(p.input[p.pos]) {
+			p.pos++
+		}
+		name := string(p.input[nameStart:p.pos])
+		if name != OpPrefix && name != OpSuffix && name != OpContains {
+			return "", p.errorAt(start, "unknown operator (use prefix, suffix or contains)")
+		}
+		if p.eof() || p.input[p.pos] != ':' {
+			return "", p.errorAt(start, "expected : after operator "+name)
+		}
+		p.pos++
+		return name, nil
+	}
+	return "", p.errorAt(start, "expected an operator (=, !=, <, <=, >, >=, :prefix:, :suffix:, :contains:)")
+}
+
+// parseValue reads a double-quoted string or a bare run of characters up to
+// the next space or parenthesis
+func (p *filterParser) parseValue() (string, error) {
+	start := p.pos
+	if p.eof() || unicode.IsSpace(p.input[p.pos]) || isFilterDelimiter(p.input[p.pos]) {
+		return "", p.errorAt(start, "expected a value")
+	}
+
+	if p.input[p.pos] != '"' {
+		for !p.eof() && !unicode.IsSpace(p.input[p.pos]) && !isFilterDelimiter(p.input[p.pos]) {
+			p.pos++
+		}
+		return string(p.input[start:p.pos]), nil
+	}
+
+	var b strings.Builder
+	p.pos++
+	for !p.eof() {
+		r := p.input[p.pos]
+		p.pos++
+		switch r {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorAt(start, "unterminated string")
+			}
+			b.WriteRune(p.input[p.pos])
+			p.pos++
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", p.errorAt(start, "unterminated string")
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
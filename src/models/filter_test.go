@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`name:prefix:Getting`, `name prefix "Getting"`},
+		{`name:prefix:Getting AND created_at>2026-01-01`, `(name prefix "Getting" AND created_at > "2026-01-01")`},
+		{`id=a OR id=b AND version>=2`, `(id = "a" OR (id = "b" AND version >= "2"))`},
+		{`(id=a OR id=b) AND NOT description:contains:"draft copy"`, `((id = "a" OR id = "b") AND NOT description contains "draft copy")`},
+		{`updated_at<="2026-01-01T10:00:00Z"`, `updated_at <= "2026-01-01T10:00:00Z"`},
+		{`name!="say \"hi\""`, `name != "say \"hi\""`},
+		{`  NOT(name:suffix:md)  `, `NOT name suffix "md"`},
+	}
+
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := f.String(); got != tt.want {
+			t.Errorf("ParseFilter(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter_Errors(t *testing.T) {
+	tests := []struct {
+		expr     string
+		position int
+		token    string
+	}{
+		{``, 1, ""},
+		{`size>3`, 1, "size>3"},
+		{`name~x`, 5, "~x"},
+		{`name:starts:x`, 5, ":starts:x"},
+		{`name:prefix`, 5, ":prefix"},
+		{`name=`, 6, ""},
+		{`version>two`, 9, "two"},
+		{`created_at>yesterday`, 12, "yesterday"},
+		{`version:contains:1`, 8, ":contains:1"},
+		{`name=a AND`, 11, ""},
+		{`name=a name=b`, 8, "name=b"},
+		{`(name=a`, 1, "("},
+		{`name=a)`, 7, ")"},
+		{`name="open`, 6, `"open`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseFilter(tt.expr)
+		var filterErr *FilterError
+		if !errors.As(err, &filterErr) || !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q) = %v, want *FilterError", tt.expr, err)
+			continue
+		}
+		if filterErr.Position != tt.position || filterErr.Token != tt.token {
+			t.Errorf("ParseFilter(%q) error at %d %q, want %d %q (%v)",
+				tt.expr, filterErr.Position, filterErr.Token, tt.position, tt.token, err)
+		}
+	}
+}
+
+func TestDocumentStore_ListFilter(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	store.Create(WithActor(ctx, "alice"), Document{ID: "1", Name: "Getting Started", Description: "Intro guide"})
+	store.Create(ctx, Document{ID: "2", Name: "API Reference", Description: "Endpoint GUIDE"})
+	store.Create(ctx, Document{ID: "3", Name: "getting help", Description: "Support"})
+	store.Update(WithActor(ctx, "bob"), "3", Document{Name: "getting help", Description: "Support v2"})
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`name:prefix:getting`, []string{"1", "3"}},
+		{`description:contains:guide AND NOT id=1`, []string{"2"}},
+		{`version=2 OR name="API Reference"`, []string{"2", "3"}},
+		{`created_at>2000-01-01`, []string{"1", "2", "3"}},
+		{`created_at<2000-01-01`, nil},
+		{`created_by=alice`, []string{"1"}},
+		{`updated_by=bob OR created_by:prefix:ALI`, []string{"1", "3"}},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q) failed: %v", tt.expr, err)
+		}
+		page, err := store.List(ctx, ListOptions{Filter: filter})
+		if err != nil {
+			t.Fatalf("List() failed: %v", err)
+		}
+		var got []string
+		for _, doc := range page.Documents {
+			got = append(got, doc.ID)
+		}
+		if len(got) != len(tt.want) || page.Total != len(tt.want) {
+			t.Errorf("filter %q matched %v (total %d), want %v", tt.expr, got, page.Total, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("filter %q matched %v, want %v", tt.expr, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// Timestamps are those of the first and latest revisions
+	history, _ := store.ListRevisions(ctx, "3")
+	cutoff := history[0].Timestamp.Add(time.Nanosecond).Format(time.RFC3339Nano)
+	filter, _ := ParseFilter(`updated_at>"` + cutoff + `" AND created_at<"` + cutoff + `"`)
+	page, _ := store.List(ctx, ListOptions{Filter: filter})
+	if len(page.Documents) != 1 || page.Documents[0].ID != "3" {
+		t.Errorf("expected only the updated document, got %+v", page.Documents)
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// maxDocumentIDLength bounds client-chosen IDs so they stay usable in URLs and indexes
+const maxDocumentIDLength = 128
+
+// reservedDocumentIDs are path segments routed to collection endpoints
+var reservedDocumentIDs = map[string]bool{"search": true}
+
+// ErrInvalidDocumentID is returned for document IDs that are empty or unsafe in a URL path
+var ErrInvalidDocumentID = errors.New("invalid document id")
+
+// NewDocumentID returns a server-generated document ID. UUIDv7 values start
+// with a millisecond timestamp, so IDs sort by creation time.
+func NewDocumentID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("generate document id: %w", err)
+	}
+	return id.String(), nil
+}
+
+// ValidateDocumentID checks a client-chosen ID: 1-128 characters from the
+// URL-unreserved set (letters, digits, '-', '.', '_', '~'), excluding the
+// path segments "." and ".." and names reserved for collection endpoints.
+func ValidateDocumentID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: must not be empty", ErrInvalidDocumentID)
+	case len(id) > maxDocumentIDLength:
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidDocumentID, maxDocumentIDLength)
+	case id == "." || id == ".." || reservedDocumentIDs[id]:
+		return fmt.Errorf("%w: %q is not allowed", ErrInvalidDocumentID, id)
+	}
+	for _, r := range id {
+		if !isUnreserved(r) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidDocumentID, r)
+		}
+	}
+	return nil
+}
+
+func isUnreserved(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+		r == '-' || r == '.' || r == '_' || r == '~'
+}
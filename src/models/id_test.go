@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewDocumentID(t *testing.T) {
+	first, err := NewDocumentID()
+	if err != nil {
+		t.Fatalf("NewDocumentID() failed: %v", err)
+	}
+	second, _ := NewDocumentID()
+
+	if first == second {
+		t.Error("expected distinct IDs")
+	}
+	if second <= first {
+		t.Errorf("expected IDs to sort by creation time: %s then %s", first, second)
+	}
+	if err := ValidateDocumentID(first); err != nil {
+		t.Errorf("generated ID %q fails validation: %v", first, err)
+	}
+}
+
+func TestValidateDocumentID(t *testing.T) {
+	valid := []string{"1", "doc-1", "Report_2024.v2", "a~b", strings.Repeat("x", maxDocumentIDLength)}
+	for _, id := range valid {
+		if err := ValidateDocumentID(id); err != nil {
+			t.Errorf("ValidateDocumentID(%q) = %v, want nil", id, err)
+		}
+	}
+
+	invalid := []string{"", ".", "..", "search", "a/b", "with space", "doc:batch", "ünïcode", strings.Repeat("x", maxDocumentIDLength+1)}
+	for _, id := range invalid {
+		if err := ValidateDocumentID(id); !errors.Is(err, ErrInvalidDocumentID) {
+			t.Errorf("ValidateDocumentID(%q) = %v, want ErrInvalidDocumentID", id, err)
+		}
+	}
+}
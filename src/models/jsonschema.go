@@ -0,0 +1,602 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxSchemaDepth bounds how deeply validation descends through subschemas
+// and references, so a reference cycle cannot recurse forever
+const maxSchemaDepth = 64
+
+// jsonSchema is a compiled JSON Schema. The supported vocabulary is the
+// draft 2020-12 core for describing one JSON value: type, enum, const, the
+// string, number, array and object assertions, the allOf, anyOf, oneOf and
+// not combinators, and $ref to locations in the same schema document.
+// Patterns are Go regular expressions. The formats date, date-time, email,
+// uri and uuid are asserted; other formats are annotations.
+type jsonSchema struct {
+	// boolean is set for the schemas true and false
+	boolean *bool
+	ref     *jsonSchema
+
+	types      []string
+	enum       []interface{}
+	constValue interface{}
+	hasConst   bool
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	format               string
+
+	minimum, maximum                   *big.Rat
+	exclusiveMinimum, exclusiveMaximum *big.Rat
+	multipleOf                         *big.Rat
+
+	items                *jsonSchema
+	minItems, maxItems   *int
+	uniqueItems          bool
+	properties           map[string]*jsonSchema
+	patternProperties    []patternSchema
+	additionalProperties *jsonSchema
+	propertyNames        *jsonSchema
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	allOf, anyOf, oneOf []*jsonSchema
+	not                 *jsonSchema
+}
+
+type patternSchema struct {
+	pattern *regexp.Regexp
+	schema  *jsonSchema
+}
+
+// schemaAnnotations are keywords that describe a schema without
+// constraining the values it accepts
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "$defs": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "string": true, "number": true,
+	"integer": true, "array": true, "object": true,
+}
+
+// schemaCompiler compiles one schema document. Subschemas are cached by
+// their JSON Pointer, which also ties reference cycles together.
+type schemaCompiler struct {
+	root     interface{}
+	compiled map[string]*jsonSchema
+}
+
+// compileJSONSchema compiles a schema document, rejecting it with
+// ErrInvalidSchema if it is malformed or uses keywords that are not supported
+func compileJSONSchema(data []byte) (*jsonSchema, error) {
+	root, err := decodeJSONValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	c := &schemaCompiler{root: root, compiled: make(map[string]*jsonSchema)}
+	return c.compile(root, "")
+}
+
+func (c *schemaCompiler) errorf(pointer, format string, args ...interface{}) error {
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Errorf("%w: at %s: %s", ErrInvalidSchema, pointer, fmt.Sprintf(format, args...))
+}
+
+func (c *schemaCompiler) compile(value interface{}, pointer string) (*jsonSchema, error) {
+	if s, ok := c.compiled[pointer]; ok {
+		return s, nil
+	}
+	s := &jsonSchema{}
+	c.compiled[pointer] = s
+
+	if b, ok := value.(bool); ok {
+		s.boolean = &b
+		return s, nil
+	}
+	members, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, c.errorf(pointer, "a schema must be an object or a boolean")
+	}
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v, at := members[key], pointer+"/"+escapePointerToken(key)
+		var err error
+		switch key {
+		case "$ref":
+			s.ref, err = c.reference(v, at)
+		case "type":
+			s.types, err = c.typeList(v, at)
+		case "enum":
+			values, ok := v.([]interface{})
+			if !ok {
+				return nil, c.errorf(at, "must be an array")
+			}
+			s.enum = values
+		case "const":
+			s.constValue, s.hasConst = v, true
+		case "minLength":
+			s.minLength, err = c.count(v, at)
+		case "maxLength":
+			s.maxLength, err = c.count(v, at)
+		case "minItems":
+			s.minItems, err = c.count(v, at)
+		case "maxItems":
+			s.maxItems, err = c.count(v, at)
+		case "minProperties":
+			s.minProperties, err = c.count(v, at)
+		case "maxProperties":
+			s.maxProperties, err = c.count(v, at)
+		case "pattern":
+			s.pattern, err = c.regexp(v, at)
+		case "format":
+			format, ok := v.(string)
+			if !ok {
+				return nil, c.errorf(at, "must be a string")
+			}
+			s.format = format
+		case "minimum":
+			s.minimum, err = c.number(v, at)
+		case "maximum":
+			s.maximum, err = c.number(v, at)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = c.number(v, at)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = c.number(v, at)
+		case "multipleOf":
+			if s.multipleOf, err = c.number(v, at); err == nil && s.multipleOf.Sign() <= 0 {
+				err = c.errorf(at, "must be greater than 0")
+			}
+		case "uniqueItems":
+			unique, ok := v.(bool)
+			if !ok {
+				return nil, c.errorf(at, "must be a boolean")
+			}
+			s.uniqueItems = unique
+		case "required":
+			s.required, err = c.stringList(v, at)
+		case "items":
+			s.items, err = c.compile(v, at)
+		case "additionalProperties":
+			s.additionalProperties, err = c.compile(v, at)
+		case "propertyNames":
+			s.propertyNames, err = c.compile(v, at)
+		case "not":
+			s.not, err = c.compile(v, at)
+		case "properties":
+			s.properties, err = c.schemaMap(v, at)
+		case "patternProperties":
+			var byPattern map[string]*jsonSchema
+			if byPattern, err = c.schemaMap(v, at); err == nil {
+				s.patternProperties, err = c.patternSchemas(byPattern, at)
+			}
+		case "allOf":
+			s.allOf, err = c.schemaList(v, at)
+		case "anyOf":
+			s.anyOf, err = c.schemaList(v, at)
+		case "oneOf":
+			s.oneOf, err = c.schemaList(v, at)
+		default:
+			if !schemaAnnotations[key] {
+				return nil, c.errorf(at, "keyword %q is not supported", key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// reference resolves a $ref to a location in the same document
+func (c *schemaCompiler) reference(v interface{}, at string) (*jsonSchema, error) {
+	ref, ok := v.(string)
+	if !ok || !strings.HasPrefix(ref, "#") {
+		return nil, c.errorf(at, "only references within the schema, starting with #, are supported")
+	}
+	fragment, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, c.errorf(at, "invalid reference %q", ref)
+	}
+	tokens, err := parsePointer(fragment)
+	if err != nil {
+		return nil, c.errorf(at, "invalid reference %q: %v", ref, err)
+	}
+	target, err := getValue(c.root, tokens)
+	if err != nil {
+		return nil, c.errorf(at, "reference %q does not resolve", ref)
+	}
+	return c.compile(target, fragment)
+}
+
+func (c *schemaCompiler) typeList(v interface{}, at string) ([]string, error) {
+	if name, ok := v.(string); ok {
+		v = []interface{}{name}
+	}
+	types, err := c.stringList(v, at)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range types {
+		if !schemaTypes[name] {
+			return nil, c.errorf(at, "unknown type %q", name)
+		}
+	}
+	return types, nil
+}
+
+func (c *schemaCompiler) stringList(v interface{}, at string) ([]string, error) {
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, c.errorf(at, "must be an array of strings")
+	}
+	list := make([]string, len(values))
+	for i, value := range values {
+		if list[i], ok = value.(string); !ok {
+			return nil, c.errorf(at, "must be an array of strings")
+		}
+	}
+	return list, nil
+}
+
+func (c *schemaCompiler) count(v interface{}, at string) (*int, error) {
+	n, err := c.number(v, at)
+	if err != nil || !n.IsInt() || n.Sign() < 0 || !n.Num().IsInt64() {
+		return nil, c.errorf(at, "must be a non-negative integer")
+	}
+	count := int(n.Num().Int64())
+	return &count, nil
+}
+
+func (c *schemaCompiler) number(v interface{}, at string) (*big.Rat, error) {
+	if n, ok := v.(json.Number); ok {
+		if r, ok := new(big.Rat).SetString(n.String()); ok {
+			return r, nil
+		}
+	}
+	return nil, c.errorf(at, "must be a number")
+}
+
+func (c *schemaCompiler) regexp(v interface{}, at string) (*regexp.Regexp, error) {
+	expr, ok := v.(string)
+	if !ok {
+		return nil, c.errorf(at, "must be a string")
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, c.errorf(at, "invalid pattern: %v", err)
+	}
+	return re, nil
+}
+
+func (c *schemaCompiler) schemaMap(v interface{}, at string) (map[string]*jsonSchema, error) {
+	members, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, c.errorf(at, "must be an object")
+	}
+	schemas := make(map[string]*jsonSchema, len(members))
+	for name, member := range members {
+		s, err := c.compile(member, at+"/"+escapePointerToken(name))
+		if err != nil {
+			return nil, err
+		}
+		schemas[name] = s
+	}
+	return schemas, nil
+}
+
+func (c *schemaCompiler) patternSchemas(byPattern map[string]*jsonSchema, at string) ([]patternSchema, error) {
+	patterns := make([]string, 0, len(byPattern))
+	for pattern := range byPattern {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	list := make([]patternSchema, len(patterns))
+	for i, pattern := range patterns {
+		re, err := c.regexp(pattern, at+"/"+escapePointerToken(pattern))
+		if err != nil {
+			return nil, err
+		}
+		list[i] = patternSchema{pattern: re, schema: byPattern[pattern]}
+	}
+	return list, nil
+}
+
+func (c *schemaCompiler) schemaList(v interface{}, at string) ([]*jsonSchema, error) {
+	values, ok := v.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, c.errorf(at, "must be a non-empty array of schemas")
+	}
+	list := make([]*jsonSchema, len(values))
+	for i, value := range values {
+		s, err := c.compile(value, fmt.Sprintf("%s/%d", at, i))
+		if err != nil {
+			return nil, err
+		}
+		list[i] = s
+	}
+	return list, nil
+}
+
+// escapePointerToken escapes a member name for use in a JSON Pointer
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// validate checks a decoded JSON value against the schema and returns every
+// violation, each located by a JSON Pointer relative to pointer
+func (s *jsonSchema) validate(value interface{}, pointer string) []FieldError {
+	return s.check(value, pointer, 0)
+}
+
+func (s *jsonSchema) check(value interface{}, pointer string, depth int) []FieldError {
+	var errs []FieldError
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, FieldError{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxSchemaDepth {
+		fail("schema nests more than %d levels deep", maxSchemaDepth)
+		return errs
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			fail("is not allowed")
+		}
+		return errs
+	}
+	if s.ref != nil {
+		errs = append(errs, s.ref.check(value, pointer, depth+1)...)
+	}
+
+	if len(s.types) > 0 && !matchesType(value, s.types) {
+		fail("must be %s", typeList(s.types))
+	}
+	if s.enum != nil && !containsJSONValue(s.enum, value) {
+		fail("must be one of %s", mustMarshal(s.enum))
+	}
+	if s.hasConst && !jsonEqual(s.constValue, value) {
+		fail("must be %s", mustMarshal(s.constValue))
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match the pattern %q", s.pattern.String())
+		}
+		if s.format != "" && !matchesFormat(v, s.format) {
+			fail("must be a valid %s", s.format)
+		}
+	case json.Number:
+		n, ok := new(big.Rat).SetString(v.String())
+		if !ok {
+			break
+		}
+		if s.minimum != nil && n.Cmp(s.minimum) < 0 {
+			fail("must be at least %s", s.minimum.RatString())
+		}
+		if s.maximum != nil && n.Cmp(s.maximum) > 0 {
+			fail("must be at most %s", s.maximum.RatString())
+		}
+		if s.exclusiveMinimum != nil && n.Cmp(s.exclusiveMinimum) <= 0 {
+			fail("must be greater than %s", s.exclusiveMinimum.RatString())
+		}
+		if s.exclusiveMaximum != nil && n.Cmp(s.exclusiveMaximum) >= 0 {
+			fail("must be less than %s", s.exclusiveMaximum.RatString())
+		}
+		if s.multipleOf != nil && !new(big.Rat).Quo(n, s.multipleOf).IsInt() {
+			fail("must be a multiple of %s", s.multipleOf.RatString())
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+			for i := range v {
+				if containsJSONValue(v[:i], v[i]) {
+					fail("must not contain duplicates")
+					break
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range v {
+				errs = append(errs, s.items.check(item, fmt.Sprintf("%s/%d", pointer, i), depth+1)...)
+			}
+		}
+	case map[string]interface{}:
+		errs = append(errs, s.checkObject(v, pointer, depth)...)
+	}
+
+	for _, sub := range s.allOf {
+		errs = append(errs, sub.check(value, pointer, depth+1)...)
+	}
+	if len(s.anyOf) > 0 && s.countMatches(s.anyOf, value, pointer, depth) == 0 {
+		fail("must match at least one schema of anyOf")
+	}
+	if len(s.oneOf) > 0 {
+		if n := s.countMatches(s.oneOf, value, pointer, depth); n != 1 {
+			fail("must match exactly one schema of oneOf, but matches %d", n)
+		}
+	}
+	if s.not != nil && len(s.not.check(value, pointer, depth+1)) == 0 {
+		fail("must not match the schema of not")
+	}
+	return errs
+}
+
+func (s *jsonSchema) checkObject(v map[string]interface{}, pointer string, depth int) []FieldError {
+	var errs []FieldError
+	if s.minProperties != nil && len(v) < *s.minProperties {
+		errs = append(errs, FieldError{Pointer: pointer, Message: fmt.Sprintf("must have at least %d properties", *s.minProperties)})
+	}
+	if s.maxProperties != nil && len(v) > *s.maxProperties {
+		errs = append(errs, FieldError{Pointer: pointer, Message: fmt.Sprintf("must have at most %d properties", *s.maxProperties)})
+	}
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			errs = append(errs, FieldError{Pointer: pointer + "/" + escapePointerToken(name), Message: "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		at := pointer + "/" + escapePointerToken(name)
+		if s.propertyNames != nil {
+			for _, e := range s.propertyNames.check(name, at, depth+1) {
+				errs = append(errs, FieldError{Pointer: at, Message: "name " + e.Message})
+			}
+		}
+		matched := false
+		if sub, ok := s.properties[name]; ok {
+			matched = true
+			errs = append(errs, sub.check(v[name], at, depth+1)...)
+		}
+		for _, p := range s.patternProperties {
+			if p.pattern.MatchString(name) {
+				matched = true
+				errs = append(errs, p.schema.check(v[name], at, depth+1)...)
+			}
+		}
+		if !matched && s.additionalProperties != nil {
+			errs = append(errs, s.additionalProperties.check(v[name], at, depth+1)...)
+		}
+	}
+	return errs
+}
+
+func (s *jsonSchema) countMatches(schemas []*jsonSchema, value interface{}, pointer string, depth int) int {
+	n := 0
+	for _, sub := range schemas {
+		if len(sub.check(value, pointer, depth+1)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if r, ok := new(big.Rat).SetString(v.String()); ok && t == "integer" && r.IsInt() {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeList renders types for a message, as in "a string or null"
+func typeList(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "null":
+			names[i] = "null"
+		case "array", "integer", "object":
+			names[i] = "an " + t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func matchesFormat(value, format string) bool {
+	switch format {
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		_, err := uuid.Parse(value)
+		return err == nil && len(value) == 36
+	}
+	return true
+}
+
+func containsJSONValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if jsonEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustMarshal renders a decoded JSON value for a message
+func mustMarshal(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileJSONSchema_Invalid(t *testing.T) {
+	invalid := []string{
+		`"string"`,
+		`{"type": "text"}`,
+		`{"type": 5}`,
+		`{"minLength": -1}`,
+		`{"minLength": 1.5}`,
+		`{"pattern": "("}`,
+		`{"multipleOf": 0}`,
+		`{"required": "name"}`,
+		`{"properties": {"a": 5}}`,
+		`{"anyOf": []}`,
+		`{"$ref": "http://example.com/schema"}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"if": {"type": "string"}}`,
+		`{"type": "object"} trailing`,
+	}
+	for _, data := range invalid {
+		if _, err := compileJSONSchema([]byte(data)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("compileJSONSchema(%s) = %v, want ErrInvalidSchema", data, err)
+		}
+	}
+}
+
+func TestJSONSchema_Validate(t *testing.T) {
+	tests := []struct {
+		name, schema, value string
+		want                []FieldError
+	}{
+		{"true", `true`, `{"a": 1}`, nil},
+		{"false", `false`, `1`, []FieldError{{Pointer: "", Message: "is not allowed"}}},
+		{"type", `{"type": ["string", "null"]}`, `1`, []FieldError{{Message: "must be a string or null"}}},
+		{"integer", `{"type": "integer"}`, `2.0`, nil},
+		{"not integer", `{"type": "integer"}`, `2.5`, []FieldError{{Message: "must be an integer"}}},
+		{"enum", `{"enum": ["a", "b"]}`, `"c"`, []FieldError{{Message: `must be one of ["a","b"]`}}},
+		{"const", `{"const": {"a": 1}}`, `{"a": 1.0}`, nil},
+		{"string", `{"minLength": 2, "maxLength": 3, "pattern": "^[a-z]+$"}`, `"äBCD"`, []FieldError{
+			{Message: "must be at most 3 characters long"},
+			{Message: `must match the pattern "^[a-z]+$"`},
+		}},
+		{"format", `{"format": "date"}`, `"2026-02-30"`, []FieldError{{Message: "must be a valid date"}}},
+		{"unknown format", `{"format": "color"}`, `"blue"`, nil},
+		{"numbers", `{"minimum": 1, "exclusiveMaximum": 10, "multipleOf": 0.1}`, `10`, []FieldError{{Message: "must be less than 10"}}},
+		{"multipleOf", `{"multipleOf": 0.1}`, `0.3`, nil},
+		{"array", `{"items": {"type": "string"}, "maxItems": 2, "uniqueItems": true}`, `["a", "a", 3]`, []FieldError{
+			{Message: "must have at most 2 items"},
+			{Message: "must not contain duplicates"},
+			{Pointer: "/2", Message: "must be a string"},
+		}},
+		{"object", `{
+			"properties": {"a/b": {"type": "string"}},
+			"patternProperties": {"^x-": {"minLength": 1}},
+			"additionalProperties": false,
+			"required": ["a/b", "c~d"]
+		}`, `{"a/b": 1, "x-1": "", "y": true}`, []FieldError{
+			{Pointer: "/c~0d", Message: "is required"},
+			{Pointer: "/a~1b", Message: "must be a string"},
+			{Pointer: "/x-1", Message: "must be at least 1 characters long"},
+			{Pointer: "/y", Message: "is not allowed"},
+		}},
+		{"propertyNames", `{"propertyNames": {"pattern": "^[a-z]+$"}}`, `{"Bad": 1}`, []FieldError{
+			{Pointer: "/Bad", Message: `name must match the pattern "^[a-z]+$"`},
+		}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "number"}]}`, `true`, []FieldError{
+			{Message: "must match at least one schema of anyOf"},
+		}},
+		{"oneOf", `{"oneOf": [{"minimum": 1}, {"maximum": 5}]}`, `3`, []FieldError{
+			{Message: "must match exactly one schema of oneOf, but matches 2"},
+		}},
+		{"not", `{"not": {"const": "x"}}`, `"x"`, []FieldError{{Message: "must not match the schema of not"}}},
+		{"allOf", `{"allOf": [{"minLength": 2}, {"maxLength": 0}]}`, `"a"`, []FieldError{
+			{Message: "must be at least 2 characters long"},
+			{Message: "must be at most 0 characters long"},
+		}},
+		{"ref", `{"$defs": {"code": {"pattern": "^[A-Z]{3}$"}}, "properties": {"currency": {"$ref": "#/$defs/code"}}}`,
+			`{"currency": "eur"}`, []FieldError{{Pointer: "/currency", Message: `must match the pattern "^[A-Z]{3}$"`}}},
+		{"recursive ref", `{"properties": {"child": {"$ref": "#"}}, "required": ["id"]}`, `{"id": 1, "child": {"id": 2, "child": {}}}`,
+			[]FieldError{{Pointer: "/child/child/id", Message: "is required"}}},
+		{"ref cycle", `{"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}`, `1`,
+			[]FieldError{{Message: "schema nests more than 64 levels deep"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := compileJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("compileJSONSchema() failed: %v", err)
+			}
+			value, err := decodeJSONValue([]byte(tt.value))
+			if err != nil {
+				t.Fatalf("decodeJSONValue() failed: %v", err)
+			}
+			if got := schema.validate(value, ""); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate(%s) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on the tags and metadata of a document
+const (
+	MaxTags                = 64
+	MaxTagLength           = 64
+	MaxMetadataEntries     = 64
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 1024
+)
+
+// normalizeLabels checks the tags and metadata of doc and brings them into
+// the form stores keep: tags sorted without duplicates, and nil rather than
+// empty collections. Both are copied, so the stored document shares nothing
+// with the caller's.
+func normalizeLabels(doc *Document) error {
+	var errs []FieldError
+	if len(doc.Metadata) > MaxMetadataEntries {
+		errs = append(errs, FieldError{Field: "metadata", Message: fmt.Sprintf("must not have more than %d entries", MaxMetadataEntries)})
+	}
+	keys := make([]string, 0, len(doc.Metadata))
+	for key := range doc.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := checkMetadataKey(key); err != nil {
+			errs = append(errs, FieldError{Field: "metadata", Message: err.Error()})
+		} else if utf8.RuneCountInString(doc.Metadata[key]) > MaxMetadataValueLength {
+			errs = append(errs, FieldError{Field: "metadata", Message: fmt.Sprintf("value of %q is longer than %d characters", key, MaxMetadataValueLength)})
+		}
+	}
+
+	tags := sortedSet(doc.Tags)
+	if len(tags) > MaxTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("must not have more than %d tags", MaxTags)})
+	}
+	for _, tag := range tags {
+		if err := checkTag(tag); err != nil {
+			errs = append(errs, FieldError{Field: "tags", Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	var metadata map[string]string
+	if len(doc.Metadata) > 0 {
+		metadata = make(map[string]string, len(doc.Metadata))
+		for key, value := range doc.Metadata {
+			metadata[key] = value
+		}
+	}
+	doc.Metadata, doc.Tags = metadata, tags
+	return nil
+}
+
+// checkTag accepts 1-64 characters without whitespace, commas, slashes or
+// control characters, so a tag fits in a query parameter and a path segment
+func checkTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tags must not be empty")
+	}
+	if utf8.RuneCountInString(tag) > MaxTagLength {
+		return fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	for _, r := range tag {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == ',' || r == '/' {
+			return fmt.Errorf("tag %q must not contain whitespace, commas, slashes or control characters", tag)
+		}
+	}
+	return nil
+}
+
+// checkMetadataKey accepts 1-64 letters, digits, '-', '_' and '.'
+func checkMetadataKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("keys must not be empty")
+	}
+	if len(key) > MaxMetadataKeyLength {
+		return fmt.Errorf("key %q is longer than %d characters", key, MaxMetadataKeyLength)
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("key %q may only contain letters, digits, '-', '_' and '.'", key)
+		}
+	}
+	return nil
+}
+
+// sortedSet returns a sorted copy of values without duplicates, or nil if
+// there are none
+func sortedSet(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	set := append([]string(nil), values...)
+	sort.Strings(set)
+	n := 1
+	for _, v := range set[1:] {
+		if v != set[n-1] {
+			set[n] = v
+			n++
+		}
+	}
+	return set[:n]
+}
+
+// retag returns tags with add added and remove removed, and whether that
+// changes anything
+func retag(tags, add, remove []string) ([]string, bool) {
+	removed := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		removed[tag] = true
+	}
+	next := make([]string, 0, len(tags)+len(add))
+	for _, tag := range tags {
+		if !removed[tag] {
+			next = append(next, tag)
+		}
+	}
+	next = sortedSet(append(next, add...))
+	if len(next) != len(tags) {
+		return next, true
+	}
+	for i := range next {
+		if next[i] != tags[i] {
+			return next, true
+		}
+	}
+	return next, false
+}
+
+// labelsEqual reports whether two documents have the same tags and metadata
+func labelsEqual(a, b Document) bool {
+	if len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	return metadataEqual(a.Metadata, b.Metadata)
+}
+
+// metadataEqual reports whether two sets of metadata have the same entries
+func metadataEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLabels reports whether doc carries every tag and metadata entry opts
+// asks for
+func matchLabels(doc Document, opts ListOptions) bool {
+	for _, tag := range opts.Tags {
+		i := sort.SearchStrings(doc.Tags, tag)
+		if i == len(doc.Tags) || doc.Tags[i] != tag {
+			return false
+		}
+	}
+	for key, value := range opts.Metadata {
+		if other, ok := doc.Metadata[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// intersect returns the IDs present in both a and b
+func intersect(a, b []string) []string {
+	set := make(map[string]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	both := make([]string, 0, len(b))
+	for _, id := range b {
+		if set[id] {
+			both = append(both, id)
+		}
+	}
+	return both
+}
+
+// label is a tag or one metadata entry as indexed. A tag has an empty key,
+// which no metadata entry has.
+type label struct{ key, value string }
+
+// labelIndex maps every tag and metadata entry to the IDs of the documents
+// carrying it, so listings filtered by them only visit matching documents.
+// It is not safe for concurrent use; DocumentStore guards it with its lock.
+type labelIndex struct {
+	postings map[label]map[string]struct{}
+}
+
+func newLabelIndex() *labelIndex {
+	return &labelIndex{postings: make(map[label]map[string]struct{})}
+}
+
+// labelsOf lists the labels of doc, or those a listing asks for
+func labelsOf(tags []string, metadata map[string]string) []label {
+	labels := make([]label, 0, len(tags)+len(metadata))
+	for _, tag := range tags {
+		labels = append(labels, label{value: tag})
+	}
+	for key, value := range metadata {
+		labels = append(labels, label{key: key, value: value})
+	}
+	return labels
+}
+
+func (idx *labelIndex) add(doc Document) {
+	for _, l := range labelsOf(doc.Tags, doc.Metadata) {
+		set, ok := idx.postings[l]
+		if !ok {
+			set = make(map[string]struct{})
+			idx.postings[l] = set
+		}
+		set[doc.ID] = struct{}{}
+	}
+}
+
+func (idx *labelIndex) remove(doc Document) {
+	for _, l := range labelsOf(doc.Tags, doc.Metadata) {
+		if set, ok := idx.postings[l]; ok {
+			delete(set, doc.ID)
+			if len(set) == 0 {
+				delete(idx.postings, l)
+			}
+		}
+	}
+}
+
+// lookup returns the IDs of the documents matching the tags and metadata in
+// opts. ok is false when opts does not filter on either.
+func (idx *labelIndex) lookup(opts ListOptions) (ids []string, ok bool) {
+	labels := labelsOf(opts.Tags, opts.Metadata)
+	if len(labels) == 0 {
+		return nil, false
+	}
+	sets := make([]map[string]struct{}, len(labels))
+	for i, l := range labels {
+		sets[i] = idx.postings[l]
+	}
+
+	// Walk the smallest set and probe the others
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	ids = make([]string, 0, len(sets[0]))
+next:
+	for id := range sets[0] {
+		for _, set := range sets[1:] {
+			if _, ok := set[id]; !ok {
+				continue next
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLabels(t *testing.T) {
+	metadata := map[string]string{"project": "apollo"}
+	doc := Document{Tags: []string{"b", "a", "b"}, Metadata: metadata}
+	if err := normalizeLabels(&doc); err != nil {
+		t.Fatalf("normalizeLabels() failed: %v", err)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"a", "b"}) {
+		t.Errorf("tags = %v, want [a b]", doc.Tags)
+	}
+	metadata["project"] = "changed"
+	if doc.Metadata["project"] != "apollo" {
+		t.Error("normalized metadata should not share the caller's map")
+	}
+
+	empty := Document{Tags: []string{}, Metadata: map[string]string{}}
+	if err := normalizeLabels(&empty); err != nil || empty.Tags != nil || empty.Metadata != nil {
+		t.Errorf("empty labels = %#v, %#v, %v, want nil", empty.Tags, empty.Metadata, err)
+	}
+
+	invalid := Document{
+		Tags:     []string{"", "two words", "a/b", strings.Repeat("x", MaxTagLength+1)},
+		Metadata: map[string]string{"bad key": "x", "long": strings.Repeat("x", MaxMetadataValueLength+1)},
+	}
+	err := normalizeLabels(&invalid)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Errors) != 6 {
+		t.Errorf("expected six field errors, got %v", err)
+	}
+}
+
+func TestRetag(t *testing.T) {
+	tests := []struct {
+		tags, add, remove, want []string
+		changed                 bool
+	}{
+		{nil, []string{"b", "a"}, nil, []string{"a", "b"}, true},
+		{[]string{"a", "b"}, []string{"a"}, nil, []string{"a", "b"}, false},
+		{[]string{"a", "b"}, nil, []string{"a"}, []string{"b"}, true},
+		{[]string{"a"}, nil, []string{"missing"}, []string{"a"}, false},
+		{[]string{"a"}, nil, []string{"a"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, changed := retag(tt.tags, tt.add, tt.remove)
+		if !reflect.DeepEqual(got, tt.want) || changed != tt.changed {
+			t.Errorf("retag(%v, +%v, -%v) = %v, %v, want %v, %v", tt.tags, tt.add, tt.remove, got, changed, tt.want, tt.changed)
+		}
+	}
+}
+
+// listIDs returns the IDs of every document the listing matches, sorted
+func listIDs(t *testing.T, store Store, opts ListOptions) []string {
+	t.Helper()
+	opts.Limit = MaxPageSize
+	page, err := store.List(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	ids := make([]string, 0, len(page.Documents))
+	for _, doc := range page.Documents {
+		ids = append(ids, doc.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestStoreContract_Labels(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			byName, err := ParseFilter("name=Report")
+			if err != nil {
+				t.Fatalf("ParseFilter() failed: %v", err)
+			}
+
+			store.Create(ctx, Document{ID: "1", Name: "Plan", Tags: []string{"urgent", "draft"}, Metadata: map[string]string{"project": "apollo", "customer": "acme"}})
+			store.Create(ctx, Document{ID: "2", Name: "Report", Tags: []string{"urgent"}, Metadata: map[string]string{"project": "apollo"}})
+			store.Create(ctx, Document{ID: "3", Name: "Notes", Metadata: map[string]string{"project": "gemini"}})
+
+			doc, err := store.Get(ctx, "1")
+			if err != nil || !reflect.DeepEqual(doc.Tags, []string{"draft", "urgent"}) || doc.Metadata["customer"] != "acme" {
+				t.Errorf("Get() = %+v, %v", doc, err)
+			}
+
+			tests := []struct {
+				name string
+				opts ListOptions
+				want []string
+			}{
+				{"one tag", ListOptions{Tags: []string{"urgent"}}, []string{"1", "2"}},
+				{"every tag", ListOptions{Tags: []string{"urgent", "draft"}}, []string{"1"}},
+				{"unknown tag", ListOptions{Tags: []string{"missing"}}, []string{}},
+				{"metadata", ListOptions{Metadata: map[string]string{"project": "apollo"}}, []string{"1", "2"}},
+				{"metadata and tag", ListOptions{Tags: []string{"urgent"}, Metadata: map[string]string{"customer": "acme"}}, []string{"1"}},
+				{"metadata value", ListOptions{Metadata: map[string]string{"project": "gemini"}}, []string{"3"}},
+				{"with filter", ListOptions{Metadata: map[string]string{"project": "apollo"}, Filter: byName}, []string{"2"}},
+			}
+			for _, tt := range tests {
+				if got := listIDs(t, store, tt.opts); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: List() = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+
+			// Rewriting a document moves it between index entries
+			store.Update(ctx, "2", Document{Name: "Report", Metadata: map[string]string{"project": "gemini"}})
+			if got := listIDs(t, store, ListOptions{Tags: []string{"urgent"}}); !reflect.DeepEqual(got, []string{"1"}) {
+				t.Errorf("after Update: tagged urgent = %v, want [1]", got)
+			}
+			if got := listIDs(t, store, ListOptions{Metadata: map[string]string{"project": "gemini"}}); !reflect.DeepEqual(got, []string{"2", "3"}) {
+				t.Errorf("after Update: project gemini = %v, want [2 3]", got)
+			}
+
+			doc, err = store.UpdateTags(ctx, "3", []string{"archived", "urgent"}, nil)
+			if err != nil || !reflect.DeepEqual(doc.Tags, []string{"archived", "urgent"}) || doc.Version != 2 {
+				t.Errorf("UpdateTags() = %+v, %v", doc, err)
+			}
+			doc, err = store.UpdateTags(ctx, "3", []string{"urgent"}, []string{"missing"})
+			if err != nil || doc.Version != 2 {
+				t.Errorf("UpdateTags() without changes = %+v, %v, want version 2 kept", doc, err)
+			}
+			doc, err = store.UpdateTags(ctx, "3", nil, []string{"urgent"}, IfMatch(2))
+			if err != nil || !reflect.DeepEqual(doc.Tags, []string{"archived"}) || doc.Version != 3 {
+				t.Errorf("UpdateTags() removing = %+v, %v", doc, err)
+			}
+			if _, err := store.UpdateTags(ctx, "3", []string{"bad tag"}, nil); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation, got %v", err)
+			}
+			if _, err := store.UpdateTags(ctx, "missing", []string{"x"}, nil); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+			if got := listIDs(t, store, ListOptions{Tags: []string{"archived"}}); !reflect.DeepEqual(got, []string{"3"}) {
+				t.Errorf("tagged archived = %v, want [3]", got)
+			}
+
+			// Patches reach into metadata, even of documents without any
+			patch, _ := ParseJSONPatch([]byte(`[{"op": "add", "path": "/metadata/owner", "value": "kim"}, {"op": "add", "path": "/tags/-", "value": "new"}]`))
+			doc, err = store.Patch(ctx, "2", patch)
+			if err != nil || doc.Metadata["owner"] != "kim" || doc.Metadata["project"] != "gemini" || !reflect.DeepEqual(doc.Tags, []string{"new"}) {
+				t.Errorf("Patch() = %+v, %v", doc, err)
+			}
+			merge, _ := ParseMergePatch([]byte(`{"metadata": {"owner": null}}`))
+			if doc, err = store.Patch(ctx, "2", merge); err != nil || !reflect.DeepEqual(doc.Metadata, map[string]string{"project": "gemini"}) {
+				t.Errorf("merge Patch() = %+v, %v", doc, err)
+			}
+			if got := listIDs(t, store, ListOptions{Metadata: map[string]string{"owner": "kim"}}); len(got) != 0 {
+				t.Errorf("owner kim = %v, want none", got)
+			}
+
+			store.Delete(ctx, "1")
+			if got := listIDs(t, store, ListOptions{Metadata: map[string]string{"customer": "acme"}}); len(got) != 0 {
+				t.Errorf("after Delete: customer acme = %v, want none", got)
+			}
+			if err := store.Create(ctx, Document{ID: "4", Metadata: map[string]string{"": "x"}}); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation for an empty metadata key, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreLabels_Reopen checks that durable backends keep tags and metadata
+// filterable across restarts
+func TestStoreLabels_Reopen(t *testing.T) {
+	ctx := context.Background()
+	doc := Document{ID: "1", Tags: []string{"kept"}, Metadata: map[string]string{"project": "apollo"}}
+	opts := ListOptions{Tags: []string{"kept"}, Metadata: map[string]string{"project": "apollo"}}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.Create(ctx, doc)
+	fileStore.Compact()
+	fileStore.Create(ctx, Document{ID: "2", Tags: doc.Tags, Metadata: doc.Metadata})
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	if got := listIDs(t, reopenedFile, opts); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("file store listing after reopen = %v, want [1 2]", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.Create(ctx, doc)
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	if got := listIDs(t, reopenedSQLite, opts); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("sqlite listing after reopen = %v, want [1]", got)
+	}
+	var plan string
+	reopenedSQLite.db.QueryRow("EXPLAIN QUERY PLAN SELECT document_id FROM document_tags WHERE tag = 'kept'").Scan(new(int), new(int), new(int), &plan)
+	if !strings.Contains(plan, "idx_document_tags_tag") {
+		t.Errorf("tag lookups should use the tag index, plan: %q", plan)
+	}
+}
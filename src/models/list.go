@@ -0,0 +1,212 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fields List can sort by
+const (
+	SortByID        = "id"
+	SortByName      = "name"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
+// Page sizes applied by List. Larger limits are clamped to MaxPageSize.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var (
+	// ErrInvalidCursor is returned for cursors that are malformed or were
+	// issued for a different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidSort is returned for an unknown sort field
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+// ListOptions selects one page of documents
+type ListOptions struct {
+	Limit      int
+	Cursor     string
+	SortBy     string
+	Descending bool
+	// Filter restricts the listing to matching documents; nil matches all
+	Filter Filter
+	// Tags and Metadata restrict the listing to documents carrying every
+	// tag and every metadata key with the value given. Stores answer them
+	// from an index.
+	Tags     []string
+	Metadata map[string]string
+	// Collection restricts the listing to the documents directly in the
+	// collection at this path ("/" for the root), or anywhere below it if
+	// Recursive is set
+	Collection string
+	Recursive  bool
+}
+
+// DocumentPage is one page of a listing. Total counts every document matching
+// the filter; NextCursor is empty on the last page.
+type DocumentPage struct {
+	Documents  []Document `json:"documents"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	Total      int        `json:"total"`
+}
+
+// ParseSort parses a sort parameter such as "name" or "-updated_at"
+// (descending) into ListOptions fields. An empty value sorts by ID.
+func ParseSort(value string) (field string, descending bool, err error) {
+	field = strings.TrimSpace(value)
+	if strings.HasPrefix(field, "-") {
+		descending = true
+		field = field[1:]
+	}
+	if field == "" && !descending {
+		return SortByID, false, nil
+	}
+	if err := checkSortField(field); err != nil {
+		return "", false, err
+	}
+	return field, descending, nil
+}
+
+func checkSortField(field string) error {
+	switch field {
+	case SortByID, SortByName, SortByCreatedAt, SortByUpdatedAt:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown field %q (use id, name, created_at or updated_at)", ErrInvalidSort, field)
+}
+
+// compareDocuments orders documents by field, breaking ties by ID so the order is total
+func compareDocuments(a, b Document, field string) int {
+	var c int
+	switch field {
+	case SortByName:
+		c = strings.Compare(a.Name, b.Name)
+	case SortByCreatedAt:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	case SortByUpdatedAt:
+		c = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	return c
+}
+
+// pageCursor is the decoded form of an opaque cursor. It holds the sort key
+// of the last document returned rather than an offset, so documents created
+// or deleted meanwhile neither repeat nor shift entries across pages.
+type pageCursor struct {
+	SortBy     string    `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	ID         string    `json:"i"`
+	Name       string    `json:"n,omitempty"`
+	Time       time.Time `json:"t,omitzero"`
+}
+
+func encodeCursor(doc Document, field string, descending bool) string {
+	c := pageCursor{SortBy: field, Descending: descending, ID: doc.ID}
+	switch field {
+	case SortByName:
+		c.Name = doc.Name
+	case SortByCreatedAt:
+		c.Time = doc.CreatedAt
+	case SortByUpdatedAt:
+		c.Time = doc.UpdatedAt
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor turns a cursor back into the sort key of the document it points after
+func decodeCursor(value, field string, descending bool) (Document, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Document{}, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return Document{}, ErrInvalidCursor
+	}
+	if c.SortBy != field || c.Descending != descending {
+		return Document{}, fmt.Errorf("%w: issued for a different sort order", ErrInvalidCursor)
+	}
+	return Document{ID: c.ID, Name: c.Name, CreatedAt: c.Time, UpdatedAt: c.Time}, nil
+}
+
+// sortField returns the field opts sorts by
+func sortField(opts ListOptions) (string, error) {
+	if opts.SortBy == "" {
+		return SortByID, nil
+	}
+	return opts.SortBy, checkSortField(opts.SortBy)
+}
+
+// pageSize returns the number of documents a page of opts holds
+func pageSize(opts ListOptions) int {
+	switch {
+	case opts.Limit <= 0:
+		return DefaultPageSize
+	case opts.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return opts.Limit
+}
+
+// paginate filters and sorts docs and cuts out the page selected by opts.
+// The in-memory backends list through here; the SQLite store does the same
+// in SQL, and the store contract tests keep their results in agreement.
+func paginate(docs []Document, opts ListOptions) (DocumentPage, error) {
+	field, err := sortField(opts)
+	if err != nil {
+		return DocumentPage{}, err
+	}
+
+	if opts.Filter != nil || len(opts.Tags) > 0 || len(opts.Metadata) > 0 {
+		matched := docs[:0]
+		for _, doc := range docs {
+			if matchLabels(doc, opts) && (opts.Filter == nil || opts.Filter.match(doc)) {
+				matched = append(matched, doc)
+			}
+		}
+		docs = matched
+	}
+
+	limit := pageSize(opts)
+
+	less := func(a, b Document) bool {
+		if opts.Descending {
+			return compareDocuments(a, b, field) > 0
+		}
+		return compareDocuments(a, b, field) < 0
+	}
+	sort.Slice(docs, func(i, j int) bool { return less(docs[i], docs[j]) })
+
+	start := 0
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, field, opts.Descending)
+		if err != nil {
+			return DocumentPage{}, err
+		}
+		start = sort.Search(len(docs), func(i int) bool { return less(after, docs[i]) })
+	}
+	end := start + limit
+	if end > len(docs) {
+		end = len(docs)
+	}
+
+	page := DocumentPage{Documents: append(make([]Document, 0, end-start), docs[start:end]...), Total: len(docs)}
+	if end < len(docs) {
+		page.NextCursor = encodeCursor(docs[end-1], field, opts.Descending)
+	}
+	return page, nil
+}
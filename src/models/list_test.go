@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		value      string
+		field      string
+		descending bool
+		wantErr    bool
+	}{
+		{"", SortByID, false, false},
+		{"name", SortByName, false, false},
+		{"-updated_at", SortByUpdatedAt, true, false},
+		{" created_at ", SortByCreatedAt, false, false},
+		{"-", "", false, true},
+		{"size", "", false, true},
+	}
+
+	for _, tt := range tests {
+		field, descending, err := ParseSort(tt.value)
+		if (err != nil) != tt.wantErr || field != tt.field || descending != tt.descending {
+			t.Errorf("ParseSort(%q) = %q, %v, %v", tt.value, field, descending, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("ParseSort(%q) error should wrap ErrInvalidSort, got %v", tt.value, err)
+		}
+	}
+}
+
+func TestDocumentStore_ListPagination(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		store.Create(ctx, Document{ID: fmt.Sprintf("doc-%d", i)})
+	}
+
+	page, err := store.List(ctx, ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if page.Total != 5 || len(page.Documents) != 2 || page.Documents[0].ID != "doc-0" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	// Writes between pages must not repeat or skip the remaining documents
+	store.Delete(ctx, "doc-1")
+	store.Create(ctx, Document{ID: "doc-00"})
+
+	page, err = store.List(ctx, ListOptions{Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("List() with cursor failed: %v", err)
+	}
+	if len(page.Documents) != 2 || page.Documents[0].ID != "doc-2" || page.Documents[1].ID != "doc-3" {
+		t.Errorf("unexpected second page: %+v", page.Documents)
+	}
+
+	page, _ = store.List(ctx, ListOptions{Limit: 2, Cursor: page.NextCursor})
+	if len(page.Documents) != 1 || page.Documents[0].ID != "doc-4" || page.NextCursor != "" {
+		t.Errorf("unexpected last page: %+v", page)
+	}
+}
+
+func TestDocumentStore_ListLimits(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	for i := 0; i < MaxPageSize+1; i++ {
+		store.Create(ctx, Document{ID: fmt.Sprintf("doc-%03d", i)})
+	}
+
+	page, _ := store.List(ctx, ListOptions{})
+	if len(page.Documents) != DefaultPageSize {
+		t.Errorf("expected default page size %d, got %d", DefaultPageSize, len(page.Documents))
+	}
+
+	page, _ = store.List(ctx, ListOptions{Limit: MaxPageSize * 10})
+	if len(page.Documents) != MaxPageSize || page.NextCursor == "" {
+		t.Errorf("expected page clamped to %d, got %d", MaxPageSize, len(page.Documents))
+	}
+}
+
+func TestDocumentStore_ListInvalidOptions(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	store.Create(ctx, Document{ID: "1"})
+	store.Create(ctx, Document{ID: "2"})
+
+	if _, err := store.List(ctx, ListOptions{SortBy: "size"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+	if _, err := store.List(ctx, ListOptions{Cursor: "%%%"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	page, _ := store.List(ctx, ListOptions{Limit: 1, SortBy: SortByName})
+	if _, err := store.List(ctx, ListOptions{Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor reused with another sort order should be rejected, got %v", err)
+	}
+}
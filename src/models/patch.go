@@ -0,0 +1,502 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch formats accepted besides plain JSON
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalidPatch is returned for patches that are malformed in themselves
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchConflict is returned when a patch does not fit the document,
+	// such as an operation on a path that does not exist
+	ErrPatchConflict = errors.New("patch does not apply to the document")
+	// ErrPatchTestFailed is returned when a JSON Patch test operation finds
+	// a different value, so the patch is not applied
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+// DocumentPatch transforms the JSON form of a document. It is applied to a
+// copy, and the result replaces the document only if every field it changes
+// may be changed and has the right type.
+type DocumentPatch interface {
+	apply(doc map[string]interface{}) (interface{}, error)
+}
+
+// MergePatch is a JSON Merge Patch (RFC 7396): an object whose members
+// replace those of the document, recursively, with null removing a member
+type MergePatch struct {
+	patch map[string]interface{}
+}
+
+// ParseMergePatch parses a JSON Merge Patch. Since documents are objects,
+// the patch must be one too.
+func ParseMergePatch(data []byte) (MergePatch, error) {
+	value, err := decodeJSONValue(data)
+	if err != nil {
+		return MergePatch{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	patch, ok := value.(map[string]interface{})
+	if !ok {
+		return MergePatch{}, fmt.Errorf("%w: a merge patch must be a JSON object", ErrInvalidPatch)
+	}
+	return MergePatch{patch: patch}, nil
+}
+
+func (p MergePatch) apply(doc map[string]interface{}) (interface{}, error) {
+	return mergePatch(doc, p.patch), nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// JSON Patch operations
+const (
+	PatchAdd     = "add"
+	PatchRemove  = "remove"
+	PatchReplace = "replace"
+	PatchMove    = "move"
+	PatchCopy    = "copy"
+	PatchTest    = "test"
+)
+
+// JSONPatch is a JSON Patch (RFC 6902): operations applied in order, all of
+// them or none
+type JSONPatch []PatchOperation
+
+// PatchOperation is one step of a JSON Patch. Path and From are JSON
+// Pointers (RFC 6901).
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+
+	path, from []string
+}
+
+// ParseJSONPatch parses a JSON Patch, checking that every operation is
+// known and has the members it needs
+func ParseJSONPatch(data []byte) (JSONPatch, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: a JSON patch must be an array of operations", ErrInvalidPatch)
+	}
+
+	patch := make(JSONPatch, len(raw))
+	for i, members := range raw {
+		op, err := parsePatchOperation(members)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalidPatch, i, err)
+		}
+		patch[i] = op
+	}
+	return patch, nil
+}
+
+func parsePatchOperation(members map[string]json.RawMessage) (PatchOperation, error) {
+	var op PatchOperation
+	for _, member := range []struct {
+		name string
+		into *string
+	}{{"op", &op.Op}, {"path", &op.Path}} {
+		raw, ok := members[member.name]
+		if !ok {
+			return op, fmt.Errorf("missing %q", member.name)
+		}
+		if err := json.Unmarshal(raw, member.into); err != nil {
+			return op, fmt.Errorf("%q must be a string", member.name)
+		}
+	}
+
+	var err error
+	if op.path, err = parsePointer(op.Path); err != nil {
+		return op, err
+	}
+	switch op.Op {
+	case PatchAdd, PatchReplace, PatchTest:
+		raw, ok := members["value"]
+		if !ok {
+			return op, fmt.Errorf("%s needs a \"value\"", op.Op)
+		}
+		if op.Value, err = decodeJSONValue(raw); err != nil {
+			return op, err
+		}
+	case PatchMove, PatchCopy:
+		raw, ok := members["from"]
+		if !ok {
+			return op, fmt.Errorf("%s needs a \"from\"", op.Op)
+		}
+		if err := json.Unmarshal(raw, &op.From); err != nil {
+			return op, errors.New(`"from" must be a string`)
+		}
+		if op.from, err = parsePointer(op.From); err != nil {
+			return op, err
+		}
+		if op.Op == PatchMove && isProperPrefix(op.from, op.path) {
+			return op, errors.New("cannot move a value into itself")
+		}
+	case PatchRemove:
+	default:
+		return op, fmt.Errorf("unknown op %q (use add, remove, replace, move, copy or test)", op.Op)
+	}
+	return op, nil
+}
+
+func (p JSONPatch) apply(doc map[string]interface{}) (interface{}, error) {
+	var root interface{} = doc
+	for i, op := range p {
+		var err error
+		if root, err = op.apply(root); err != nil {
+			if errors.Is(err, ErrPatchTestFailed) {
+				return nil, fmt.Errorf("%w: operation %d: %s", ErrPatchTestFailed, i, op.Path)
+			}
+			return nil, fmt.Errorf("%w: operation %d (%s %s): %v", ErrPatchConflict, i, op.Op, op.Path, err)
+		}
+	}
+	return root, nil
+}
+
+func (op PatchOperation) apply(root interface{}) (interface{}, error) {
+	switch op.Op {
+	case PatchAdd:
+		return addValue(root, op.path, copyJSONValue(op.Value))
+	case PatchRemove:
+		root, _, err := removeValue(root, op.path)
+		return root, err
+	case PatchReplace:
+		if len(op.path) == 0 {
+			return copyJSONValue(op.Value), nil
+		}
+		root, _, err := removeValue(root, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(root, op.path, copyJSONValue(op.Value))
+	case PatchMove:
+		root, value, err := removeValue(root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(root, op.path, value)
+	case PatchCopy:
+		value, err := getValue(root, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(root, op.path, copyJSONValue(value))
+	case PatchTest:
+		value, err := getValue(root, op.path)
+		if err != nil || !jsonEqual(value, op.Value) {
+			return nil, ErrPatchTestFailed
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must be empty or start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, fmt.Errorf("path %q has an invalid escape; use ~0 for ~ and ~1 for /", pointer)
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex resolves a reference token to an index of an array of length n.
+// When appending, "-" and n itself name the position after the last element.
+func arrayIndex(token string, n int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	if i > n || (i == n && !appending) {
+		return 0, fmt.Errorf("index %d is out of range", i)
+	}
+	return i, nil
+}
+
+func getValue(node interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			node = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar", token)
+		}
+	}
+	return node, nil
+}
+
+// atParent applies change to the container holding the last token of
+// tokens, returning node with the changed container in place
+func atParent(node interface{}, tokens []string, change func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return change(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", tokens[0])
+		}
+		child, err := atParent(child, tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := atParent(n[i], tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot look up %q in a scalar", tokens[0])
+}
+
+func addValue(root interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return atParent(root, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			c[token] = value
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a scalar", token)
+	})
+}
+
+// removeValue removes the value at tokens, returning it along with root
+func removeValue(root interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	var removed interface{}
+	root, err := atParent(root, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch c := container.(type) {
+		case map[string]interface{}:
+			value, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			removed = value
+			delete(c, token)
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove %q from a scalar", token)
+	})
+	return root, removed, err
+}
+
+// decodeJSONValue decodes JSON keeping numbers exact
+func decodeJSONValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			c[key] = copyJSONValue(member)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, element := range v {
+			c[i] = copyJSONValue(element)
+		}
+		return c
+	}
+	return value
+}
+
+// jsonEqual compares decoded JSON values as RFC 6902 test does: numbers by
+// value, objects regardless of member order
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	}
+	return a == b
+}
+
+// applyPatch returns doc with patch applied to its JSON form. The fields the
+// patch changes are checked like those of a partial update.
+func applyPatch(doc Document, patch DocumentPatch) (Document, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return Document{}, err
+	}
+	decoded, err := decodeJSONValue(data)
+	if err != nil {
+		return Document{}, err
+	}
+	original := decoded.(map[string]interface{})
+	// An empty type, metadata and tags are omitted from the JSON form, but
+	// patches must be able to replace or add to them
+	if _, ok := original["type"]; !ok {
+		original["type"] = ""
+	}
+	if _, ok := original["metadata"]; !ok {
+		original["metadata"] = map[string]interface{}{}
+	}
+	if _, ok := original["tags"]; !ok {
+		original["tags"] = []interface{}{}
+	}
+
+	patched, err := patch.apply(copyJSONValue(original).(map[string]interface{}))
+	if err != nil {
+		return Document{}, err
+	}
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return Document{}, fmt.Errorf("%w: the document must remain a JSON object", ErrPatchConflict)
+	}
+
+	updates := make(map[string]interface{})
+	var removed []string
+	for key, value := range result {
+		if before, ok := original[key]; !ok || !jsonEqual(before, value) {
+			updates[key] = value
+		}
+	}
+	for key := range original {
+		if _, ok := result[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	if err := applyFieldChanges(&doc, updates, removed); err != nil {
+		return Document{}, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPatch(t *testing.T) {
+	valid := []string{
+		`[]`,
+		`[{"op": "add", "path": "/name", "value": "x"}]`,
+		`[{"op": "remove", "path": "/description"}]`,
+		`[{"op": "move", "from": "/a~1b", "path": "/c~0d"}]`,
+		`[{"op": "test", "path": "", "value": {}}]`,
+		`[{"op": "add", "path": "/name", "value": null}]`,
+	}
+	for _, data := range valid {
+		if _, err := ParseJSONPatch([]byte(data)); err != nil {
+			t.Errorf("ParseJSONPatch(%s) failed: %v", data, err)
+		}
+	}
+
+	invalid := []string{
+		`{"op": "add"}`,
+		`[{"path": "/name", "value": "x"}]`,
+		`[{"op": "frobnicate", "path": "/name"}]`,
+		`[{"op": "add", "path": "/name"}]`,
+		`[{"op": "copy", "path": "/name"}]`,
+		`[{"op": "add", "path": "name", "value": "x"}]`,
+		`[{"op": "add", "path": "/~2", "value": "x"}]`,
+		`[{"op": "move", "from": "/a", "path": "/a/b"}]`,
+		`[{"op": "add", "path": "/name", "value": "x"}] trailing`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseJSONPatch([]byte(data)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("ParseJSONPatch(%s) = %v, want ErrInvalidPatch", data, err)
+		}
+	}
+}
+
+func TestParseMergePatch(t *testing.T) {
+	if _, err := ParseMergePatch([]byte(`{"name": "x", "description": null}`)); err != nil {
+		t.Errorf("ParseMergePatch() failed: %v", err)
+	}
+	for _, data := range []string{`["name"]`, `"name"`, `null`, `{`} {
+		if _, err := ParseMergePatch([]byte(data)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("ParseMergePatch(%s) = %v, want ErrInvalidPatch", data, err)
+		}
+	}
+}
+
+func TestMergePatch_RFC7396(t *testing.T) {
+	// Examples from RFC 7396, appendix A
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		target, _ := decodeJSONValue([]byte(tt.target))
+		patch, _ := decodeJSONValue([]byte(tt.patch))
+		want, _ := decodeJSONValue([]byte(tt.want))
+		if got := mergePatch(target, patch); !jsonEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPatch_RFC6902(t *testing.T) {
+	// Examples from RFC 6902, appendix A
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy", `{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":{"bar":1},"baz":{"bar":1}}`, nil},
+		{"test success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"test failure", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrPatchTestFailed},
+		{"nested add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrPatchConflict},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", ErrPatchConflict},
+		{"escaped pointers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":8}]`, `{"/":8,"~1":10}`, nil},
+		{"index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"x"}]`, "", ErrPatchConflict},
+		{"leading zero index", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", ErrPatchConflict},
+		{"test object ignores order", `{"foo":{"a":1,"b":2}}`, `[{"op":"test","path":"/foo","value":{"b":2,"a":1}}]`, `{"foo":{"a":1,"b":2}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := ParseJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ParseJSONPatch() failed: %v", err)
+			}
+			doc, _ := decodeJSONValue([]byte(tt.doc))
+			got, err := patch.apply(doc.(map[string]interface{}))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("apply() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			want, _ := decodeJSONValue([]byte(tt.want))
+			if err != nil || !jsonEqual(got, want) {
+				t.Errorf("apply() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreContract_Patch(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			store.Create(ctx, Document{ID: "1", Name: "One", Description: "First"})
+
+			mustPatch := func(data string, parse func([]byte) (DocumentPatch, error)) DocumentPatch {
+				t.Helper()
+				patch, err := parse([]byte(data))
+				if err != nil {
+					t.Fatalf("parse %s failed: %v", data, err)
+				}
+				return patch
+			}
+			merge := func(data []byte) (DocumentPatch, error) { return ParseMergePatch(data) }
+			jsonPatch := func(data []byte) (DocumentPatch, error) { return ParseJSONPatch(data) }
+
+			doc, err := store.Patch(ctx, "1", mustPatch(`{"name": "Uno", "description": null}`, merge))
+			if err != nil || doc.Name != "Uno" || doc.Description != "" || doc.Version != 2 {
+				t.Errorf("merge Patch() = %+v, %v", doc, err)
+			}
+			if got, _ := store.Get(ctx, "1"); !reflect.DeepEqual(got, doc) {
+				t.Errorf("Get() after Patch() = %+v, want %+v", got, doc)
+			}
+
+			doc, err = store.Patch(ctx, "1", mustPatch(`[
+				{"op": "test", "path": "/version", "value": 2},
+				{"op": "copy", "from": "/name", "path": "/description"},
+				{"op": "replace", "path": "/name", "value": "One"}
+			]`, jsonPatch))
+			if err != nil || doc.Name != "One" || doc.Description != "Uno" || doc.Version != 3 {
+				t.Errorf("JSON Patch() = %+v, %v", doc, err)
+			}
+
+			// A failed test is a compare-and-set that lost: nothing changes
+			_, err = store.Patch(ctx, "1", mustPatch(`[
+				{"op": "replace", "path": "/name", "value": "Lost"},
+				{"op": "test", "path": "/version", "value": 2}
+			]`, jsonPatch))
+			if !errors.Is(err, ErrPatchTestFailed) {
+				t.Errorf("expected ErrPatchTestFailed, got %v", err)
+			}
+
+			_, err = store.Patch(ctx, "1", mustPatch(`[{"op": "replace", "path": "/id", "value": "2"}]`, jsonPatch))
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !reflect.DeepEqual(validationErr.Errors, []FieldError{{Field: "id", Message: "is read-only"}}) {
+				t.Errorf("expected id to be read-only, got %v", err)
+			}
+			_, err = store.Patch(ctx, "1", mustPatch(`{"name": 5, "unknown": true}`, merge))
+			if !errors.As(err, &validationErr) || len(validationErr.Errors) != 2 {
+				t.Errorf("expected two field errors, got %v", err)
+			}
+			if _, err := store.Patch(ctx, "1", mustPatch(`[{"op": "replace", "path": "", "value": []}]`, jsonPatch)); !errors.Is(err, ErrPatchConflict) {
+				t.Errorf("expected ErrPatchConflict, got %v", err)
+			}
+
+			if got, _ := store.Get(ctx, "1"); !reflect.DeepEqual(got, doc) {
+				t.Errorf("failed patches changed the document: %+v, want %+v", got, doc)
+			}
+			if _, err := store.Patch(ctx, "1", mustPatch(`{}`, merge), IfMatch(1)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			if _, err := store.Patch(ctx, "missing", mustPatch(`{}`, merge)); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRevisionNotFound is returned when a document has no revision with the requested number
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is an immutable record of a document as it was after one write
+type Revision struct {
+	Revision  int64     `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author"`
+	Document  Document  `json:"document"`
+}
+
+// newRevision records doc, whose Version and update fields have already
+// been set, as a revision
+func newRevision(doc Document) *Revision {
+	return &Revision{
+		Revision:  doc.Version,
+		Timestamp: doc.UpdatedAt,
+		Author:    doc.UpdatedBy,
+		Document:  doc,
+	}
+}
+
+// findRevision returns the revision numbered rev from history
+func findRevision(history []Revision, rev int64) (Revision, error) {
+	for _, r := range history {
+		if r.Revision == rev {
+			return r, nil
+		}
+	}
+	return Revision{}, ErrRevisionNotFound
+}
+
+func (s *DocumentStore) ListRevisions(ctx context.Context, id string) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.documents[id]; !exists {
+		return nil, ErrDocumentNotFound
+	}
+
+	history := make([]Revision, len(s.revisions[id]))
+	copy(history, s.revisions[id])
+	return history, nil
+}
+
+func (s *DocumentStore) GetRevision(ctx context.Context, id string, rev int64) (Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return Revision{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.documents[id]; !exists {
+		return Revision{}, ErrDocumentNotFound
+	}
+	return findRevision(s.revisions[id], rev)
+}
+
+func (s *DocumentStore) RestoreRevision(ctx context.Context, id string, rev int64, opts ...WriteOption) (Document, error) {
+	if err := ctx.Err(); err != nil {
+		return Document{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.documents[id]
+	if !exists {
+		return Document{}, ErrDocumentNotFound
+	}
+	if err := collectWriteOptions(opts).check(current); err != nil {
+		return Document{}, err
+	}
+	old, err := findRevision(s.revisions[id], rev)
+	if err != nil {
+		return Document{}, err
+	}
+
+	// The content and the collection are not part of what is restored
+	restored := old.Document
+	restored.ContentInfo = current.ContentInfo
+	restored.CollectionID = current.CollectionID
+	if err := s.put(ctx, restored); err != nil {
+		return Document{}, err
+	}
+	return s.documents[id], nil
+}
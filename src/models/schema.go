@@ -0,0 +1,164 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxTypeLength bounds the name of a document type
+const MaxTypeLength = 64
+
+var (
+	// ErrSchemaNotFound is returned when no schema is registered for a type
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrInvalidSchema is returned for schema documents that are malformed
+	// or use keywords that are not supported
+	ErrInvalidSchema = errors.New("invalid schema")
+	// ErrInvalidType is returned for malformed document type names
+	ErrInvalidType = errors.New("invalid document type")
+)
+
+// Schema is the JSON Schema the metadata of every document of a type must
+// conform to. It applies to the metadata object, so property schemas
+// describe metadata values, which are always strings.
+type Schema struct {
+	Type      string          `json:"type"`
+	Schema    json.RawMessage `json:"schema" swaggertype:"object"`
+	Version   int64           `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	CreatedBy string          `json:"created_by"`
+	UpdatedBy string          `json:"updated_by"`
+}
+
+// checkTypeName accepts 1-64 letters, digits, '-', '_' and '.'
+func checkTypeName(name string) error {
+	if name == "" || len(name) > MaxTypeLength {
+		return fmt.Errorf("%w: must be 1 to %d characters", ErrInvalidType, MaxTypeLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("%w: %q may only contain letters, digits, '-', '_' and '.'", ErrInvalidType, name)
+		}
+	}
+	return nil
+}
+
+// newSchema checks schema and prepares it as the next version of the
+// registration for docType, replacing current if there is one
+func newSchema(ctx context.Context, docType string, schema json.RawMessage, current *Schema) (Schema, error) {
+	if err := checkTypeName(docType); err != nil {
+		return Schema{}, err
+	}
+	if _, err := compileJSONSchema(schema); err != nil {
+		return Schema{}, err
+	}
+	now, actor := time.Now().UTC(), ActorFromContext(ctx)
+	s := Schema{Type: docType, Schema: append(json.RawMessage(nil), schema...), Version: 1,
+		CreatedAt: now, UpdatedAt: now, CreatedBy: actor, UpdatedBy: actor}
+	if current != nil {
+		s.Version = current.Version + 1
+		s.CreatedAt, s.CreatedBy = current.CreatedAt, current.CreatedBy
+	}
+	return s, nil
+}
+
+// checkDocumentSchema validates the type of doc and, if schema is registered
+// for it, its metadata. current is the stored state doc replaces, or nil on
+// create. Metadata that neither changes nor moves to another type is not
+// checked again, so registering a stricter schema does not block unrelated
+// edits of documents written before.
+func checkDocumentSchema(doc Document, current *Document, schema *jsonSchema) error {
+	if doc.Type != "" {
+		if err := checkTypeName(doc.Type); err != nil {
+			return &ValidationError{Errors: []FieldError{{Field: "type", Message: err.Error()}}}
+		}
+	}
+	if schema == nil || current != nil && current.Type == doc.Type && metadataEqual(current.Metadata, doc.Metadata) {
+		return nil
+	}
+	metadata := make(map[string]interface{}, len(doc.Metadata))
+	for key, value := range doc.Metadata {
+		metadata[key] = value
+	}
+	errs := schema.validate(metadata, "/metadata")
+	if len(errs) == 0 {
+		return nil
+	}
+	for i := range errs {
+		errs[i].Field = "metadata"
+	}
+	return &ValidationError{Errors: errs}
+}
+
+// sortSchemas orders schemas by type
+func sortSchemas(schemas []Schema) {
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Type < schemas[j].Type })
+}
+
+func (s *DocumentStore) PutSchema(ctx context.Context, docType string, schema json.RawMessage) (Schema, error) {
+	if err := ctx.Err(); err != nil {
+		return Schema{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current *Schema
+	if existing, ok := s.schemas[docType]; ok {
+		current = &existing
+	}
+	registered, err := newSchema(ctx, docType, schema, current)
+	if err != nil {
+		return Schema{}, err
+	}
+	if err := s.commit(walRecord{Op: walOpPutSchema, ID: docType, Schema: &registered}); err != nil {
+		return Schema{}, err
+	}
+	return registered, nil
+}
+
+func (s *DocumentStore) GetSchema(ctx context.Context, docType string) (Schema, error) {
+	if err := ctx.Err(); err != nil {
+		return Schema{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, ok := s.schemas[docType]
+	if !ok {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return schema, nil
+}
+
+func (s *DocumentStore) ListSchemas(ctx context.Context) ([]Schema, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schemas := make([]Schema, 0, len(s.schemas))
+	for _, schema := range s.schemas {
+		schemas = append(schemas, schema)
+	}
+	sortSchemas(schemas)
+	return schemas, nil
+}
+
+func (s *DocumentStore) DeleteSchema(ctx context.Context, docType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schemas[docType]; !ok {
+		return ErrSchemaNotFound
+	}
+	return s.commit(walRecord{Op: walOpDeleteSchema, ID: docType})
+}
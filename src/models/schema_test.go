@@ -0,0 +1,168 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const contractSchema = `{
+	"type": "object",
+	"properties": {
+		"customer": {"type": "string", "minLength": 1},
+		"signed": {"type": "string", "format": "date"}
+	},
+	"required": ["customer"],
+	"additionalProperties": false
+}`
+
+// schemaErrors returns the field errors of a failed write
+func schemaErrors(t *testing.T, err error) []FieldError {
+	t.Helper()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	return validationErr.Errors
+}
+
+func TestStoreContract_Schemas(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := WithActor(context.Background(), "alice")
+
+			schema, err := store.PutSchema(ctx, "contract", json.RawMessage(contractSchema))
+			if err != nil || schema.Type != "contract" || schema.Version != 1 || schema.CreatedBy != "alice" {
+				t.Fatalf("PutSchema() = %+v, %v", schema, err)
+			}
+			if got, err := store.GetSchema(ctx, "contract"); err != nil || string(got.Schema) != contractSchema {
+				t.Errorf("GetSchema() = %+v, %v", got, err)
+			}
+			if _, err := store.PutSchema(ctx, "bad type", json.RawMessage(`{}`)); !errors.Is(err, ErrInvalidType) {
+				t.Errorf("expected ErrInvalidType, got %v", err)
+			}
+			if _, err := store.PutSchema(ctx, "other", json.RawMessage(`{"type": "text"}`)); !errors.Is(err, ErrInvalidSchema) {
+				t.Errorf("expected ErrInvalidSchema, got %v", err)
+			}
+
+			// Create, Update, PartialUpdate and Patch all validate
+			err = store.Create(ctx, Document{ID: "1", Type: "contract", Metadata: map[string]string{"signed": "yesterday", "extra": "x"}})
+			want := []FieldError{
+				{Field: "metadata", Pointer: "/metadata/customer", Message: "is required"},
+				{Field: "metadata", Pointer: "/metadata/extra", Message: "is not allowed"},
+				{Field: "metadata", Pointer: "/metadata/signed", Message: "must be a valid date"},
+			}
+			if got := schemaErrors(t, err); !reflect.DeepEqual(got, want) {
+				t.Errorf("Create() errors = %+v, want %+v", got, want)
+			}
+			if err := store.Create(ctx, Document{ID: "1", Type: "contract", Metadata: map[string]string{"customer": "acme"}}); err != nil {
+				t.Fatalf("Create() failed: %v", err)
+			}
+			if err := store.Create(ctx, Document{ID: "2", Type: "bad type"}); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation for a malformed type, got %v", err)
+			}
+			if _, err := store.Update(ctx, "1", Document{Name: "Lease", Type: "contract"}); !errors.Is(err, ErrValidation) {
+				t.Errorf("Update() without customer = %v, want ErrValidation", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"metadata": map[string]interface{}{"customer": ""}}); !errors.Is(err, ErrValidation) {
+				t.Errorf("PartialUpdate() with an empty customer = %v, want ErrValidation", err)
+			}
+			patch, _ := ParseJSONPatch([]byte(`[{"op": "add", "path": "/metadata/signed", "value": "2026-03-01"}]`))
+			doc, err := store.Patch(ctx, "1", patch)
+			if err != nil || doc.Metadata["signed"] != "2026-03-01" {
+				t.Errorf("Patch() = %+v, %v", doc, err)
+			}
+
+			// Documents of other types, or none, are not checked
+			if err := store.Create(ctx, Document{ID: "3", Metadata: map[string]string{"extra": "x"}}); err != nil {
+				t.Errorf("Create() without type failed: %v", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "3", map[string]interface{}{"type": "contract"}); !errors.Is(err, ErrValidation) {
+				t.Errorf("changing the type to contract = %v, want ErrValidation", err)
+			}
+
+			// A stricter schema leaves existing documents editable until
+			// their metadata changes
+			replaced, err := store.PutSchema(ctx, "contract", json.RawMessage(`{"required": ["customer", "region"]}`))
+			if err != nil || replaced.Version != 2 || !replaced.CreatedAt.Equal(schema.CreatedAt) {
+				t.Fatalf("PutSchema() replacing = %+v, %v", replaced, err)
+			}
+			if _, err := store.UpdateTags(ctx, "1", []string{"signed"}, nil); err != nil {
+				t.Errorf("UpdateTags() under a stricter schema failed: %v", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"metadata": map[string]interface{}{"customer": "globex"}}); !errors.Is(err, ErrValidation) {
+				t.Errorf("changing metadata under a stricter schema = %v, want ErrValidation", err)
+			}
+
+			store.PutSchema(ctx, "memo", json.RawMessage(`true`))
+			schemas, err := store.ListSchemas(ctx)
+			if err != nil || len(schemas) != 2 || schemas[0].Type != "contract" || schemas[1].Type != "memo" {
+				t.Errorf("ListSchemas() = %+v, %v", schemas, err)
+			}
+			if err := store.DeleteSchema(ctx, "contract"); err != nil {
+				t.Errorf("DeleteSchema() failed: %v", err)
+			}
+			if err := store.DeleteSchema(ctx, "contract"); !errors.Is(err, ErrSchemaNotFound) {
+				t.Errorf("expected ErrSchemaNotFound, got %v", err)
+			}
+			if _, err := store.GetSchema(ctx, "contract"); !errors.Is(err, ErrSchemaNotFound) {
+				t.Errorf("expected ErrSchemaNotFound, got %v", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"metadata": map[string]interface{}{}}); err != nil {
+				t.Errorf("PartialUpdate() after deleting the schema failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreSchemas_Reopen checks that durable backends keep enforcing
+// registered schemas across restarts
+func TestStoreSchemas_Reopen(t *testing.T) {
+	ctx := context.Background()
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		schemas, err := store.ListSchemas(ctx)
+		if err != nil || len(schemas) != 2 {
+			t.Errorf("ListSchemas() after reopen = %+v, %v", schemas, err)
+		}
+		if err := store.Create(ctx, Document{ID: "x", Type: "contract"}); !errors.Is(err, ErrValidation) {
+			t.Errorf("expected ErrValidation after reopen, got %v", err)
+		}
+		if doc, err := store.Get(ctx, "1"); err != nil || doc.Type != "contract" {
+			t.Errorf("Get() after reopen = %+v, %v", doc, err)
+		}
+	}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.PutSchema(ctx, "contract", json.RawMessage(contractSchema))
+	fileStore.Create(ctx, Document{ID: "1", Type: "contract", Metadata: map[string]string{"customer": "acme"}})
+	fileStore.Compact()
+	fileStore.PutSchema(ctx, "memo", json.RawMessage(`{}`))
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	check(t, reopenedFile)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.PutSchema(ctx, "contract", json.RawMessage(contractSchema))
+	sqliteStore.PutSchema(ctx, "memo", json.RawMessage(`{}`))
+	sqliteStore.Create(ctx, Document{ID: "1", Type: "contract", Metadata: map[string]string{"customer": "acme"}})
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	check(t, reopenedSQLite)
+}
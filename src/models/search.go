@@ -0,0 +1,410 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInvalidSearchQuery is returned for search queries without any terms
+// or with an unterminated phrase
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// BM25 parameters: k1 limits how much repeated terms add, b how strongly
+// scores are normalised by field length
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// snippetTokens is the number of tokens shown around the first match of a field
+const snippetTokens = 24
+
+// searchField is one indexed document field. Fields with a larger weight
+// contribute more to the score; adding a content field is one more entry.
+type searchField struct {
+	name   string
+	weight float64
+	value  func(Document) string
+}
+
+var searchFields = []searchField{
+	{name: "name", weight: 2, value: func(d Document) string { return d.Name }},
+	{name: "description", weight: 1, value: func(d Document) string { return d.Description }},
+}
+
+// SearchResult is a matching document with its relevance score and, per
+// matching field, an HTML snippet with the matched words wrapped in <mark>
+type SearchResult struct {
+	Document   Document          `json:"document"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SearchResults holds the best matches, most relevant first. Total counts
+// every matching document, including those beyond the limit.
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+}
+
+// token is one word of a text: its stemmed term and its byte range in the text
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower-cased, stemmed words of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	return token{term: stem(strings.ToLower(text[start:end])), start: start, end: end}
+}
+
+// searchQuery is a parsed query. Documents must contain every term and
+// every phrase; a phrase's terms must appear consecutively in one field.
+type searchQuery struct {
+	terms   []string
+	phrases [][]string
+}
+
+// parseSearchQuery splits a query into words and "quoted phrases"
+func parseSearchQuery(q string) (searchQuery, error) {
+	var query searchQuery
+	parts := strings.Split(q, `"`)
+	if len(parts)%2 == 0 {
+		return query, fmt.Errorf("%w: unterminated phrase", ErrInvalidSearchQuery)
+	}
+	for i, part := range parts {
+		var terms []string
+		for _, t := range tokenize(part) {
+			terms = append(terms, t.term)
+		}
+		switch {
+		case i%2 == 0 || len(terms) == 1:
+			query.terms = append(query.terms, terms...)
+		case len(terms) > 1:
+			query.phrases = append(query.phrases, terms)
+		}
+	}
+	if len(query.terms) == 0 && len(query.phrases) == 0 {
+		return query, fmt.Errorf("%w: no words to search for", ErrInvalidSearchQuery)
+	}
+	return query, nil
+}
+
+// allTerms lists the distinct terms of the query, including those of phrases
+func (q searchQuery) allTerms() []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, list := range append([][]string{q.terms}, q.phrases...) {
+		for _, t := range list {
+			if !seen[t] {
+				seen[t] = true
+				terms = append(terms, t)
+			}
+		}
+	}
+	return terms
+}
+
+// indexedDoc is what the index keeps about one document
+type indexedDoc struct {
+	doc     Document
+	lengths []int    // tokens per field
+	terms   []string // distinct terms, to unlink the document on removal
+}
+
+// searchIndex is an inverted index from stemmed terms to the positions where
+// they occur in each document field. Stores keep it current on every
+// mutation. It has its own lock so backends without a global mutex can share it.
+type searchIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[string][][]int // term -> document ID -> field -> positions
+	docs     map[string]*indexedDoc
+	totalLen []int // tokens per field across all documents
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string][][]int),
+		docs:     make(map[string]*indexedDoc),
+		totalLen: make([]int, len(searchFields)),
+	}
+}
+
+// add indexes doc, replacing any earlier version of it
+func (idx *searchIndex) add(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(doc.ID)
+
+	entry := &indexedDoc{doc: doc, lengths: make([]int, len(searchFields))}
+	for f, field := range searchFields {
+		tokens := tokenize(field.value(doc))
+		entry.lengths[f] = len(tokens)
+		idx.totalLen[f] += len(tokens)
+
+		for pos, t := range tokens {
+			byDoc := idx.postings[t.term]
+			if byDoc == nil {
+				byDoc = make(map[string][][]int)
+				idx.postings[t.term] = byDoc
+			}
+			positions := byDoc[doc.ID]
+			if positions == nil {
+				positions = make([][]int, len(searchFields))
+				byDoc[doc.ID] = positions
+				entry.terms = append(entry.terms, t.term)
+			}
+			positions[f] = append(positions[f], pos)
+		}
+	}
+	idx.docs[doc.ID] = entry
+}
+
+// remove drops a document from the index
+func (idx *searchIndex) remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+}
+
+func (idx *searchIndex) removeLocked(id string) {
+	entry, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range entry.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	for f, n := range entry.lengths {
+		idx.totalLen[f] -= n
+	}
+	delete(idx.docs, id)
+}
+
+// search ranks the documents matching query by BM25 and returns up to limit
+// of them. If visible is set, documents it rejects are left out.
+func (idx *searchIndex) search(query searchQuery, limit int, visible func(doc Document) bool) SearchResults {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	terms := query.allTerms()
+	candidates := idx.candidates(terms)
+
+	results := make([]SearchResult, 0, len(candidates))
+	for _, id := range candidates {
+		if !idx.matchesPhrases(id, query.phrases) {
+			continue
+		}
+		if visible != nil && !visible(idx.docs[id].doc) {
+			continue
+		}
+		results = append(results, SearchResult{Document: idx.docs[id].doc, Score: idx.score(id, terms)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Document.ID < results[j].Document.ID
+	})
+
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	termSet := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		termSet[t] = true
+	}
+	for i := range results {
+		results[i].Highlights = highlight(results[i].Document, termSet)
+	}
+	return SearchResults{Results: results, Total: total}
+}
+
+// candidates returns the documents containing every term, walking the
+// rarest term's postings and probing the others
+func (idx *searchIndex) candidates(terms []string) []string {
+	if len(terms) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), terms...)
+	sort.Slice(sorted, func(i, j int) bool { return len(idx.postings[sorted[i]]) < len(idx.postings[sorted[j]]) })
+
+	var ids []string
+	for id := range idx.postings[sorted[0]] {
+		all := true
+		for _, t := range sorted[1:] {
+			if _, ok := idx.postings[t][id]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// matchesPhrases reports whether every phrase occurs, as consecutive
+// tokens within a single field, in the document
+func (idx *searchIndex) matchesPhrases(id string, phrases [][]string) bool {
+	for _, phrase := range phrases {
+		if !idx.matchesPhrase(id, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+func (idx *searchIndex) matchesPhrase(id string, phrase []string) bool {
+	for f := range searchFields {
+		for _, start := range idx.postings[phrase[0]][id][f] {
+			if idx.phraseAt(id, phrase, f, start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (idx *searchIndex) phraseAt(id string, phrase []string, field, start int) bool {
+	for offset, term := range phrase[1:] {
+		positions := idx.postings[term][id][field]
+		want := start + offset + 1
+		i := sort.SearchInts(positions, want)
+		if i == len(positions) || positions[i] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// score sums the weighted BM25 score of every term over every field
+func (idx *searchIndex) score(id string, terms []string) float64 {
+	n := float64(len(idx.docs))
+	entry := idx.docs[id]
+
+	var score float64
+	for _, term := range terms {
+		df := float64(len(idx.postings[term]))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		positions := idx.postings[term][id]
+
+		for f, field := range searchFields {
+			tf := float64(len(positions[f]))
+			if tf == 0 {
+				continue
+			}
+			avgLen := float64(idx.totalLen[f]) / n
+			norm := 1 - bm25B + bm25B*float64(entry.lengths[f])/avgLen
+			score += field.weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return score
+}
+
+// highlight builds a snippet for each field of doc containing one of terms
+func highlight(doc Document, terms map[string]bool) map[string]string {
+	highlights := make(map[string]string)
+	for _, field := range searchFields {
+		if snippet, ok := fieldSnippet(field.value(doc), terms); ok {
+			highlights[field.name] = snippet
+		}
+	}
+	return highlights
+}
+
+// fieldSnippet returns a window of text around the first matching token with
+// every matching token marked. Text outside the marks is HTML-escaped.
+func fieldSnippet(text string, terms map[string]bool) (string, bool) {
+	tokens := tokenize(text)
+	first := -1
+	for i, t := range tokens {
+		if terms[t.term] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	from := first - snippetTokens/4
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetTokens
+	if to > len(tokens) {
+		to = len(tokens)
+	}
+
+	start, end := 0, len(text)
+	if from > 0 {
+		start = tokens[from].start
+	}
+	if to < len(tokens) {
+		end = tokens[to-1].end
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	cursor := start
+	for _, t := range tokens[from:to] {
+		if !terms[t.term] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[cursor:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		cursor = t.end
+	}
+	b.WriteString(html.EscapeString(text[cursor:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// clampSearchLimit applies the listing page sizes to search results
+func clampSearchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return limit
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func searchIDs(t *testing.T, store Store, query string) []string {
+	t.Helper()
+	results, err := store.Search(context.Background(), query, 0)
+	if err != nil {
+		t.Fatalf("Search(%q) failed: %v", query, err)
+	}
+	ids := make([]string, 0, len(results.Results))
+	for _, r := range results.Results {
+		ids = append(ids, r.Document.ID)
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Searching the API-reference, v2!")
+	want := []token{{"search", 0, 9}, {"the", 10, 13}, {"api", 14, 17}, {"refer", 18, 27}, {"v2", 29, 31}}
+	if len(tokens) != len(want) {
+		t.Fatalf("tokenize() = %+v, want %+v", tokens, want)
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("token %d = %+v, want %+v", i, tokens[i], want[i])
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := parseSearchQuery(`Searching "API reference" "guides"`)
+	if err != nil {
+		t.Fatalf("parseSearchQuery() failed: %v", err)
+	}
+	if len(q.terms) != 2 || q.terms[0] != "search" || q.terms[1] != "guid" {
+		t.Errorf("unexpected terms %v", q.terms)
+	}
+	if len(q.phrases) != 1 || len(q.phrases[0]) != 2 || q.phrases[0][1] != "refer" {
+		t.Errorf("unexpected phrases %v", q.phrases)
+	}
+
+	for _, bad := range []string{"", "  ,; ", `"unterminated phrase`} {
+		if _, err := parseSearchQuery(bad); !errors.Is(err, ErrInvalidSearchQuery) {
+			t.Errorf("parseSearchQuery(%q) = %v, want ErrInvalidSearchQuery", bad, err)
+		}
+	}
+}
+
+func TestDocumentStore_Search(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	store.Create(ctx, Document{ID: "guide", Name: "Getting Started", Description: "A guide to getting started with the document store"})
+	store.Create(ctx, Document{ID: "api", Name: "API Reference", Description: "Complete API reference for document operations"})
+	store.Create(ctx, Document{ID: "faq", Name: "FAQ", Description: "Questions about the store, answered: started? reference?"})
+
+	// Stemming matches other forms of a word; every word is required
+	if ids := searchIDs(t, store, "documents"); len(ids) != 2 {
+		t.Errorf("expected both documents mentioning document, got %v", ids)
+	}
+	if ids := searchIDs(t, store, "document operation"); len(ids) != 1 || ids[0] != "api" {
+		t.Errorf("expected only api, got %v", ids)
+	}
+
+	// Name matches are weighted above description matches
+	if ids := searchIDs(t, store, "reference"); len(ids) != 2 || ids[0] != "api" {
+		t.Errorf("expected api ranked first, got %v", ids)
+	}
+
+	// Phrases require consecutive words in one field
+	if ids := searchIDs(t, store, `"getting started"`); len(ids) != 1 || ids[0] != "guide" {
+		t.Errorf("expected phrase to match only the guide, got %v", ids)
+	}
+	if ids := searchIDs(t, store, `"reference complete"`); len(ids) != 0 {
+		t.Errorf("phrases should not span fields, got %v", ids)
+	}
+	if ids := searchIDs(t, store, `"store answered"`); len(ids) != 1 || ids[0] != "faq" {
+		t.Errorf("expected phrase across punctuation to match, got %v", ids)
+	}
+
+	// The index follows updates and deletes
+	store.Update(ctx, "api", Document{Name: "Endpoints", Description: "Operations"})
+	if ids := searchIDs(t, store, "reference"); len(ids) != 1 || ids[0] != "faq" {
+		t.Errorf("expected updated document to drop out, got %v", ids)
+	}
+	store.PartialUpdate(ctx, "faq", map[string]interface{}{"name": "Reference FAQ"})
+	store.Delete(ctx, "guide")
+	if ids := searchIDs(t, store, "started"); len(ids) != 1 || ids[0] != "faq" {
+		t.Errorf("expected deleted document to drop out, got %v", ids)
+	}
+	if len(store.index.postings["guid"]) != 0 {
+		t.Error("postings of a deleted document should be removed")
+	}
+}
+
+func TestDocumentStore_SearchLimitAndHighlights(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	store.Create(ctx, Document{ID: "1", Name: "Search <basics>", Description: "How searching works"})
+	store.Create(ctx, Document{ID: "2", Name: "Other", Description: "Nothing to see but search"})
+	store.Create(ctx, Document{ID: "3", Name: "Long",
+		Description: "one two three four five six seven eight nine ten eleven twelve search thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty twentyone twentytwo twentythree twentyfour twentyfive twentysix"})
+
+	results, err := store.Search(ctx, "search", 1)
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if results.Total != 3 || len(results.Results) != 1 {
+		t.Fatalf("expected 1 of 3 results, got %d of %d", len(results.Results), results.Total)
+	}
+
+	top := results.Results[0]
+	if top.Document.ID != "1" || top.Score <= 0 {
+		t.Errorf("unexpected top result %+v", top)
+	}
+	if got := top.Highlights["name"]; got != "<mark>Search</mark> &lt;basics&gt;" {
+		t.Errorf("name highlight = %q", got)
+	}
+	if got := top.Highlights["description"]; got != "How <mark>searching</mark> works" {
+		t.Errorf("description highlight = %q", got)
+	}
+
+	results, _ = store.Search(ctx, "search", 10)
+	for _, r := range results.Results {
+		if r.Document.ID != "3" {
+			continue
+		}
+		want := "…seven eight nine ten eleven twelve <mark>search</mark> thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty twentyone twentytwo twentythree twentyfour twentyfive twentysix"
+		if _, ok := r.Highlights["name"]; ok || r.Highlights["description"] != want {
+			t.Errorf("long highlight = %+v", r.Highlights)
+		}
+	}
+}
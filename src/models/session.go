@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned when no session exists for the given
+	// ID, including sessions that expired and were removed
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionRevoked is returned when refreshing a session that was
+	// logged out or revoked after a refresh token was reused
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrRefreshTokenReused is returned when a refresh token that was
+	// already exchanged is presented again. The session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Session is one login of a user: the family of refresh tokens, each
+// exchanged for the next, issued since they logged in. Only the latest may
+// be exchanged; presenting an earlier one means it was stolen, and revokes
+// the session with every token issued for it.
+type Session struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// RefreshTokenID is the jti of the latest refresh token
+	RefreshTokenID string    `json:"refresh_token_id"`
+	Revoked        bool      `json:"revoked"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	// ExpiresAt is when the latest refresh token expires, after which the
+	// session can be removed
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// rotateSession checks that refreshTokenID is the latest refresh token of
+// session and returns the session with nextTokenID as the latest, expiring
+// at expiresAt. A reused token yields the session revoked, along with
+// ErrRefreshTokenReused.
+func rotateSession(session Session, refreshTokenID, nextTokenID string, expiresAt time.Time) (Session, error) {
+	if session.Revoked {
+		return Session{}, ErrSessionRevoked
+	}
+	session.UpdatedAt = time.Now().UTC()
+	if refreshTokenID != session.RefreshTokenID {
+		session.Revoked = true
+		return session, ErrRefreshTokenReused
+	}
+	session.RefreshTokenID, session.ExpiresAt = nextTokenID, expiresAt.UTC()
+	return session, nil
+}
+
+func (s *DocumentStore) CreateSession(ctx context.Context, session Session) (Session, error) {
+	if err := ctx.Err(); err != nil {
+		return Session{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	session.CreatedAt, session.UpdatedAt, session.ExpiresAt = now, now, session.ExpiresAt.UTC()
+	if err := s.commit(walRecord{Op: walOpPutSession, ID: session.ID, Session: &session}); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (s *DocumentStore) GetSession(ctx context.Context, id string) (Session, error) {
+	if err := ctx.Err(); err != nil {
+		return Session{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *DocumentStore) RotateSession(ctx context.Context, id, refreshTokenID, nextTokenID string, expiresAt time.Time) (Session, error) {
+	if err := ctx.Err(); err != nil {
+		return Session{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	session, err := rotateSession(current, refreshTokenID, nextTokenID, expiresAt)
+	if err != nil && !errors.Is(err, ErrRefreshTokenReused) {
+		return Session{}, err
+	}
+	if err := s.commit(walRecord{Op: walOpPutSession, ID: id, Session: &session}); err != nil {
+		return Session{}, err
+	}
+	return session, err
+}
+
+func (s *DocumentStore) RevokeSession(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.Revoked {
+		return nil
+	}
+	session.Revoked, session.UpdatedAt = true, time.Now().UTC()
+	return s.commit(walRecord{Op: walOpPutSession, ID: id, Session: &session})
+}
+
+func (s *DocumentStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt = expiresAt.UTC()
+	return s.commit(walRecord{Op: walOpRevokeToken, ID: tokenID, Time: &expiresAt})
+}
+
+func (s *DocumentStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, revoked := s.revokedTokens[tokenID]
+	return revoked, nil
+}
+
+func (s *DocumentStore) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.countExpired(now)
+	if n == 0 {
+		return 0, nil
+	}
+	now = now.UTC()
+	if err := s.commit(walRecord{Op: walOpExpireSessions, Time: &now}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// countExpired returns how many sessions and revoked tokens expired before
+// now. Callers must hold mu.
+func (s *DocumentStore) countExpired(now time.Time) int {
+	n := 0
+	for _, session := range s.sessions {
+		if session.ExpiresAt.Before(now) {
+			n++
+		}
+	}
+	for _, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// expireSessions removes the sessions and revoked tokens that expired
+// before now. Callers must hold mu for writing.
+func (s *DocumentStore) expireSessions(now time.Time) {
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(s.sessions, id)
+		}
+	}
+	for id, expiresAt := range s.revokedTokens {
+		if expiresAt.Before(now) {
+			delete(s.revokedTokens, id)
+		}
+	}
+}
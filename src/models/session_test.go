@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreContract_Sessions(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			expires := time.Now().Add(time.Hour)
+
+			created, err := store.CreateSession(ctx, Session{ID: "s1", Username: "alice", RefreshTokenID: "r1", ExpiresAt: expires})
+			if err != nil || created.CreatedAt.IsZero() || created.Revoked {
+				t.Fatalf("CreateSession() = %+v, %v", created, err)
+			}
+			if _, err := store.GetSession(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+
+			rotated, err := store.RotateSession(ctx, "s1", "r1", "r2", expires.Add(time.Hour))
+			if err != nil || rotated.RefreshTokenID != "r2" || !rotated.ExpiresAt.Equal(expires.Add(time.Hour)) {
+				t.Fatalf("RotateSession() = %+v, %v", rotated, err)
+			}
+			if _, err := store.RotateSession(ctx, "s1", "r1", "r3", expires); !errors.Is(err, ErrRefreshTokenReused) {
+				t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+			}
+			if session, err := store.GetSession(ctx, "s1"); err != nil || !session.Revoked || session.RefreshTokenID != "r2" {
+				t.Errorf("expected the reuse to revoke the session, got %+v, %v", session, err)
+			}
+			if _, err := store.RotateSession(ctx, "s1", "r2", "r3", expires); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("expected ErrSessionRevoked, got %v", err)
+			}
+			if _, err := store.RotateSession(ctx, "missing", "r1", "r2", expires); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+
+			store.CreateSession(ctx, Session{ID: "s2", Username: "bob", RefreshTokenID: "r1", ExpiresAt: expires})
+			if err := store.RevokeSession(ctx, "s2"); err != nil {
+				t.Fatalf("RevokeSession() failed: %v", err)
+			}
+			if err := store.RevokeSession(ctx, "s2"); err != nil {
+				t.Errorf("expected revoking twice to succeed, got %v", err)
+			}
+			if err := store.RevokeSession(ctx, "missing"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected ErrSessionNotFound, got %v", err)
+			}
+
+			if err := store.RevokeToken(ctx, "t1", expires); err != nil {
+				t.Fatalf("RevokeToken() failed: %v", err)
+			}
+			store.RevokeToken(ctx, "t2", time.Now().Add(-time.Minute))
+			if revoked, err := store.IsTokenRevoked(ctx, "t1"); err != nil || !revoked {
+				t.Errorf("IsTokenRevoked(t1) = %v, %v", revoked, err)
+			}
+			if revoked, err := store.IsTokenRevoked(ctx, "t3"); err != nil || revoked {
+				t.Errorf("IsTokenRevoked(t3) = %v, %v", revoked, err)
+			}
+
+			store.CreateSession(ctx, Session{ID: "s3", Username: "carol", RefreshTokenID: "r1", ExpiresAt: time.Now().Add(-time.Minute)})
+			if n, err := store.DeleteExpiredSessions(ctx, time.Now()); err != nil || n != 2 {
+				t.Errorf("DeleteExpiredSessions() = %d, %v; want 2", n, err)
+			}
+			if _, err := store.GetSession(ctx, "s3"); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("expected the expired session to be removed, got %v", err)
+			}
+			if revoked, _ := store.IsTokenRevoked(ctx, "t2"); revoked {
+				t.Error("expected the expired token to be removed")
+			}
+			if _, err := store.GetSession(ctx, "s1"); err != nil {
+				t.Errorf("expected the live session to be kept, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreSessions_Reopen checks that durable backends keep sessions and
+// revoked tokens across restarts
+func TestStoreSessions_Reopen(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+	populate := func(store Store) {
+		store.CreateSession(ctx, Session{ID: "s1", Username: "alice", RefreshTokenID: "r1", ExpiresAt: expires})
+		store.CreateSession(ctx, Session{ID: "s2", Username: "alice", RefreshTokenID: "r1", ExpiresAt: time.Now().Add(-time.Minute)})
+		store.RevokeToken(ctx, "t1", expires)
+	}
+	change := func(store Store) {
+		store.RotateSession(ctx, "s1", "r1", "r2", expires)
+		store.DeleteExpiredSessions(ctx, time.Now())
+	}
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		if session, err := store.GetSession(ctx, "s1"); err != nil || session.RefreshTokenID != "r2" || !session.ExpiresAt.Equal(expires) {
+			t.Errorf("GetSession() after reopen = %+v, %v", session, err)
+		}
+		if _, err := store.GetSession(ctx, "s2"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expected the expired session to stay removed, got %v", err)
+		}
+		if revoked, err := store.IsTokenRevoked(ctx, "t1"); err != nil || !revoked {
+			t.Errorf("IsTokenRevoked() after reopen = %v, %v", revoked, err)
+		}
+	}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	populate(fileStore)
+	fileStore.Compact()
+	change(fileStore)
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	check(t, reopenedFile)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	populate(sqliteStore)
+	change(sqliteStore)
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	check(t, reopenedSQLite)
+}
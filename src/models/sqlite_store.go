@@ -0,0 +1,2209 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteMigrations holds the schema history; entry i upgrades the database to
+// version i+1. Released migrations must never be edited, only appended to.
+var sqliteMigrations = []string{
+	// 1: documents table
+	`CREATE TABLE documents (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX idx_documents_name ON documents (name);`,
+
+	// 2: immutable revision history, removed together with its document
+	`CREATE TABLE document_revisions (
+		document_id TEXT    NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		revision    INTEGER NOT NULL,
+		created_at  TEXT    NOT NULL,
+		author      TEXT    NOT NULL DEFAULT '',
+		data        TEXT    NOT NULL,
+		PRIMARY KEY (document_id, revision)
+	);`,
+
+	// 3: current version number, backfilled from the recorded history
+	`ALTER TABLE documents ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+	UPDATE documents SET version = (
+		SELECT COALESCE(MAX(revision), 0) FROM document_revisions WHERE document_id = documents.id
+	);`,
+
+	// 4: server-managed timestamps and authors, backfilled from the first and
+	// latest revisions
+	`ALTER TABLE documents ADD COLUMN created_at TEXT NOT NULL DEFAULT '';
+	ALTER TABLE documents ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+	ALTER TABLE documents ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE documents ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+	UPDATE documents SET
+		created_at = COALESCE((SELECT created_at FROM document_revisions r WHERE r.document_id = documents.id ORDER BY revision LIMIT 1), ''),
+		created_by = COALESCE((SELECT author FROM document_revisions r WHERE r.document_id = documents.id ORDER BY revision LIMIT 1), ''),
+		updated_at = COALESCE((SELECT created_at FROM document_revisions r WHERE r.document_id = documents.id ORDER BY revision DESC LIMIT 1), ''),
+		updated_by = COALESCE((SELECT author FROM document_revisions r WHERE r.document_id = documents.id ORDER BY revision DESC LIMIT 1), '');`,
+
+	// 5: description of the uploaded content, whose bytes live in files
+	`ALTER TABLE documents ADD COLUMN content_type TEXT NOT NULL DEFAULT '';
+	ALTER TABLE documents ADD COLUMN content_size INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE documents ADD COLUMN content_sha256 TEXT NOT NULL DEFAULT '';`,
+
+	// 6: user-defined tags and metadata, kept as JSON on the document and
+	// in one row per entry for indexed filtering
+	`ALTER TABLE documents ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE documents ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+	CREATE TABLE document_tags (
+		document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		tag         TEXT NOT NULL,
+		PRIMARY KEY (document_id, tag)
+	) WITHOUT ROWID;
+	CREATE INDEX idx_document_tags_tag ON document_tags (tag, document_id);
+	CREATE TABLE document_metadata (
+		document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		key         TEXT NOT NULL,
+		value       TEXT NOT NULL,
+		PRIMARY KEY (document_id, key)
+	) WITHOUT ROWID;
+	CREATE INDEX idx_document_metadata_entry ON document_metadata (key, value, document_id);`,
+
+	// 7: nested collections; the root is the empty ID, so top-level
+	// collections and documents outside any collection refer to ''
+	`CREATE TABLE collections (
+		id         TEXT PRIMARY KEY,
+		parent_id  TEXT NOT NULL DEFAULT '',
+		name       TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		UNIQUE (parent_id, name)
+	);
+	ALTER TABLE documents ADD COLUMN collection_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_documents_collection ON documents (collection_id);`,
+
+	// 8: document types and the JSON Schemas their metadata must conform to
+	`ALTER TABLE documents ADD COLUMN type TEXT NOT NULL DEFAULT '';
+	CREATE TABLE document_schemas (
+		type       TEXT PRIMARY KEY,
+		schema     TEXT    NOT NULL,
+		version    INTEGER NOT NULL,
+		created_at TEXT    NOT NULL,
+		updated_at TEXT    NOT NULL,
+		created_by TEXT    NOT NULL DEFAULT '',
+		updated_by TEXT    NOT NULL DEFAULT ''
+	);`,
+
+	// 9: accounts that can log in
+	`CREATE TABLE users (
+		username      TEXT PRIMARY KEY,
+		password_hash TEXT    NOT NULL,
+		disabled      INTEGER NOT NULL DEFAULT 0,
+		created_at    TEXT    NOT NULL,
+		updated_at    TEXT    NOT NULL,
+		created_by    TEXT    NOT NULL DEFAULT '',
+		updated_by    TEXT    NOT NULL DEFAULT ''
+	);`,
+
+	// 10: user roles; existing users become readers
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'reader';`,
+
+	// 11: the groups users belong to, and who documents are shared with
+	`ALTER TABLE users ADD COLUMN groups TEXT NOT NULL DEFAULT '[]';
+	CREATE TABLE document_acl (
+		document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		principal   TEXT NOT NULL,
+		level       TEXT NOT NULL,
+		granted_at  TEXT NOT NULL,
+		granted_by  TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (document_id, principal)
+	) WITHOUT ROWID;
+	CREATE INDEX idx_document_acl_principal ON document_acl (principal, document_id);`,
+
+	// 12: login sessions and tokens revoked before they expire. Expiries
+	// are Unix nanoseconds so that they compare in order.
+	`CREATE TABLE sessions (
+		id               TEXT PRIMARY KEY,
+		username         TEXT NOT NULL,
+		refresh_token_id TEXT NOT NULL,
+		revoked          INTEGER NOT NULL DEFAULT 0,
+		created_at       TEXT NOT NULL,
+		updated_at       TEXT NOT NULL,
+		expires_at       INTEGER NOT NULL
+	);
+	CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
+	CREATE TABLE revoked_tokens (
+		id         TEXT PRIMARY KEY,
+		expires_at INTEGER NOT NULL
+	) WITHOUT ROWID;
+	CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);`,
+
+	// 13: sort keys for listing in SQL: timestamps as Unix nanoseconds (see
+	// timeKey), backfilled by backfillTimeKeys, and every sort field indexed
+	// with the ID that breaks its ties
+	`ALTER TABLE documents ADD COLUMN created_at_ns INTEGER NOT NULL DEFAULT -9223372036854775808;
+	ALTER TABLE documents ADD COLUMN updated_at_ns INTEGER NOT NULL DEFAULT -9223372036854775808;
+	DROP INDEX idx_documents_name;
+	CREATE INDEX idx_documents_name ON documents (name, id);
+	CREATE INDEX idx_documents_created_at ON documents (created_at_ns, id);
+	CREATE INDEX idx_documents_updated_at ON documents (updated_at_ns, id);`,
+
+	// 14: the owner of each document, its creator until an admin gives it to
+	// someone else or the owner is deleted (see SQLiteStore.DeleteUser)
+	`ALTER TABLE documents ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	UPDATE documents SET owner = created_by;
+	CREATE INDEX idx_documents_owner ON documents (owner);`,
+
+	// 15: the last version of every deleted document, which one created
+	// again under its ID continues from so that versions are never reused
+	`CREATE TABLE document_tombstones (
+		id      TEXT PRIMARY KEY,
+		version INTEGER NOT NULL
+	) WITHOUT ROWID;`,
+}
+
+// sqliteBackfills fill in what a migration adds but SQL alone cannot
+// compute. Each runs in the transaction of the migration numbered by its key.
+var sqliteBackfills = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	13: backfillTimeKeys,
+}
+
+// documentColumns lists the columns scanned by scanDocument, in order
+const documentColumns = "id, name, description, version, created_at, updated_at, created_by, updated_by, " +
+	"content_type, content_size, content_sha256, tags, metadata, collection_id, type"
+
+// SQLiteStore is a Store persisting documents in a single SQLite database file.
+// The full-text index is kept in memory: it is built when the store opens and
+// updated after every committed write. Document content is kept in files in
+// a "content" directory next to the database.
+type SQLiteStore struct {
+	db    *sql.DB
+	index *searchIndex
+	blobs *blobStore
+
+	// writeMu orders index updates the same way as the commits they follow
+	writeMu sync.Mutex
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens (or creates) the database at path and brings its
+// schema up to date before returning.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create data directory: %w", err)
+	}
+
+	// WAL journaling lets readers proceed during writes; immediate
+	// transactions take the write lock up front so read-modify-write
+	// sequences cannot deadlock on lock upgrades.
+	dsn := "file:" + path +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite database: %w", err)
+	}
+
+	if err := migrateSQLite(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLiteStore{db: db, index: newSearchIndex()}
+	refs, err := s.buildIndex(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if s.blobs, err = openDirBlobStore(filepath.Join(filepath.Dir(path), contentDirName), refs); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// buildIndex indexes every stored document for full-text search. It returns
+// the content the documents reference, keyed by document ID.
+func (s *SQLiteStore) buildIndex(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+documentColumns+" FROM documents")
+	if err != nil {
+		return nil, fmt.Errorf("build search index: %w", err)
+	}
+	defer rows.Close()
+
+	refs := make(map[string]string)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("build search index: %w", err)
+		}
+		s.index.add(doc)
+		if doc.HasContent() {
+			refs[doc.ID] = doc.ContentSHA256
+		}
+	}
+	return refs, rows.Err()
+}
+
+// migrateSQLite applies every migration newer than the recorded schema version
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)",
+			current, len(sqliteMigrations))
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if backfill := sqliteBackfills[version]; backfill != nil {
+			if err := backfill(ctx, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("backfill migration %d: %w", version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			version, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", version, err)
+		}
+		log.Printf("Applied SQLite schema migration %d", version)
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDocument(row rowScanner) (Document, error) {
+	var (
+		doc                Document
+		createdAt, updated string
+		tags, metadata     string
+	)
+	if err := row.Scan(&doc.ID, &doc.Name, &doc.Description, &doc.Version,
+		&createdAt, &updated, &doc.CreatedBy, &doc.UpdatedBy,
+		&doc.ContentType, &doc.ContentSize, &doc.ContentSHA256, &tags, &metadata, &doc.CollectionID, &doc.Type); err != nil {
+		return Document{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &doc.Tags); err != nil {
+		return Document{}, fmt.Errorf("decode tags: %w", err)
+	}
+	if err := json.Unmarshal([]byte(metadata), &doc.Metadata); err != nil {
+		return Document{}, fmt.Errorf("decode metadata: %w", err)
+	}
+	if len(doc.Tags) == 0 {
+		doc.Tags = nil
+	}
+	if len(doc.Metadata) == 0 {
+		doc.Metadata = nil
+	}
+	var err error
+	if doc.CreatedAt, err = parseSQLiteTime(createdAt); err != nil {
+		return Document{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	if doc.UpdatedAt, err = parseSQLiteTime(updated); err != nil {
+		return Document{}, fmt.Errorf("parse updated_at: %w", err)
+	}
+	return doc, nil
+}
+
+// parseSQLiteTime parses a stored timestamp. Documents written before
+// timestamps were recorded have none and get the zero time.
+func parseSQLiteTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// The range of times timeKey tells apart
+var (
+	minTimeKey = time.Unix(0, math.MinInt64+1)
+	maxTimeKey = time.Unix(0, math.MaxInt64)
+)
+
+// timeKey turns a timestamp into the Unix nanoseconds it is sorted and
+// compared by in SQL, where the RFC 3339 text does not sort in time order.
+// The zero time of documents without timestamps comes first; times beyond
+// what nanoseconds can count, which only filters use, are clamped.
+func timeKey(t time.Time) int64 {
+	switch {
+	case t.IsZero():
+		return math.MinInt64
+	case t.Before(minTimeKey):
+		return math.MinInt64 + 1
+	case t.After(maxTimeKey):
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// backfillTimeKeys sets the time keys of the documents stored before they
+// were recorded
+func backfillTimeKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, created_at, updated_at FROM documents")
+	if err != nil {
+		return err
+	}
+	type timeKeys struct {
+		id               string
+		created, updated int64
+	}
+	var keys []timeKeys
+	for rows.Next() {
+		var id, createdAt, updatedAt string
+		if err := rows.Scan(&id, &createdAt, &updatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		created, err := parseSQLiteTime(createdAt)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("parse created_at of %s: %w", id, err)
+		}
+		updated, err := parseSQLiteTime(updatedAt)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("parse updated_at of %s: %w", id, err)
+		}
+		keys = append(keys, timeKeys{id, timeKey(created), timeKey(updated)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if _, err := tx.ExecContext(ctx, "UPDATE documents SET created_at_ns = ?, updated_at_ns = ? WHERE id = ?",
+			k.created, k.updated, k.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// placeholders returns n comma-separated parameter placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// getDocument loads a document through either the database or a transaction
+func getDocument(ctx context.Context, q queryRower, id string) (Document, error) {
+	doc, err := scanDocument(q.QueryRowContext(ctx,
+		"SELECT "+documentColumns+" FROM documents WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, ErrDocumentNotFound
+	}
+	return doc, err
+}
+
+// encodeLabels returns the tags and metadata of doc as stored in the
+// documents table
+func encodeLabels(doc Document) (tags, metadata string, err error) {
+	tagList, entries := doc.Tags, doc.Metadata
+	if tagList == nil {
+		tagList = []string{}
+	}
+	if entries == nil {
+		entries = map[string]string{}
+	}
+	tagData, err := json.Marshal(tagList)
+	if err != nil {
+		return "", "", err
+	}
+	metadataData, err := json.Marshal(entries)
+	if err != nil {
+		return "", "", err
+	}
+	return string(tagData), string(metadataData), nil
+}
+
+// saveLabels replaces the index rows of a document whose tags or metadata
+// changed from those of previous
+func saveLabels(ctx context.Context, tx *sql.Tx, doc, previous Document) error {
+	if labelsEqual(doc, previous) {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM document_tags WHERE document_id = ?", doc.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM document_metadata WHERE document_id = ?", doc.ID); err != nil {
+		return err
+	}
+	for _, tag := range doc.Tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO document_tags (document_id, tag) VALUES (?, ?)", doc.ID, tag); err != nil {
+			return err
+		}
+	}
+	for key, value := range doc.Metadata {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO document_metadata (document_id, key, value) VALUES (?, ?, ?)",
+			doc.ID, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// affectedOrNotFound converts an UPDATE/DELETE that touched no row into ErrDocumentNotFound
+func affectedOrNotFound(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction that is committed only if fn succeeds
+func (s *SQLiteStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkWriteOptions loads the document a write targets and verifies opts against it
+func checkWriteOptions(ctx context.Context, tx *sql.Tx, id string, opts []WriteOption) (Document, error) {
+	current, err := getDocument(ctx, tx, id)
+	if err != nil {
+		return Document{}, err
+	}
+	return current, collectWriteOptions(opts).check(current)
+}
+
+// write runs fn in a transaction and, once it commits, reindexes the
+// document fn saved
+func (s *SQLiteStore) write(ctx context.Context, fn func(tx *sql.Tx) (Document, error)) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var saved Document
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		saved, err = fn(tx)
+		return err
+	})
+	if err == nil {
+		s.index.add(saved)
+	}
+	return err
+}
+
+// saveDocument overwrites current, the row as read in tx, with doc under the
+// next version number and records the new revision. The stored document is
+// returned. Callers decide whether doc keeps the current content.
+func saveDocument(ctx context.Context, tx *sql.Tx, doc, current Document) (Document, error) {
+	if err := normalizeLabels(&doc); err != nil {
+		return Document{}, err
+	}
+	doc.ID = current.ID
+	doc.Version = current.Version + 1
+	schema, err := loadSchema(ctx, tx, doc.Type)
+	if err != nil {
+		return Document{}, err
+	}
+	if err := checkDocumentSchema(doc, &current, schema); err != nil {
+		return Document{}, err
+	}
+	stamp(ctx, &doc, &current)
+	tags, metadata, err := encodeLabels(doc)
+	if err != nil {
+		return Document{}, err
+	}
+	err = affectedOrNotFound(tx.ExecContext(ctx,
+		`UPDATE documents SET name = ?, description = ?, version = ?, updated_at = ?, updated_at_ns = ?, updated_by = ?,
+			content_type = ?, content_size = ?, content_sha256 = ?, tags = ?, metadata = ?, collection_id = ?, type = ? WHERE id = ?`,
+		doc.Name, doc.Description, doc.Version, doc.UpdatedAt.Format(time.RFC3339Nano), timeKey(doc.UpdatedAt), doc.UpdatedBy,
+		doc.ContentType, doc.ContentSize, doc.ContentSHA256, tags, metadata, doc.CollectionID, doc.Type, doc.ID))
+	if err != nil {
+		return Document{}, err
+	}
+	if err := saveLabels(ctx, tx, doc, current); err != nil {
+		return Document{}, err
+	}
+	return doc, insertRevision(ctx, tx, doc)
+}
+
+// insertRevision appends doc, whose Version and update fields are already
+// set, to its document's history
+func insertRevision(ctx context.Context, tx *sql.Tx, doc Document) error {
+	rev := newRevision(doc)
+	data, err := json.Marshal(rev.Document)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO document_revisions (document_id, revision, created_at, author, data) VALUES (?, ?, ?, ?, ?)",
+		doc.ID, rev.Revision, rev.Timestamp.Format(time.RFC3339Nano), rev.Author, string(data))
+	return err
+}
+
+func scanRevision(row rowScanner) (Revision, error) {
+	var (
+		rev       Revision
+		createdAt string
+		data      string
+	)
+	if err := row.Scan(&rev.Revision, &createdAt, &rev.Author, &data); err != nil {
+		return Revision{}, err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return Revision{}, fmt.Errorf("parse revision timestamp: %w", err)
+	}
+	rev.Timestamp = timestamp
+	if err := json.Unmarshal([]byte(data), &rev.Document); err != nil {
+		return Revision{}, fmt.Errorf("decode revision: %w", err)
+	}
+	return rev, nil
+}
+
+// getRevision loads one revision, distinguishing a missing document from a missing revision
+func getRevision(ctx context.Context, q queryRower, id string, rev int64) (Revision, error) {
+	if _, err := getDocument(ctx, q, id); err != nil {
+		return Revision{}, err
+	}
+	r, err := scanRevision(q.QueryRowContext(ctx,
+		"SELECT revision, created_at, author, data FROM document_revisions WHERE document_id = ? AND revision = ?",
+		id, rev))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, ErrRevisionNotFound
+	}
+	return r, err
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, doc Document) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		doc, err = insertDocument(ctx, tx, doc)
+		return err
+	})
+	if err == nil {
+		s.index.add(doc)
+	}
+	return err
+}
+
+// insertDocument stores doc as a new document, continuing from the last
+// version of a deleted one under its ID, and returns it as stored
+func insertDocument(ctx context.Context, tx *sql.Tx, doc Document) (Document, error) {
+	if err := normalizeLabels(&doc); err != nil {
+		return Document{}, err
+	}
+	if err := checkCollectionExists(ctx, tx, doc.CollectionID); err != nil {
+		return Document{}, err
+	}
+	schema, err := loadSchema(ctx, tx, doc.Type)
+	if err != nil {
+		return Document{}, err
+	}
+	if err := checkDocumentSchema(doc, nil, schema); err != nil {
+		return Document{}, err
+	}
+	var tombstone int64
+	err = tx.QueryRowContext(ctx, "SELECT version FROM document_tombstones WHERE id = ?", doc.ID).Scan(&tombstone)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Document{}, err
+	}
+	doc.Version = tombstone + 1
+	doc.ContentInfo = ContentInfo{}
+	stamp(ctx, &doc, nil)
+	tags, metadata, err := encodeLabels(doc)
+	if err != nil {
+		return Document{}, err
+	}
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO documents ("+documentColumns+", created_at_ns, updated_at_ns, owner) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING",
+		doc.ID, doc.Name, doc.Description, doc.Version,
+		doc.CreatedAt.Format(time.RFC3339Nano), doc.UpdatedAt.Format(time.RFC3339Nano), doc.CreatedBy, doc.UpdatedBy,
+		doc.ContentType, doc.ContentSize, doc.ContentSHA256, tags, metadata, doc.CollectionID, doc.Type,
+		timeKey(doc.CreatedAt), timeKey(doc.UpdatedAt), doc.CreatedBy)
+	if err != nil {
+		return Document{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Document{}, err
+	}
+	if n == 0 {
+		return Document{}, ErrDocumentExists
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM document_tombstones WHERE id = ?", doc.ID); err != nil {
+		return Document{}, err
+	}
+	if err := saveLabels(ctx, tx, doc, Document{}); err != nil {
+		return Document{}, err
+	}
+	return doc, insertRevision(ctx, tx, doc)
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Document, error) {
+	return getDocument(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) List(ctx context.Context, opts ListOptions) (DocumentPage, error) {
+	field, err := sortField(opts)
+	if err != nil {
+		return DocumentPage{}, err
+	}
+	var after Document
+	if opts.Cursor != "" {
+		if after, err = decodeCursor(opts.Cursor, field, opts.Descending); err != nil {
+			return DocumentPage{}, err
+		}
+	}
+
+	// Every tag and metadata entry asked for narrows the rows read through
+	// its index
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	for _, tag := range sortedSet(opts.Tags) {
+		conditions = append(conditions, "id IN (SELECT document_id FROM document_tags WHERE tag = ?)")
+		args = append(args, tag)
+	}
+	keys := make([]string, 0, len(opts.Metadata))
+	for key := range opts.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, "id IN (SELECT document_id FROM document_metadata WHERE key = ? AND value = ?)")
+		args = append(args, key, opts.Metadata[key])
+	}
+	if opts.Collection != "" {
+		names, err := ParseCollectionPath(opts.Collection)
+		if err != nil {
+			return DocumentPage{}, err
+		}
+		collection, err := resolveCollection(ctx, s.db, names)
+		if err != nil {
+			return DocumentPage{}, err
+		}
+		switch {
+		case !opts.Recursive:
+			conditions = append(conditions, "collection_id = ?")
+			args = append(args, collection)
+		case collection != "":
+			conditions = append(conditions, `collection_id IN (
+				WITH RECURSIVE subtree (id) AS (
+					SELECT ? UNION ALL SELECT c.id FROM collections c JOIN subtree ON c.parent_id = subtree.id
+				) SELECT id FROM subtree)`)
+			args = append(args, collection)
+		}
+	}
+	if viewer, ok := ViewerFromContext(ctx); ok {
+		principals := viewer.principals()
+		conditions = append(conditions, "(owner = ? AND owner != '' OR id IN (SELECT document_id FROM document_acl WHERE principal IN ("+
+			placeholders(len(principals))+")))")
+		args = append(args, viewer.Username)
+		for _, principal := range principals {
+			args = append(args, principal)
+		}
+	}
+	if opts.Filter != nil {
+		condition, filterArgs := filterSQL(opts.Filter)
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+
+	// The count and the page are read in one transaction so they agree
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return DocumentPage{}, err
+	}
+	defer tx.Rollback()
+
+	var page DocumentPage
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM documents"+where(conditions), args...).Scan(&page.Total); err != nil {
+		return DocumentPage{}, err
+	}
+
+	order, afterCursor := sortClauses(field, opts.Descending)
+	if opts.Cursor != "" {
+		conditions = append(conditions, afterCursor)
+		if field != SortByID {
+			args = append(args, sortKey(after, field))
+		}
+		args = append(args, after.ID)
+	}
+	limit := pageSize(opts)
+	rows, err := tx.QueryContext(ctx, "SELECT "+documentColumns+" FROM documents"+where(conditions)+order+" LIMIT ?",
+		append(args, limit+1)...)
+	if err != nil {
+		return DocumentPage{}, err
+	}
+	defer rows.Close()
+
+	page.Documents = make([]Document, 0)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return DocumentPage{}, err
+		}
+		page.Documents = append(page.Documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return DocumentPage{}, err
+	}
+	// The extra row only tells whether another page follows
+	if len(page.Documents) > limit {
+		page.Documents = page.Documents[:limit]
+		page.NextCursor = encodeCursor(page.Documents[limit-1], field, opts.Descending)
+	}
+	return page, nil
+}
+
+// sortColumns maps the fields List sorts by to the columns it sorts on
+var sortColumns = map[string]string{
+	SortByID:        "id",
+	SortByName:      "name",
+	SortByCreatedAt: "created_at_ns",
+	SortByUpdatedAt: "updated_at_ns",
+}
+
+// sortClauses returns the ORDER BY clause listing by field, with ties
+// broken by ID, and the condition selecting the rows after a cursor. Its
+// parameters are the cursor's sortKey, unless field is the ID, and ID.
+// Both follow an index, so a page reads only the rows it returns.
+func sortClauses(field string, descending bool) (order, after string) {
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+	if field == SortByID {
+		return " ORDER BY id " + direction, "id " + comparison + " ?"
+	}
+	column := sortColumns[field]
+	return " ORDER BY " + column + " " + direction + ", id " + direction,
+		"(" + column + ", id) " + comparison + " (?, ?)"
+}
+
+// sortKey returns the value of doc's sortColumns entry for field
+func sortKey(doc Document, field string) interface{} {
+	switch field {
+	case SortByName:
+		return doc.Name
+	case SortByCreatedAt:
+		return timeKey(doc.CreatedAt)
+	case SortByUpdatedAt:
+		return timeKey(doc.UpdatedAt)
+	}
+	return doc.ID
+}
+
+// where joins conditions into a WHERE clause, if there are any
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// filterSQL translates a filter into a condition on the documents table
+// that matches the same documents as Filter.match
+func filterSQL(f Filter) (string, []interface{}) {
+	switch f := f.(type) {
+	case *AndFilter:
+		left, leftArgs := filterSQL(f.Left)
+		right, rightArgs := filterSQL(f.Right)
+		return "(" + left + " AND " + right + ")", append(leftArgs, rightArgs...)
+	case *OrFilter:
+		left, leftArgs := filterSQL(f.Left)
+		right, rightArgs := filterSQL(f.Right)
+		return "(" + left + " OR " + right + ")", append(leftArgs, rightArgs...)
+	case *NotFilter:
+		operand, args := filterSQL(f.Operand)
+		return "NOT " + operand, args
+	case *Comparison:
+		switch filterFields[f.Field] {
+		case kindNumber:
+			return f.Field + " " + f.Op + " ?", []interface{}{f.number}
+		case kindTime:
+			return f.Field + "_ns " + f.Op + " ?", []interface{}{timeKey(f.time)}
+		}
+		switch f.Op {
+		case OpPrefix, OpSuffix, OpContains:
+			return "docstore_match(?, " + f.Field + ", ?)", []interface{}{f.Op, f.Value}
+		}
+		return f.Field + " " + f.Op + " ?", []interface{}{f.Value}
+	}
+	// Filters only come from ParseFilter, so this is not reached
+	return "0", nil
+}
+
+func init() {
+	// docstore_match(op, s, value) applies a substring operator to text the
+	// way filters do in Go, whose case folding SQLite's lower() lacks
+	sqlite.MustRegisterDeterministicScalarFunction("docstore_match", 3,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			var text [3]string
+			for i, arg := range args {
+				switch arg := arg.(type) {
+				case string:
+					text[i] = arg
+				case []byte:
+					text[i] = string(arg)
+				}
+			}
+			return matchString(text[0], text[1], text[2]), nil
+		})
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, id string, doc Document, opts ...WriteOption) (Document, error) {
+	var updated Document
+	err := s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		doc.ContentInfo = current.ContentInfo
+		doc.CollectionID = current.CollectionID
+		updated, err = saveDocument(ctx, tx, doc, current)
+		return updated, err
+	})
+	return updated, err
+}
+
+func (s *SQLiteStore) PartialUpdate(ctx context.Context, id string, updates map[string]interface{}, opts ...WriteOption) (Document, error) {
+	var updated Document
+	err := s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		doc := current
+		if err := applyPartialUpdate(&doc, updates); err != nil {
+			return Document{}, err
+		}
+		updated, err = saveDocument(ctx, tx, doc, current)
+		return updated, err
+	})
+	return updated, err
+}
+
+func (s *SQLiteStore) UpdateTags(ctx context.Context, id string, add, remove []string, opts ...WriteOption) (Document, error) {
+	var tagged Document
+	err := s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		tags, changed := retag(current.Tags, add, remove)
+		if !changed {
+			tagged = current
+			return current, nil
+		}
+		doc := current
+		doc.Tags = tags
+		tagged, err = saveDocument(ctx, tx, doc, current)
+		return tagged, err
+	})
+	return tagged, err
+}
+
+func (s *SQLiteStore) Patch(ctx context.Context, id string, patch DocumentPatch, opts ...WriteOption) (Document, error) {
+	var patched Document
+	err := s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		doc, err := applyPatch(current, patch)
+		if err != nil {
+			return Document{}, err
+		}
+		patched, err = saveDocument(ctx, tx, doc, current)
+		return patched, err
+	})
+	return patched, err
+}
+
+func (s *SQLiteStore) Search(ctx context.Context, query string, limit int) (SearchResults, error) {
+	if err := ctx.Err(); err != nil {
+		return SearchResults{}, err
+	}
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	var visible func(doc Document) bool
+	if viewer, ok := ViewerFromContext(ctx); ok {
+		ids, err := visibleTo(ctx, s.db, viewer)
+		if err != nil {
+			return SearchResults{}, err
+		}
+		visible = func(doc Document) bool { return ids[doc.ID] }
+	}
+	return s.index.search(q, clampSearchLimit(limit), visible), nil
+}
+
+// visibleTo returns the IDs of the documents viewer owns or that are shared
+// with them or one of their groups
+func visibleTo(ctx context.Context, q querier, viewer Viewer) (map[string]bool, error) {
+	principals := viewer.principals()
+	args := []interface{}{viewer.Username}
+	for _, principal := range principals {
+		args = append(args, principal)
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT id FROM documents WHERE owner = ? AND owner != ''
+		UNION SELECT document_id FROM document_acl WHERE principal IN (`+placeholders(len(principals))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visible := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		visible[id] = true
+	}
+	return visible, rows.Err()
+}
+
+func (s *SQLiteStore) ListRevisions(ctx context.Context, id string) ([]Revision, error) {
+	if _, err := getDocument(ctx, s.db, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT revision, created_at, author, data FROM document_revisions WHERE document_id = ? ORDER BY revision",
+		id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]Revision, 0)
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, rev)
+	}
+	return history, rows.Err()
+}
+
+func (s *SQLiteStore) GetRevision(ctx context.Context, id string, rev int64) (Revision, error) {
+	return getRevision(ctx, s.db, id, rev)
+}
+
+func (s *SQLiteStore) RestoreRevision(ctx context.Context, id string, rev int64, opts ...WriteOption) (Document, error) {
+	var restored Document
+	err := s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		old, err := getRevision(ctx, tx, id, rev)
+		if err != nil {
+			return Document{}, err
+		}
+		// The content and the collection are not part of what is restored
+		old.Document.ContentInfo = current.ContentInfo
+		old.Document.CollectionID = current.CollectionID
+		restored, err = saveDocument(ctx, tx, old.Document, current)
+		return restored, err
+	})
+	return restored, err
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string, opts ...WriteOption) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var deleted Document
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		deleted, err = deleteDocument(ctx, tx, id, opts)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.index.remove(id)
+	if deleted.HasContent() {
+		s.blobs.release(deleted.ContentSHA256)
+	}
+	return nil
+}
+
+// deleteDocument removes a document with its history, leaving a tombstone
+// of its version, and returns it as it was
+func deleteDocument(ctx context.Context, tx *sql.Tx, id string, opts []WriteOption) (Document, error) {
+	current, err := checkWriteOptions(ctx, tx, id, opts)
+	if err != nil {
+		return Document{}, err
+	}
+	if err := affectedOrNotFound(tx.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", id)); err != nil {
+		return Document{}, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO document_tombstones (id, version) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET version = excluded.version",
+		id, current.Version)
+	return current, err
+}
+
+func (s *SQLiteStore) Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error) {
+	if err := checkBatch(ops); err != nil {
+		return nil, err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var results []BatchResult
+	var released []string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		results, released, err = applyBatch(ctx, tx, ops)
+		if err != nil {
+			return err
+		}
+		if atomic && abortBatch(results) {
+			return ErrBatchAborted
+		}
+		return nil
+	})
+	if errors.Is(err, ErrBatchAborted) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.finishBatch(ops, results, released)
+	return results, nil
+}
+
+// applyBatch performs ops in tx, each after the ones before it. The writes
+// of an operation that fails are undone and its error reported in its
+// result. The content released by deletes is returned along with the
+// results; the error is set only if tx itself failed.
+func applyBatch(ctx context.Context, tx *sql.Tx, ops []BatchOperation) ([]BatchResult, []string, error) {
+	results := make([]BatchResult, len(ops))
+	var released []string
+	for i, op := range ops {
+		// A savepoint undoes whatever a failing operation wrote before it
+		// failed, keeping the writes of the others
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_operation"); err != nil {
+			return nil, nil, err
+		}
+		doc, err := batchOperation(ctx, tx, op)
+		if err != nil {
+			if _, rerr := tx.ExecContext(ctx, "ROLLBACK TO batch_operation"); rerr != nil {
+				return nil, nil, rerr
+			}
+			results[i].Err = err
+		} else if op.Op == BatchDelete {
+			if doc.HasContent() {
+				released = append(released, doc.ContentSHA256)
+			}
+		} else {
+			results[i].Document = doc
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE batch_operation"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return results, released, nil
+}
+
+// finishBatch updates the search index and releases content once a batch
+// has committed. Callers must hold writeMu.
+func (s *SQLiteStore) finishBatch(ops []BatchOperation, results []BatchResult, released []string) {
+	for i, op := range ops {
+		switch {
+		case results[i].Err != nil:
+		case op.Op == BatchDelete:
+			s.index.remove(op.ID)
+		default:
+			s.index.add(results[i].Document)
+		}
+	}
+	for _, sha := range released {
+		s.blobs.release(sha)
+	}
+}
+
+// batchOperation performs one operation of a batch in tx and returns the
+// document it wrote, or deleted. The viewer's access is checked in tx too,
+// so it reflects the operations before this one.
+func batchOperation(ctx context.Context, tx *sql.Tx, op BatchOperation) (Document, error) {
+	if op.Op != BatchCreate {
+		acl, err := getACL(ctx, tx, op.ID)
+		if err != nil {
+			return Document{}, err
+		}
+		if err := authorizeViewer(ctx, acl, AccessWrite); err != nil {
+			return Document{}, err
+		}
+	}
+	switch op.Op {
+	case BatchCreate:
+		if err := ValidateDocumentID(op.ID); err != nil {
+			return Document{}, err
+		}
+		doc := op.Document
+		doc.ID = op.ID
+		return insertDocument(ctx, tx, doc)
+	case BatchUpdate:
+		current, err := checkWriteOptions(ctx, tx, op.ID, op.Options)
+		if err != nil {
+			return Document{}, err
+		}
+		doc := op.Document
+		doc.ContentInfo, doc.CollectionID = current.ContentInfo, current.CollectionID
+		return saveDocument(ctx, tx, doc, current)
+	case BatchPatch:
+		if op.Patch == nil {
+			return Document{}, fmt.Errorf("%w: patch operation without a patch", ErrInvalidBatch)
+		}
+		current, err := checkWriteOptions(ctx, tx, op.ID, op.Options)
+		if err != nil {
+			return Document{}, err
+		}
+		doc, err := applyPatch(current, op.Patch)
+		if err != nil {
+			return Document{}, err
+		}
+		return saveDocument(ctx, tx, doc, current)
+	case BatchDelete:
+		return deleteDocument(ctx, tx, op.ID, op.Options)
+	}
+	return Document{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidBatch, op.Op)
+}
+
+// sqliteTx is a transaction on a SQLiteStore. It reads through a read-only
+// SQLite transaction, which in WAL mode keeps seeing the database as it was
+// at its first read, and applies its writes in one write transaction on
+// commit.
+type sqliteTx struct {
+	txState
+	store *SQLiteStore
+	read  *sql.Tx
+}
+
+func (s *SQLiteStore) Begin(ctx context.Context) (Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// database/sql rolls the snapshot back, releasing its connection, once
+	// ctx is done
+	read, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	// A read-only transaction takes its snapshot at its first read
+	var exists bool
+	if err := read.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM documents)").Scan(&exists); err != nil {
+		read.Rollback()
+		return nil, err
+	}
+	tx := &sqliteTx{store: s, read: read}
+	tx.txState = newTxState(ctx, tx.get, tx.getACL)
+	return tx, nil
+}
+
+// get returns a document as it was when the transaction began
+func (t *sqliteTx) get(ctx context.Context, id string) (Document, bool, error) {
+	doc, err := getDocument(ctx, t.read, id)
+	if errors.Is(err, ErrDocumentNotFound) {
+		return Document{}, false, nil
+	}
+	return doc, err == nil, err
+}
+
+// getACL returns the ACL of a document as it was when the transaction began
+func (t *sqliteTx) getACL(ctx context.Context, doc Document) (ACL, error) {
+	return getACL(ctx, t.read, doc.ID)
+}
+
+func (t *sqliteTx) Commit(ctx context.Context) error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	defer t.read.Rollback()
+	if err := t.begun.Err(); err != nil {
+		return err
+	}
+	if len(t.ops) == 0 {
+		return nil
+	}
+	s := t.store
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var results []BatchResult
+	var released []string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Every document written must still be as the snapshot saw it
+		for id := range t.written {
+			before, existed, err := t.get(ctx, id)
+			if err != nil {
+				return err
+			}
+			now, err := getDocument(ctx, tx, id)
+			if err != nil && !errors.Is(err, ErrDocumentNotFound) {
+				return err
+			}
+			if exists := err == nil; exists != existed ||
+				exists && (now.Version != before.Version || !now.UpdatedAt.Equal(before.UpdatedAt)) {
+				return ErrTxConflict
+			}
+		}
+		var err error
+		results, released, err = applyBatch(ctx, tx, t.ops)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				return result.Err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.finishBatch(t.ops, results, released)
+	return nil
+}
+
+func (t *sqliteTx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.done = true
+	// The snapshot is already rolled back if the transaction's context is
+	// done
+	if err := t.read.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteStore) PutContent(ctx context.Context, id, contentType string, r io.Reader, opts ...WriteOption) (Document, error) {
+	staged, err := s.blobs.stage(r)
+	if err != nil {
+		return Document{}, err
+	}
+
+	var (
+		saved, previous Document
+		committed       bool
+	)
+	err = s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		if err := s.blobs.commit(staged); err != nil {
+			return Document{}, err
+		}
+		committed, previous = true, current
+		doc := current
+		doc.ContentInfo = staged.info(contentType)
+		saved, err = saveDocument(ctx, tx, doc, current)
+		return saved, err
+	})
+	switch {
+	case !committed:
+		s.blobs.discard(staged)
+	case err != nil:
+		s.blobs.release(staged.sha256)
+	case previous.HasContent():
+		s.blobs.release(previous.ContentSHA256)
+	}
+	return saved, err
+}
+
+func (s *SQLiteStore) OpenContent(ctx context.Context, id string) (Content, error) {
+	// An upload may replace the content, freeing its blob, between reading
+	// the document and opening the blob; reading it again sees the new one
+	for attempt := 0; ; attempt++ {
+		doc, err := getDocument(ctx, s.db, id)
+		if err != nil {
+			return Content{}, err
+		}
+		if !doc.HasContent() {
+			return Content{}, ErrContentNotFound
+		}
+		stream, err := s.blobs.open(doc.ContentSHA256)
+		if errors.Is(err, ErrContentNotFound) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return Content{}, err
+		}
+		return Content{Document: doc, ReadSeekCloser: stream}, nil
+	}
+}
+
+func (s *SQLiteStore) CollectGarbage(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.blobs.collectGarbage(time.Now())
+}
+
+// collectionColumns lists the columns scanned by scanCollection, in order
+const collectionColumns = "id, parent_id, name, created_at, created_by"
+
+// scanCollection reads a row of collectionColumns followed by the path
+func scanCollection(row rowScanner) (Collection, error) {
+	var (
+		c         Collection
+		createdAt string
+	)
+	if err := row.Scan(&c.ID, &c.ParentID, &c.Name, &createdAt, &c.CreatedBy, &c.Path); err != nil {
+		return Collection{}, err
+	}
+	var err error
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Collection{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	return c, nil
+}
+
+// resolveCollection returns the ID of the collection at the path names
+// spell out, walking down from the root
+func resolveCollection(ctx context.Context, q queryRower, names []string) (string, error) {
+	id := ""
+	for _, name := range names {
+		err := q.QueryRowContext(ctx, "SELECT id FROM collections WHERE parent_id = ? AND name = ?", id, name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrCollectionNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// getCollection loads the collection at the path names spell out
+func getCollection(ctx context.Context, q queryRower, names []string) (Collection, error) {
+	id, err := resolveCollection(ctx, q, names)
+	if err != nil {
+		return Collection{}, err
+	}
+	return scanCollection(q.QueryRowContext(ctx,
+		"SELECT "+collectionColumns+", ? FROM collections WHERE id = ?", collectionPath(names), id))
+}
+
+// checkCollectionExists fails with a validation error unless id is the root
+// or names a collection
+func checkCollectionExists(ctx context.Context, q queryRower, id string) error {
+	if id == "" {
+		return nil
+	}
+	var found int
+	err := q.QueryRowContext(ctx, "SELECT 1 FROM collections WHERE id = ?", id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &ValidationError{Errors: []FieldError{{Field: "collection_id", Message: "no such collection"}}}
+	}
+	return err
+}
+
+func (s *SQLiteStore) CreateCollection(ctx context.Context, path string) (Collection, error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 {
+		return Collection{}, ErrCollectionExists
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var created Collection
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := resolveCollection(ctx, tx, names); err == nil {
+			return ErrCollectionExists
+		} else if !errors.Is(err, ErrCollectionNotFound) {
+			return err
+		}
+		// Missing ancestors are created on the way down
+		parent := ""
+		for i, name := range names {
+			id, err := resolveCollection(ctx, tx, names[:i+1])
+			if err == nil {
+				parent = id
+				continue
+			}
+			if !errors.Is(err, ErrCollectionNotFound) {
+				return err
+			}
+			c, err := newCollection(ctx, name, parent)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO collections ("+collectionColumns+") VALUES (?, ?, ?, ?, ?)",
+				c.ID, c.ParentID, c.Name, c.CreatedAt.Format(time.RFC3339Nano), c.CreatedBy); err != nil {
+				return err
+			}
+			c.Path = collectionPath(names[:i+1])
+			created, parent = c, c.ID
+		}
+		return nil
+	})
+	return created, err
+}
+
+func (s *SQLiteStore) GetCollection(ctx context.Context, path string) (Collection, error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 {
+		return Collection{Path: "/"}, nil
+	}
+	return getCollection(ctx, s.db, names)
+}
+
+func (s *SQLiteStore) ListCollections(ctx context.Context, path string, recursive bool) ([]Collection, error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return nil, err
+	}
+	id, err := resolveCollection(ctx, s.db, names)
+	if err != nil {
+		return nil, err
+	}
+	prefix := collectionPath(names)
+	if len(names) > 0 {
+		prefix += "/"
+	}
+
+	// Paths are built on the way down, so a subtree takes one query
+	query := "SELECT " + collectionColumns + ", ? || name FROM collections WHERE parent_id = ? ORDER BY name"
+	if recursive {
+		query = `WITH RECURSIVE tree (` + collectionColumns + `, path) AS (
+			SELECT ` + collectionColumns + `, ? || name FROM collections WHERE parent_id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, c.name, c.created_at, c.created_by, tree.path || '/' || c.name
+			FROM collections c JOIN tree ON c.parent_id = tree.id
+		) SELECT ` + collectionColumns + `, path FROM tree ORDER BY path`
+	}
+	rows, err := s.db.QueryContext(ctx, query, prefix, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make([]Collection, 0)
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortCollections(collections)
+	return collections, nil
+}
+
+func (s *SQLiteStore) MoveCollection(ctx context.Context, path, newPath string) (Collection, error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Collection{}, err
+	}
+	newNames, err := ParseCollectionPath(newPath)
+	if err != nil {
+		return Collection{}, err
+	}
+	if len(names) == 0 || len(newNames) == 0 {
+		return Collection{}, fmt.Errorf("%w: the root cannot be moved", ErrInvalidCollectionPath)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var moved Collection
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := resolveCollection(ctx, tx, names)
+		if err != nil {
+			return err
+		}
+		parent, err := resolveCollection(ctx, tx, newNames[:len(newNames)-1])
+		if err != nil {
+			return err
+		}
+		if _, err := resolveCollection(ctx, tx, newNames); err == nil {
+			return ErrCollectionExists
+		} else if !errors.Is(err, ErrCollectionNotFound) {
+			return err
+		}
+		for ancestor := parent; ancestor != ""; {
+			if ancestor == id {
+				return fmt.Errorf("%w: cannot move a collection into itself", ErrInvalidCollectionPath)
+			}
+			if err := tx.QueryRowContext(ctx, "SELECT parent_id FROM collections WHERE id = ?", ancestor).Scan(&ancestor); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE collections SET name = ?, parent_id = ? WHERE id = ?",
+			newNames[len(newNames)-1], parent, id); err != nil {
+			return err
+		}
+		moved, err = getCollection(ctx, tx, newNames)
+		return err
+	})
+	return moved, err
+}
+
+func (s *SQLiteStore) DeleteCollection(ctx context.Context, path string) error {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: the root cannot be deleted", ErrInvalidCollectionPath)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := resolveCollection(ctx, tx, names)
+		if err != nil {
+			return err
+		}
+		var inUse bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM collections WHERE parent_id = ?)
+				OR EXISTS (SELECT 1 FROM documents WHERE collection_id = ?)`, id, id).Scan(&inUse); err != nil {
+			return err
+		}
+		if inUse {
+			return ErrCollectionNotEmpty
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM collections WHERE id = ?", id)
+		return err
+	})
+}
+
+func (s *SQLiteStore) MoveDocument(ctx context.Context, id, path string, opts ...WriteOption) (Document, error) {
+	names, err := ParseCollectionPath(path)
+	if err != nil {
+		return Document{}, err
+	}
+	var moved Document
+	err = s.write(ctx, func(tx *sql.Tx) (Document, error) {
+		current, err := checkWriteOptions(ctx, tx, id, opts)
+		if err != nil {
+			return Document{}, err
+		}
+		collection, err := resolveCollection(ctx, tx, names)
+		if err != nil {
+			return Document{}, err
+		}
+		if collection == current.CollectionID {
+			moved = current
+			return current, nil
+		}
+		doc := current
+		doc.CollectionID = collection
+		moved, err = saveDocument(ctx, tx, doc, current)
+		return moved, err
+	})
+	return moved, err
+}
+
+// schemaColumns lists the columns scanned by scanSchema, in order
+const schemaColumns = "type, schema, version, created_at, updated_at, created_by, updated_by"
+
+func scanSchema(row rowScanner) (Schema, error) {
+	var (
+		schema             Schema
+		data               string
+		createdAt, updated string
+	)
+	if err := row.Scan(&schema.Type, &data, &schema.Version, &createdAt, &updated, &schema.CreatedBy, &schema.UpdatedBy); err != nil {
+		return Schema{}, err
+	}
+	schema.Schema = json.RawMessage(data)
+	var err error
+	if schema.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Schema{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	if schema.UpdatedAt, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return Schema{}, fmt.Errorf("parse updated_at: %w", err)
+	}
+	return schema, nil
+}
+
+func getSchema(ctx context.Context, q queryRower, docType string) (Schema, error) {
+	schema, err := scanSchema(q.QueryRowContext(ctx,
+		"SELECT "+schemaColumns+" FROM document_schemas WHERE type = ?", docType))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return schema, err
+}
+
+// loadSchema compiles the schema registered for docType, or returns nil if
+// there is none
+func loadSchema(ctx context.Context, q queryRower, docType string) (*jsonSchema, error) {
+	if docType == "" {
+		return nil, nil
+	}
+	schema, err := getSchema(ctx, q, docType)
+	if errors.Is(err, ErrSchemaNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compileJSONSchema(schema.Schema)
+}
+
+func (s *SQLiteStore) PutSchema(ctx context.Context, docType string, schema json.RawMessage) (Schema, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var registered Schema
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var current *Schema
+		existing, err := getSchema(ctx, tx, docType)
+		if err == nil {
+			current = &existing
+		} else if !errors.Is(err, ErrSchemaNotFound) {
+			return err
+		}
+		if registered, err = newSchema(ctx, docType, schema, current); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO document_schemas (`+schemaColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (type) DO UPDATE SET schema = excluded.schema, version = excluded.version,
+				updated_at = excluded.updated_at, updated_by = excluded.updated_by`,
+			registered.Type, string(registered.Schema), registered.Version,
+			registered.CreatedAt.Format(time.RFC3339Nano), registered.UpdatedAt.Format(time.RFC3339Nano),
+			registered.CreatedBy, registered.UpdatedBy)
+		return err
+	})
+	return registered, err
+}
+
+func (s *SQLiteStore) GetSchema(ctx context.Context, docType string) (Schema, error) {
+	return getSchema(ctx, s.db, docType)
+}
+
+func (s *SQLiteStore) ListSchemas(ctx context.Context) ([]Schema, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+schemaColumns+" FROM document_schemas ORDER BY type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := make([]Schema, 0)
+	for rows.Next() {
+		schema, err := scanSchema(rows)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteSchema(ctx context.Context, docType string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	res, err := s.db.ExecContext(ctx, "DELETE FROM document_schemas WHERE type = ?", docType)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSchemaNotFound
+	}
+	return nil
+}
+
+// userColumns lists the columns scanned by scanUser, in order
+const userColumns = "username, password_hash, role, disabled, groups, created_at, updated_at, created_by, updated_by"
+
+func scanUser(row rowScanner) (User, error) {
+	var (
+		user               User
+		groups             string
+		createdAt, updated string
+	)
+	if err := row.Scan(&user.Username, &user.PasswordHash, &user.Role, &user.Disabled, &groups,
+		&createdAt, &updated, &user.CreatedBy, &user.UpdatedBy); err != nil {
+		return User{}, err
+	}
+	if err := json.Unmarshal([]byte(groups), &user.Groups); err != nil {
+		return User{}, fmt.Errorf("decode groups: %w", err)
+	}
+	var err error
+	if user.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return User{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	if user.UpdatedAt, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return User{}, fmt.Errorf("parse updated_at: %w", err)
+	}
+	return user, nil
+}
+
+func getUser(ctx context.Context, q queryRower, username string) (User, error) {
+	user, err := scanUser(q.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE username = ?", username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *SQLiteStore) CreateUser(ctx context.Context, user User) (User, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var created User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := getUser(ctx, tx, user.Username)
+		if err == nil {
+			return ErrUserExists
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		if created, err = newUser(ctx, user, nil); err != nil {
+			return err
+		}
+		groups, err := json.Marshal(created.Groups)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			created.Username, created.PasswordHash, created.Role, created.Disabled, string(groups),
+			created.CreatedAt.Format(time.RFC3339Nano), created.UpdatedAt.Format(time.RFC3339Nano),
+			created.CreatedBy, created.UpdatedBy)
+		return err
+	})
+	return created, err
+}
+
+func (s *SQLiteStore) GetUser(ctx context.Context, username string) (User, error) {
+	return getUser(ctx, s.db, username)
+}
+
+func (s *SQLiteStore) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteStore) UpdateUser(ctx context.Context, user User) (User, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var updated User
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := getUser(ctx, tx, user.Username)
+		if err != nil {
+			return err
+		}
+		if updated, err = newUser(ctx, user, &current); err != nil {
+			return err
+		}
+		groups, err := json.Marshal(updated.Groups)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE users SET password_hash = ?, role = ?, disabled = ?, groups = ?, updated_at = ?, updated_by = ? WHERE username = ?",
+			updated.PasswordHash, updated.Role, updated.Disabled, string(groups), updated.UpdatedAt.Format(time.RFC3339Nano), updated.UpdatedBy,
+			updated.Username)
+		return err
+	})
+	return updated, err
+}
+
+// DeleteUser also leaves the documents the user owned without an owner and
+// revokes what was shared with them, so that a user created later under the
+// same name inherits neither
+func (s *SQLiteStore) DeleteUser(ctx context.Context, username string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE username = ?", username)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE documents SET owner = '' WHERE owner = ?", username); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM document_acl WHERE principal = ?", PrincipalUser+username)
+		return err
+	})
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	queryRower
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// getGrants loads who document id is shared with, ordered by principal
+func getGrants(ctx context.Context, q querier, id string) ([]Grant, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT principal, level, granted_at, granted_by FROM document_acl WHERE document_id = ? ORDER BY principal", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := make([]Grant, 0)
+	for rows.Next() {
+		var (
+			grant     Grant
+			grantedAt string
+		)
+		if err := rows.Scan(&grant.Principal, &grant.Level, &grantedAt, &grant.GrantedBy); err != nil {
+			return nil, err
+		}
+		if grant.GrantedAt, err = time.Parse(time.RFC3339Nano, grantedAt); err != nil {
+			return nil, fmt.Errorf("parse granted_at: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// getACL loads the ACL of document id through either the database or a
+// transaction
+func getACL(ctx context.Context, q querier, id string) (ACL, error) {
+	var owner string
+	err := q.QueryRowContext(ctx, "SELECT owner FROM documents WHERE id = ?", id).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ACL{}, ErrDocumentNotFound
+	}
+	if err != nil {
+		return ACL{}, err
+	}
+	grants, err := getGrants(ctx, q, id)
+	if err != nil {
+		return ACL{}, err
+	}
+	return ACL{DocumentID: id, Owner: owner, Grants: grants}, nil
+}
+
+func (s *SQLiteStore) GetACL(ctx context.Context, id string) (ACL, error) {
+	return getACL(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) GrantAccess(ctx context.Context, id, principal, level string) (ACL, error) {
+	if err := checkGrant(principal, level); err != nil {
+		return ACL{}, err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var acl ACL
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getDocument(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO document_acl (document_id, principal, level, granted_at, granted_by) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (document_id, principal) DO UPDATE SET level = excluded.level,
+				granted_at = excluded.granted_at, granted_by = excluded.granted_by`,
+			id, principal, level, time.Now().UTC().Format(time.RFC3339Nano), ActorFromContext(ctx))
+		if err != nil {
+			return err
+		}
+		acl, err = getACL(ctx, tx, id)
+		return err
+	})
+	return acl, err
+}
+
+func (s *SQLiteStore) RevokeAccess(ctx context.Context, id, principal string) (ACL, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var acl ACL
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getDocument(ctx, tx, id); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM document_acl WHERE document_id = ? AND principal = ?", id, principal)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrGrantNotFound
+		}
+		acl, err = getACL(ctx, tx, id)
+		return err
+	})
+	return acl, err
+}
+
+func (s *SQLiteStore) SetOwner(ctx context.Context, id, owner string) (ACL, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var acl ACL
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getDocument(ctx, tx, id); err != nil {
+			return err
+		}
+		if _, err := getUser(ctx, tx, owner); errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("%w: owner %q is not a user", ErrInvalidGrant, owner)
+		} else if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE documents SET owner = ? WHERE id = ?", owner, id); err != nil {
+			return err
+		}
+		var err error
+		acl, err = getACL(ctx, tx, id)
+		return err
+	})
+	return acl, err
+}
+
+// sessionColumns lists the columns scanned by scanSession, in order
+const sessionColumns = "id, username, refresh_token_id, revoked, created_at, updated_at, expires_at"
+
+func scanSession(row rowScanner) (Session, error) {
+	var (
+		session              Session
+		createdAt, updatedAt string
+		expiresAt            int64
+	)
+	if err := row.Scan(&session.ID, &session.Username, &session.RefreshTokenID, &session.Revoked,
+		&createdAt, &updatedAt, &expiresAt); err != nil {
+		return Session{}, err
+	}
+	var err error
+	if session.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Session{}, fmt.Errorf("parse created_at: %w", err)
+	}
+	if session.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return Session{}, fmt.Errorf("parse updated_at: %w", err)
+	}
+	session.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return session, nil
+}
+
+func getSession(ctx context.Context, q queryRower, id string) (Session, error) {
+	session, err := scanSession(q.QueryRowContext(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, err
+}
+
+// putSession writes every field of session but its creation
+func putSession(ctx context.Context, tx *sql.Tx, session Session) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE sessions SET refresh_token_id = ?, revoked = ?, updated_at = ?, expires_at = ? WHERE id = ?",
+		session.RefreshTokenID, session.Revoked, session.UpdatedAt.Format(time.RFC3339Nano),
+		session.ExpiresAt.UnixNano(), session.ID)
+	return err
+}
+
+func (s *SQLiteStore) CreateSession(ctx context.Context, session Session) (Session, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	now := time.Now().UTC()
+	session.CreatedAt, session.UpdatedAt, session.ExpiresAt = now, now, session.ExpiresAt.UTC()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.Username, session.RefreshTokenID, session.Revoked,
+		now.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano), session.ExpiresAt.UnixNano())
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (s *SQLiteStore) GetSession(ctx context.Context, id string) (Session, error) {
+	return getSession(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) RotateSession(ctx context.Context, id, refreshTokenID, nextTokenID string, expiresAt time.Time) (Session, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var (
+		session  Session
+		rotation error
+	)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := getSession(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		// A reused token still commits, revoking the session
+		session, rotation = rotateSession(current, refreshTokenID, nextTokenID, expiresAt)
+		if rotation != nil && !errors.Is(rotation, ErrRefreshTokenReused) {
+			return rotation
+		}
+		return putSession(ctx, tx, session)
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, rotation
+}
+
+func (s *SQLiteStore) RevokeSession(ctx context.Context, id string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	res, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked = 1, updated_at = ? WHERE id = ? AND revoked = 0",
+		time.Now().UTC().Format(time.RFC3339Nano), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		// Already revoked, or missing
+		_, err := getSession(ctx, s.db, id)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at",
+		tokenID, expiresAt.UnixNano())
+	return err
+}
+
+func (s *SQLiteStore) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var one int
+	err := s.db.QueryRowContext(ctx, "SELECT 1 FROM revoked_tokens WHERE id = ?", tokenID).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *SQLiteStore) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var deleted int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range []string{"sessions", "revoked_tokens"} {
+			res, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at < ?", now.UnixNano())
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		return nil
+	})
+	return int(deleted), err
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
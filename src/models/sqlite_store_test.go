@@ -0,0 +1,256 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docstore.db")
+	ctx := context.Background()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	store.Create(ctx, Document{ID: "1", Name: "One", Description: "First"})
+	store.Close()
+
+	reopened, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopened.Close()
+
+	doc, err := reopened.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Get() after reopen failed: %v", err)
+	}
+	if doc.Name != "One" || doc.Description != "First" {
+		t.Errorf("unexpected document after reopen: %+v", doc)
+	}
+}
+
+func TestSQLiteStore_Migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docstore.db")
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+
+	var version, applied int
+	store.db.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_migrations").Scan(&version, &applied)
+	if version != len(sqliteMigrations) || applied != len(sqliteMigrations) {
+		t.Errorf("schema at version %d with %d migrations, want %d", version, applied, len(sqliteMigrations))
+	}
+	store.Close()
+
+	// Reopening must not re-apply anything
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	store.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if applied != len(sqliteMigrations) {
+		t.Errorf("expected %d recorded migrations after reopen, got %d", len(sqliteMigrations), applied)
+	}
+
+	// A database written by a newer build is refused
+	store.db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, 'later')", len(sqliteMigrations)+1)
+	store.Close()
+
+	if _, err := NewSQLiteStore(path); err == nil {
+		t.Error("expected error for schema newer than supported")
+	}
+}
+
+func TestSQLiteStore_FailedMigrationRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "docstore.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	// Occupy the name of the first migration's table so it fails
+	db.Exec("CREATE TABLE documents (id TEXT)")
+
+	if err := migrateSQLite(context.Background(), db); err == nil {
+		t.Fatal("expected migration failure")
+	}
+
+	var applied int
+	db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if applied != 0 {
+		t.Errorf("failed migration should not be recorded, got %d", applied)
+	}
+}
+
+func TestSQLiteStore_VersionBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docstore.db")
+	ctx := context.Background()
+
+	// Build a database at schema version 2, before documents carried a version
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	all := sqliteMigrations
+	sqliteMigrations = all[:2]
+	err = migrateSQLite(ctx, db)
+	sqliteMigrations = all
+	if err != nil {
+		t.Fatalf("migrate to version 2: %v", err)
+	}
+	db.Exec("INSERT INTO documents (id, name) VALUES ('1', 'One')")
+	for _, rev := range []int{1, 2} {
+		db.Exec("INSERT INTO document_revisions (document_id, revision, created_at, data) VALUES ('1', ?, '2024-01-01T00:00:00Z', '{}')", rev)
+	}
+	db.Close()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	doc, err := store.Get(ctx, "1")
+	if err != nil || doc.Version != 2 {
+		t.Fatalf("expected version backfilled from history, got %+v (%v)", doc, err)
+	}
+	if _, err := store.Update(ctx, "1", Document{Name: "One v3"}, IfMatch(2)); err != nil {
+		t.Errorf("Update() after backfill failed: %v", err)
+	}
+}
+
+func TestSQLiteStore_MetadataBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docstore.db")
+	ctx := context.Background()
+
+	// Build a database at schema version 3, before documents carried timestamps
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	all := sqliteMigrations
+	sqliteMigrations = all[:3]
+	err = migrateSQLite(ctx, db)
+	sqliteMigrations = all
+	if err != nil {
+		t.Fatalf("migrate to version 3: %v", err)
+	}
+	db.Exec("INSERT INTO documents (id, name, version) VALUES ('1', 'One', 2)")
+	db.Exec("INSERT INTO documents (id, name) VALUES ('2', 'Two')")
+	db.Exec("INSERT INTO document_revisions (document_id, revision, created_at, author, data) VALUES ('1', 1, '2024-01-01T00:00:00Z', 'alice', '{}')")
+	db.Exec("INSERT INTO document_revisions (document_id, revision, created_at, author, data) VALUES ('1', 2, '2024-02-01T00:00:00Z', 'bob', '{}')")
+	db.Close()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	doc, err := store.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if doc.CreatedBy != "alice" || doc.UpdatedBy != "bob" ||
+		!doc.CreatedAt.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		!doc.UpdatedAt.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected metadata backfilled from history, got %+v", doc)
+	}
+
+	// Documents without history are left without timestamps
+	doc, err = store.Get(ctx, "2")
+	if err != nil || !doc.CreatedAt.IsZero() {
+		t.Errorf("expected zero timestamps for a document without history, got %+v (%v)", doc, err)
+	}
+}
+
+func TestSQLiteStore_TimeKeyBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docstore.db")
+	ctx := context.Background()
+
+	// Build a database at schema version 12, before listings sorted in SQL.
+	// The text of these timestamps sorts in the opposite order of time.
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	all := sqliteMigrations
+	sqliteMigrations = all[:12]
+	err = migrateSQLite(ctx, db)
+	sqliteMigrations = all
+	if err != nil {
+		t.Fatalf("migrate to version 12: %v", err)
+	}
+	db.Exec("INSERT INTO documents (id, created_at, updated_at) VALUES ('1', '2024-01-01T00:00:00.55Z', '2024-01-01T00:00:00.55Z')")
+	db.Exec("INSERT INTO documents (id, created_at, updated_at) VALUES ('2', '2024-01-01T00:00:00.5Z', '2024-01-01T02:00:00+03:00')")
+	db.Exec("INSERT INTO documents (id) VALUES ('3')")
+	db.Close()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	for _, tt := range []struct {
+		field string
+		want  string
+	}{
+		{SortByCreatedAt, "[3 2 1]"},
+		{SortByUpdatedAt, "[3 2 1]"},
+	} {
+		page, err := store.List(ctx, ListOptions{SortBy: tt.field})
+		if err != nil {
+			t.Fatalf("List() failed: %v", err)
+		}
+		var got []string
+		for _, doc := range page.Documents {
+			got = append(got, doc.ID)
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("List() by %s = %v, want %s", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteStore_ListUsesIndexes(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "docstore.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	for field := range sortColumns {
+		for _, descending := range []bool{false, true} {
+			order, after := sortClauses(field, descending)
+			args := []interface{}{"x", "x"}
+			if field == SortByID {
+				args = args[:1]
+			}
+			rows, err := store.db.Query("EXPLAIN QUERY PLAN SELECT "+documentColumns+" FROM documents WHERE "+after+order+" LIMIT 10", args...)
+			if err != nil {
+				t.Fatalf("EXPLAIN failed: %v", err)
+			}
+			var plan []string
+			for rows.Next() {
+				var id, parent, unused int
+				var detail string
+				rows.Scan(&id, &parent, &unused, &detail)
+				plan = append(plan, detail)
+			}
+			rows.Close()
+			if joined := strings.Join(plan, "; "); !strings.Contains(joined, "INDEX") || strings.Contains(joined, "TEMP B-TREE") {
+				t.Errorf("listing by %s (descending %v) does not follow an index: %s", field, descending, joined)
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"docstore-api/src/config"
+)
+
+// Storage backends selectable through STORAGE_BACKEND
+const (
+	BackendMemory = "memory"
+	BackendFile   = "file"
+	BackendSQLite = "sqlite"
+)
+
+var (
+	// ErrDocumentNotFound is returned when no document exists for the given ID
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrDocumentExists is returned when creating a document whose ID is already taken
+	ErrDocumentExists = errors.New("document already exists")
+	// ErrPreconditionFailed is returned when a conditional write finds another version
+	ErrPreconditionFailed = errors.New("document version does not match")
+)
+
+// Store is the persistence contract the service layer depends on.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	Create(ctx context.Context, doc Document) error
+	Get(ctx context.Context, id string) (Document, error)
+	// List returns one page of documents in the order selected by opts
+	List(ctx context.Context, opts ListOptions) (DocumentPage, error)
+	// Search ranks documents by relevance to a full-text query and returns
+	// at most limit of them
+	Search(ctx context.Context, query string, limit int) (SearchResults, error)
+	// Writes to existing documents accept IfMatch, checked atomically with
+	// the write. Update and PartialUpdate return the document as written.
+	Update(ctx context.Context, id string, doc Document, opts ...WriteOption) (Document, error)
+	PartialUpdate(ctx context.Context, id string, updates map[string]interface{}, opts ...WriteOption) (Document, error)
+	Delete(ctx context.Context, id string, opts ...WriteOption) error
+	// UpdateTags adds and removes tags and returns the document. A change
+	// that leaves the tags as they are writes no new version.
+	UpdateTags(ctx context.Context, id string, add, remove []string, opts ...WriteOption) (Document, error)
+	// Patch applies a JSON Merge Patch or JSON Patch to a document and
+	// returns the result. The patch applies as a whole or not at all.
+	Patch(ctx context.Context, id string, patch DocumentPatch, opts ...WriteOption) (Document, error)
+	// Batch performs ops in order under a single lock, each seeing the
+	// outcome of those before it, and returns one result per operation. If
+	// atomic is set and any operation fails, none is applied and the others
+	// report ErrBatchAborted; otherwise every operation that succeeds is
+	// applied. Operations on existing documents fail unless the viewer in
+	// ctx, if any, may write them as the operations before left them. The
+	// returned error is set only if the batch could not run.
+	Batch(ctx context.Context, ops []BatchOperation, atomic bool) ([]BatchResult, error)
+	// Begin starts a transaction reading a snapshot of the documents as
+	// they are now; see Tx
+	Begin(ctx context.Context) (Tx, error)
+
+	// Every write records an immutable revision; the actor in ctx (see
+	// WithActor) is stored as its author.
+	ListRevisions(ctx context.Context, id string) ([]Revision, error)
+	GetRevision(ctx context.Context, id string, rev int64) (Revision, error)
+	// RestoreRevision makes an old revision current by writing it as a new one.
+	// The document keeps its current content.
+	RestoreRevision(ctx context.Context, id string, rev int64, opts ...WriteOption) (Document, error)
+
+	// PutContent replaces a document's content with the bytes read from r,
+	// recording their type, size and SHA-256 as a new revision
+	PutContent(ctx context.Context, id, contentType string, r io.Reader, opts ...WriteOption) (Document, error)
+	// OpenContent returns a document's content, or ErrContentNotFound if none
+	// was uploaded. The caller must close it.
+	OpenContent(ctx context.Context, id string) (Content, error)
+	// CollectGarbage removes stored content no document references any
+	// more, returning how many blobs and abandoned uploads it removed.
+	// Content shared by several documents is kept until the last is gone.
+	CollectGarbage(ctx context.Context) (int, error)
+
+	// Collections are addressed by path, such as "/contracts/2026/q3".
+	// CreateCollection creates missing ancestors along the way.
+	CreateCollection(ctx context.Context, path string) (Collection, error)
+	GetCollection(ctx context.Context, path string) (Collection, error)
+	// ListCollections returns the collections directly below path, or all
+	// of them below it if recursive is set, ordered by path
+	ListCollections(ctx context.Context, path string, recursive bool) ([]Collection, error)
+	// MoveCollection moves or renames a collection with everything below it
+	MoveCollection(ctx context.Context, path, newPath string) (Collection, error)
+	// DeleteCollection removes an empty collection, or fails with
+	// ErrCollectionNotEmpty
+	DeleteCollection(ctx context.Context, path string) error
+	// MoveDocument puts a document into the collection at path and returns
+	// it. Moving a document writes a new version unless it is already there.
+	MoveDocument(ctx context.Context, id, path string, opts ...WriteOption) (Document, error)
+
+	// PutSchema registers the JSON Schema the metadata of documents of a
+	// type must conform to, replacing any registered before. Documents
+	// already stored are not checked again until their metadata changes.
+	PutSchema(ctx context.Context, docType string, schema json.RawMessage) (Schema, error)
+	GetSchema(ctx context.Context, docType string) (Schema, error)
+	// ListSchemas returns every registered schema, ordered by type
+	ListSchemas(ctx context.Context) ([]Schema, error)
+	DeleteSchema(ctx context.Context, docType string) error
+
+	// Users are the accounts that can log in. CreateUser fails with
+	// ErrUserExists if the name is taken; UpdateUser replaces every field
+	// of an existing user but its name and creation.
+	CreateUser(ctx context.Context, user User) (User, error)
+	GetUser(ctx context.Context, username string) (User, error)
+	// ListUsers returns every user, ordered by name
+	ListUsers(ctx context.Context) ([]User, error)
+	UpdateUser(ctx context.Context, user User) (User, error)
+	DeleteUser(ctx context.Context, username string) error
+
+	// Every document has an ACL listing the users and groups it is shared
+	// with besides its owner. List and Search return only the documents
+	// the viewer in ctx, if any (see WithViewer), may see; checking
+	// access to single documents is left to callers (see
+	// Viewer.Authorize). A document's ACL goes with it when it is deleted.
+	GetACL(ctx context.Context, id string) (ACL, error)
+	// GrantAccess shares a document with principal at level, replacing
+	// what it was granted before, and returns the resulting ACL
+	GrantAccess(ctx context.Context, id, principal, level string) (ACL, error)
+	// RevokeAccess removes the grant to principal, or fails with
+	// ErrGrantNotFound
+	RevokeAccess(ctx context.Context, id, principal string) (ACL, error)
+	// SetOwner gives a document to the existing user owner. Documents are
+	// owned by their creator until then; deleting a user leaves theirs
+	// without an owner and revokes what was shared with them.
+	SetOwner(ctx context.Context, id, owner string) (ACL, error)
+
+	// Sessions track the refresh tokens issued since each login (see
+	// Session). RotateSession replaces the latest refresh token of a
+	// session in one step: if refreshTokenID is not the latest, it revokes
+	// the session instead and fails with ErrRefreshTokenReused.
+	CreateSession(ctx context.Context, session Session) (Session, error)
+	GetSession(ctx context.Context, id string) (Session, error)
+	RotateSession(ctx context.Context, id, refreshTokenID, nextTokenID string, expiresAt time.Time) (Session, error)
+	RevokeSession(ctx context.Context, id string) error
+	// RevokeToken lists a token as revoked until it expires at expiresAt
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpiredSessions removes the sessions and revoked tokens that
+	// expired before now and returns how many there were
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+
+	Close() error
+}
+
+// WriteOption adjusts a single write to an existing document
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	checkVersion bool
+	versions     []int64
+}
+
+// IfMatch makes a write succeed only while the document's current version is
+// one of versions; otherwise it fails with ErrPreconditionFailed. Calling it
+// without versions makes the write fail unconditionally.
+func IfMatch(versions ...int64) WriteOption {
+	return func(o *writeOptions) {
+		o.checkVersion = true
+		o.versions = append(o.versions, versions...)
+	}
+}
+
+func collectWriteOptions(opts []WriteOption) writeOptions {
+	var o writeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// check verifies the preconditions against the document about to be written
+func (o writeOptions) check(current Document) error {
+	if !o.checkVersion {
+		return nil
+	}
+	for _, v := range o.versions {
+		if v == current.Version {
+			return nil
+		}
+	}
+	return ErrPreconditionFailed
+}
+
+// NewStore creates the storage backend selected in the configuration
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.StorageBackend {
+	case "", BackendMemory:
+		return NewDocumentStore(), nil
+	case BackendFile:
+		store, err := NewFileStore(FileStoreOptions{
+			Dir:              cfg.DataDir,
+			SyncPolicy:       cfg.WALSyncPolicy,
+			SyncInterval:     cfg.WALSyncInterval,
+			CompactThreshold: cfg.WALCompactThreshold,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendSQLite:
+		store, err := NewSQLiteStore(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
@@ -0,0 +1,533 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"docstore-api/src/config"
+)
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		expectError bool
+	}{
+		{name: "memory backend", backend: BackendMemory},
+		{name: "empty backend defaults to memory", backend: ""},
+		{name: "unknown backend", backend: "tape", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(&config.Config{StorageBackend: tt.backend})
+			if tt.expectError {
+				if err == nil {
+					t.Error("NewStore() should fail for unknown backend")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewStore() failed: %v", err)
+			}
+			if _, ok := store.(*DocumentStore); !ok {
+				t.Errorf("expected *DocumentStore, got %T", store)
+			}
+		})
+	}
+}
+
+func TestNewStore_File(t *testing.T) {
+	store, err := NewStore(&config.Config{StorageBackend: BackendFile, DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	if _, ok := store.(*FileStore); !ok {
+		t.Errorf("expected *FileStore, got %T", store)
+	}
+}
+
+func TestNewStore_SQLite(t *testing.T) {
+	store, err := NewStore(&config.Config{StorageBackend: BackendSQLite, SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	if _, ok := store.(*SQLiteStore); !ok {
+		t.Errorf("expected *SQLiteStore, got %T", store)
+	}
+}
+
+func TestDocumentStore_TypedErrors(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+
+	store.Create(ctx, Document{ID: "1"})
+
+	if err := store.Create(ctx, Document{ID: "1"}); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("expected ErrDocumentExists, got %v", err)
+	}
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got %v", err)
+	}
+	if _, err := store.Update(ctx, "missing", Document{}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got %v", err)
+	}
+	if err := store.Delete(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestDocumentStore_CanceledContext(t *testing.T) {
+	store := NewDocumentStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.Create(ctx, Document{ID: "1"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(store.documents) != 0 {
+		t.Error("canceled Create() should not store the document")
+	}
+	if _, err := store.List(ctx, ListOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// storeFactories builds a fresh instance of every backend for contract tests
+func storeFactories() map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		BackendMemory: func(t *testing.T) Store {
+			return NewDocumentStore()
+		},
+		BackendFile: func(t *testing.T) Store {
+			store, err := NewFileStore(FileStoreOptions{Dir: t.TempDir(), SyncPolicy: SyncNever})
+			if err != nil {
+				t.Fatalf("NewFileStore() failed: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		BackendSQLite: func(t *testing.T) Store {
+			store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore() failed: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+}
+
+// TestStoreContract checks that every backend behaves like the in-memory store
+func TestStoreContract(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			if err := store.Create(ctx, Document{ID: "1", Name: "One", Description: "First"}); err != nil {
+				t.Fatalf("Create() failed: %v", err)
+			}
+			if err := store.Create(ctx, Document{ID: "1"}); !errors.Is(err, ErrDocumentExists) {
+				t.Errorf("expected ErrDocumentExists, got %v", err)
+			}
+
+			doc, err := store.Get(ctx, "1")
+			if err != nil || !reflect.DeepEqual(withoutMetadata(doc), Document{ID: "1", Name: "One", Description: "First", Version: 1}) {
+				t.Errorf("Get() = %+v, %v", doc, err)
+			}
+			if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			updated, err := store.Update(ctx, "1", Document{ID: "other", Name: "One v2", Description: "Replaced"})
+			if err != nil || updated.ID != "1" || updated.Version != 2 || updated.Description != "Replaced" {
+				t.Errorf("Update() = %+v, %v", updated, err)
+			}
+			if _, err := store.Update(ctx, "missing", Document{}); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"description": "Patched", "id": "x"}); !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation for a read-only field, got %v", err)
+			}
+			updated, err = store.PartialUpdate(ctx, "1", map[string]interface{}{"description": "Patched"})
+			if err != nil || updated.Version != 3 || updated.Name != "One v2" || updated.Description != "Patched" {
+				t.Errorf("PartialUpdate() = %+v, %v", updated, err)
+			}
+			if _, err := store.PartialUpdate(ctx, "missing", map[string]interface{}{}); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			doc, _ = store.Get(ctx, "1")
+			if !reflect.DeepEqual(withoutMetadata(doc), Document{ID: "1", Name: "One v2", Description: "Patched", Version: 3}) {
+				t.Errorf("unexpected document after updates: %+v", doc)
+			}
+
+			store.Create(ctx, Document{ID: "2", Name: "Two"})
+			page, err := store.List(ctx, ListOptions{})
+			docs := page.Documents
+			if err != nil || len(docs) != 2 {
+				t.Errorf("List() = %d documents, %v", len(docs), err)
+			}
+
+			if err := store.Delete(ctx, "1"); err != nil {
+				t.Errorf("Delete() failed: %v", err)
+			}
+			if err := store.Delete(ctx, "1"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreContract_Revisions(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			store.Create(WithActor(ctx, "alice"), Document{ID: "1", Name: "Draft"})
+			store.Update(WithActor(ctx, "bob"), "1", Document{Name: "Final", Description: "Done"})
+			store.PartialUpdate(WithActor(ctx, "carol"), "1", map[string]interface{}{"description": "Reviewed"})
+
+			history, err := store.ListRevisions(ctx, "1")
+			if err != nil {
+				t.Fatalf("ListRevisions() failed: %v", err)
+			}
+			if len(history) != 3 {
+				t.Fatalf("expected 3 revisions, got %d", len(history))
+			}
+			for i, author := range []string{"alice", "bob", "carol"} {
+				if history[i].Revision != int64(i+1) || history[i].Author != author || history[i].Timestamp.IsZero() {
+					t.Errorf("revision %d = %+v, want number %d by %s", i, history[i], i+1, author)
+				}
+			}
+
+			first, err := store.GetRevision(ctx, "1", 1)
+			if err != nil || first.Document.Name != "Draft" {
+				t.Errorf("GetRevision(1) = %+v, %v", first, err)
+			}
+			if _, err := store.GetRevision(ctx, "1", 9); !errors.Is(err, ErrRevisionNotFound) {
+				t.Errorf("expected ErrRevisionNotFound, got %v", err)
+			}
+			if _, err := store.GetRevision(ctx, "missing", 1); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			restored, err := store.RestoreRevision(WithActor(ctx, "dave"), "1", 1)
+			if err != nil || restored.Name != "Draft" {
+				t.Fatalf("RestoreRevision() = %+v, %v", restored, err)
+			}
+			current, _ := store.Get(ctx, "1")
+			if !reflect.DeepEqual(withoutMetadata(current), Document{ID: "1", Name: "Draft", Version: 4}) || !reflect.DeepEqual(restored, current) {
+				t.Errorf("restore did not make revision 1 current: %+v", current)
+			}
+			history, _ = store.ListRevisions(ctx, "1")
+			if len(history) != 4 || history[3].Author != "dave" || history[3].Document.Name != "Draft" {
+				t.Errorf("restore should be recorded as revision 4, got %+v", history)
+			}
+			if _, err := store.RestoreRevision(ctx, "1", 42); !errors.Is(err, ErrRevisionNotFound) {
+				t.Errorf("expected ErrRevisionNotFound, got %v", err)
+			}
+
+			// Deleting a document drops its history; a recreated ID starts a
+			// new one, numbered on from the deleted document so that no
+			// version, and no ETag, is reused
+			deleted, _ := store.Get(ctx, "1")
+			store.Delete(ctx, "1")
+			if _, err := store.ListRevisions(ctx, "1"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound after delete, got %v", err)
+			}
+			store.Create(ctx, Document{ID: "1", Name: "Reborn"})
+			history, _ = store.ListRevisions(ctx, "1")
+			if len(history) != 1 || history[0].Revision != deleted.Version+1 || history[0].Document.Version != deleted.Version+1 {
+				t.Errorf("recreated document should have a fresh history after version %d, got %+v", deleted.Version, history)
+			}
+		})
+	}
+}
+
+// TestStoreContract_Metadata checks that timestamps and authors are set by
+// the store and survive attempts to overwrite them
+func TestStoreContract_Metadata(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			forged := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			before := time.Now().UTC()
+			store.Create(WithActor(ctx, "alice"), Document{ID: "1", Name: "One", CreatedAt: forged, CreatedBy: "mallory"})
+			created, _ := store.Get(ctx, "1")
+			if created.CreatedBy != "alice" || created.UpdatedBy != "alice" {
+				t.Errorf("expected alice as creator and updater, got %+v", created)
+			}
+			if created.CreatedAt.Before(before) || !created.UpdatedAt.Equal(created.CreatedAt) {
+				t.Errorf("expected creation time set by the store, got %+v", created)
+			}
+
+			store.Update(WithActor(ctx, "bob"), "1", Document{Name: "One v2", CreatedAt: forged, CreatedBy: "mallory", UpdatedBy: "mallory"})
+			_, err := store.PartialUpdate(WithActor(ctx, "carol"), "1", map[string]interface{}{
+				"created_by": "mallory",
+				"updated_by": "mallory",
+				"created_at": forged,
+				"version":    int64(99),
+			})
+			if !errors.Is(err, ErrValidation) {
+				t.Errorf("expected ErrValidation for server-managed fields, got %v", err)
+			}
+			store.PartialUpdate(WithActor(ctx, "carol"), "1", map[string]interface{}{"description": "Reviewed"})
+
+			doc, _ := store.Get(ctx, "1")
+			if doc.CreatedBy != "alice" || !doc.CreatedAt.Equal(created.CreatedAt) {
+				t.Errorf("creation fields changed: %+v", doc)
+			}
+			if doc.UpdatedBy != "carol" || doc.UpdatedAt.Before(created.UpdatedAt) || doc.Version != 3 {
+				t.Errorf("expected carol's write as the latest, got %+v", doc)
+			}
+
+			history, _ := store.ListRevisions(ctx, "1")
+			latest := history[len(history)-1]
+			if !latest.Timestamp.Equal(doc.UpdatedAt) || latest.Author != doc.UpdatedBy {
+				t.Errorf("latest revision %+v does not match document %+v", latest, doc)
+			}
+		})
+	}
+}
+
+func TestStoreContract_IfMatch(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			store.Create(ctx, Document{ID: "1", Name: "v1"})
+
+			if _, err := store.Update(ctx, "1", Document{Name: "stale"}, IfMatch(2)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			if _, err := store.Update(ctx, "1", Document{Name: "v2"}, IfMatch(7, 1)); err != nil {
+				t.Errorf("Update() with matching version failed: %v", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"name": "stale"}, IfMatch(1)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			if _, err := store.PartialUpdate(ctx, "1", map[string]interface{}{"name": "v3"}, IfMatch(2)); err != nil {
+				t.Errorf("PartialUpdate() with matching version failed: %v", err)
+			}
+			if _, err := store.RestoreRevision(ctx, "1", 1, IfMatch(2)); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("expected ErrPreconditionFailed, got %v", err)
+			}
+			if err := store.Delete(ctx, "1", IfMatch()); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("IfMatch() without versions should never match, got %v", err)
+			}
+			if _, err := store.Update(ctx, "missing", Document{}, IfMatch(1)); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("expected ErrDocumentNotFound, got %v", err)
+			}
+
+			// Rejected writes leave neither the document nor its history behind
+			doc, _ := store.Get(ctx, "1")
+			history, _ := store.ListRevisions(ctx, "1")
+			if doc.Name != "v3" || doc.Version != 3 || len(history) != 3 {
+				t.Errorf("failed preconditions changed state: %+v with %d revisions", doc, len(history))
+			}
+
+			if err := store.Delete(ctx, "1", IfMatch(3)); err != nil {
+				t.Errorf("Delete() with matching version failed: %v", err)
+			}
+
+			// Preconditions taken before a delete never match the document
+			// created again under the same ID, nor one recreated in a batch
+			store.Create(ctx, Document{ID: "1", Name: "v1 again"})
+			for _, version := range []int64{1, 3} {
+				if _, err := store.Update(ctx, "1", Document{Name: "stale"}, IfMatch(version)); !errors.Is(err, ErrPreconditionFailed) {
+					t.Errorf("IfMatch(%d) after recreating: expected ErrPreconditionFailed, got %v", version, err)
+				}
+			}
+			results, err := store.Batch(ctx, []BatchOperation{
+				{Op: BatchDelete, ID: "1", Options: []WriteOption{IfMatch(4)}},
+				{Op: BatchCreate, ID: "1", Document: Document{Name: "v1 once more"}},
+			}, true)
+			if err != nil || results[1].Err != nil || results[1].Document.Version != 5 {
+				t.Errorf("Batch() = %+v, %v; want the recreated document at version 5", results, err)
+			}
+		})
+	}
+}
+
+func TestStoreContract_ListOrder(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			store.Create(ctx, Document{ID: "b", Name: "Zulu"})
+			store.Create(ctx, Document{ID: "c", Name: "Alpha"})
+			store.Create(ctx, Document{ID: "a", Name: "Mike"})
+			store.Update(ctx, "b", Document{Name: "Zulu"})
+
+			tests := []struct {
+				opts ListOptions
+				want []string
+			}{
+				{ListOptions{}, []string{"a", "b", "c"}},
+				{ListOptions{Descending: true}, []string{"c", "b", "a"}},
+				{ListOptions{SortBy: SortByName}, []string{"c", "a", "b"}},
+				{ListOptions{SortBy: SortByCreatedAt}, []string{"b", "c", "a"}},
+				{ListOptions{SortBy: SortByUpdatedAt, Descending: true}, []string{"b", "a", "c"}},
+			}
+			for _, tt := range tests {
+				// Walk one document at a time to exercise the cursors too
+				var got []string
+				opts := tt.opts
+				opts.Limit = 1
+				for {
+					page, err := store.List(ctx, opts)
+					if err != nil {
+						t.Fatalf("List(%+v) failed: %v", opts, err)
+					}
+					if page.Total != 3 {
+						t.Errorf("List(%+v) total = %d, want 3", opts, page.Total)
+					}
+					for _, doc := range page.Documents {
+						got = append(got, doc.ID)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("List(%+v) order = %v, want %v", tt.opts, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreContract_ListFilter(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			store.Create(WithActor(ctx, "alice"), Document{ID: "a", Name: "Été report", Tags: []string{"draft"}})
+			store.Create(WithActor(ctx, "bob"), Document{ID: "b", Name: "Winter report", Description: "Final copy"})
+			store.Create(WithActor(ctx, "alice"), Document{ID: "c", Name: "notes", Tags: []string{"draft"}})
+			store.Update(WithActor(ctx, "bob"), "c", Document{Name: "Notes", Tags: []string{"draft"}})
+			created, _ := store.Get(ctx, "b")
+
+			tests := []struct {
+				filter string
+				tags   []string
+				want   []string
+			}{
+				{`name:prefix:été`, nil, []string{"a"}},
+				{`name:suffix:REPORT AND NOT created_by=bob`, nil, []string{"a"}},
+				{`name<Notes OR description:contains:"final"`, nil, []string{"b"}},
+				{`version>=2`, nil, []string{"c"}},
+				{`created_at>=` + created.CreatedAt.Format(time.RFC3339Nano), nil, []string{"c", "b"}},
+				{`created_at>1900-01-01 AND updated_by!=alice`, nil, []string{"c", "b"}},
+				{`name:contains:report`, []string{"draft"}, []string{"a"}},
+			}
+			for _, tt := range tests {
+				filter, err := ParseFilter(tt.filter)
+				if err != nil {
+					t.Fatalf("ParseFilter(%q) failed: %v", tt.filter, err)
+				}
+				opts := ListOptions{Filter: filter, Tags: tt.tags, SortBy: SortByName, Limit: 1}
+				var got []string
+				for {
+					page, err := store.List(ctx, opts)
+					if err != nil {
+						t.Fatalf("List(%q) failed: %v", tt.filter, err)
+					}
+					if page.Total != len(tt.want) {
+						t.Errorf("List(%q) total = %d, want %d", tt.filter, page.Total, len(tt.want))
+					}
+					for _, doc := range page.Documents {
+						got = append(got, doc.ID)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("List(%q) = %v, want %v", tt.filter, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreContract_Search(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+
+			store.Create(ctx, Document{ID: "1", Name: "Getting Started", Description: "Start here"})
+			store.Create(ctx, Document{ID: "2", Name: "API Reference", Description: "Getting documents"})
+			store.Create(ctx, Document{ID: "3", Name: "Gone", Description: "getting removed"})
+			store.PartialUpdate(ctx, "2", map[string]interface{}{"description": "Listing documents"})
+			store.RestoreRevision(ctx, "2", 1)
+			store.Delete(ctx, "3")
+
+			if ids := searchIDs(t, store, "getting"); fmt.Sprint(ids) != "[1 2]" {
+				t.Errorf("Search(getting) = %v, want [1 2]", ids)
+			}
+			if ids := searchIDs(t, store, `"api reference"`); fmt.Sprint(ids) != "[2]" {
+				t.Errorf(`Search("api reference") = %v, want [2]`, ids)
+			}
+			if _, err := store.Search(ctx, "", 10); !errors.Is(err, ErrInvalidSearchQuery) {
+				t.Errorf("expected ErrInvalidSearchQuery, got %v", err)
+			}
+		})
+	}
+}
+
+// TestStoreSearch_Reopen checks that durable backends rebuild the index on startup
+func TestStoreSearch_Reopen(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.Create(ctx, Document{ID: "1", Name: "Snapshot"})
+	fileStore.Compact()
+	fileStore.Create(ctx, Document{ID: "2", Name: "Logged snapshot"})
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	if ids := searchIDs(t, reopenedFile, "snapshot"); len(ids) != 2 {
+		t.Errorf("file store search after reopen = %v, want both documents", ids)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.Create(ctx, Document{ID: "1", Name: "Persisted"})
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	if ids := searchIDs(t, reopenedSQLite, "persisted"); len(ids) != 1 {
+		t.Errorf("sqlite search after reopen = %v, want [1]", ids)
+	}
+}
@@ -0,0 +1,337 @@
+package models
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrTxConflict is returned by Commit when a document the transaction
+	// writes was changed by someone else after the transaction began
+	ErrTxConflict = errors.New("transaction conflict: a document it writes was changed concurrently")
+	// ErrTxDone is returned by every call on a committed or rolled back
+	// transaction
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
+
+// Tx is a unit of reads and writes on a store with snapshot isolation.
+// Reads see the documents as they were when the transaction began, together
+// with the transaction's own writes. Writes are checked as they are made and
+// applied together by Commit, which fails with ErrTxConflict if another
+// write changed any document the transaction writes in the meantime.
+// Documents the transaction only reads are not checked, so two
+// transactions may each write what the other read (write skew).
+//
+// Until Commit, documents read back carry the fields the transaction set;
+// versions and timestamps are assigned on commit. When ctx carries a viewer
+// (see WithViewer), Get fails for documents they may not read, and writes to
+// existing documents fail unless they may write them, as Viewer.Authorize
+// reports; the documents the transaction wrote itself are left unchecked.
+// Commit checks the writes again as they apply. A Tx is not safe for
+// concurrent use and must end with Commit or Rollback, or with the context
+// it was begun with: once that is done the transaction is rolled back, its
+// resources are released and its calls fail with the context's error.
+type Tx interface {
+	Get(ctx context.Context, id string) (Document, error)
+	Create(ctx context.Context, doc Document) error
+	Update(ctx context.Context, id string, doc Document, opts ...WriteOption) error
+	Patch(ctx context.Context, id string, patch DocumentPatch, opts ...WriteOption) error
+	Delete(ctx context.Context, id string, opts ...WriteOption) error
+	Commit(ctx context.Context) error
+	// Rollback discards the transaction's writes. Rolling back a finished
+	// transaction returns ErrTxDone.
+	Rollback() error
+}
+
+// txState is the part of a transaction every backend shares: the writes it
+// buffers and the documents as they will be once those are applied
+type txState struct {
+	// begun is the context the transaction was begun with
+	begun context.Context
+	// snapshot reads a document as it was when the transaction began
+	snapshot func(ctx context.Context, id string) (Document, bool, error)
+	// acl returns who may use a document read from the snapshot
+	acl func(ctx context.Context, doc Document) (ACL, error)
+	ops []BatchOperation
+	// written maps the IDs written so far to their new state, nil once
+	// deleted
+	written map[string]*Document
+	done    bool
+}
+
+func newTxState(begun context.Context, snapshot func(ctx context.Context, id string) (Document, bool, error), acl func(ctx context.Context, doc Document) (ACL, error)) txState {
+	return txState{begun: begun, snapshot: snapshot, acl: acl, written: make(map[string]*Document)}
+}
+
+// checkOpen returns ErrTxDone for a finished transaction, or the error of
+// ctx or of the context it was begun with once either is done
+func (t *txState) checkOpen(ctx context.Context) error {
+	if t.done {
+		return ErrTxDone
+	}
+	if err := t.begun.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (t *txState) Get(ctx context.Context, id string) (Document, error) {
+	doc, err := t.current(ctx, id)
+	if err != nil {
+		return Document{}, err
+	}
+	if _, ok := t.written[id]; !ok {
+		if err := t.authorize(ctx, doc, AccessRead); err != nil {
+			return Document{}, err
+		}
+	}
+	return doc, nil
+}
+
+// current returns a document as the transaction sees it, whoever may see it
+func (t *txState) current(ctx context.Context, id string) (Document, error) {
+	if err := t.checkOpen(ctx); err != nil {
+		return Document{}, err
+	}
+	if doc, ok := t.written[id]; ok {
+		if doc == nil {
+			return Document{}, ErrDocumentNotFound
+		}
+		return *doc, nil
+	}
+	doc, ok, err := t.snapshot(ctx, id)
+	if err != nil {
+		return Document{}, err
+	}
+	if !ok {
+		return Document{}, ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+// authorize checks that the viewer in ctx, if any, may use doc, as read from
+// the snapshot, at level
+func (t *txState) authorize(ctx context.Context, doc Document, level string) error {
+	viewer, ok := ViewerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	acl, err := t.acl(ctx, doc)
+	if err != nil {
+		return err
+	}
+	return viewer.Authorize(acl, level)
+}
+
+func (t *txState) Create(ctx context.Context, doc Document) error {
+	return t.write(ctx, BatchOperation{Op: BatchCreate, ID: doc.ID, Document: doc})
+}
+
+func (t *txState) Update(ctx context.Context, id string, doc Document, opts ...WriteOption) error {
+	return t.write(ctx, BatchOperation{Op: BatchUpdate, ID: id, Document: doc, Options: opts})
+}
+
+func (t *txState) Patch(ctx context.Context, id string, patch DocumentPatch, opts ...WriteOption) error {
+	return t.write(ctx, BatchOperation{Op: BatchPatch, ID: id, Patch: patch, Options: opts})
+}
+
+func (t *txState) Delete(ctx context.Context, id string, opts ...WriteOption) error {
+	return t.write(ctx, BatchOperation{Op: BatchDelete, ID: id, Options: opts})
+}
+
+// write checks op against the transaction's view of the store and buffers
+// it. Rules that depend on the rest of the store, such as registered
+// schemas, are checked again on commit.
+func (t *txState) write(ctx context.Context, op BatchOperation) error {
+	current, err := t.current(ctx, op.ID)
+	exists := err == nil
+	if err != nil && !errors.Is(err, ErrDocumentNotFound) {
+		return err
+	}
+
+	var next *Document
+	if op.Op == BatchCreate {
+		if err := ValidateDocumentID(op.ID); err != nil {
+			return err
+		}
+		if exists {
+			return ErrDocumentExists
+		}
+		doc := op.Document
+		doc.ID, doc.ContentInfo, doc.Version = op.ID, ContentInfo{}, 1
+		if err := normalizeLabels(&doc); err != nil {
+			return err
+		}
+		next = &doc
+	} else {
+		if !exists {
+			return ErrDocumentNotFound
+		}
+		if _, ok := t.written[op.ID]; !ok {
+			if err := t.authorize(ctx, current, AccessWrite); err != nil {
+				return err
+			}
+		}
+		if err := collectWriteOptions(op.Options).check(current); err != nil {
+			return err
+		}
+		doc := current
+		switch op.Op {
+		case BatchUpdate:
+			doc = op.Document
+			doc.ID, doc.ContentInfo, doc.CollectionID = op.ID, current.ContentInfo, current.CollectionID
+		case BatchPatch:
+			if doc, err = applyPatch(current, op.Patch); err != nil {
+				return err
+			}
+		}
+		if op.Op != BatchDelete {
+			doc.Version = current.Version + 1
+			doc.CreatedAt, doc.CreatedBy = current.CreatedAt, current.CreatedBy
+			if err := normalizeLabels(&doc); err != nil {
+				return err
+			}
+			next = &doc
+		}
+	}
+	t.ops = append(t.ops, op)
+	t.written[op.ID] = next
+	return nil
+}
+
+// memTx is a transaction on a DocumentStore. It holds no lock between
+// calls: writes committed while it runs first hand it the state they
+// replace, which is both what its reads see and how conflicts are detected.
+type memTx struct {
+	txState
+	store *DocumentStore
+	// preimages holds the state at Begin of every document written since,
+	// nil for one that did not exist. It is guarded by store.mu, and set to
+	// nil when the transaction is abandoned.
+	preimages map[string]*Document
+	// stop unregisters abandon from the context the transaction was begun
+	// with
+	stop func() bool
+}
+
+func (s *DocumentStore) Begin(ctx context.Context) (Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx := &memTx{store: s, preimages: make(map[string]*Document)}
+	tx.txState = newTxState(ctx, tx.read, tx.readACL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions[tx] = struct{}{}
+	tx.stop = context.AfterFunc(ctx, tx.abandon)
+	return tx, nil
+}
+
+// abandon stops handing the transaction the state writes replace once the
+// context it was begun with is done, so a Tx that is dropped without
+// Commit or Rollback does not collect preimages forever
+func (t *memTx) abandon() {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	delete(t.store.transactions, t)
+	t.preimages = nil
+}
+
+// read returns a document as it was when the transaction began
+func (t *memTx) read(ctx context.Context, id string) (Document, bool, error) {
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+	if t.preimages == nil {
+		return Document{}, false, t.begun.Err()
+	}
+	if doc, ok := t.preimages[id]; ok {
+		if doc == nil {
+			return Document{}, false, nil
+		}
+		return *doc, true, nil
+	}
+	doc, ok := t.store.documents[id]
+	return doc, ok, nil
+}
+
+// readACL returns the ACL of a document the transaction read
+func (t *memTx) readACL(ctx context.Context, doc Document) (ACL, error) {
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+	return t.store.acl(doc), nil
+}
+
+func (t *memTx) Commit(ctx context.Context) error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.stop()
+	s := t.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.done = true
+	delete(s.transactions, t)
+	// The context it was begun with is done whenever abandon has run
+	if err := t.begun.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for id := range t.written {
+		if _, changed := t.preimages[id]; changed {
+			return ErrTxConflict
+		}
+	}
+	if len(t.ops) == 0 {
+		return nil
+	}
+	results, records, released := s.stageBatch(ctx, t.ops)
+	for _, result := range results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return s.commitBatch(records, released)
+}
+
+func (t *memTx) Rollback() error {
+	if t.done {
+		return ErrTxDone
+	}
+	t.stop()
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	t.done = true
+	delete(t.store.transactions, t)
+	return nil
+}
+
+// preserve hands the documents rec is about to change, as they are now, to
+// every open transaction that has not been handed them yet. Callers must
+// hold mu for writing.
+func (s *DocumentStore) preserve(rec walRecord) {
+	if len(s.transactions) == 0 {
+		return
+	}
+	if rec.Op == walOpBatch {
+		for _, item := range rec.Batch {
+			s.preserve(item)
+		}
+		return
+	}
+	if rec.Op != walOpPut && rec.Op != walOpDelete {
+		return
+	}
+	var preimage *Document
+	if doc, ok := s.documents[rec.ID]; ok {
+		preimage = &doc
+	}
+	for tx := range s.transactions {
+		if _, ok := tx.preimages[rec.ID]; !ok {
+			tx.preimages[rec.ID] = preimage
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreContract_Transactions(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			store.Create(ctx, Document{ID: "a", Name: "Alpha"})
+			store.Create(ctx, Document{ID: "b", Name: "Beta"})
+
+			t.Run("Snapshot", func(t *testing.T) {
+				tx, err := store.Begin(ctx)
+				if err != nil {
+					t.Fatalf("Begin() failed: %v", err)
+				}
+				defer tx.Rollback()
+				store.PartialUpdate(ctx, "a", map[string]interface{}{"name": "Alpha 2"})
+				store.Create(ctx, Document{ID: "later"})
+
+				if doc, err := tx.Get(ctx, "a"); err != nil || doc.Name != "Alpha" || doc.Version != 1 {
+					t.Errorf("Get(a) in the transaction = %+v, %v; want the snapshot", doc, err)
+				}
+				if _, err := tx.Get(ctx, "later"); !errors.Is(err, ErrDocumentNotFound) {
+					t.Errorf("expected a document created later to be invisible, got %v", err)
+				}
+			})
+
+			t.Run("Own writes", func(t *testing.T) {
+				tx, _ := store.Begin(ctx)
+				if err := tx.Create(ctx, Document{ID: "c", Name: "Gamma"}); err != nil {
+					t.Fatalf("Create() failed: %v", err)
+				}
+				merge, _ := ParseMergePatch([]byte(`{"description": "patched"}`))
+				if err := tx.Patch(ctx, "c", merge, IfMatch(1)); err != nil {
+					t.Fatalf("Patch() failed: %v", err)
+				}
+				if err := tx.Delete(ctx, "b"); err != nil {
+					t.Fatalf("Delete() failed: %v", err)
+				}
+				if err := tx.Update(ctx, "b", Document{}); !errors.Is(err, ErrDocumentNotFound) {
+					t.Errorf("expected the deleted document to be gone, got %v", err)
+				}
+				if err := tx.Create(ctx, Document{ID: "a"}); !errors.Is(err, ErrDocumentExists) {
+					t.Errorf("expected ErrDocumentExists, got %v", err)
+				}
+				if err := tx.Update(ctx, "a", Document{}, IfMatch(7)); !errors.Is(err, ErrPreconditionFailed) {
+					t.Errorf("expected ErrPreconditionFailed, got %v", err)
+				}
+				if doc, err := tx.Get(ctx, "c"); err != nil || doc.Description != "patched" {
+					t.Errorf("Get(c) in the transaction = %+v, %v", doc, err)
+				}
+				if _, err := store.Get(ctx, "c"); !errors.Is(err, ErrDocumentNotFound) {
+					t.Errorf("expected uncommitted writes to be invisible, got %v", err)
+				}
+
+				if err := tx.Commit(ctx); err != nil {
+					t.Fatalf("Commit() failed: %v", err)
+				}
+				if doc, err := store.Get(ctx, "c"); err != nil || doc.Version != 2 || doc.Description != "patched" {
+					t.Errorf("Get(c) = %+v, %v", doc, err)
+				}
+				if _, err := store.Get(ctx, "b"); !errors.Is(err, ErrDocumentNotFound) {
+					t.Errorf("expected b to be deleted, got %v", err)
+				}
+				if found, _ := store.Search(ctx, "gamma", 10); found.Total != 1 {
+					t.Errorf("expected the committed document to be searchable, got %+v", found)
+				}
+				if err := tx.Commit(ctx); !errors.Is(err, ErrTxDone) {
+					t.Errorf("expected ErrTxDone, got %v", err)
+				}
+				if _, err := tx.Get(ctx, "c"); !errors.Is(err, ErrTxDone) {
+					t.Errorf("expected ErrTxDone, got %v", err)
+				}
+			})
+
+			t.Run("Conflicts", func(t *testing.T) {
+				first, _ := store.Begin(ctx)
+				second, _ := store.Begin(ctx)
+				first.Update(ctx, "a", Document{Name: "First"})
+				second.Update(ctx, "a", Document{Name: "Second"})
+				if err := first.Commit(ctx); err != nil {
+					t.Fatalf("Commit() failed: %v", err)
+				}
+				if err := second.Commit(ctx); !errors.Is(err, ErrTxConflict) {
+					t.Errorf("expected ErrTxConflict, got %v", err)
+				}
+				if doc, _ := store.Get(ctx, "a"); doc.Name != "First" {
+					t.Errorf("expected the first commit to win, got %+v", doc)
+				}
+
+				// Creating what someone else created meanwhile conflicts too
+				tx, _ := store.Begin(ctx)
+				tx.Create(ctx, Document{ID: "d"})
+				store.Create(ctx, Document{ID: "d"})
+				if err := tx.Commit(ctx); !errors.Is(err, ErrTxConflict) {
+					t.Errorf("expected ErrTxConflict, got %v", err)
+				}
+
+				// Documents only read are not checked
+				tx, _ = store.Begin(ctx)
+				tx.Get(ctx, "d")
+				tx.Update(ctx, "c", Document{Name: "Gamma 2"})
+				store.PartialUpdate(ctx, "d", map[string]interface{}{"name": "Delta"})
+				if err := tx.Commit(ctx); err != nil {
+					t.Errorf("Commit() after a read document changed = %v", err)
+				}
+			})
+
+			t.Run("Rollback", func(t *testing.T) {
+				tx, _ := store.Begin(ctx)
+				tx.Delete(ctx, "a")
+				if err := tx.Rollback(); err != nil {
+					t.Fatalf("Rollback() failed: %v", err)
+				}
+				if _, err := store.Get(ctx, "a"); err != nil {
+					t.Errorf("expected a to survive the rollback, got %v", err)
+				}
+				if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+					t.Errorf("expected ErrTxDone, got %v", err)
+				}
+			})
+
+			t.Run("Context done", func(t *testing.T) {
+				txCtx, cancel := context.WithCancel(ctx)
+				tx, _ := store.Begin(txCtx)
+				tx.Delete(ctx, "a")
+				cancel()
+				if _, err := tx.Get(ctx, "b"); !errors.Is(err, context.Canceled) {
+					t.Errorf("expected context.Canceled from Get, got %v", err)
+				}
+				if err := tx.Commit(ctx); !errors.Is(err, context.Canceled) {
+					t.Errorf("expected context.Canceled from Commit, got %v", err)
+				}
+				if _, err := store.Get(ctx, "a"); err != nil {
+					t.Errorf("expected nothing to be applied, got %v", err)
+				}
+			})
+
+			t.Run("Commit validates", func(t *testing.T) {
+				tx, _ := store.Begin(ctx)
+				tx.Create(ctx, Document{ID: "e", Type: "memo"})
+				tx.Delete(ctx, "a")
+				store.PutSchema(ctx, "memo", json.RawMessage(`{"required": ["author"]}`))
+				if err := tx.Commit(ctx); !errors.Is(err, ErrValidation) {
+					t.Errorf("expected ErrValidation, got %v", err)
+				}
+				if _, err := store.Get(ctx, "a"); err != nil {
+					t.Errorf("expected nothing to be applied, got %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestStoreContract_TransactionAccess(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			alice := WithActor(context.Background(), "alice")
+			for _, id := range []string{"private", "shared", "readonly"} {
+				store.Create(alice, Document{ID: id, Name: "Alice's"})
+			}
+			store.GrantAccess(alice, "shared", "user:bob", AccessWrite)
+			store.GrantAccess(alice, "readonly", "user:bob", AccessRead)
+
+			bob := WithViewer(WithActor(context.Background(), "bob"), Viewer{Username: "bob"})
+			tx, err := store.Begin(bob)
+			if err != nil {
+				t.Fatalf("Begin() failed: %v", err)
+			}
+			defer tx.Rollback()
+
+			if _, err := tx.Get(bob, "private"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("Get(private) = %v, want ErrDocumentNotFound", err)
+			}
+			if err := tx.Update(bob, "private", Document{Name: "Bob's"}); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("Update(private) = %v, want ErrDocumentNotFound", err)
+			}
+			if err := tx.Delete(bob, "private"); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("Delete(private) = %v, want ErrDocumentNotFound", err)
+			}
+			if err := tx.Create(bob, Document{ID: "private"}); !errors.Is(err, ErrDocumentExists) {
+				t.Errorf("Create(private) = %v, want ErrDocumentExists", err)
+			}
+			if _, err := tx.Get(bob, "readonly"); err != nil {
+				t.Errorf("Get(readonly) failed: %v", err)
+			}
+			merge, _ := ParseMergePatch([]byte(`{"description": "Bob's"}`))
+			if err := tx.Patch(bob, "readonly", merge); !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("Patch(readonly) = %v, want ErrAccessDenied", err)
+			}
+			if err := tx.Delete(bob, "shared"); err != nil {
+				t.Errorf("Delete(shared) failed: %v", err)
+			}
+			// Documents the transaction wrote are the viewer's to use
+			if err := tx.Create(bob, Document{ID: "shared", Name: "Bob's"}); err != nil {
+				t.Errorf("Create(shared) failed: %v", err)
+			}
+			if err := tx.Update(bob, "shared", Document{Name: "Bob's v2"}); err != nil {
+				t.Errorf("Update(shared) failed: %v", err)
+			}
+			if doc, err := tx.Get(bob, "shared"); err != nil || doc.Name != "Bob's v2" {
+				t.Errorf("Get(shared) = %+v, %v", doc, err)
+			}
+			if err := tx.Commit(bob); err != nil {
+				t.Fatalf("Commit() failed: %v", err)
+			}
+			if doc, _ := store.Get(alice, "private"); doc.Name != "Alice's" {
+				t.Errorf("expected alice's document to be left alone, got %+v", doc)
+			}
+			if acl, err := store.GetACL(alice, "shared"); err != nil || acl.Owner != "bob" {
+				t.Errorf("GetACL() of the recreated document = %+v, %v", acl, err)
+			}
+		})
+	}
+}
+
+// TestStoreTransactions_Concurrent increments a counter from concurrent
+// transactions, retrying on conflicts; no increment may be lost
+func TestStoreTransactions_Concurrent(t *testing.T) {
+	const workers, increments = 4, 10
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := context.Background()
+			store.Create(ctx, Document{ID: "counter", Name: "0"})
+
+			increment := func() error {
+				for {
+					tx, err := store.Begin(ctx)
+					if err != nil {
+						return err
+					}
+					doc, err := tx.Get(ctx, "counter")
+					if err != nil {
+						tx.Rollback()
+						return err
+					}
+					n, _ := strconv.Atoi(doc.Name)
+					tx.Update(ctx, "counter", Document{Name: strconv.Itoa(n + 1)})
+					err = tx.Commit(ctx)
+					if !errors.Is(err, ErrTxConflict) {
+						return err
+					}
+				}
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, workers*increments)
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < increments; i++ {
+						if err := increment(); err != nil {
+							errs <- err
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatalf("increment failed: %v", err)
+			}
+			if doc, _ := store.Get(ctx, "counter"); doc.Name != strconv.Itoa(workers*increments) {
+				t.Errorf("counter = %s, want %d", doc.Name, workers*increments)
+			}
+		})
+	}
+}
+
+func TestDocumentStore_AbandonedTransaction(t *testing.T) {
+	store := NewDocumentStore()
+	ctx := context.Background()
+	store.Create(ctx, Document{ID: "a"})
+
+	// A transaction dropped without Commit or Rollback is let go once its
+	// context is done, and no longer collects what writes replace
+	txCtx, cancel := context.WithCancel(ctx)
+	tx, _ := store.Begin(txCtx)
+	store.Update(ctx, "a", Document{Name: "A"})
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		store.mu.RLock()
+		open := len(store.transactions)
+		store.mu.RUnlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the abandoned transaction to be released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	store.Update(ctx, "a", Document{Name: "A2"})
+	if preimages := tx.(*memTx).preimages; preimages != nil {
+		t.Errorf("expected the abandoned transaction to drop its preimages, got %v", preimages)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Rollback() of an abandoned transaction = %v", err)
+	}
+
+	// Finished transactions stop watching their context
+	tx, _ = store.Begin(ctx)
+	tx.Commit(ctx)
+	if tx.(*memTx).stop() {
+		t.Error("expected Commit to unregister the transaction from its context")
+	}
+}
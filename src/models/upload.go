@@ -0,0 +1,491 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUploadNotFound is returned for unknown, finished or expired upload sessions
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffset is returned when a chunk does not start where the upload left off
+	ErrUploadOffset = errors.New("upload offset does not match")
+	// ErrUploadBusy is returned while another request is writing to the same upload
+	ErrUploadBusy = errors.New("upload is being written by another request")
+	// ErrUploadTooLarge is returned for chunks extending past the declared size
+	ErrUploadTooLarge = errors.New("upload exceeds its declared size")
+	// ErrUploadIncomplete is returned when completing an upload before all bytes arrived
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	// ErrChecksumMismatch is returned when the assembled content does not
+	// have the expected SHA-256
+	ErrChecksumMismatch = errors.New("upload checksum does not match")
+	// ErrInvalidUpload is returned for malformed upload parameters
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrUploadInterrupted is returned when reading a chunk fails part way;
+	// the bytes received before the failure are kept
+	ErrUploadInterrupted = errors.New("upload interrupted")
+)
+
+// Upload session files in an UploadStore directory
+const (
+	uploadDataSuffix = ".part"
+	uploadMetaSuffix = ".json"
+)
+
+// UploadParams describes an upload when its session is created. Size and
+// SHA256 are optional; when given they are enforced.
+type UploadParams struct {
+	ContentType string `json:"content_type"`
+	Size        *int64 `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// UploadSession is a resumable upload of a document's content. Offset is
+// the number of bytes received so far, which is where the next chunk starts.
+type UploadSession struct {
+	ID          string    `json:"id"`
+	DocumentID  string    `json:"document_id"`
+	ContentType string    `json:"content_type"`
+	Size        *int64    `json:"size,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Offset      int64     `json:"offset"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// uploadRecord is the on-disk form of a session. HashState is the running
+// SHA-256 of the bytes received, so resuming never re-reads them.
+type uploadRecord struct {
+	UploadSession
+	HashState []byte `json:"hash_state"`
+}
+
+// upload is a session loaded in memory. mu serialises writers, which also
+// take the store lock to replace record so readers can use either lock.
+type upload struct {
+	mu     sync.Mutex
+	record uploadRecord
+}
+
+// UploadStore keeps resumable upload sessions in a directory: the bytes
+// received so far in <id>.part and the session in <id>.json. Sessions expire
+// after a period without activity and are garbage-collected in the background.
+type UploadStore struct {
+	dir string
+	ttl time.Duration
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewUploadStore opens the sessions kept in dir. Expired sessions are swept
+// every gcInterval; a zero interval disables the background sweep.
+func NewUploadStore(dir string, ttl, gcInterval time.Duration) (*UploadStore, error) {
+	if ttl <= 0 {
+		return nil, errors.New("upload session ttl must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create upload directory: %w", err)
+	}
+
+	s := &UploadStore{dir: dir, ttl: ttl, uploads: make(map[string]*upload), stop: make(chan struct{})}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if gcInterval > 0 {
+		s.wg.Add(1)
+		go s.background(gcInterval)
+	}
+	return s, nil
+}
+
+// load reads the sessions left by a previous run
+func (s *UploadStore) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read upload directory: %w", err)
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), uploadMetaSuffix)
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read upload %s: %w", id, err)
+		}
+		var rec uploadRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			log.Printf("Discarding unreadable upload session %s: %v", id, err)
+			s.removeFiles(id)
+			continue
+		}
+		s.uploads[id] = &upload{record: rec}
+	}
+
+	// Data files without a session are left over from a crash in Create
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), uploadDataSuffix)
+		if ok && s.uploads[id] == nil {
+			s.removeFiles(id)
+		}
+	}
+	return nil
+}
+
+func (s *UploadStore) dataPath(id string) string { return filepath.Join(s.dir, id+uploadDataSuffix) }
+func (s *UploadStore) metaPath(id string) string { return filepath.Join(s.dir, id+uploadMetaSuffix) }
+
+func (s *UploadStore) removeFiles(id string) {
+	for _, path := range []string{s.dataPath(id), s.metaPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+// save persists the session record. Callers must hold the upload's lock.
+func (s *UploadStore) save(rec uploadRecord) error {
+	return writeFileAtomic(s.metaPath(rec.ID), rec)
+}
+
+// Create starts an upload session for a document
+func (s *UploadStore) Create(ctx context.Context, documentID string, params UploadParams) (UploadSession, error) {
+	if err := ctx.Err(); err != nil {
+		return UploadSession{}, err
+	}
+	if params.Size != nil && *params.Size < 0 {
+		return UploadSession{}, fmt.Errorf("%w: size must not be negative", ErrInvalidUpload)
+	}
+	if params.SHA256 != "" && !isSHA256Hex(params.SHA256) {
+		return UploadSession{}, fmt.Errorf("%w: sha256 must be 64 hexadecimal digits", ErrInvalidUpload)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return UploadSession{}, err
+	}
+	state, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return UploadSession{}, err
+	}
+	now := time.Now().UTC()
+	rec := uploadRecord{
+		UploadSession: UploadSession{
+			ID:          id.String(),
+			DocumentID:  documentID,
+			ContentType: params.ContentType,
+			Size:        params.Size,
+			SHA256:      strings.ToLower(params.SHA256),
+			CreatedBy:   ActorFromContext(ctx),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.ttl),
+		},
+		HashState: state,
+	}
+
+	f, err := os.OpenFile(s.dataPath(rec.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return UploadSession{}, fmt.Errorf("create upload: %w", err)
+	}
+	f.Close()
+	if err := s.save(rec); err != nil {
+		s.removeFiles(rec.ID)
+		return UploadSession{}, fmt.Errorf("create upload: %w", err)
+	}
+
+	s.mu.Lock()
+	s.uploads[rec.ID] = &upload{record: rec}
+	s.mu.Unlock()
+	return rec.UploadSession, nil
+}
+
+// lookup finds a live session of documentID. Expired sessions are not
+// live even before the garbage collector gets to them.
+func (s *UploadStore) lookup(documentID, id string) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok || u.record.DocumentID != documentID || !u.record.ExpiresAt.After(time.Now()) {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+// acquire locks a live session for writing, failing fast if it is busy
+func (s *UploadStore) acquire(documentID, id string) (*upload, error) {
+	u, err := s.lookup(documentID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.mu.TryLock() {
+		return nil, ErrUploadBusy
+	}
+	// The session may have been finished or collected since the lookup
+	if _, err := s.lookup(documentID, id); err != nil {
+		u.mu.Unlock()
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get returns the state of a session. While a chunk is streaming in, the
+// offset is the one the chunk started from.
+func (s *UploadStore) Get(ctx context.Context, documentID, id string) (UploadSession, error) {
+	if err := ctx.Err(); err != nil {
+		return UploadSession{}, err
+	}
+	u, err := s.lookup(documentID, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return u.record.UploadSession, nil
+}
+
+// Append writes a chunk that must start at offset, the number of bytes
+// received so far. If the chunk is cut short, the bytes that did arrive are
+// kept, so the client can resume from the returned offset.
+func (s *UploadStore) Append(ctx context.Context, documentID, id string, offset int64, r io.Reader) (UploadSession, error) {
+	if err := ctx.Err(); err != nil {
+		return UploadSession{}, err
+	}
+	u, err := s.acquire(documentID, id)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	defer u.mu.Unlock()
+
+	rec := u.record
+	if offset != rec.Offset {
+		return rec.UploadSession, fmt.Errorf("%w: upload is at offset %d", ErrUploadOffset, rec.Offset)
+	}
+
+	h, err := restoreHash(rec.HashState)
+	if err != nil {
+		return rec.UploadSession, err
+	}
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return rec.UploadSession, fmt.Errorf("open upload: %w", err)
+	}
+	defer f.Close()
+	// Drop bytes beyond the recorded offset left by a crash mid-chunk
+	if err := f.Truncate(rec.Offset); err != nil {
+		return rec.UploadSession, fmt.Errorf("truncate upload: %w", err)
+	}
+	if _, err := f.Seek(rec.Offset, io.SeekStart); err != nil {
+		return rec.UploadSession, fmt.Errorf("seek upload: %w", err)
+	}
+
+	src := &readErrRecorder{r: r}
+	limited := io.Reader(src)
+	if rec.Size != nil {
+		// Read one byte past the declared size to detect oversized chunks
+		limited = io.LimitReader(src, *rec.Size-rec.Offset+1)
+	}
+	n, err := io.Copy(io.MultiWriter(f, h), limited)
+	if rec.Size != nil && rec.Offset+n > *rec.Size {
+		f.Truncate(rec.Offset)
+		return rec.UploadSession, fmt.Errorf("%w of %d bytes", ErrUploadTooLarge, *rec.Size)
+	}
+	if err != nil && src.err == nil {
+		// Writing failed, so the received bytes cannot be trusted
+		f.Truncate(rec.Offset)
+		return rec.UploadSession, fmt.Errorf("write upload: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return rec.UploadSession, fmt.Errorf("sync upload: %w", err)
+	}
+
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return rec.UploadSession, err
+	}
+	rec.Offset += n
+	rec.HashState = state
+	rec.ExpiresAt = time.Now().UTC().Add(s.ttl)
+	if err := s.save(rec); err != nil {
+		return u.record.UploadSession, fmt.Errorf("save upload: %w", err)
+	}
+
+	s.mu.Lock()
+	u.record = rec
+	s.mu.Unlock()
+	if src.err != nil {
+		return rec.UploadSession, fmt.Errorf("%w at offset %d: %v", ErrUploadInterrupted, rec.Offset, src.err)
+	}
+	return rec.UploadSession, nil
+}
+
+// readErrRecorder remembers the error of the reader it wraps, telling
+// failures of the client apart from failures to store what it sent
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// Complete verifies that an upload is whole and matches its checksum, then
+// hands its bytes to attach. expectedSHA256, if set, is checked in addition
+// to the checksum declared at creation. The session ends once attach succeeds.
+func (s *UploadStore) Complete(ctx context.Context, documentID, id, expectedSHA256 string,
+	attach func(session UploadSession, content io.Reader) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if expectedSHA256 != "" && !isSHA256Hex(expectedSHA256) {
+		return fmt.Errorf("%w: sha256 must be 64 hexadecimal digits", ErrInvalidUpload)
+	}
+	u, err := s.acquire(documentID, id)
+	if err != nil {
+		return err
+	}
+	defer u.mu.Unlock()
+
+	rec := u.record
+	if rec.Size != nil && rec.Offset != *rec.Size {
+		return fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, rec.Offset, *rec.Size)
+	}
+	h, err := restoreHash(rec.HashState)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	for _, expected := range []string{rec.SHA256, expectedSHA256} {
+		if expected != "" && !strings.EqualFold(expected, sum) {
+			return fmt.Errorf("%w: received content has sha256 %s", ErrChecksumMismatch, sum)
+		}
+	}
+
+	f, err := os.Open(s.dataPath(id))
+	if err != nil {
+		return fmt.Errorf("open upload: %w", err)
+	}
+	err = attach(rec.UploadSession, io.LimitReader(f, rec.Offset))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	s.forget(id)
+	return nil
+}
+
+// Cancel ends a session and discards its bytes
+func (s *UploadStore) Cancel(ctx context.Context, documentID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u, err := s.acquire(documentID, id)
+	if err != nil {
+		return err
+	}
+	defer u.mu.Unlock()
+	s.forget(id)
+	return nil
+}
+
+// forget drops a session. Callers must hold the upload's lock.
+func (s *UploadStore) forget(id string) {
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	s.removeFiles(id)
+}
+
+// CollectGarbage removes the sessions that expired before now, skipping any
+// being written to, and returns how many were removed
+func (s *UploadStore) CollectGarbage(now time.Time) int {
+	s.mu.Lock()
+	var expired []string
+	for id, u := range s.uploads {
+		if u.record.ExpiresAt.Before(now) {
+			expired = append(expired, id)
+		}
+	}
+	s.mu.Unlock()
+
+	removed := 0
+	for _, id := range expired {
+		s.mu.Lock()
+		u, ok := s.uploads[id]
+		s.mu.Unlock()
+		if !ok || !u.mu.TryLock() {
+			continue
+		}
+		if u.record.ExpiresAt.Before(now) {
+			s.forget(id)
+			removed++
+		}
+		u.mu.Unlock()
+	}
+	return removed
+}
+
+// background sweeps expired sessions until Close
+func (s *UploadStore) background(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			if n := s.CollectGarbage(now); n > 0 {
+				log.Printf("Removed %d expired upload sessions", n)
+			}
+		}
+	}
+}
+
+// Close stops the background sweep. Sessions stay on disk to be resumed.
+func (s *UploadStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+	})
+	return nil
+}
+
+func restoreHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("restore upload checksum: %w", err)
+	}
+	return h, nil
+}
+
+func isSHA256Hex(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
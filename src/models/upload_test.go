@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestUploadStore(t *testing.T, dir string) *UploadStore {
+	t.Helper()
+	uploads, err := NewUploadStore(dir, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("NewUploadStore() failed: %v", err)
+	}
+	return uploads
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// collect completes an upload and returns the bytes handed to attach
+func collect(t *testing.T, uploads *UploadStore, documentID, id, expected string) (string, error) {
+	t.Helper()
+	var got string
+	err := uploads.Complete(context.Background(), documentID, id, expected, func(_ UploadSession, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		got = string(data)
+		return err
+	})
+	return got, err
+}
+
+// failingReader returns some bytes and then an error, like a dropped connection
+type failingReader struct {
+	data string
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("connection reset")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestUploadStore_ChunkedUpload(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	dir := t.TempDir()
+	uploads := openTestUploadStore(t, dir)
+
+	body := "first chunk|second chunk|third"
+	size := int64(len(body))
+	session, err := uploads.Create(ctx, "doc-1", UploadParams{ContentType: "text/plain", Size: &size, SHA256: strings.ToUpper(sha256Hex(body))})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if session.Offset != 0 || session.CreatedBy != "alice" || session.SHA256 != sha256Hex(body) {
+		t.Errorf("Create() = %+v", session)
+	}
+
+	session, err = uploads.Append(ctx, "doc-1", session.ID, 0, strings.NewReader(body[:12]))
+	if err != nil || session.Offset != 12 {
+		t.Fatalf("Append() = %+v, %v", session, err)
+	}
+	if _, err := uploads.Append(ctx, "doc-1", session.ID, 0, strings.NewReader("again")); !errors.Is(err, ErrUploadOffset) {
+		t.Errorf("expected ErrUploadOffset for a replayed chunk, got %v", err)
+	}
+	if _, err := collect(t, uploads, "doc-1", session.ID, ""); !errors.Is(err, ErrUploadIncomplete) {
+		t.Errorf("expected ErrUploadIncomplete, got %v", err)
+	}
+
+	// A dropped connection keeps what arrived
+	session, err = uploads.Append(ctx, "doc-1", session.ID, 12, &failingReader{data: body[12:20]})
+	if !errors.Is(err, ErrUploadInterrupted) || session.Offset != 20 {
+		t.Errorf("interrupted Append() = %+v, %v", session, err)
+	}
+
+	// Sessions, and the hash of what has arrived, survive a restart
+	uploads.Close()
+	uploads = openTestUploadStore(t, dir)
+	defer uploads.Close()
+	session, err = uploads.Get(ctx, "doc-1", session.ID)
+	if err != nil || session.Offset != 20 {
+		t.Fatalf("Get() after reopen = %+v, %v", session, err)
+	}
+
+	if _, err := uploads.Append(ctx, "doc-1", session.ID, 20, strings.NewReader(body[20:]+"overflow")); !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("expected ErrUploadTooLarge, got %v", err)
+	}
+	if session, _ = uploads.Get(ctx, "doc-1", session.ID); session.Offset != 20 {
+		t.Errorf("oversized chunk moved the offset to %d", session.Offset)
+	}
+	if _, err := uploads.Append(ctx, "doc-1", session.ID, 20, strings.NewReader(body[20:])); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+
+	if _, err := collect(t, uploads, "doc-1", session.ID, sha256Hex("something else")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := collect(t, uploads, "doc-2", session.ID, ""); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected ErrUploadNotFound for another document, got %v", err)
+	}
+
+	// A failed attach leaves the session to be retried
+	failed := uploads.Complete(ctx, "doc-1", session.ID, "", func(UploadSession, io.Reader) error { return ErrPreconditionFailed })
+	if !errors.Is(failed, ErrPreconditionFailed) {
+		t.Errorf("expected the attach error, got %v", failed)
+	}
+	got, err := collect(t, uploads, "doc-1", session.ID, sha256Hex(body))
+	if err != nil || got != body {
+		t.Fatalf("Complete() = %q, %v", got, err)
+	}
+	if _, err := uploads.Get(ctx, "doc-1", session.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected the completed session to be gone, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected an empty upload directory, found %d entries", len(entries))
+	}
+}
+
+func TestUploadStore_UnknownSize(t *testing.T) {
+	ctx := context.Background()
+	uploads := openTestUploadStore(t, t.TempDir())
+	defer uploads.Close()
+
+	session, _ := uploads.Create(ctx, "doc-1", UploadParams{})
+	uploads.Append(ctx, "doc-1", session.ID, 0, strings.NewReader("no size "))
+	uploads.Append(ctx, "doc-1", session.ID, 8, strings.NewReader("declared"))
+	if got, err := collect(t, uploads, "doc-1", session.ID, ""); err != nil || got != "no size declared" {
+		t.Errorf("Complete() = %q, %v", got, err)
+	}
+}
+
+func TestUploadStore_InvalidParams(t *testing.T) {
+	ctx := context.Background()
+	uploads := openTestUploadStore(t, t.TempDir())
+	defer uploads.Close()
+
+	negative := int64(-1)
+	for name, params := range map[string]UploadParams{
+		"negative size": {Size: &negative},
+		"bad sha256":    {SHA256: "abc"},
+	} {
+		if _, err := uploads.Create(ctx, "doc-1", params); !errors.Is(err, ErrInvalidUpload) {
+			t.Errorf("%s: expected ErrInvalidUpload, got %v", name, err)
+		}
+	}
+	session, _ := uploads.Create(ctx, "doc-1", UploadParams{})
+	if _, err := collect(t, uploads, "doc-1", session.ID, "not-hex"); !errors.Is(err, ErrInvalidUpload) {
+		t.Errorf("expected ErrInvalidUpload for a bad expected sha256, got %v", err)
+	}
+}
+
+func TestUploadStore_CancelAndExpire(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	uploads := openTestUploadStore(t, dir)
+	defer uploads.Close()
+
+	cancelled, _ := uploads.Create(ctx, "doc-1", UploadParams{})
+	if err := uploads.Cancel(ctx, "doc-1", cancelled.ID); err != nil {
+		t.Fatalf("Cancel() failed: %v", err)
+	}
+	if err := uploads.Cancel(ctx, "doc-1", cancelled.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected ErrUploadNotFound, got %v", err)
+	}
+
+	abandoned, _ := uploads.Create(ctx, "doc-1", UploadParams{})
+	uploads.Append(ctx, "doc-1", abandoned.ID, 0, strings.NewReader("partial"))
+	active, _ := uploads.Create(ctx, "doc-1", UploadParams{})
+
+	// Sessions expire ttl after their last chunk
+	if n := uploads.CollectGarbage(time.Now()); n != 0 {
+		t.Errorf("CollectGarbage() removed %d live sessions", n)
+	}
+	later := time.Now().Add(2 * time.Hour)
+	uploads.mu.Lock()
+	uploads.uploads[active.ID].record.ExpiresAt = later.Add(time.Hour)
+	uploads.mu.Unlock()
+	if n := uploads.CollectGarbage(later); n != 1 {
+		t.Errorf("CollectGarbage() removed %d sessions, want 1", n)
+	}
+	if _, err := uploads.Get(ctx, "doc-1", abandoned.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expected the abandoned session to be gone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, abandoned.ID+uploadDataSuffix)); !os.IsNotExist(err) {
+		t.Errorf("abandoned upload data was not removed")
+	}
+	if _, err := uploads.Get(ctx, "doc-1", active.ID); err != nil {
+		t.Errorf("active session was collected: %v", err)
+	}
+}
+
+func TestUploadStore_LoadCleansUp(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "orphan"+uploadDataSuffix), []byte("left by a crash"), 0o640)
+	os.WriteFile(filepath.Join(dir, "corrupt"+uploadMetaSuffix), []byte("{"), 0o640)
+
+	uploads := openTestUploadStore(t, dir)
+	defer uploads.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected leftovers to be removed, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxUsernameLength bounds the name of a user, and of a group
+const MaxUsernameLength = 64
+
+// MaxUserGroups bounds the number of groups a user belongs to
+const MaxUserGroups = 64
+
+// Roles a user can have, from least to most privileged
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var (
+	// ErrUserNotFound is returned when no user exists for the given name
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose name is taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidUsername is returned for malformed user names
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrInvalidRole is returned for roles other than reader, editor and
+	// admin
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrInvalidGroup is returned for malformed group names
+	ErrInvalidGroup = errors.New("invalid group")
+)
+
+// User is an account that can log in. The store keeps the password hash
+// alone; it is never rendered as JSON.
+type User struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	Disabled     bool   `json:"disabled"`
+	// Groups are the groups the user belongs to, which documents can be
+	// shared with. Stores keep them sorted and deduplicated.
+	Groups    []string  `json:"groups"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreatedBy string    `json:"created_by"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// storedUser is a User as the durable backends persist it, password hash
+// included
+type storedUser struct {
+	User
+	PasswordHash string `json:"password_hash"`
+}
+
+func newStoredUser(user User) *storedUser {
+	return &storedUser{User: user, PasswordHash: user.PasswordHash}
+}
+
+func (u storedUser) user() User {
+	user := u.User
+	user.PasswordHash = u.PasswordHash
+	// Users stored before roles existed are readers
+	if user.Role == "" {
+		user.Role = RoleReader
+	}
+	if user.Groups == nil {
+		user.Groups = []string{}
+	}
+	return user
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	switch role {
+	case RoleReader, RoleEditor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// checkUsername accepts 1-64 letters, digits, '-', '_', '.' and '@'
+func checkUsername(name string) error {
+	return checkAccountName(ErrInvalidUsername, name)
+}
+
+// checkGroupName accepts the same names as checkUsername
+func checkGroupName(name string) error {
+	return checkAccountName(ErrInvalidGroup, name)
+}
+
+// checkAccountName checks a user or group name, failing with invalid
+func checkAccountName(invalid error, name string) error {
+	if name == "" || len(name) > MaxUsernameLength {
+		return fmt.Errorf("%w: must be 1 to %d characters", invalid, MaxUsernameLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '-' || r == '_' || r == '.' || r == '@') {
+			return fmt.Errorf("%w: %q may only contain letters, digits, '-', '_', '.' and '@'", invalid, name)
+		}
+	}
+	return nil
+}
+
+// normalizeGroups checks the group names and returns them sorted and
+// deduplicated, never nil
+func normalizeGroups(groups []string) ([]string, error) {
+	if len(groups) > MaxUserGroups {
+		return nil, fmt.Errorf("%w: a user belongs to at most %d groups", ErrInvalidGroup, MaxUserGroups)
+	}
+	for _, group := range groups {
+		if err := checkGroupName(group); err != nil {
+			return nil, err
+		}
+	}
+	if len(groups) == 0 {
+		return []string{}, nil
+	}
+	return sortedSet(groups), nil
+}
+
+// newUser prepares user to be stored, as a new account if current is nil
+// and otherwise as the next state of current, whose name and creation it
+// keeps. Users without a role are readers.
+func newUser(ctx context.Context, user User, current *User) (User, error) {
+	if err := checkUsername(user.Username); err != nil {
+		return User{}, err
+	}
+	if user.Role == "" {
+		user.Role = RoleReader
+	}
+	if !ValidRole(user.Role) {
+		return User{}, fmt.Errorf("%w: %q must be %s, %s or %s", ErrInvalidRole, user.Role, RoleReader, RoleEditor, RoleAdmin)
+	}
+	groups, err := normalizeGroups(user.Groups)
+	if err != nil {
+		return User{}, err
+	}
+	user.Groups = groups
+	now, actor := time.Now().UTC(), ActorFromContext(ctx)
+	user.UpdatedAt, user.UpdatedBy = now, actor
+	if current != nil {
+		user.CreatedAt, user.CreatedBy = current.CreatedAt, current.CreatedBy
+	} else {
+		user.CreatedAt, user.CreatedBy = now, actor
+	}
+	return user, nil
+}
+
+// sortUsers orders users by name
+func sortUsers(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+}
+
+func (s *DocumentStore) CreateUser(ctx context.Context, user User) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Username]; ok {
+		return User{}, ErrUserExists
+	}
+	created, err := newUser(ctx, user, nil)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.commit(walRecord{Op: walOpPutUser, ID: created.Username, User: newStoredUser(created)}); err != nil {
+		return User{}, err
+	}
+	return created, nil
+}
+
+func (s *DocumentStore) GetUser(ctx context.Context, username string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *DocumentStore) ListUsers(ctx context.Context) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sortUsers(users)
+	return users, nil
+}
+
+func (s *DocumentStore) UpdateUser(ctx context.Context, user User) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[user.Username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	updated, err := newUser(ctx, user, &current)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.commit(walRecord{Op: walOpPutUser, ID: updated.Username, User: newStoredUser(updated)}); err != nil {
+		return User{}, err
+	}
+	return updated, nil
+}
+
+func (s *DocumentStore) DeleteUser(ctx context.Context, username string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return ErrUserNotFound
+	}
+	return s.commit(walRecord{Op: walOpDeleteUser, ID: username})
+}
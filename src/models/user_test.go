@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreContract_Users(t *testing.T) {
+	for backend, open := range storeFactories() {
+		t.Run(backend, func(t *testing.T) {
+			store := open(t)
+			ctx := WithActor(context.Background(), "admin")
+
+			user, err := store.CreateUser(ctx, User{Username: "bob", PasswordHash: "hash-1"})
+			if err != nil || user.CreatedBy != "admin" || user.CreatedAt.IsZero() || user.PasswordHash != "hash-1" {
+				t.Fatalf("CreateUser() = %+v, %v", user, err)
+			}
+			if _, err := store.CreateUser(ctx, User{Username: "bob"}); !errors.Is(err, ErrUserExists) {
+				t.Errorf("expected ErrUserExists, got %v", err)
+			}
+			if _, err := store.CreateUser(ctx, User{Username: "bad name"}); !errors.Is(err, ErrInvalidUsername) {
+				t.Errorf("expected ErrInvalidUsername, got %v", err)
+			}
+			if _, err := store.CreateUser(ctx, User{Username: "carol", Role: "owner"}); !errors.Is(err, ErrInvalidRole) {
+				t.Errorf("expected ErrInvalidRole, got %v", err)
+			}
+			store.CreateUser(ctx, User{Username: "alice@example.com", PasswordHash: "hash-2"})
+
+			if got, err := store.GetUser(ctx, "bob"); err != nil || got.PasswordHash != "hash-1" || got.Role != RoleReader || got.Disabled {
+				t.Errorf("GetUser() = %+v, %v", got, err)
+			}
+			if _, err := store.GetUser(ctx, "carol"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("expected ErrUserNotFound, got %v", err)
+			}
+
+			updated, err := store.UpdateUser(WithActor(ctx, "root"), User{Username: "bob", PasswordHash: "hash-1", Role: RoleEditor, Disabled: true})
+			if err != nil || !updated.Disabled || updated.Role != RoleEditor || updated.UpdatedBy != "root" || updated.CreatedBy != "admin" ||
+				!updated.CreatedAt.Equal(user.CreatedAt) {
+				t.Errorf("UpdateUser() = %+v, %v", updated, err)
+			}
+			if _, err := store.UpdateUser(ctx, User{Username: "carol"}); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("expected ErrUserNotFound, got %v", err)
+			}
+
+			users, err := store.ListUsers(ctx)
+			if err != nil || len(users) != 2 || users[0].Username != "alice@example.com" || !users[1].Disabled {
+				t.Errorf("ListUsers() = %+v, %v", users, err)
+			}
+
+			if err := store.DeleteUser(ctx, "bob"); err != nil {
+				t.Errorf("DeleteUser() failed: %v", err)
+			}
+			if err := store.DeleteUser(ctx, "bob"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("expected ErrUserNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUser_JSONOmitsPasswordHash(t *testing.T) {
+	data, _ := json.Marshal(User{Username: "bob", PasswordHash: "secret-hash"})
+	if strings.Contains(string(data), "secret-hash") {
+		t.Errorf("expected the password hash to be left out, got %s", data)
+	}
+	data, _ = json.Marshal(newStoredUser(User{Username: "bob", PasswordHash: "secret-hash"}))
+	var stored storedUser
+	if err := json.Unmarshal(data, &stored); err != nil || stored.user().PasswordHash != "secret-hash" {
+		t.Errorf("expected the stored form to keep the hash, got %s", data)
+	}
+}
+
+// TestStoreUsers_Reopen checks that durable backends keep users and their
+// password hashes across restarts
+func TestStoreUsers_Reopen(t *testing.T) {
+	ctx := context.Background()
+	check := func(t *testing.T, store Store) {
+		t.Helper()
+		users, err := store.ListUsers(ctx)
+		if err != nil || len(users) != 2 {
+			t.Errorf("ListUsers() after reopen = %+v, %v", users, err)
+		}
+		if user, err := store.GetUser(ctx, "bob"); err != nil || user.PasswordHash != "hash-1" || !user.Disabled {
+			t.Errorf("GetUser() after reopen = %+v, %v", user, err)
+		}
+	}
+
+	dir := t.TempDir()
+	fileStore := openTestFileStore(t, dir)
+	fileStore.CreateUser(ctx, User{Username: "bob", PasswordHash: "hash-1"})
+	fileStore.Compact()
+	fileStore.CreateUser(ctx, User{Username: "carol", PasswordHash: "hash-2"})
+	fileStore.UpdateUser(ctx, User{Username: "bob", PasswordHash: "hash-1", Disabled: true})
+	fileStore.wal.Close()
+
+	reopenedFile := openTestFileStore(t, dir)
+	defer reopenedFile.Close()
+	check(t, reopenedFile)
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	sqliteStore, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	sqliteStore.CreateUser(ctx, User{Username: "bob", PasswordHash: "hash-1", Disabled: true})
+	sqliteStore.CreateUser(ctx, User{Username: "carol", PasswordHash: "hash-2"})
+	sqliteStore.Close()
+
+	reopenedSQLite, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	defer reopenedSQLite.Close()
+	check(t, reopenedSQLite)
+}
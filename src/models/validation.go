@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrValidation is wrapped by every *ValidationError
+var ErrValidation = errors.New("validation failed")
+
+// FieldError reports why the value given for one field was rejected.
+// Pointer locates the offending value within the document as a JSON
+// Pointer when it lies below the field, as for schema violations.
+type FieldError struct {
+	Field   string `json:"field"`
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rejected field of a write. A write that fails
+// validation changes nothing.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		location := fe.Field
+		if fe.Pointer != "" {
+			location = fe.Pointer
+		}
+		messages[i] = location + ": " + fe.Message
+	}
+	return "invalid document: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error { return ErrValidation }
+
+// editableFields maps the JSON name of every field a partial update may set
+// to the field's index in Document
+var editableFields = func() map[string]int {
+	fields := make(map[string]int)
+	docType := reflect.TypeOf(Document{})
+	for i := 0; i < docType.NumField(); i++ {
+		field := docType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous || name == "" || name == "-" || serverManagedFields[name] {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+// editableFieldNames lists the editable fields for error messages
+func editableFieldNames() string {
+	names := make([]string, 0, len(editableFields))
+	for name := range editableFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyPartialUpdate sets the fields of doc named in updates by their JSON
+// names. Every entry is checked before any is applied: unknown fields,
+// server-managed fields and values of the wrong type are all reported, and
+// doc is left untouched unless there are none.
+func applyPartialUpdate(doc *Document, updates map[string]interface{}) error {
+	return applyFieldChanges(doc, updates, nil)
+}
+
+// applyFieldChanges is applyPartialUpdate for changes that may also remove
+// fields, as patches do. A removed field is reset to its zero value.
+func applyFieldChanges(doc *Document, updates map[string]interface{}, removed []string) error {
+	docValue := reflect.ValueOf(doc).Elem()
+	values := make(map[int]reflect.Value, len(updates)+len(removed))
+	var errs []FieldError
+	check := func(key string) (int, bool) {
+		if serverManagedFields[key] {
+			errs = append(errs, FieldError{Field: key, Message: "is read-only"})
+			return 0, false
+		}
+		index, ok := editableFields[key]
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Message: "unknown field (editable fields are " + editableFieldNames() + ")"})
+		}
+		return index, ok
+	}
+
+	for key, value := range updates {
+		index, ok := check(key)
+		if !ok {
+			continue
+		}
+		decoded, err := decodeFieldValue(value, docValue.Field(index).Type())
+		if err != nil {
+			errs = append(errs, FieldError{Field: key, Message: err.Error()})
+			continue
+		}
+		values[index] = decoded
+	}
+	for _, key := range removed {
+		if index, ok := check(key); ok {
+			values[index] = reflect.Zero(docValue.Field(index).Type())
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return &ValidationError{Errors: errs}
+	}
+
+	for index, value := range values {
+		docValue.Field(index).Set(value)
+	}
+	return nil
+}
+
+// decodeFieldValue converts a value decoded from JSON to a field's type
+// without coercion: a number is not a string and null is not a value
+func decodeFieldValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Value{}, fmt.Errorf("must be %s, not null", jsonTypeName(t))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("must be %s", jsonTypeName(t))
+	}
+	decoded := reflect.New(t)
+	if err := json.Unmarshal(data, decoded.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("must be %s", jsonTypeName(t))
+	}
+	return decoded.Elem(), nil
+}
+
+// jsonTypeName describes the JSON values a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.String {
+			return "an array of strings"
+		}
+		return "an array"
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.String {
+			return "an object with string values"
+		}
+		return "an object"
+	case reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Operations recorded in the write-ahead log
+const (
+	walOpPut              = "put"
+	walOpDelete           = "delete"
+	walOpPutCollection    = "put_collection"
+	walOpDeleteCollection = "delete_collection"
+	walOpPutSchema        = "put_schema"
+	walOpDeleteSchema     = "delete_schema"
+	walOpPutUser          = "put_user"
+	walOpDeleteUser       = "delete_user"
+	walOpPutACL           = "put_acl"
+	walOpPutOwner         = "put_owner"
+	walOpPutSession       = "put_session"
+	walOpRevokeToken      = "revoke_token"
+	walOpExpireSessions   = "expire_sessions"
+	walOpBatch            = "batch"
+)
+
+// walFrameHeaderSize is the length prefix plus the CRC of every frame
+const walFrameHeaderSize = 8
+
+// walMaxFrameSize bounds a single record so a corrupt length prefix
+// cannot trigger a huge allocation during replay
+const walMaxFrameSize = 64 << 20
+
+var (
+	errWALCorrupt   = errors.New("wal frame checksum mismatch")
+	errWALTruncated = errors.New("wal frame truncated")
+)
+
+// walRecord is a single logged mutation. Records carry the full resulting
+// document (and the revision it produced) rather than the requested change;
+// the LSN guarantees each one is applied at most once on replay.
+type walRecord struct {
+	LSN uint64    `json:"lsn"`
+	Op  string    `json:"op"`
+	ID  string    `json:"id"`
+	Doc *Document `json:"doc,omitempty"`
+	Rev *Revision `json:"rev,omitempty"`
+	// Collection is the resulting collection of a put_collection
+	Collection *Collection `json:"collection,omitempty"`
+	// Schema is the resulting registration of a put_schema
+	Schema *Schema `json:"schema,omitempty"`
+	// User is the resulting account of a put_user
+	User *storedUser `json:"user,omitempty"`
+	// Grants is the resulting ACL of a put_acl; empty once the last grant
+	// is revoked
+	Grants []Grant `json:"grants,omitempty"`
+	// Owner is the user a put_owner gives the document to
+	Owner string `json:"owner,omitempty"`
+	// Session is the resulting state of a put_session
+	Session *Session `json:"session,omitempty"`
+	// Time is when the token of a revoke_token expires, or the instant
+	// before which expire_sessions removes what expired
+	Time *time.Time `json:"time,omitempty"`
+	// Batch holds the puts and deletes of a batch, which are logged in a
+	// single frame so that replay applies all of them or none
+	Batch []walRecord `json:"batch,omitempty"`
+}
+
+// journal durably records a mutation before the store applies it
+type journal interface {
+	append(rec *walRecord) error
+}
+
+// encodeWALFrame serialises a record as [len uint32][crc32 uint32][json payload]
+func encodeWALFrame(rec *walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, walFrameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[walFrameHeaderSize:], payload)
+	return frame, nil
+}
+
+// readWALFrame reads the next record and returns the number of bytes consumed.
+// io.EOF is returned only on a clean frame boundary; a partially written
+// frame yields errWALTruncated and a damaged one errWALCorrupt.
+func readWALFrame(r *bufio.Reader) (walRecord, int, error) {
+	var rec walRecord
+
+	header := make([]byte, walFrameHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return rec, 0, io.EOF
+	}
+	if err != nil {
+		return rec, n, errWALTruncated
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > walMaxFrameSize {
+		return rec, n, errWALCorrupt
+	}
+
+	payload := make([]byte, size)
+	m, err := io.ReadFull(r, payload)
+	if err != nil {
+		return rec, n + m, errWALTruncated
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return rec, n + m, errWALCorrupt
+	}
+
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, n + m, fmt.Errorf("%w: %v", errWALCorrupt, err)
+	}
+	if !validWALRecord(rec) {
+		return rec, n + m, fmt.Errorf("%w: invalid record %q", errWALCorrupt, rec.Op)
+	}
+	return rec, n + m, nil
+}
+
+// validWALRecord reports whether rec is an operation this build knows,
+// carrying what the operation needs
+func validWALRecord(rec walRecord) bool {
+	switch rec.Op {
+	case walOpPut:
+		return rec.Doc != nil
+	case walOpPutCollection:
+		return rec.Collection != nil
+	case walOpPutSchema:
+		return rec.Schema != nil
+	case walOpPutUser:
+		return rec.User != nil
+	case walOpPutSession:
+		return rec.Session != nil
+	case walOpRevokeToken, walOpExpireSessions:
+		return rec.Time != nil
+	case walOpPutOwner:
+		return rec.Owner != ""
+	case walOpDelete, walOpDeleteCollection, walOpDeleteSchema, walOpDeleteUser, walOpPutACL:
+		return true
+	case walOpBatch:
+		for _, item := range rec.Batch {
+			if item.Op != walOpPut && item.Op != walOpDelete || !validWALRecord(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+
+	"docstore-api/src/models"
+)
+
+// CollectionService organises documents into nested collections addressed
+// by path, such as "/contracts/2026/q3"
+type CollectionService interface {
+	// CreateCollection creates a collection along with any missing ancestors
+	CreateCollection(ctx context.Context, path string) (models.Collection, error)
+	GetCollection(ctx context.Context, path string) (models.Collection, error)
+	// ListCollections returns the collections directly below path, or every
+	// one below it if recursive is set
+	ListCollections(ctx context.Context, path string, recursive bool) ([]models.Collection, error)
+	// MoveCollection moves or renames a collection and everything below it
+	MoveCollection(ctx context.Context, path, newPath string) (models.Collection, error)
+	// DeleteCollection removes a collection that holds nothing
+	DeleteCollection(ctx context.Context, path string) error
+}
+
+type collectionService struct {
+	store models.Store
+}
+
+func NewCollectionService(store models.Store) CollectionService {
+	return &collectionService{
+		store: store,
+	}
+}
+
+func (s *collectionService) CreateCollection(ctx context.Context, path string) (models.Collection, error) {
+	return s.store.CreateCollection(ctx, path)
+}
+
+func (s *collectionService) GetCollection(ctx context.Context, path string) (models.Collection, error) {
+	return s.store.GetCollection(ctx, path)
+}
+
+func (s *collectionService) ListCollections(ctx context.Context, path string, recursive bool) ([]models.Collection, error) {
+	return s.store.ListCollections(ctx, path, recursive)
+}
+
+func (s *collectionService) MoveCollection(ctx context.Context, path, newPath string) (models.Collection, error) {
+	return s.store.MoveCollection(ctx, path, newPath)
+}
+
+func (s *collectionService) DeleteCollection(ctx context.Context, path string) error {
+	return s.store.DeleteCollection(ctx, path)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"docstore-api/src/models"
+	"errors"
+	"testing"
+)
+
+func TestCollectionService_Collections(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewCollectionService(store)
+	ctx := context.Background()
+
+	created, err := service.CreateCollection(ctx, "/contracts/2026")
+	if err != nil || created.Path != "/contracts/2026" {
+		t.Fatalf("Expected /contracts/2026, got %+v, %v", created, err)
+	}
+	if got, err := service.GetCollection(ctx, "/contracts"); err != nil || got.Path != "/contracts" {
+		t.Errorf("Expected the parent to be created, got %+v, %v", got, err)
+	}
+	children, err := service.ListCollections(ctx, "/contracts", false)
+	if err != nil || len(children) != 1 || children[0].ID != created.ID {
+		t.Errorf("Expected one child, got %+v, %v", children, err)
+	}
+
+	moved, err := service.MoveCollection(ctx, "/contracts/2026", "/archive")
+	if err != nil || moved.Path != "/archive" {
+		t.Errorf("Expected /archive, got %+v, %v", moved, err)
+	}
+	if err := service.DeleteCollection(ctx, "/contracts/2026"); !errors.Is(err, models.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if err := service.DeleteCollection(ctx, "/archive"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestDocumentService_MoveDocument(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+	collection, _ := store.CreateCollection(ctx, "/reports")
+	store.Create(ctx, models.Document{ID: "test-1"})
+
+	doc, err := service.MoveDocument(ctx, "test-1", "/reports")
+	if err != nil || doc.CollectionID != collection.ID {
+		t.Errorf("Expected the document in /reports, got %+v, %v", doc, err)
+	}
+	page, err := service.ListDocuments(ctx, models.ListOptions{Collection: "/reports", Limit: 10})
+	if err != nil || len(page.Documents) != 1 {
+		t.Errorf("Expected one document in /reports, got %+v, %v", page, err)
+	}
+	if _, err := service.MoveDocument(ctx, "missing", "/"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
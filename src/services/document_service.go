@@ -1,48 +1,264 @@
 package services
 
 import (
+	"context"
+	"io"
+
 	"docstore-api/src/models"
 )
 
+// DocumentService manages documents. When ctx carries a viewer (see
+// models.WithViewer), every method is limited to the documents the viewer
+// owns or that are shared with them: documents they cannot see are reported
+// as models.ErrDocumentNotFound, and writes to those shared with them for
+// reading only fail with models.ErrAccessDenied.
 type DocumentService interface {
-	CreateDocument(doc models.Document) error
-	GetDocument(id string) (models.Document, error)
-	ListDocuments() []models.Document
-	DeleteDocument(id string) error
-	UpdateDocument(id string, doc models.Document) error
-	PartialUpdateDocument(id string, updates map[string]interface{}) error
+	// CreateDocument stores doc, generating an ID when doc.ID is empty, and
+	// returns the document as stored
+	CreateDocument(ctx context.Context, doc models.Document) (models.Document, error)
+	GetDocument(ctx context.Context, id string) (models.Document, error)
+	ListDocuments(ctx context.Context, opts models.ListOptions) (models.DocumentPage, error)
+	SearchDocuments(ctx context.Context, query string, limit int) (models.SearchResults, error)
+	DeleteDocument(ctx context.Context, id string, opts ...models.WriteOption) error
+	UpdateDocument(ctx context.Context, id string, doc models.Document, opts ...models.WriteOption) (models.Document, error)
+	PartialUpdateDocument(ctx context.Context, id string, updates map[string]interface{}, opts ...models.WriteOption) (models.Document, error)
+	// AddDocumentTags and RemoveDocumentTags change the tags of a document
+	// and return it
+	AddDocumentTags(ctx context.Context, id string, tags []string, opts ...models.WriteOption) (models.Document, error)
+	RemoveDocumentTags(ctx context.Context, id string, tags []string, opts ...models.WriteOption) (models.Document, error)
+	// PatchDocument applies a JSON Merge Patch or JSON Patch and returns
+	// the patched document
+	PatchDocument(ctx context.Context, id string, patch models.DocumentPatch, opts ...models.WriteOption) (models.Document, error)
+	// MoveDocument puts a document into the collection at path ("/" for
+	// the root) and returns it
+	MoveDocument(ctx context.Context, id, path string, opts ...models.WriteOption) (models.Document, error)
+	// BatchDocuments performs several writes in one go, generating IDs for
+	// creates without one; see models.Store.Batch
+	BatchDocuments(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	// BeginTransaction starts a snapshot-isolated transaction; see
+	// models.Tx
+	BeginTransaction(ctx context.Context) (models.Tx, error)
+	// RunInTransaction runs fn in a new transaction, committing it when fn
+	// succeeds and rolling it back otherwise. Commit conflicts are returned
+	// as models.ErrTxConflict and are not retried.
+	RunInTransaction(ctx context.Context, fn func(tx models.Tx) error) error
+	ListDocumentVersions(ctx context.Context, id string) ([]models.Revision, error)
+	GetDocumentVersion(ctx context.Context, id string, rev int64) (models.Revision, error)
+	RestoreDocumentVersion(ctx context.Context, id string, rev int64, opts ...models.WriteOption) (models.Document, error)
+	// UploadDocumentContent replaces the content of a document and returns
+	// the document with the new content's type, size and checksum
+	UploadDocumentContent(ctx context.Context, id, contentType string, r io.Reader, opts ...models.WriteOption) (models.Document, error)
+	OpenDocumentContent(ctx context.Context, id string) (models.Content, error)
+	// GetDocumentACL returns who a document is shared with
+	GetDocumentACL(ctx context.Context, id string) (models.ACL, error)
+	// GrantDocumentAccess shares a document with a user ("user:<name>") or
+	// group ("group:<name>") at read or write level, and
+	// RevokeDocumentAccess stops sharing it. Only the owner and admins may
+	// change who a document is shared with.
+	GrantDocumentAccess(ctx context.Context, id, principal, level string) (models.ACL, error)
+	RevokeDocumentAccess(ctx context.Context, id, principal string) (models.ACL, error)
+	// SetDocumentOwner gives a document to another user. The owner may hand
+	// it over; admins may also give an owner to documents that have none,
+	// such as those written before authors were recorded.
+	SetDocumentOwner(ctx context.Context, id, owner string) (models.ACL, error)
 }
 
 type documentService struct {
-	store *models.DocumentStore
+	store models.Store
 }
 
-func NewDocumentService(store *models.DocumentStore) DocumentService {
+func NewDocumentService(store models.Store) DocumentService {
 	return &documentService{
 		store: store,
 	}
 }
 
-func (s *documentService) CreateDocument(doc models.Document) error {
-	return s.store.Create(doc)
+// authorize checks that the viewer in ctx, if any, may use document id at
+// level
+func authorize(ctx context.Context, store models.Store, id, level string) error {
+	viewer, ok := models.ViewerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	acl, err := store.GetACL(ctx, id)
+	if err != nil {
+		return err
+	}
+	return viewer.Authorize(acl, level)
+}
+
+func (s *documentService) CreateDocument(ctx context.Context, doc models.Document) (models.Document, error) {
+	if doc.ID == "" {
+		id, err := models.NewDocumentID()
+		if err != nil {
+			return models.Document{}, err
+		}
+		doc.ID = id
+	} else if err := models.ValidateDocumentID(doc.ID); err != nil {
+		return models.Document{}, err
+	}
+
+	if err := s.store.Create(ctx, doc); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.Get(ctx, doc.ID)
+}
+
+func (s *documentService) GetDocument(ctx context.Context, id string) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessRead); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.Get(ctx, id)
+}
+
+func (s *documentService) ListDocuments(ctx context.Context, opts models.ListOptions) (models.DocumentPage, error) {
+	return s.store.List(ctx, opts)
+}
+
+func (s *documentService) SearchDocuments(ctx context.Context, query string, limit int) (models.SearchResults, error) {
+	return s.store.Search(ctx, query, limit)
+}
+
+func (s *documentService) DeleteDocument(ctx context.Context, id string, opts ...models.WriteOption) error {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, id, opts...)
+}
+
+func (s *documentService) UpdateDocument(ctx context.Context, id string, doc models.Document, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.Update(ctx, id, doc, opts...)
+}
+
+func (s *documentService) PartialUpdateDocument(ctx context.Context, id string, updates map[string]interface{}, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.PartialUpdate(ctx, id, updates, opts...)
+}
+
+func (s *documentService) AddDocumentTags(ctx context.Context, id string, tags []string, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.UpdateTags(ctx, id, tags, nil, opts...)
+}
+
+func (s *documentService) RemoveDocumentTags(ctx context.Context, id string, tags []string, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.UpdateTags(ctx, id, nil, tags, opts...)
+}
+
+func (s *documentService) PatchDocument(ctx context.Context, id string, patch models.DocumentPatch, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.Patch(ctx, id, patch, opts...)
+}
+
+func (s *documentService) MoveDocument(ctx context.Context, id, path string, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.MoveDocument(ctx, id, path, opts...)
+}
+
+func (s *documentService) BatchDocuments(ctx context.Context, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	for i := range ops {
+		if ops[i].Op != models.BatchCreate || ops[i].ID != "" {
+			continue
+		}
+		id, err := models.NewDocumentID()
+		if err != nil {
+			return nil, err
+		}
+		ops[i].ID = id
+	}
+	// The store checks the viewer's access to each document as the
+	// operations before it left it, under the lock the batch runs in
+	return s.store.Batch(ctx, ops, atomic)
+}
+
+func (s *documentService) BeginTransaction(ctx context.Context) (models.Tx, error) {
+	return s.store.Begin(ctx)
 }
 
-func (s *documentService) GetDocument(id string) (models.Document, error) {
-	return s.store.Get(id)
+func (s *documentService) RunInTransaction(ctx context.Context, fn func(tx models.Tx) error) error {
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (s *documentService) ListDocuments() []models.Document {
-	return s.store.List()
+func (s *documentService) ListDocumentVersions(ctx context.Context, id string) ([]models.Revision, error) {
+	if err := authorize(ctx, s.store, id, models.AccessRead); err != nil {
+		return nil, err
+	}
+	return s.store.ListRevisions(ctx, id)
 }
 
-func (s *documentService) DeleteDocument(id string) error {
-	return s.store.Delete(id)
+func (s *documentService) GetDocumentVersion(ctx context.Context, id string, rev int64) (models.Revision, error) {
+	if err := authorize(ctx, s.store, id, models.AccessRead); err != nil {
+		return models.Revision{}, err
+	}
+	return s.store.GetRevision(ctx, id, rev)
 }
 
-func (s *documentService) UpdateDocument(id string, doc models.Document) error {
-	return s.store.Update(id, doc)
+func (s *documentService) RestoreDocumentVersion(ctx context.Context, id string, rev int64, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.RestoreRevision(ctx, id, rev, opts...)
 }
 
-func (s *documentService) PartialUpdateDocument(id string, updates map[string]interface{}) error {
-	return s.store.PartialUpdate(id, updates)
+func (s *documentService) UploadDocumentContent(ctx context.Context, id, contentType string, r io.Reader, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, id, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	return s.store.PutContent(ctx, id, contentType, r, opts...)
+}
+
+func (s *documentService) OpenDocumentContent(ctx context.Context, id string) (models.Content, error) {
+	if err := authorize(ctx, s.store, id, models.AccessRead); err != nil {
+		return models.Content{}, err
+	}
+	return s.store.OpenContent(ctx, id)
+}
+
+func (s *documentService) GetDocumentACL(ctx context.Context, id string) (models.ACL, error) {
+	if err := authorize(ctx, s.store, id, models.AccessRead); err != nil {
+		return models.ACL{}, err
+	}
+	return s.store.GetACL(ctx, id)
+}
+
+func (s *documentService) GrantDocumentAccess(ctx context.Context, id, principal, level string) (models.ACL, error) {
+	if err := authorize(ctx, s.store, id, models.AccessOwner); err != nil {
+		return models.ACL{}, err
+	}
+	return s.store.GrantAccess(ctx, id, principal, level)
+}
+
+func (s *documentService) RevokeDocumentAccess(ctx context.Context, id, principal string) (models.ACL, error) {
+	if err := authorize(ctx, s.store, id, models.AccessOwner); err != nil {
+		return models.ACL{}, err
+	}
+	return s.store.RevokeAccess(ctx, id, principal)
+}
+
+func (s *documentService) SetDocumentOwner(ctx context.Context, id, owner string) (models.ACL, error) {
+	if err := authorize(ctx, s.store, id, models.AccessOwner); err != nil {
+		return models.ACL{}, err
+	}
+	return s.store.SetOwner(ctx, id, owner)
 }
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
 	"docstore-api/src/models"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -15,16 +19,43 @@ func TestDocumentService_CreateDocument(t *testing.T) {
 		Description: "Test Description",
 	}
 
-	err := service.CreateDocument(doc)
+	created, err := service.CreateDocument(context.Background(), doc)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
+	if created.ID != doc.ID || created.Version != 1 {
+		t.Errorf("Expected stored document with version 1, got %+v", created)
+	}
 
 	// Test duplicate creation
-	err = service.CreateDocument(doc)
+	_, err = service.CreateDocument(context.Background(), doc)
 	if err == nil {
 		t.Error("Expected error for duplicate document, got nil")
 	}
+
+	// Test invalid client-chosen ID
+	_, err = service.CreateDocument(context.Background(), models.Document{ID: "a/b"})
+	if !errors.Is(err, models.ErrInvalidDocumentID) {
+		t.Errorf("Expected ErrInvalidDocumentID, got %v", err)
+	}
+}
+
+func TestDocumentService_CreateDocumentGeneratesID(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+
+	first, err := service.CreateDocument(context.Background(), models.Document{Name: "First"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	second, _ := service.CreateDocument(context.Background(), models.Document{Name: "Second"})
+
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("Expected distinct generated IDs, got %q and %q", first.ID, second.ID)
+	}
+	if stored, err := service.GetDocument(context.Background(), first.ID); err != nil || stored.Name != "First" {
+		t.Errorf("Expected generated document to be stored, got %+v (%v)", stored, err)
+	}
 }
 
 func TestDocumentService_GetDocument(t *testing.T) {
@@ -38,10 +69,10 @@ func TestDocumentService_GetDocument(t *testing.T) {
 	}
 
 	// Create document first
-	service.CreateDocument(doc)
+	service.CreateDocument(context.Background(), doc)
 
 	// Test getting existing document
-	retrieved, err := service.GetDocument("test-1")
+	retrieved, err := service.GetDocument(context.Background(), "test-1")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -50,7 +81,7 @@ func TestDocumentService_GetDocument(t *testing.T) {
 	}
 
 	// Test getting non-existent document
-	_, err = service.GetDocument("non-existent")
+	_, err = service.GetDocument(context.Background(), "non-existent")
 	if err == nil {
 		t.Error("Expected error for non-existent document, got nil")
 	}
@@ -61,7 +92,8 @@ func TestDocumentService_ListDocuments(t *testing.T) {
 	service := NewDocumentService(store)
 
 	// Test empty list
-	docs := service.ListDocuments()
+	page, _ := service.ListDocuments(context.Background(), models.ListOptions{})
+	docs := page.Documents
 	if len(docs) != 0 {
 		t.Errorf("Expected empty list, got %d documents", len(docs))
 	}
@@ -70,10 +102,11 @@ func TestDocumentService_ListDocuments(t *testing.T) {
 	doc1 := models.Document{ID: "1", Name: "Doc 1", Description: "First doc"}
 	doc2 := models.Document{ID: "2", Name: "Doc 2", Description: "Second doc"}
 
-	service.CreateDocument(doc1)
-	service.CreateDocument(doc2)
+	service.CreateDocument(context.Background(), doc1)
+	service.CreateDocument(context.Background(), doc2)
 
-	docs = service.ListDocuments()
+	page, _ = service.ListDocuments(context.Background(), models.ListOptions{})
+	docs = page.Documents
 	if len(docs) != 2 {
 		t.Errorf("Expected 2 documents, got %d", len(docs))
 	}
@@ -89,7 +122,7 @@ func TestDocumentService_UpdateDocument(t *testing.T) {
 		Name:        "Original Name",
 		Description: "Original Description",
 	}
-	service.CreateDocument(doc)
+	service.CreateDocument(context.Background(), doc)
 
 	// Update document
 	updatedDoc := models.Document{
@@ -98,19 +131,19 @@ func TestDocumentService_UpdateDocument(t *testing.T) {
 		Description: "Updated Description",
 	}
 
-	err := service.UpdateDocument("test-1", updatedDoc)
+	_, err := service.UpdateDocument(context.Background(), "test-1", updatedDoc)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
 	// Verify update
-	retrieved, _ := service.GetDocument("test-1")
+	retrieved, _ := service.GetDocument(context.Background(), "test-1")
 	if retrieved.Name != "Updated Name" || retrieved.Description != "Updated Description" {
 		t.Errorf("Document not updated correctly. Got %+v", retrieved)
 	}
 
 	// Test updating non-existent document
-	err = service.UpdateDocument("non-existent", updatedDoc)
+	_, err = service.UpdateDocument(context.Background(), "non-existent", updatedDoc)
 	if err == nil {
 		t.Error("Expected error for non-existent document, got nil")
 	}
@@ -126,20 +159,20 @@ func TestDocumentService_PartialUpdateDocument(t *testing.T) {
 		Name:        "Original Name",
 		Description: "Original Description",
 	}
-	service.CreateDocument(doc)
+	service.CreateDocument(context.Background(), doc)
 
 	// Partial update - only name
 	updates := map[string]interface{}{
 		"name": "Updated Name Only",
 	}
 
-	err := service.PartialUpdateDocument("test-1", updates)
+	_, err := service.PartialUpdateDocument(context.Background(), "test-1", updates)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
 	// Verify partial update
-	retrieved, _ := service.GetDocument("test-1")
+	retrieved, _ := service.GetDocument(context.Background(), "test-1")
 	if retrieved.Name != "Updated Name Only" {
 		t.Errorf("Name not updated. Got %s, want %s", retrieved.Name, "Updated Name Only")
 	}
@@ -152,13 +185,13 @@ func TestDocumentService_PartialUpdateDocument(t *testing.T) {
 		"description": "Updated Description Only",
 	}
 
-	err = service.PartialUpdateDocument("test-1", updates)
+	_, err = service.PartialUpdateDocument(context.Background(), "test-1", updates)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
 	// Verify description update
-	retrieved, _ = service.GetDocument("test-1")
+	retrieved, _ = service.GetDocument(context.Background(), "test-1")
 	if retrieved.Description != "Updated Description Only" {
 		t.Errorf("Description not updated. Got %s, want %s", retrieved.Description, "Updated Description Only")
 	}
@@ -167,7 +200,7 @@ func TestDocumentService_PartialUpdateDocument(t *testing.T) {
 	}
 
 	// Test partial update on non-existent document
-	err = service.PartialUpdateDocument("non-existent", updates)
+	_, err = service.PartialUpdateDocument(context.Background(), "non-existent", updates)
 	if err == nil {
 		t.Error("Expected error for non-existent document, got nil")
 	}
@@ -184,23 +217,391 @@ func TestDocumentService_DeleteDocument(t *testing.T) {
 	}
 
 	// Create document first
-	service.CreateDocument(doc)
+	service.CreateDocument(context.Background(), doc)
 
 	// Delete document
-	err := service.DeleteDocument("test-1")
+	err := service.DeleteDocument(context.Background(), "test-1")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
 
 	// Verify deletion
-	_, err = service.GetDocument("test-1")
+	_, err = service.GetDocument(context.Background(), "test-1")
 	if err == nil {
 		t.Error("Expected error after deletion, got nil")
 	}
 
 	// Test deleting non-existent document
-	err = service.DeleteDocument("non-existent")
+	err = service.DeleteDocument(context.Background(), "non-existent")
 	if err == nil {
 		t.Error("Expected error for non-existent document, got nil")
 	}
 }
+
+func TestDocumentService_DocumentVersions(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := models.WithActor(context.Background(), "editor")
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Name: "First"})
+	service.UpdateDocument(ctx, "test-1", models.Document{Name: "Second"})
+
+	history, err := service.ListDocumentVersions(ctx, "test-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(history) != 2 || history[1].Author != "editor" {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	rev, err := service.GetDocumentVersion(ctx, "test-1", 1)
+	if err != nil || rev.Document.Name != "First" {
+		t.Errorf("Expected revision 1 named First, got %+v (%v)", rev, err)
+	}
+
+	restored, err := service.RestoreDocumentVersion(ctx, "test-1", 1)
+	if err != nil || restored.Name != "First" {
+		t.Errorf("Expected restored document named First, got %+v (%v)", restored, err)
+	}
+
+	_, err = service.GetDocumentVersion(ctx, "test-1", 5)
+	if err == nil {
+		t.Error("Expected error for non-existent revision, got nil")
+	}
+}
+
+func TestDocumentService_ConditionalWrites(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Name: "First"})
+
+	_, err := service.UpdateDocument(ctx, "test-1", models.Document{Name: "Second"}, models.IfMatch(2))
+	if !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+
+	_, err = service.PartialUpdateDocument(ctx, "test-1", map[string]interface{}{"name": "Second"}, models.IfMatch(1))
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	doc, _ := service.GetDocument(ctx, "test-1")
+	if doc.Version != 2 {
+		t.Errorf("Expected version 2, got %d", doc.Version)
+	}
+
+	err = service.DeleteDocument(ctx, "test-1", models.IfMatch(1))
+	if !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+}
+
+func TestDocumentService_SearchDocuments(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Name: "Getting Started"})
+	service.CreateDocument(ctx, models.Document{ID: "test-2", Name: "API Reference"})
+
+	results, err := service.SearchDocuments(ctx, "started", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results.Total != 1 || results.Results[0].Document.ID != "test-1" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	_, err = service.SearchDocuments(ctx, "", 10)
+	if !errors.Is(err, models.ErrInvalidSearchQuery) {
+		t.Errorf("Expected ErrInvalidSearchQuery, got %v", err)
+	}
+}
+
+func TestDocumentService_DocumentContent(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Name: "Attachment"})
+
+	doc, err := service.UploadDocumentContent(ctx, "test-1", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if doc.ContentSize != 5 || doc.ContentType != "text/plain" {
+		t.Errorf("Unexpected document after upload: %+v", doc)
+	}
+
+	content, err := service.OpenDocumentContent(ctx, "test-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "hello" {
+		t.Errorf("Expected uploaded content, got %q", data)
+	}
+}
+
+func TestDocumentService_PatchDocument(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Name: "First", Description: "Notes"})
+
+	patch, _ := models.ParseJSONPatch([]byte(`[{"op": "test", "path": "/name", "value": "First"}, {"op": "remove", "path": "/description"}]`))
+	doc, err := service.PatchDocument(ctx, "test-1", patch, models.IfMatch(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if doc.Name != "First" || doc.Description != "" || doc.Version != 2 {
+		t.Errorf("Unexpected document after patch: %+v", doc)
+	}
+
+	merge, _ := models.ParseMergePatch([]byte(`{"name": "Second"}`))
+	if _, err := service.PatchDocument(ctx, "test-1", merge, models.IfMatch(1)); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+}
+
+func TestDocumentService_Tags(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+
+	service.CreateDocument(ctx, models.Document{ID: "test-1", Metadata: map[string]string{"project": "apollo"}})
+	service.CreateDocument(ctx, models.Document{ID: "test-2"})
+
+	doc, err := service.AddDocumentTags(ctx, "test-1", []string{"urgent", "draft"})
+	if err != nil || len(doc.Tags) != 2 {
+		t.Fatalf("Expected two tags, got %v, %v", doc.Tags, err)
+	}
+	doc, err = service.RemoveDocumentTags(ctx, "test-1", []string{"draft"}, models.IfMatch(doc.Version))
+	if err != nil || len(doc.Tags) != 1 || doc.Tags[0] != "urgent" {
+		t.Errorf("Expected [urgent], got %v, %v", doc.Tags, err)
+	}
+
+	page, err := service.ListDocuments(ctx, models.ListOptions{Tags: []string{"urgent"}, Metadata: map[string]string{"project": "apollo"}})
+	if err != nil || page.Total != 1 || page.Documents[0].ID != "test-1" {
+		t.Errorf("Expected only test-1, got %+v, %v", page, err)
+	}
+}
+
+func TestDocumentService_BatchDocuments(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+	service.CreateDocument(ctx, models.Document{ID: "test-1"})
+
+	results, err := service.BatchDocuments(ctx, []models.BatchOperation{
+		{Op: models.BatchCreate, Document: models.Document{Name: "Generated"}},
+		{Op: models.BatchDelete, ID: "test-1"},
+	}, true)
+	if err != nil || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("Expected both operations to succeed, got %+v, %v", results, err)
+	}
+	if err := models.ValidateDocumentID(results[0].Document.ID); err != nil {
+		t.Errorf("Expected a generated ID, got %q", results[0].Document.ID)
+	}
+	if _, err := service.GetDocument(ctx, "test-1"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+// viewerContext returns a context acting as username, limited to the
+// documents they may see
+func viewerContext(username string, groups ...string) context.Context {
+	ctx := models.WithActor(context.Background(), username)
+	return models.WithViewer(ctx, models.Viewer{Username: username, Groups: groups})
+}
+
+func TestDocumentService_Sharing(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	alice, bob, carol := viewerContext("alice"), viewerContext("bob"), viewerContext("carol", "finance")
+	service.CreateDocument(alice, models.Document{ID: "report", Name: "Report"})
+	service.CreateDocument(alice, models.Document{ID: "private", Name: "Private"})
+
+	if _, err := service.GetDocument(bob, "report"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound before sharing, got %v", err)
+	}
+	if _, err := service.GrantDocumentAccess(alice, "report", "user:bob", models.AccessRead); err != nil {
+		t.Fatalf("GrantDocumentAccess() failed: %v", err)
+	}
+	if _, err := service.GrantDocumentAccess(alice, "report", "group:finance", models.AccessWrite); err != nil {
+		t.Fatalf("GrantDocumentAccess() failed: %v", err)
+	}
+
+	if _, err := service.GetDocument(bob, "report"); err != nil {
+		t.Errorf("Expected bob to read the shared document, got %v", err)
+	}
+	if _, err := service.ListDocumentVersions(bob, "report"); err != nil {
+		t.Errorf("Expected bob to read the versions, got %v", err)
+	}
+	if _, err := service.UpdateDocument(bob, "report", models.Document{Name: "Mine"}); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied for a read-only share, got %v", err)
+	}
+	if _, err := service.AddDocumentTags(bob, "report", []string{"x"}); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied for a read-only share, got %v", err)
+	}
+	if _, err := service.AddDocumentTags(carol, "report", []string{"q3"}); err != nil {
+		t.Errorf("Expected the finance group to write, got %v", err)
+	}
+	if _, err := service.GrantDocumentAccess(carol, "report", "user:carol", models.AccessWrite); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected only the owner to share, got %v", err)
+	}
+	if err := service.DeleteDocument(bob, "private"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+
+	page, err := service.ListDocuments(bob, models.ListOptions{})
+	if err != nil || page.Total != 1 || page.Documents[0].ID != "report" {
+		t.Errorf("Expected bob to list the shared document alone, got %+v, %v", page, err)
+	}
+	if page, _ := service.ListDocuments(context.Background(), models.ListOptions{}); page.Total != 2 {
+		t.Errorf("Expected every document without a viewer, got %d", page.Total)
+	}
+
+	acl, err := service.RevokeDocumentAccess(alice, "report", "user:bob")
+	if err != nil || len(acl.Grants) != 1 {
+		t.Errorf("RevokeDocumentAccess() = %+v, %v", acl, err)
+	}
+	if _, err := service.GetDocumentACL(bob, "report"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound once revoked, got %v", err)
+	}
+	if _, err := service.RevokeDocumentAccess(context.Background(), "report", "group:finance"); err != nil {
+		t.Errorf("Expected admins to revoke, got %v", err)
+	}
+}
+
+func TestDocumentService_SetDocumentOwner(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	admin := context.Background()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		store.CreateUser(admin, models.User{Username: username})
+	}
+	alice, bob := viewerContext("alice"), viewerContext("bob")
+	service.CreateDocument(alice, models.Document{ID: "report", Name: "Report"})
+	store.Create(admin, models.Document{ID: "legacy", Name: "Legacy"})
+
+	if _, err := service.SetDocumentOwner(bob, "report", "bob"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for a document bob cannot see, got %v", err)
+	}
+	service.GrantDocumentAccess(alice, "report", "user:bob", models.AccessWrite)
+	if _, err := service.SetDocumentOwner(bob, "report", "bob"); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected only the owner to hand the document over, got %v", err)
+	}
+	if acl, err := service.SetDocumentOwner(alice, "report", "bob"); err != nil || acl.Owner != "bob" {
+		t.Errorf("SetDocumentOwner() = %+v, %v", acl, err)
+	}
+	if _, err := service.GrantDocumentAccess(alice, "report", "user:alice", models.AccessRead); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected alice to lose the document once given away, got %v", err)
+	}
+
+	if _, err := service.GetDocument(alice, "legacy"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected documents without an owner to be hidden, got %v", err)
+	}
+	if _, err := service.SetDocumentOwner(admin, "legacy", "alice"); err != nil {
+		t.Errorf("Expected admins to give a document an owner, got %v", err)
+	}
+	if _, err := service.GetDocument(alice, "legacy"); err != nil {
+		t.Errorf("Expected the new owner to read the document, got %v", err)
+	}
+}
+
+func TestDocumentService_BatchDocumentsSharing(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	alice, bob := viewerContext("alice"), viewerContext("bob")
+	service.CreateDocument(alice, models.Document{ID: "shared"})
+	service.CreateDocument(alice, models.Document{ID: "private"})
+	service.GrantDocumentAccess(alice, "shared", "user:bob", models.AccessWrite)
+
+	ops := func() []models.BatchOperation {
+		return []models.BatchOperation{
+			{Op: models.BatchCreate, ID: "new"},
+			{Op: models.BatchUpdate, ID: "new", Document: models.Document{Name: "Renamed"}},
+			{Op: models.BatchUpdate, ID: "shared", Document: models.Document{Name: "Renamed"}},
+			{Op: models.BatchDelete, ID: "private"},
+		}
+	}
+	results, err := service.BatchDocuments(bob, ops(), true)
+	if err != nil || !errors.Is(results[3].Err, models.ErrDocumentNotFound) || !errors.Is(results[0].Err, models.ErrBatchAborted) {
+		t.Fatalf("Expected the atomic batch to abort, got %+v, %v", results, err)
+	}
+	if _, err := store.Get(context.Background(), "new"); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected nothing to be applied, got %v", err)
+	}
+
+	results, err = service.BatchDocuments(bob, ops(), false)
+	if err != nil || results[0].Err != nil || results[1].Err != nil || results[2].Err != nil ||
+		!errors.Is(results[3].Err, models.ErrDocumentNotFound) {
+		t.Fatalf("Expected the allowed operations to apply, got %+v, %v", results, err)
+	}
+	if results[1].Document.Name != "Renamed" || results[2].Document.ID != "shared" {
+		t.Errorf("Expected results in the order of the operations, got %+v", results)
+	}
+	if _, err := store.Get(context.Background(), "private"); err != nil {
+		t.Errorf("Expected the denied delete not to apply, got %v", err)
+	}
+
+	// Creating an existing document does not make it bob's to change
+	results, err = service.BatchDocuments(bob, []models.BatchOperation{
+		{Op: models.BatchCreate, ID: "private"},
+		{Op: models.BatchUpdate, ID: "private", Document: models.Document{Name: "pwned"}},
+	}, false)
+	if err != nil || !errors.Is(results[0].Err, models.ErrDocumentExists) ||
+		!errors.Is(results[1].Err, models.ErrDocumentNotFound) {
+		t.Fatalf("Expected both operations to fail, got %+v, %v", results, err)
+	}
+	if doc, _ := store.Get(context.Background(), "private"); doc.Name == "pwned" || doc.UpdatedBy == "bob" {
+		t.Errorf("Expected the private document to be unchanged, got %+v", doc)
+	}
+}
+
+func TestDocumentService_RunInTransaction(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewDocumentService(store)
+	ctx := context.Background()
+	service.CreateDocument(ctx, models.Document{ID: "from", Name: "10"})
+	service.CreateDocument(ctx, models.Document{ID: "to", Name: "0"})
+
+	err := service.RunInTransaction(ctx, func(tx models.Tx) error {
+		if err := tx.Update(ctx, "from", models.Document{Name: "5"}); err != nil {
+			return err
+		}
+		return tx.Update(ctx, "to", models.Document{Name: "5"})
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction() failed: %v", err)
+	}
+	if doc, _ := service.GetDocument(ctx, "to"); doc.Name != "5" {
+		t.Errorf("Expected the transaction to be committed, got %+v", doc)
+	}
+
+	failure := errors.New("insufficient funds")
+	err = service.RunInTransaction(ctx, func(tx models.Tx) error {
+		tx.Delete(ctx, "from")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	if _, err := service.GetDocument(ctx, "from"); err != nil {
+		t.Errorf("Expected the transaction to be rolled back, got %v", err)
+	}
+
+	tx, err := service.BeginTransaction(ctx)
+	if err != nil {
+		t.Fatalf("BeginTransaction() failed: %v", err)
+	}
+	tx.Update(ctx, "to", models.Document{Name: "6"})
+	service.UpdateDocument(ctx, "to", models.Document{Name: "7"})
+	if err := tx.Commit(ctx); !errors.Is(err, models.ErrTxConflict) {
+		t.Errorf("Expected ErrTxConflict, got %v", err)
+	}
+}
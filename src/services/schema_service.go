@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"docstore-api/src/models"
+)
+
+// SchemaService manages the JSON Schemas that document metadata is
+// validated against, one per document type
+type SchemaService interface {
+	// PutSchema registers schema for docType, replacing any earlier version
+	PutSchema(ctx context.Context, docType string, schema json.RawMessage) (models.Schema, error)
+	GetSchema(ctx context.Context, docType string) (models.Schema, error)
+	ListSchemas(ctx context.Context) ([]models.Schema, error)
+	// DeleteSchema stops validating documents of docType
+	DeleteSchema(ctx context.Context, docType string) error
+}
+
+type schemaService struct {
+	store models.Store
+}
+
+func NewSchemaService(store models.Store) SchemaService {
+	return &schemaService{
+		store: store,
+	}
+}
+
+func (s *schemaService) PutSchema(ctx context.Context, docType string, schema json.RawMessage) (models.Schema, error) {
+	return s.store.PutSchema(ctx, docType, schema)
+}
+
+func (s *schemaService) GetSchema(ctx context.Context, docType string) (models.Schema, error) {
+	return s.store.GetSchema(ctx, docType)
+}
+
+func (s *schemaService) ListSchemas(ctx context.Context) ([]models.Schema, error) {
+	return s.store.ListSchemas(ctx)
+}
+
+func (s *schemaService) DeleteSchema(ctx context.Context, docType string) error {
+	return s.store.DeleteSchema(ctx, docType)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"docstore-api/src/models"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchemaService_Schemas(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewSchemaService(store)
+	ctx := context.Background()
+
+	schema, err := service.PutSchema(ctx, "invoice", json.RawMessage(`{"required": ["number"]}`))
+	if err != nil || schema.Version != 1 {
+		t.Fatalf("Expected version 1, got %+v, %v", schema, err)
+	}
+	if _, err := service.PutSchema(ctx, "invoice", json.RawMessage(`{"required": "number"}`)); !errors.Is(err, models.ErrInvalidSchema) {
+		t.Errorf("Expected ErrInvalidSchema, got %v", err)
+	}
+	if got, err := service.GetSchema(ctx, "invoice"); err != nil || got.Version != 1 {
+		t.Errorf("Expected the first version to remain, got %+v, %v", got, err)
+	}
+	if err := store.Create(ctx, models.Document{ID: "test-1", Type: "invoice"}); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Expected ErrValidation, got %v", err)
+	}
+
+	schemas, err := service.ListSchemas(ctx)
+	if err != nil || len(schemas) != 1 {
+		t.Errorf("Expected one schema, got %+v, %v", schemas, err)
+	}
+	if err := service.DeleteSchema(ctx, "invoice"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := service.GetSchema(ctx, "invoice"); !errors.Is(err, models.ErrSchemaNotFound) {
+		t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"docstore-api/src/models"
+)
+
+// SessionService keeps track of the sessions tokens are issued for and of
+// the tokens revoked before they expire. Signing the tokens is left to the
+// caller; the service only records their IDs.
+type SessionService interface {
+	// StartSession records a login of username whose first refresh token,
+	// tokenID, expires at expiresAt. Sessions that expired are removed
+	// along the way.
+	StartSession(ctx context.Context, id, username, tokenID string, expiresAt time.Time) (models.Session, error)
+	// RotateSession exchanges refresh token tokenID of session id for
+	// nextTokenID. Presenting a refresh token that was already exchanged
+	// revokes the session, since it must have been stolen, and fails with
+	// models.ErrRefreshTokenReused.
+	RotateSession(ctx context.Context, id, tokenID, nextTokenID string, expiresAt time.Time) (models.Session, error)
+	// EndSession revokes session id, and with it every token issued for
+	// it, and lists access token tokenID, which expires at expiresAt, as
+	// revoked
+	EndSession(ctx context.Context, id, tokenID string, expiresAt time.Time) error
+	// IsRevoked reports whether token tokenID was revoked, or session
+	// sessionID, if any, was revoked or is unknown. It is the revocation
+	// list access tokens are checked against.
+	IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
+}
+
+type sessionService struct {
+	store models.Store
+}
+
+// NewSessionService creates the service
+func NewSessionService(store models.Store) SessionService {
+	return &sessionService{store: store}
+}
+
+func (s *sessionService) StartSession(ctx context.Context, id, username, tokenID string, expiresAt time.Time) (models.Session, error) {
+	if _, err := s.store.DeleteExpiredSessions(ctx, time.Now()); err != nil {
+		return models.Session{}, err
+	}
+	return s.store.CreateSession(ctx, models.Session{ID: id, Username: username, RefreshTokenID: tokenID, ExpiresAt: expiresAt})
+}
+
+func (s *sessionService) RotateSession(ctx context.Context, id, tokenID, nextTokenID string, expiresAt time.Time) (models.Session, error) {
+	return s.store.RotateSession(ctx, id, tokenID, nextTokenID, expiresAt)
+}
+
+func (s *sessionService) EndSession(ctx context.Context, id, tokenID string, expiresAt time.Time) error {
+	if err := s.store.RevokeToken(ctx, tokenID, expiresAt); err != nil {
+		return err
+	}
+	if id == "" {
+		return nil
+	}
+	return s.store.RevokeSession(ctx, id)
+}
+
+func (s *sessionService) IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	if revoked, err := s.store.IsTokenRevoked(ctx, tokenID); err != nil || revoked {
+		return revoked, err
+	}
+	if sessionID == "" {
+		return false, nil
+	}
+	session, err := s.store.GetSession(ctx, sessionID)
+	if errors.Is(err, models.ErrSessionNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.Revoked, nil
+}
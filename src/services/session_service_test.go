@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"docstore-api/src/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionService_Rotation(t *testing.T) {
+	service := NewSessionService(models.NewDocumentStore())
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	if _, err := service.StartSession(ctx, "s1", "alice", "r1", expires); err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	if revoked, err := service.IsRevoked(ctx, "a1", "s1"); err != nil || revoked {
+		t.Errorf("IsRevoked() for a live session = %v, %v", revoked, err)
+	}
+	if session, err := service.RotateSession(ctx, "s1", "r1", "r2", expires); err != nil || session.RefreshTokenID != "r2" {
+		t.Fatalf("RotateSession() = %+v, %v", session, err)
+	}
+
+	// Replaying the first refresh token kills the whole family
+	if _, err := service.RotateSession(ctx, "s1", "r1", "r3", expires); !errors.Is(err, models.ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := service.RotateSession(ctx, "s1", "r2", "r3", expires); !errors.Is(err, models.ErrSessionRevoked) {
+		t.Errorf("expected the latest token to be revoked too, got %v", err)
+	}
+	if revoked, err := service.IsRevoked(ctx, "a2", "s1"); err != nil || !revoked {
+		t.Errorf("expected access tokens of the session to be revoked, got %v, %v", revoked, err)
+	}
+	if revoked, err := service.IsRevoked(ctx, "a3", "unknown"); err != nil || !revoked {
+		t.Errorf("expected tokens of unknown sessions to be revoked, got %v, %v", revoked, err)
+	}
+}
+
+func TestSessionService_EndSession(t *testing.T) {
+	store := models.NewDocumentStore()
+	service := NewSessionService(store)
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	service.StartSession(ctx, "s1", "alice", "r1", expires)
+	if err := service.EndSession(ctx, "s1", "a1", expires); err != nil {
+		t.Fatalf("EndSession() failed: %v", err)
+	}
+	if revoked, err := service.IsRevoked(ctx, "a1", ""); err != nil || !revoked {
+		t.Errorf("expected the access token to be listed, got %v, %v", revoked, err)
+	}
+	if _, err := service.RotateSession(ctx, "s1", "r1", "r2", expires); !errors.Is(err, models.ErrSessionRevoked) {
+		t.Errorf("expected ErrSessionRevoked, got %v", err)
+	}
+
+	// Starting a session removes those that expired
+	service.StartSession(ctx, "s2", "bob", "r1", time.Now().Add(-time.Minute))
+	service.StartSession(ctx, "s3", "bob", "r1", expires)
+	if _, err := store.GetSession(ctx, "s2"); !errors.Is(err, models.ErrSessionNotFound) {
+		t.Errorf("expected the expired session to be removed, got %v", err)
+	}
+}
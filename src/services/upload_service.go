@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"docstore-api/src/models"
+)
+
+// UploadService assembles document content from resumable chunked uploads.
+// A viewer in ctx (see models.WithViewer) must be allowed to write the
+// document.
+type UploadService interface {
+	// CreateUpload starts an upload session for an existing document
+	CreateUpload(ctx context.Context, documentID string, params models.UploadParams) (models.UploadSession, error)
+	GetUpload(ctx context.Context, documentID, uploadID string) (models.UploadSession, error)
+	// AppendUpload writes a chunk starting at offset and returns the new offset
+	AppendUpload(ctx context.Context, documentID, uploadID string, offset int64, r io.Reader) (models.UploadSession, error)
+	// CompleteUpload verifies the assembled bytes and makes them the
+	// document's content, returning the updated document
+	CompleteUpload(ctx context.Context, documentID, uploadID, sha256 string, opts ...models.WriteOption) (models.Document, error)
+	CancelUpload(ctx context.Context, documentID, uploadID string) error
+}
+
+type uploadService struct {
+	uploads *models.UploadStore
+	store   models.Store
+}
+
+func NewUploadService(uploads *models.UploadStore, store models.Store) UploadService {
+	return &uploadService{
+		uploads: uploads,
+		store:   store,
+	}
+}
+
+func (s *uploadService) CreateUpload(ctx context.Context, documentID string, params models.UploadParams) (models.UploadSession, error) {
+	if err := authorize(ctx, s.store, documentID, models.AccessWrite); err != nil {
+		return models.UploadSession{}, err
+	}
+	if _, err := s.store.Get(ctx, documentID); err != nil {
+		return models.UploadSession{}, err
+	}
+	return s.uploads.Create(ctx, documentID, params)
+}
+
+func (s *uploadService) GetUpload(ctx context.Context, documentID, uploadID string) (models.UploadSession, error) {
+	if err := authorize(ctx, s.store, documentID, models.AccessWrite); err != nil {
+		return models.UploadSession{}, err
+	}
+	return s.uploads.Get(ctx, documentID, uploadID)
+}
+
+func (s *uploadService) AppendUpload(ctx context.Context, documentID, uploadID string, offset int64, r io.Reader) (models.UploadSession, error) {
+	if err := authorize(ctx, s.store, documentID, models.AccessWrite); err != nil {
+		return models.UploadSession{}, err
+	}
+	return s.uploads.Append(ctx, documentID, uploadID, offset, r)
+}
+
+func (s *uploadService) CompleteUpload(ctx context.Context, documentID, uploadID, sha256 string, opts ...models.WriteOption) (models.Document, error) {
+	if err := authorize(ctx, s.store, documentID, models.AccessWrite); err != nil {
+		return models.Document{}, err
+	}
+	var doc models.Document
+	err := s.uploads.Complete(ctx, documentID, uploadID, sha256, func(session models.UploadSession, content io.Reader) error {
+		var err error
+		doc, err = s.store.PutContent(ctx, documentID, session.ContentType, content, opts...)
+		return err
+	})
+	return doc, err
+}
+
+func (s *uploadService) CancelUpload(ctx context.Context, documentID, uploadID string) error {
+	if err := authorize(ctx, s.store, documentID, models.AccessWrite); err != nil {
+		return err
+	}
+	return s.uploads.Cancel(ctx, documentID, uploadID)
+}
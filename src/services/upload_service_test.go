@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"docstore-api/src/models"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestUploadService(t *testing.T) (UploadService, models.Store) {
+	t.Helper()
+	uploads, err := models.NewUploadStore(t.TempDir(), time.Hour, 0)
+	if err != nil {
+		t.Fatalf("NewUploadStore() failed: %v", err)
+	}
+	t.Cleanup(func() { uploads.Close() })
+	store := models.NewDocumentStore()
+	return NewUploadService(uploads, store), store
+}
+
+func TestUploadService_CreateUpload(t *testing.T) {
+	service, store := newTestUploadService(t)
+	ctx := context.Background()
+
+	_, err := service.CreateUpload(ctx, "missing", models.UploadParams{})
+	if !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+
+	store.Create(ctx, models.Document{ID: "test-1"})
+	session, err := service.CreateUpload(ctx, "test-1", models.UploadParams{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, err := service.GetUpload(ctx, "test-1", session.ID); err != nil || got != session {
+		t.Errorf("Expected the created session, got %+v, %v", got, err)
+	}
+
+	if err := service.CancelUpload(ctx, "test-1", session.ID); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := service.GetUpload(ctx, "test-1", session.ID); !errors.Is(err, models.ErrUploadNotFound) {
+		t.Errorf("Expected ErrUploadNotFound, got %v", err)
+	}
+}
+
+func TestUploadService_Sharing(t *testing.T) {
+	service, store := newTestUploadService(t)
+	alice := models.WithActor(context.Background(), "alice")
+	store.Create(alice, models.Document{ID: "test-1"})
+	store.GrantAccess(alice, "test-1", "user:bob", models.AccessRead)
+
+	bob := models.WithViewer(context.Background(), models.Viewer{Username: "bob"})
+	if _, err := service.CreateUpload(bob, "test-1", models.UploadParams{}); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied for a read-only share, got %v", err)
+	}
+	carol := models.WithViewer(context.Background(), models.Viewer{Username: "carol"})
+	if _, err := service.CreateUpload(carol, "test-1", models.UploadParams{}); !errors.Is(err, models.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+
+	session, err := service.CreateUpload(alice, "test-1", models.UploadParams{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.GetUpload(bob, "test-1", session.ID); !errors.Is(err, models.ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+}
+
+func TestUploadService_CompleteUpload(t *testing.T) {
+	service, store := newTestUploadService(t)
+	ctx := context.Background()
+	store.Create(ctx, models.Document{ID: "test-1", Name: "Attachment"})
+
+	session, _ := service.CreateUpload(ctx, "test-1", models.UploadParams{ContentType: "text/plain"})
+	service.AppendUpload(ctx, "test-1", session.ID, 0, strings.NewReader("hello "))
+	if _, err := service.AppendUpload(ctx, "test-1", session.ID, 6, strings.NewReader("world")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// A failed precondition keeps the session for another attempt
+	if _, err := service.CompleteUpload(ctx, "test-1", session.ID, "", models.IfMatch(7)); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed, got %v", err)
+	}
+
+	doc, err := service.CompleteUpload(ctx, "test-1", session.ID, "", models.IfMatch(1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if doc.ContentSize != 11 || doc.ContentType != "text/plain" || doc.Version != 2 {
+		t.Errorf("Unexpected document after upload: %+v", doc)
+	}
+
+	content, err := store.OpenContent(ctx, "test-1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer content.Close()
+	if data, _ := io.ReadAll(content); string(data) != "hello world" {
+		t.Errorf("Expected assembled content, got %q", data)
+	}
+	if _, err := service.GetUpload(ctx, "test-1", session.ID); !errors.Is(err, models.ErrUploadNotFound) {
+		t.Errorf("Expected the session to end, got %v", err)
+	}
+}
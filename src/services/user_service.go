@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"docstore-api/src/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bounds of an acceptable password; bcrypt ignores anything past 72 bytes
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var (
+	// ErrInvalidCredentials is returned by Authenticate for an unknown
+	// user, a wrong password or a disabled account alike
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrInvalidPassword is returned for passwords that are too short or
+	// too long
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrBootstrapAccount is returned when trying to create, change or
+	// delete the account configured through the environment
+	ErrBootstrapAccount = errors.New("the bootstrap admin account is configured through the environment")
+)
+
+// UserChanges lists the fields of a user to change; nil fields are left as
+// they are
+type UserChanges struct {
+	Role     *string
+	Disabled *bool
+	Groups   *[]string
+}
+
+// UserService manages the accounts that can log in. Besides the stored
+// users, the admin configured through the environment can always log in
+// with the admin role, so that there is a way in to create the others.
+type UserService interface {
+	// Authenticate returns the user username if password is theirs and the
+	// account is enabled. It takes as long whether or not the user exists.
+	Authenticate(ctx context.Context, username, password string) (models.User, error)
+	// ActiveUser returns the user username as they are now if they may
+	// still log in, or ErrInvalidCredentials, without checking a password.
+	// Refreshing a session reissues tokens from it.
+	ActiveUser(ctx context.Context, username string) (models.User, error)
+	// CreateUser creates an account with role, or a reader if role is empty
+	CreateUser(ctx context.Context, username, password, role string) (models.User, error)
+	GetUser(ctx context.Context, username string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	// UpdateUser changes the role or groups of an account or disables it,
+	// so that it cannot log in, or re-enables it
+	UpdateUser(ctx context.Context, username string, changes UserChanges) (models.User, error)
+	DeleteUser(ctx context.Context, username string) error
+}
+
+type userService struct {
+	store     models.Store
+	adminUser string
+	// adminHash is the hash of the bootstrap admin's password, and
+	// dummyHash one no password matches, compared against for unknown
+	// users so that they take as long to reject as known ones
+	adminHash []byte
+	dummyHash []byte
+}
+
+// NewUserService creates the service, with adminUser and adminPass as the
+// bootstrap admin account
+func NewUserService(store models.Store, adminUser, adminPass string) (UserService, error) {
+	adminHash, err := bcrypt.GenerateFromPassword([]byte(adminPass), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash admin password: %w", err)
+	}
+	dummy := make([]byte, 32)
+	if _, err := rand.Read(dummy); err != nil {
+		return nil, err
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword(dummy, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &userService{
+		store:     store,
+		adminUser: adminUser,
+		adminHash: adminHash,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// checkPassword enforces the password length bounds
+func checkPassword(password string) error {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return fmt.Errorf("%w: must be %d to %d bytes", ErrInvalidPassword, MinPasswordLength, MaxPasswordLength)
+	}
+	return nil
+}
+
+func (s *userService) Authenticate(ctx context.Context, username, password string) (models.User, error) {
+	var user models.User
+	hash, known := s.dummyHash, false
+	if username == s.adminUser {
+		user, hash, known = models.User{Username: s.adminUser, Role: models.RoleAdmin}, s.adminHash, true
+	} else {
+		stored, err := s.store.GetUser(ctx, username)
+		if err == nil {
+			user, hash, known = stored, []byte(stored.PasswordHash), true
+		} else if !errors.Is(err, models.ErrUserNotFound) {
+			return models.User{}, err
+		}
+	}
+
+	// Every attempt pays for one hash comparison, so response times do not
+	// tell which users exist
+	matches := bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+	if !known || !matches || user.Disabled {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+func (s *userService) ActiveUser(ctx context.Context, username string) (models.User, error) {
+	if username == s.adminUser {
+		return models.User{Username: s.adminUser, Role: models.RoleAdmin}, nil
+	}
+	user, err := s.store.GetUser(ctx, username)
+	if errors.Is(err, models.ErrUserNotFound) || err == nil && user.Disabled {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, err
+}
+
+func (s *userService) CreateUser(ctx context.Context, username, password, role string) (models.User, error) {
+	if username == s.adminUser {
+		return models.User{}, ErrBootstrapAccount
+	}
+	if err := checkPassword(password); err != nil {
+		return models.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+	return s.store.CreateUser(ctx, models.User{Username: username, PasswordHash: string(hash), Role: role})
+}
+
+func (s *userService) GetUser(ctx context.Context, username string) (models.User, error) {
+	return s.store.GetUser(ctx, username)
+}
+
+func (s *userService) ListUsers(ctx context.Context) ([]models.User, error) {
+	return s.store.ListUsers(ctx)
+}
+
+func (s *userService) UpdateUser(ctx context.Context, username string, changes UserChanges) (models.User, error) {
+	if username == s.adminUser {
+		return models.User{}, ErrBootstrapAccount
+	}
+	user, err := s.store.GetUser(ctx, username)
+	if err != nil {
+		return models.User{}, err
+	}
+	if changes.Role != nil {
+		user.Role = *changes.Role
+	}
+	if changes.Disabled != nil {
+		user.Disabled = *changes.Disabled
+	}
+	if changes.Groups != nil {
+		user.Groups = *changes.Groups
+	}
+	return s.store.UpdateUser(ctx, user)
+}
+
+func (s *userService) DeleteUser(ctx context.Context, username string) error {
+	if username == s.adminUser {
+		return ErrBootstrapAccount
+	}
+	return s.store.DeleteUser(ctx, username)
+}
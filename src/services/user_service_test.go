@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"docstore-api/src/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestUserService(t *testing.T) (UserService, models.Store) {
+	t.Helper()
+	store := models.NewDocumentStore()
+	service, err := NewUserService(store, "admin", "bootstrap-secret")
+	if err != nil {
+		t.Fatalf("NewUserService() failed: %v", err)
+	}
+	return service, store
+}
+
+func TestUserService_Authenticate(t *testing.T) {
+	service, store := newTestUserService(t)
+	ctx := context.Background()
+
+	if user, err := service.Authenticate(ctx, "admin", "bootstrap-secret"); err != nil || user.Username != "admin" || user.Role != models.RoleAdmin {
+		t.Errorf("Expected the bootstrap admin to log in, got %+v, %v", user, err)
+	}
+	if _, err := service.CreateUser(ctx, "bob", "correct horse", ""); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	if stored, _ := store.GetUser(ctx, "bob"); !strings.HasPrefix(stored.PasswordHash, "$2") {
+		t.Errorf("Expected a bcrypt hash to be stored, got %q", stored.PasswordHash)
+	}
+	if user, err := service.Authenticate(ctx, "bob", "correct horse"); err != nil || user.Username != "bob" || user.Role != models.RoleReader {
+		t.Errorf("Expected bob to log in, got %+v, %v", user, err)
+	}
+
+	for _, attempt := range []struct{ username, password string }{
+		{"bob", "wrong horse"},
+		{"admin", "correct horse"},
+		{"carol", "correct horse"},
+		{"", ""},
+	} {
+		if _, err := service.Authenticate(ctx, attempt.username, attempt.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", attempt.username, attempt.password, err)
+		}
+	}
+
+	disabled, enabled := true, false
+	if user, err := service.UpdateUser(ctx, "bob", UserChanges{Disabled: &disabled}); err != nil || !user.Disabled {
+		t.Fatalf("UpdateUser() = %+v, %v", user, err)
+	}
+	if _, err := service.Authenticate(ctx, "bob", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a disabled user to be rejected, got %v", err)
+	}
+	service.UpdateUser(ctx, "bob", UserChanges{Disabled: &enabled})
+	if _, err := service.Authenticate(ctx, "bob", "correct horse"); err != nil {
+		t.Errorf("Expected a re-enabled user to log in, got %v", err)
+	}
+}
+
+func TestUserService_ActiveUser(t *testing.T) {
+	service, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	if user, err := service.ActiveUser(ctx, "admin"); err != nil || user.Role != models.RoleAdmin {
+		t.Errorf("Expected the bootstrap admin to be active, got %+v, %v", user, err)
+	}
+	service.CreateUser(ctx, "bob", "correct horse", "")
+	editor, disabled := models.RoleEditor, true
+	service.UpdateUser(ctx, "bob", UserChanges{Role: &editor})
+	if user, err := service.ActiveUser(ctx, "bob"); err != nil || user.Role != models.RoleEditor {
+		t.Errorf("Expected bob's current role, got %+v, %v", user, err)
+	}
+	service.UpdateUser(ctx, "bob", UserChanges{Disabled: &disabled})
+	for _, username := range []string{"bob", "carol"} {
+		if _, err := service.ActiveUser(ctx, username); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("ActiveUser(%q) = %v, want ErrInvalidCredentials", username, err)
+		}
+	}
+}
+
+func TestUserService_ManageUsers(t *testing.T) {
+	service, _ := newTestUserService(t)
+	ctx := context.Background()
+
+	if _, err := service.CreateUser(ctx, "bob", "short", ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if _, err := service.CreateUser(ctx, "bob", strings.Repeat("x", MaxPasswordLength+1), ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("Expected ErrInvalidPassword, got %v", err)
+	}
+	if _, err := service.CreateUser(ctx, "admin", "a new password", ""); !errors.Is(err, ErrBootstrapAccount) {
+		t.Errorf("Expected ErrBootstrapAccount, got %v", err)
+	}
+	if _, err := service.CreateUser(ctx, "carol", "correct horse", "owner"); !errors.Is(err, models.ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+	editor := models.RoleEditor
+	if _, err := service.UpdateUser(ctx, "admin", UserChanges{Role: &editor}); !errors.Is(err, ErrBootstrapAccount) {
+		t.Errorf("Expected ErrBootstrapAccount, got %v", err)
+	}
+	if err := service.DeleteUser(ctx, "admin"); !errors.Is(err, ErrBootstrapAccount) {
+		t.Errorf("Expected ErrBootstrapAccount, got %v", err)
+	}
+
+	service.CreateUser(ctx, "bob", "correct horse", "")
+	if _, err := service.CreateUser(ctx, "bob", "correct horse", ""); !errors.Is(err, models.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+	if user, err := service.UpdateUser(ctx, "bob", UserChanges{Role: &editor}); err != nil || user.Role != models.RoleEditor || user.Disabled {
+		t.Errorf("Expected bob to become an editor, got %+v, %v", user, err)
+	}
+	groups := []string{"finance"}
+	if user, err := service.UpdateUser(ctx, "bob", UserChanges{Groups: &groups}); err != nil || len(user.Groups) != 1 || user.Role != models.RoleEditor {
+		t.Errorf("Expected bob to join finance, got %+v, %v", user, err)
+	}
+	if user, err := service.Authenticate(ctx, "bob", "correct horse"); err != nil || len(user.Groups) != 1 {
+		t.Errorf("Expected bob to log in with their groups, got %+v, %v", user, err)
+	}
+	if users, err := service.ListUsers(ctx); err != nil || len(users) != 1 {
+		t.Errorf("Expected one user, got %+v, %v", users, err)
+	}
+	if err := service.DeleteUser(ctx, "bob"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if _, err := service.GetUser(ctx, "bob"); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := service.UpdateUser(ctx, "bob", UserChanges{Role: &editor}); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}